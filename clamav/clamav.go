@@ -0,0 +1,172 @@
+// Package clamav scans streams with a clamd daemon over its INSTREAM protocol, on a
+// TCP or unix socket.
+package clamav
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Chunks must stay below clamd's StreamMaxLength, whatever it is configured to
+	DefaultChunkSize = 64 * 1024
+	DefaultTimeout   = 5 * time.Minute
+)
+
+// ErrScanFailed is returned when clamd could not scan a stream, e.g. because it
+// exceeds clamd's StreamMaxLength. Scanning the same stream again will fail the same way.
+var ErrScanFailed = errors.New("clamav: scan failed")
+
+// Result is clamd's verdict on a stream
+type Result struct {
+	Infected bool
+	// Name of the matched signature, only set when infected
+	Signature string
+}
+
+type Client struct {
+	Network string
+	Address string
+	Timeout time.Duration
+}
+
+// New returns a client for a clamd address given as tcp://host:port or unix:///path/to/clamd.sock
+func New(address string) (*Client, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clamd address: %w", err)
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid clamd address %q: missing host", address)
+		}
+		return &Client{Network: "tcp", Address: u.Host, Timeout: DefaultTimeout}, nil
+	case "unix":
+		if u.Path == "" {
+			return nil, fmt.Errorf("invalid clamd address %q: missing socket path", address)
+		}
+		return &Client{Network: "unix", Address: u.Path, Timeout: DefaultTimeout}, nil
+	}
+	return nil, fmt.Errorf("invalid clamd address %q: scheme must be tcp or unix", address)
+}
+
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(c.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+// Ping checks clamd is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return err
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamav: unexpected reply to PING: %q", reply)
+	}
+	return nil
+}
+
+// Scan streams r to clamd and returns its verdict
+func (c *Client) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	w := bufio.NewWriterSize(conn, DefaultChunkSize+4)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return Result{}, err
+	}
+	chunk := make([]byte, DefaultChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := io.ReadFull(r, chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			w.Write(size)
+			if _, err := w.Write(chunk[:n]); err != nil {
+				// clamd closes the connection once the stream exceeds its limit, its reply says why
+				return replyAfterWriteError(conn, err)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return Result{}, readErr
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	w.Write(size)
+	if err := w.Flush(); err != nil {
+		return replyAfterWriteError(conn, err)
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return Result{}, err
+	}
+	return parseReply(reply)
+}
+
+func replyAfterWriteError(conn net.Conn, writeErr error) (Result, error) {
+	reply, err := readReply(conn)
+	if err != nil || reply == "" {
+		return Result{}, writeErr
+	}
+	return parseReply(reply)
+}
+
+func readReply(r io.Reader) (string, error) {
+	reply, err := bufio.NewReader(r).ReadBytes(0)
+	if err != nil && !(err == io.EOF && len(reply) > 0) {
+		return "", err
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+// parseReply reads replies such as "stream: OK", "stream: Eicar-Signature FOUND"
+// and "INSTREAM size limit exceeded. ERROR"
+func parseReply(reply string) (Result, error) {
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(reply, " FOUND")
+		if i := strings.Index(signature, ": "); i >= 0 {
+			signature = signature[i+2:]
+		}
+		return Result{Infected: true, Signature: signature}, nil
+	case strings.HasSuffix(reply, " OK"):
+		return Result{}, nil
+	case strings.HasSuffix(reply, " ERROR"):
+		return Result{}, fmt.Errorf("%w: %s", ErrScanFailed, strings.TrimSuffix(reply, " ERROR"))
+	}
+	return Result{}, fmt.Errorf("clamav: unexpected reply %q", reply)
+}
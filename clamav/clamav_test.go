@@ -0,0 +1,114 @@
+package clamav
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd speaks enough of the clamd protocol to answer PING and INSTREAM
+func fakeClamd(t *testing.T, network, address string, streamMaxLength int) {
+	t.Helper()
+	listener, err := net.Listen(network, address)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn, streamMaxLength)
+		}
+	}()
+}
+
+func serveClamd(conn net.Conn, streamMaxLength int) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch command {
+	case "zPING\x00":
+		conn.Write([]byte("PONG\x00"))
+		return
+	case "zINSTREAM\x00":
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+	var stream bytes.Buffer
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, size); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			break
+		}
+		if stream.Len()+int(n) > streamMaxLength {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+		if _, err := io.CopyN(&stream, r, int64(n)); err != nil {
+			return
+		}
+	}
+	if strings.Contains(stream.String(), eicar) {
+		conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		return
+	}
+	conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestScanTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := l.Addr().String()
+	l.Close()
+	fakeClamd(t, "tcp", address, 1<<20)
+	client, err := New("tcp://" + address)
+	require.NoError(t, err)
+
+	require.NoError(t, client.Ping(context.Background()))
+
+	result, err := client.Scan(context.Background(), bytes.NewReader(bytes.Repeat([]byte("clean "), 50000)))
+	require.NoError(t, err)
+	assert.False(t, result.Infected)
+
+	result, err = client.Scan(context.Background(), strings.NewReader("prefix "+eicar))
+	require.NoError(t, err)
+	assert.True(t, result.Infected)
+	assert.Equal(t, "Eicar-Test-Signature", result.Signature)
+}
+
+func TestScanUnixSizeLimit(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "clamd.sock")
+	fakeClamd(t, "unix", socket, 100*1024)
+	client, err := New("unix://" + socket)
+	require.NoError(t, err)
+
+	_, err = client.Scan(context.Background(), bytes.NewReader(make([]byte, 1<<20)))
+	assert.ErrorIs(t, err, ErrScanFailed)
+}
+
+func TestNewRejectsInvalidAddresses(t *testing.T) {
+	for _, address := range []string{"localhost:3310", "http://localhost:3310", "tcp://", "unix://"} {
+		_, err := New(address)
+		assert.Error(t, err, address)
+	}
+}
@@ -0,0 +1,158 @@
+// Package cloudfront signs download URLs and cookies for CloudFront distributions
+// restricted to a trusted key group, in place of S3 presigned URLs.
+package cloudfront
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudfront/sign"
+)
+
+const (
+	PolicyCanned = "canned"
+	PolicyCustom = "custom"
+)
+
+// Distribution serves a consumer's objects, zero when the consumer downloads from S3
+type Distribution struct {
+	// Domain name of the distribution, e.g. d111111abcdef8.cloudfront.net or cdn.example.com
+	Domain string `json:"domain"`
+	// ID of the public key registered in the distribution's trusted key group
+	KeyPairID string `json:"keyPairId"`
+	// PEM encoded RSA private key matching KeyPairID
+	PrivateKeyPath string `json:"privateKeyPath"`
+	// canned (default) or custom, signed cookies always use a custom policy
+	Policy string `json:"policy,omitempty"`
+	// Custom policies only: CIDR range downloads are restricted to
+	AllowedIPRange string `json:"allowedIpRange,omitempty"`
+	// Domain attribute of signed cookies, e.g. .example.com when the API and the
+	// distribution share a parent domain
+	CookieDomain string `json:"cookieDomain,omitempty"`
+
+	key *rsa.PrivateKey
+}
+
+func (d Distribution) Enabled() bool {
+	return d.Domain != ""
+}
+
+// WithKey returns d signing with key, for keys not read from PrivateKeyPath
+func (d Distribution) WithKey(key *rsa.PrivateKey) Distribution {
+	d.key = key
+	return d
+}
+
+func (d Distribution) load() (Distribution, error) {
+	if !d.Enabled() {
+		return d, nil
+	}
+	if d.KeyPairID == "" || d.PrivateKeyPath == "" {
+		return d, fmt.Errorf("keyPairId and privateKeyPath are required")
+	}
+	switch d.Policy {
+	case "", PolicyCanned:
+		if d.AllowedIPRange != "" {
+			return d, fmt.Errorf("allowedIpRange requires the custom policy")
+		}
+	case PolicyCustom:
+		if d.AllowedIPRange != "" {
+			if _, _, err := net.ParseCIDR(d.AllowedIPRange); err != nil {
+				return d, fmt.Errorf("invalid allowedIpRange: %w", err)
+			}
+		}
+	default:
+		return d, fmt.Errorf("unknown policy %q", d.Policy)
+	}
+	key, err := sign.LoadPEMPrivKeyFile(d.PrivateKeyPath)
+	if err != nil {
+		return d, fmt.Errorf("invalid private key: %w", err)
+	}
+	return d.WithKey(key), nil
+}
+
+// URL is the unsigned address of an object key behind the distribution
+func (d Distribution) URL(key string) string {
+	u := url.URL{Scheme: "https", Host: d.Domain, Path: "/" + strings.TrimPrefix(key, "/")}
+	return u.String()
+}
+
+func (d Distribution) policy(resource string, expires time.Time) *sign.Policy {
+	statement := sign.Statement{
+		Resource: resource,
+		Condition: sign.Condition{
+			DateLessThan: sign.NewAWSEpochTime(expires),
+		},
+	}
+	if d.AllowedIPRange != "" {
+		statement.Condition.IPAddress = &sign.IPAddress{SourceIP: d.AllowedIPRange}
+	}
+	return &sign.Policy{Statements: []sign.Statement{statement}}
+}
+
+// SignURL signs the URL of an object key valid until expires
+func (d Distribution) SignURL(key string, expires time.Time) (string, error) {
+	if d.key == nil {
+		return "", fmt.Errorf("cloudfront: no private key loaded for %s", d.Domain)
+	}
+	signer := sign.NewURLSigner(d.KeyPairID, d.key)
+	resource := d.URL(key)
+	if d.Policy == PolicyCustom {
+		return signer.SignWithPolicy(resource, d.policy(resource, expires))
+	}
+	return signer.Sign(resource, expires)
+}
+
+// SignCookies signs cookies granting access to every object under prefix until expires
+func (d Distribution) SignCookies(prefix string, expires time.Time) ([]*http.Cookie, error) {
+	if d.key == nil {
+		return nil, fmt.Errorf("cloudfront: no private key loaded for %s", d.Domain)
+	}
+	prefix = strings.TrimPrefix(prefix, "/")
+	signer := sign.NewCookieSigner(d.KeyPairID, d.key, func(o *sign.CookieOptions) {
+		o.Path = "/" + prefix
+		o.Domain = d.CookieDomain
+		o.Secure = true
+	})
+	return signer.SignWithPolicy(d.policy(d.URL(prefix)+"*", expires))
+}
+
+type Distributions struct {
+	Default   Distribution            `json:"default"`
+	Consumers map[string]Distribution `json:"consumers"`
+}
+
+func (p Distributions) For(consumer string) Distribution {
+	if distribution, ok := p.Consumers[consumer]; ok {
+		return distribution
+	}
+	return p.Default
+}
+
+// LoadDistributions reads per-consumer distributions from a JSON file and their private keys
+func LoadDistributions(path string) (Distributions, error) {
+	var distributions Distributions
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return distributions, err
+	}
+	if err := json.Unmarshal(data, &distributions); err != nil {
+		return distributions, fmt.Errorf("invalid cloudfront distributions: %w", err)
+	}
+	if distributions.Default, err = distributions.Default.load(); err != nil {
+		return distributions, fmt.Errorf("default distribution: %w", err)
+	}
+	for consumer, distribution := range distributions.Consumers {
+		if distributions.Consumers[consumer], err = distribution.load(); err != nil {
+			return distributions, fmt.Errorf("distribution of %s: %w", consumer, err)
+		}
+	}
+	return distributions, nil
+}
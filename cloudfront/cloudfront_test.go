@@ -0,0 +1,135 @@
+package cloudfront
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decode reverses CloudFront's URL-safe base64 variant
+func decode(t *testing.T, s string) []byte {
+	s = strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(s)
+	b, err := base64.StdEncoding.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func verify(t *testing.T, key *rsa.PrivateKey, policy []byte, signature string) {
+	digest := sha1.Sum(policy)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], decode(t, signature)))
+}
+
+func loadTestDistributions(t *testing.T, config string) (Distributions, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "private_key.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	require.NoError(t, os.WriteFile(keyPath, keyPEM, 0o600))
+	configPath := filepath.Join(dir, "cloudfront.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(strings.ReplaceAll(config, "KEY_PATH", keyPath)), 0o600))
+	distributions, err := LoadDistributions(configPath)
+	require.NoError(t, err)
+	return distributions, key
+}
+
+func TestSignURLCannedPolicy(t *testing.T) {
+	distributions, key := loadTestDistributions(t, `{
+		"consumers": {"media": {"domain": "d111111abcdef8.cloudfront.net", "keyPairId": "K2JCJMDEHXQW5F", "privateKeyPath": "KEY_PATH"}}
+	}`)
+	assert.False(t, distributions.For("other").Enabled())
+	distribution := distributions.For("media")
+	expires := time.Unix(1767225600, 0)
+
+	signed, err := distribution.SignURL("consumer/2026/report 1.pdf", expires)
+	require.NoError(t, err)
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "/consumer/2026/report 1.pdf", u.Path)
+	query := u.Query()
+	assert.Equal(t, "1767225600", query.Get("Expires"))
+	assert.Equal(t, "K2JCJMDEHXQW5F", query.Get("Key-Pair-Id"))
+	assert.Empty(t, query.Get("Policy"))
+
+	resource := "https://d111111abcdef8.cloudfront.net/consumer/2026/report%201.pdf"
+	canned := fmt.Sprintf(`{"Statement":[{"Resource":"%s","Condition":{"DateLessThan":{"AWS:EpochTime":1767225600}}}]}`, resource)
+	verify(t, key, []byte(canned), query.Get("Signature"))
+}
+
+func TestSignURLCustomPolicy(t *testing.T) {
+	distributions, key := loadTestDistributions(t, `{
+		"default": {"domain": "cdn.example.com", "keyPairId": "K2JCJMDEHXQW5F", "privateKeyPath": "KEY_PATH",
+			"policy": "custom", "allowedIpRange": "203.0.113.0/24"}
+	}`)
+	expires := time.Unix(1767225600, 0)
+
+	signed, err := distributions.For("any").SignURL("a/b.jpg", expires)
+	require.NoError(t, err)
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	query := u.Query()
+	assert.Empty(t, query.Get("Expires"))
+	policy := decode(t, query.Get("Policy"))
+	assert.JSONEq(t, `{"Statement":[{"Resource":"https://cdn.example.com/a/b.jpg","Condition":{
+		"DateLessThan":{"AWS:EpochTime":1767225600},
+		"IpAddress":{"AWS:SourceIp":"203.0.113.0/24"}}}]}`, string(policy))
+	verify(t, key, policy, query.Get("Signature"))
+}
+
+func TestSignCookiesForDirectory(t *testing.T) {
+	distributions, key := loadTestDistributions(t, `{
+		"default": {"domain": "cdn.example.com", "keyPairId": "K2JCJMDEHXQW5F", "privateKeyPath": "KEY_PATH", "cookieDomain": ".example.com"}
+	}`)
+	expires := time.Unix(1767225600, 0)
+
+	cookies, err := distributions.Default.SignCookies("renditions/3f0c6f8e/", expires)
+	require.NoError(t, err)
+	values := map[string]string{}
+	for _, cookie := range cookies {
+		assert.Equal(t, "/renditions/3f0c6f8e/", cookie.Path)
+		assert.Equal(t, ".example.com", cookie.Domain)
+		assert.True(t, cookie.Secure)
+		values[cookie.Name] = cookie.Value
+	}
+	assert.Equal(t, "K2JCJMDEHXQW5F", values["CloudFront-Key-Pair-Id"])
+	policy := decode(t, values["CloudFront-Policy"])
+	var decoded struct {
+		Statement []struct {
+			Resource string
+		}
+	}
+	require.NoError(t, json.Unmarshal(policy, &decoded))
+	assert.Equal(t, "https://cdn.example.com/renditions/3f0c6f8e/*", decoded.Statement[0].Resource)
+	verify(t, key, policy, values["CloudFront-Signature"])
+}
+
+func TestLoadDistributionsRejectsInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	for name, config := range map[string]string{
+		"missing key":      `{"default": {"domain": "cdn.example.com", "keyPairId": "K1"}}`,
+		"unknown policy":   `{"default": {"domain": "cdn.example.com", "keyPairId": "K1", "privateKeyPath": "k.pem", "policy": "other"}}`,
+		"canned ip range":  `{"default": {"domain": "cdn.example.com", "keyPairId": "K1", "privateKeyPath": "k.pem", "allowedIpRange": "10.0.0.0/8"}}`,
+		"invalid ip range": `{"default": {"domain": "cdn.example.com", "keyPairId": "K1", "privateKeyPath": "k.pem", "policy": "custom", "allowedIpRange": "10.0.0.0"}}`,
+		"missing key file": `{"consumers": {"media": {"domain": "cdn.example.com", "keyPairId": "K1", "privateKeyPath": "/nonexistent.pem"}}}`,
+	} {
+		path := filepath.Join(dir, "cloudfront.json")
+		require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+		_, err := LoadDistributions(path)
+		assert.Error(t, err, name)
+	}
+}
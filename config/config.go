@@ -0,0 +1,318 @@
+// Package config loads the service configuration from an optional YAML or JSON file
+// overlaid with environment variables
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OliPou/s3are/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// Fields tagged env are overridden by that environment variable. Lists are comma
+// separated and durations use time.ParseDuration. Fields tagged secret are redacted from
+// the printed configuration.
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Log        LogConfig        `yaml:"log"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	Health     HealthConfig     `yaml:"health"`
+	Database   DatabaseConfig   `yaml:"database"`
+	S3         S3Config         `yaml:"s3"`
+	Uploads    UploadsConfig    `yaml:"uploads"`
+	Search     SearchConfig     `yaml:"search"`
+	Scan       ScanConfig       `yaml:"scan"`
+	Thumbnails ThumbnailsConfig `yaml:"thumbnails"`
+	CloudFront CloudFrontConfig `yaml:"cloudFront"`
+	RateLimit  RateLimitConfig  `yaml:"rateLimit"`
+}
+
+type ServerConfig struct {
+	Port        int    `yaml:"port" env:"PORT"`
+	RouterGroup string `yaml:"routerGroup" env:"GIN_ROUTER_GROUP_NAME"`
+	// Origins allowed by CORS, every origin when empty
+	AllowedOrigins []string `yaml:"allowedOrigins" env:"ALLOWED_ORIGINS"`
+	// IPs and CIDR ranges of the proxies whose X-Forwarded-For is believed, none when
+	// empty so the client address is the peer's and can't be spoofed
+	TrustedProxies    []string      `yaml:"trustedProxies" env:"TRUSTED_PROXIES"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" env:"READ_HEADER_TIMEOUT"`
+	// In-flight requests get ShutdownTimeout to finish on SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+	// Lets load balancers see the service unready before it stops accepting connections
+	DrainDelay time.Duration `yaml:"drainDelay" env:"SHUTDOWN_DRAIN_DELAY"`
+}
+
+type LogConfig struct {
+	// debug, info, warn or error
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+}
+
+type TracingConfig struct {
+	// otlp, stdout or none, the OTLP collector is set by the standard OTEL_EXPORTER_OTLP_* variables
+	Exporter string `yaml:"exporter" env:"OTEL_TRACES_EXPORTER"`
+}
+
+type MetricsConfig struct {
+	// Admin port serving /metrics, the API port serves them when 0
+	Port int `yaml:"port" env:"METRICS_PORT"`
+}
+
+type HealthConfig struct {
+	Timeout time.Duration `yaml:"timeout" env:"HEALTH_CHECK_TIMEOUT"`
+	// Buckets are checked at most every BucketCheckTTL, Postgres on every probe
+	BucketCheckTTL time.Duration `yaml:"bucketCheckTTL" env:"S3_HEALTH_CHECK_TTL"`
+}
+
+type DatabaseConfig struct {
+	URL string `yaml:"url" env:"DB_URL" secret:"true"`
+	// Applies pending migrations on startup, otherwise they are applied with migrate up
+	AutoMigrate bool `yaml:"autoMigrate" env:"DB_AUTO_MIGRATE"`
+}
+
+type S3Config struct {
+	// Every file goes to Bucket in Region unless RoutingFile routes consumers to their own buckets
+	Region      string `yaml:"region" env:"AWS_REGION"`
+	Bucket      string `yaml:"bucket" env:"S3_BUCKET"`
+	RoutingFile string `yaml:"routingFile" env:"S3_ROUTING_CONFIG_FILE"`
+	// Record S3 version IDs of uploads
+	BucketVersioning bool   `yaml:"bucketVersioning" env:"S3_BUCKET_VERSIONING"`
+	EncryptionFile   string `yaml:"encryptionFile" env:"ENCRYPTION_CONFIG_FILE"`
+	StorageClassFile string `yaml:"storageClassFile" env:"STORAGE_CLASS_CONFIG_FILE"`
+	RetentionFile    string `yaml:"retentionFile" env:"RETENTION_CONFIG_FILE"`
+	// Only runs when the storage class policies transition objects
+	TransitionInterval   time.Duration `yaml:"transitionInterval" env:"STORAGE_TRANSITION_INTERVAL"`
+	RestoreCheckInterval time.Duration `yaml:"restoreCheckInterval" env:"RESTORE_CHECK_INTERVAL"`
+}
+
+type UploadsConfig struct {
+	// keylayout.DefaultTemplate when empty
+	ObjectKeyTemplate     string `yaml:"objectKeyTemplate" env:"OBJECT_KEY_TEMPLATE"`
+	ContentTypeFile       string `yaml:"contentTypeFile" env:"CONTENT_TYPE_CONFIG_FILE"`
+	MetadataStrippingFile string `yaml:"metadataStrippingFile" env:"METADATA_STRIPPING_CONFIG_FILE"`
+	EnvelopeKeyfile       string `yaml:"envelopeKeyfile" env:"ENVELOPE_KEYFILE"`
+}
+
+type SearchConfig struct {
+	LanguageFile       string        `yaml:"languageFile" env:"SEARCH_LANGUAGE_CONFIG_FILE"`
+	ExtractionInterval time.Duration `yaml:"extractionInterval" env:"EXTRACTION_INTERVAL"`
+}
+
+type ScanConfig struct {
+	// Scanning is off when empty
+	ClamdAddress     string        `yaml:"clamdAddress" env:"CLAMD_ADDRESS"`
+	QuarantinePrefix string        `yaml:"quarantinePrefix" env:"QUARANTINE_PREFIX"`
+	Interval         time.Duration `yaml:"interval" env:"SCAN_INTERVAL"`
+}
+
+type ThumbnailsConfig struct {
+	// e.g. small=160x160,large=1024x1024, no thumbnails when empty
+	Sizes    []string      `yaml:"sizes" env:"THUMBNAIL_SIZES"`
+	Interval time.Duration `yaml:"interval" env:"RENDITION_INTERVAL"`
+}
+
+type CloudFrontConfig struct {
+	DistributionsFile string `yaml:"distributionsFile" env:"CLOUDFRONT_CONFIG_FILE"`
+}
+
+type RateLimitConfig struct {
+	RulesFile string `yaml:"rulesFile" env:"RATE_LIMIT_CONFIG_FILE"`
+	// memory limits each replica on its own, postgres shares the buckets across replicas
+	Store string `yaml:"store" env:"RATE_LIMIT_STORE"`
+}
+
+// Default is the configuration used for everything neither the file nor the environment set
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:              8080,
+			ReadHeaderTimeout: 10 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Log:     LogConfig{Level: "info"},
+		Tracing: TracingConfig{Exporter: "none"},
+		Health: HealthConfig{
+			Timeout:        2 * time.Second,
+			BucketCheckTTL: 30 * time.Second,
+		},
+		S3: S3Config{
+			TransitionInterval:   time.Hour,
+			RestoreCheckInterval: 5 * time.Minute,
+		},
+		Search:     SearchConfig{ExtractionInterval: 30 * time.Second},
+		Scan:       ScanConfig{Interval: 30 * time.Second},
+		Thumbnails: ThumbnailsConfig{Interval: 30 * time.Second},
+		RateLimit:  RateLimitConfig{Store: "memory"},
+	}
+}
+
+// Load reads the file at path over the defaults, no file when path is empty, then applies
+// the environment and validates the result
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		// YAML is a superset of JSON, JSON files decode the same way
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil {
+			return cfg, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem(), os.LookupEnv); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// applyEnv overrides the env tagged fields of v found by lookup, reporting every
+// unparsable variable at once
+func applyEnv(v reflect.Value, lookup func(string) (string, bool)) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		tag := v.Type().Field(i).Tag
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, lookup); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		name := tag.Get("env")
+		if name == "" {
+			continue
+		}
+		// Empty variables count as unset, as they did before the config file existed
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once
+func (cfg Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(cfg.Server.Port > 0 && cfg.Server.Port < 65536, "server.port (PORT): %d is not a valid port", cfg.Server.Port)
+	check(cfg.Metrics.Port >= 0 && cfg.Metrics.Port < 65536, "metrics.port (METRICS_PORT): %d is not a valid port", cfg.Metrics.Port)
+	check(cfg.Metrics.Port != cfg.Server.Port, "metrics.port (METRICS_PORT): must differ from server.port")
+	for _, proxy := range cfg.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil, "server.trustedProxies (TRUSTED_PROXIES): %q is not an IP or CIDR range", proxy)
+	}
+	check(cfg.Server.ReadHeaderTimeout > 0, "server.readHeaderTimeout (READ_HEADER_TIMEOUT): must be positive")
+	check(cfg.Server.ShutdownTimeout > 0, "server.shutdownTimeout (SHUTDOWN_TIMEOUT): must be positive")
+	check(cfg.Server.DrainDelay >= 0, "server.drainDelay (SHUTDOWN_DRAIN_DELAY): must not be negative")
+	_, err := logging.ParseLevel(cfg.Log.Level)
+	check(err == nil, "log.level (LOG_LEVEL): %q is not debug, info, warn or error", cfg.Log.Level)
+	switch cfg.Tracing.Exporter {
+	case "", "none", "otlp", "stdout", "console":
+	default:
+		check(false, "tracing.exporter (OTEL_TRACES_EXPORTER): %q is not otlp, stdout or none", cfg.Tracing.Exporter)
+	}
+	check(cfg.Health.Timeout > 0, "health.timeout (HEALTH_CHECK_TIMEOUT): must be positive")
+	check(cfg.Health.BucketCheckTTL >= 0, "health.bucketCheckTTL (S3_HEALTH_CHECK_TTL): must not be negative")
+	check(cfg.Database.URL != "", "database.url (DB_URL): is required")
+	check(cfg.S3.RoutingFile != "" || (cfg.S3.Region != "" && cfg.S3.Bucket != ""),
+		"s3.region (AWS_REGION) and s3.bucket (S3_BUCKET): are required without s3.routingFile (S3_ROUTING_CONFIG_FILE)")
+	check(cfg.S3.TransitionInterval > 0, "s3.transitionInterval (STORAGE_TRANSITION_INTERVAL): must be positive")
+	check(cfg.S3.RestoreCheckInterval > 0, "s3.restoreCheckInterval (RESTORE_CHECK_INTERVAL): must be positive")
+	check(cfg.Search.ExtractionInterval > 0, "search.extractionInterval (EXTRACTION_INTERVAL): must be positive")
+	check(cfg.Scan.Interval > 0, "scan.interval (SCAN_INTERVAL): must be positive")
+	check(cfg.Thumbnails.Interval > 0, "thumbnails.interval (RENDITION_INTERVAL): must be positive")
+	check(cfg.RateLimit.Store == "memory" || cfg.RateLimit.Store == "postgres",
+		"rateLimit.store (RATE_LIMIT_STORE): %q is not memory or postgres", cfg.RateLimit.Store)
+	return errors.Join(errs...)
+}
+
+// Redacted is cfg with its secrets masked, safe to print
+func (cfg Config) Redacted() Config {
+	redactSecrets(reflect.ValueOf(&cfg).Elem())
+	return cfg
+}
+
+func redactSecrets(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			redactSecrets(field)
+			continue
+		}
+		if v.Type().Field(i).Tag.Get("secret") == "true" && field.Kind() == reflect.String && field.String() != "" {
+			field.SetString(redactSecret(field.String()))
+		}
+	}
+}
+
+// redactSecret keeps what a URL points to, masking its password
+func redactSecret(secret string) string {
+	if u, err := url.Parse(secret); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+	}
+	return "REDACTED"
+}
+
+// YAML is the effective configuration with its secrets masked
+func (cfg Config) YAML() (string, error) {
+	data, err := yaml.Marshal(cfg.Redacted())
+	return string(data), err
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadOverlaysEnvironment(t *testing.T) {
+	path := writeConfig(t, "s3are.yaml", `
+server:
+  port: 9000
+  allowedOrigins: [https://app.example.com]
+database:
+  url: postgres://s3are:secret@db:5432/s3are
+s3:
+  region: eu-west-3
+  bucket: uploads
+scan:
+  interval: 1m
+`)
+	t.Setenv("PORT", "9090")
+	t.Setenv("ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("SCAN_INTERVAL", "45s")
+	t.Setenv("S3_BUCKET_VERSIONING", "true")
+	t.Setenv("LOG_LEVEL", "")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 9090, cfg.Server.Port)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.Server.AllowedOrigins)
+	assert.Equal(t, 45*time.Second, cfg.Scan.Interval)
+	assert.True(t, cfg.S3.BucketVersioning)
+	assert.Equal(t, "uploads", cfg.S3.Bucket)
+	// Defaults fill in what neither set, empty variables count as unset
+	assert.Equal(t, "info", cfg.Log.Level)
+	assert.Equal(t, 30*time.Second, cfg.Server.ShutdownTimeout)
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := writeConfig(t, "s3are.json", `{"database": {"url": "postgres://db/s3are"}, "s3": {"routingFile": "routing.json"}}`)
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "routing.json", cfg.S3.RoutingFile)
+
+	path = writeConfig(t, "s3are.json", `{"database": {"uri": "postgres://db/s3are"}}`)
+	_, err = Load(path)
+	assert.ErrorContains(t, err, "field uri not found")
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	t.Setenv("SHUTDOWN_TIMEOUT", "soon")
+	t.Setenv("METRICS_PORT", "metrics")
+	_, err := Load("")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `SHUTDOWN_TIMEOUT: invalid duration "soon"`)
+	assert.Contains(t, err.Error(), `METRICS_PORT: invalid integer "metrics"`)
+
+	t.Setenv("SHUTDOWN_TIMEOUT", "")
+	t.Setenv("METRICS_PORT", "")
+	t.Setenv("RATE_LIMIT_STORE", "redis")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,proxy.internal")
+	_, err = Load("")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database.url (DB_URL): is required")
+	assert.Contains(t, err.Error(), "s3.region (AWS_REGION) and s3.bucket (S3_BUCKET)")
+	assert.Contains(t, err.Error(), `rateLimit.store (RATE_LIMIT_STORE): "redis" is not memory or postgres`)
+	assert.Contains(t, err.Error(), `server.trustedProxies (TRUSTED_PROXIES): "proxy.internal" is not an IP or CIDR range`)
+	assert.NotContains(t, err.Error(), "10.0.0.0/8")
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "postgres://s3are:secret@db:5432/s3are?sslmode=disable"
+	out, err := cfg.YAML()
+	require.NoError(t, err)
+	assert.Contains(t, out, "url: postgres://s3are:xxxxx@db:5432/s3are?sslmode=disable")
+	assert.NotContains(t, out, "secret")
+	assert.Contains(t, out, "shutdownTimeout: 30s")
+
+	cfg.Database.URL = "host=db password=secret"
+	assert.Equal(t, "REDACTED", cfg.Redacted().Database.URL)
+	// The original is left alone
+	assert.Equal(t, "host=db password=secret", cfg.Database.URL)
+}
@@ -0,0 +1,145 @@
+// Package contenttype detects the real type of a file from its first bytes and checks
+// it against what the client declared and what the consumer accepts.
+package contenttype
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// SniffLength is how many leading bytes detection looks at
+const SniffLength = 3072
+
+var (
+	ErrTypeNotAllowed = errors.New("file type not allowed")
+	ErrTypeMismatch   = errors.New("file content does not match its declared type")
+)
+
+// Detection is the type found in a file's content
+type Detection struct {
+	MIME      string
+	Extension string
+	// The content contradicts the declared extension or type
+	Mismatch bool
+}
+
+// Detect sniffs header, the first SniffLength bytes of a file, and compares the result
+// with the declared extension and MIME type. Empty declarations are not checked.
+func Detect(header []byte, declaredExtension string, declaredType string) Detection {
+	detected := mimetype.Detect(header)
+	detection := Detection{
+		MIME:      detected.String(),
+		Extension: detected.Extension(),
+	}
+	// Plain text and unknown binaries are too generic to contradict anything
+	if generic(detected) {
+		return detection
+	}
+	if declaredExtension != "" && !extensionMatches(detected, declaredExtension) {
+		detection.Mismatch = true
+	}
+	if declaredType != "" && !typeMatches(detected, declaredType) {
+		detection.Mismatch = true
+	}
+	return detection
+}
+
+func generic(m *mimetype.MIME) bool {
+	return m.Is("application/octet-stream") || m.Is("text/plain")
+}
+
+// extensionMatches accepts the extension of the detected type or of one of its parents,
+// e.g. ".txt" for a CSV, and aliases known to the system such as ".jpeg"
+func extensionMatches(detected *mimetype.MIME, extension string) bool {
+	extension = "." + strings.ToLower(strings.TrimPrefix(extension, "."))
+	if byExtension := mime.TypeByExtension(extension); byExtension != "" && typeMatches(detected, byExtension) {
+		return true
+	}
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Extension() == extension {
+			return true
+		}
+	}
+	return false
+}
+
+func typeMatches(detected *mimetype.MIME, declaredType string) bool {
+	mediaType, _, err := mime.ParseMediaType(declaredType)
+	if err != nil {
+		return false
+	}
+	for m := detected; m != nil; m = m.Parent() {
+		if m.Is(mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy restricts the types a consumer may store
+type Policy struct {
+	// MIME types such as "application/pdf" or families such as "image/*", any type when empty
+	Allowed []string `json:"allowed,omitempty"`
+	// Refuse files whose content contradicts their declared extension or type
+	RejectMismatch bool `json:"rejectMismatch,omitempty"`
+}
+
+// Restricts reports whether the policy may refuse a file, which takes reading it
+func (p Policy) Restricts() bool {
+	return len(p.Allowed) > 0 || p.RejectMismatch
+}
+
+// Check returns ErrTypeNotAllowed or ErrTypeMismatch when the detection violates the policy
+func (p Policy) Check(detection Detection) error {
+	if p.RejectMismatch && detection.Mismatch {
+		return fmt.Errorf("%w: content is %s", ErrTypeMismatch, detection.MIME)
+	}
+	if len(p.Allowed) == 0 {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(detection.MIME)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrTypeNotAllowed, detection.MIME)
+	}
+	for _, allowed := range p.Allowed {
+		if family, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mediaType, family+"/") {
+				return nil
+			}
+		} else if mimetype.EqualsAny(mediaType, allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrTypeNotAllowed, mediaType)
+}
+
+// Policies holds the default policy and per consumer overrides
+type Policies struct {
+	Default   Policy            `json:"default"`
+	Consumers map[string]Policy `json:"consumers"`
+}
+
+func (p Policies) For(consumer string) Policy {
+	if policy, ok := p.Consumers[consumer]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+func LoadPolicies(path string) (Policies, error) {
+	var policies Policies
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policies, err
+	}
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return policies, fmt.Errorf("invalid content type policies: %w", err)
+	}
+	return policies, nil
+}
@@ -0,0 +1,41 @@
+package contenttype
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var pdfHeader = []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj\n")
+
+func TestDetect(t *testing.T) {
+	detection := Detect(pdfHeader, "pdf", "application/pdf")
+	assert.Equal(t, "application/pdf", detection.MIME)
+	assert.Equal(t, ".pdf", detection.Extension)
+	assert.False(t, detection.Mismatch)
+
+	assert.True(t, Detect(pdfHeader, "jpg", "").Mismatch)
+	assert.True(t, Detect(pdfHeader, "", "image/jpeg").Mismatch)
+
+	// A CSV is also plain text
+	assert.False(t, Detect([]byte("a,b,c\n1,2,3\n4,5,6\n"), "txt", "text/plain").Mismatch)
+	// Generic content cannot contradict a declaration
+	assert.False(t, Detect([]byte("just some notes"), "md", "text/markdown").Mismatch)
+}
+
+func TestPolicyCheck(t *testing.T) {
+	pdf := Detect(pdfHeader, "jpg", "")
+	png := Detect([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), "png", "image/png")
+
+	assert.NoError(t, Policy{}.Check(pdf))
+	assert.ErrorIs(t, Policy{RejectMismatch: true}.Check(pdf), ErrTypeMismatch)
+
+	images := Policy{Allowed: []string{"image/*"}}
+	assert.NoError(t, images.Check(png))
+	assert.ErrorIs(t, images.Check(pdf), ErrTypeNotAllowed)
+	assert.NoError(t, Policy{Allowed: []string{"application/pdf"}}.Check(pdf))
+
+	assert.False(t, Policy{}.Restricts())
+	assert.True(t, images.Restricts())
+	assert.True(t, Policy{RejectMismatch: true}.Restricts())
+}
@@ -0,0 +1,194 @@
+// Package envelope implements client-side envelope encryption: every file gets its own
+// data key, the file is encrypted with AES-256-GCM in fixed size chunks and the data key
+// is stored wrapped by a consumer master key held by a KeyProvider.
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	Algorithm        = "AES-256-GCM-CHUNKED"
+	DefaultChunkSize = 64 * 1024
+	KeySize          = 32
+	NonceSize        = 12
+)
+
+var ErrInvalidCiphertext = errors.New("envelope: invalid or truncated ciphertext")
+
+// KeyProvider wraps and unwraps data keys with a consumer master key
+type KeyProvider interface {
+	// Enabled reports whether the consumer's files must be envelope encrypted
+	Enabled(consumer string) bool
+	WrapKey(consumer string, dataKey []byte) (wrappedKey []byte, keyID string, err error)
+	UnwrapKey(consumer string, keyID string, wrappedKey []byte) ([]byte, error)
+}
+
+// Params are stored alongside an encrypted file and are needed to decrypt it
+type Params struct {
+	KeyID      string
+	WrappedKey []byte
+	Nonce      []byte
+	ChunkSize  int
+}
+
+// NewDataKey generates a fresh data key for one file and wraps it for the consumer
+func NewDataKey(provider KeyProvider, consumer string) ([]byte, Params, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, Params{}, err
+	}
+	nonce := make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, Params{}, err
+	}
+	wrappedKey, keyID, err := provider.WrapKey(consumer, dataKey)
+	if err != nil {
+		return nil, Params{}, fmt.Errorf("wrapping data key: %w", err)
+	}
+	return dataKey, Params{
+		KeyID:      keyID,
+		WrappedKey: wrappedKey,
+		Nonce:      nonce,
+		ChunkSize:  DefaultChunkSize,
+	}, nil
+}
+
+// OpenDataKey recovers the data key of a file
+func OpenDataKey(provider KeyProvider, consumer string, params Params) ([]byte, error) {
+	dataKey, err := provider.UnwrapKey(consumer, params.KeyID, params.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// chunkNonce derives a unique nonce per chunk by mixing the chunk index into the base nonce
+func chunkNonce(base []byte, index uint64) []byte {
+	nonce := make([]byte, NonceSize)
+	copy(nonce, base)
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], index)
+	for i := range counter {
+		nonce[NonceSize-8+i] ^= counter[i]
+	}
+	return nonce
+}
+
+// The final chunk is authenticated as such so that truncation at a chunk boundary is detected
+func chunkAAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func newGCM(key, nonce []byte, chunkSize int) (cipher.AEAD, error) {
+	if len(nonce) != NonceSize {
+		return nil, fmt.Errorf("envelope: nonce must be %d bytes", NonceSize)
+	}
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("envelope: invalid chunk size %d", chunkSize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type chunkReader struct {
+	src      *bufio.Reader
+	aead     cipher.AEAD
+	nonce    []byte
+	readSize int
+	index    uint64
+	seal     bool
+	buf      []byte
+	out      []byte
+	done     bool
+	err      error
+}
+
+// NewEncryptingReader returns a reader producing the chunked ciphertext of r
+func NewEncryptingReader(r io.Reader, key, nonce []byte, chunkSize int) (io.Reader, error) {
+	aead, err := newGCM(key, nonce, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{
+		src:      bufio.NewReader(r),
+		aead:     aead,
+		nonce:    nonce,
+		readSize: chunkSize,
+		seal:     true,
+		buf:      make([]byte, chunkSize),
+	}, nil
+}
+
+// NewDecryptingReader returns a reader producing the plaintext of a chunked ciphertext
+func NewDecryptingReader(r io.Reader, key, nonce []byte, chunkSize int) (io.Reader, error) {
+	aead, err := newGCM(key, nonce, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{
+		src:      bufio.NewReader(r),
+		aead:     aead,
+		nonce:    nonce,
+		readSize: chunkSize + aead.Overhead(),
+		buf:      make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for len(cr.out) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+		if cr.done {
+			return 0, io.EOF
+		}
+		cr.err = cr.nextChunk()
+	}
+	n := copy(p, cr.out)
+	cr.out = cr.out[n:]
+	return n, nil
+}
+
+func (cr *chunkReader) nextChunk() error {
+	n, err := io.ReadFull(cr.src, cr.buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	final := n < cr.readSize
+	if !final {
+		if _, peekErr := cr.src.Peek(1); peekErr == io.EOF {
+			final = true
+		} else if peekErr != nil {
+			return peekErr
+		}
+	}
+	nonce := chunkNonce(cr.nonce, cr.index)
+	if cr.seal {
+		cr.out = cr.aead.Seal(cr.out[:0], nonce, cr.buf[:n], chunkAAD(final))
+	} else {
+		if n < cr.aead.Overhead() {
+			return ErrInvalidCiphertext
+		}
+		cr.out, err = cr.aead.Open(cr.out[:0], nonce, cr.buf[:n], chunkAAD(final))
+		if err != nil {
+			return ErrInvalidCiphertext
+		}
+	}
+	cr.index++
+	cr.done = final
+	return nil
+}
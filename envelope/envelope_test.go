@@ -0,0 +1,110 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKeyfile(t *testing.T) string {
+	t.Helper()
+	oldKey := make([]byte, KeySize)
+	newKey := make([]byte, KeySize)
+	rand.Read(oldKey)
+	rand.Read(newKey)
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keyfile := `{"regulated": {"activeKeyId": "k2", "keys": {"k1": "` +
+		base64.StdEncoding.EncodeToString(oldKey) + `", "k2": "` +
+		base64.StdEncoding.EncodeToString(newKey) + `"}}}`
+	require.NoError(t, os.WriteFile(path, []byte(keyfile), 0600))
+	return path
+}
+
+func encrypt(t *testing.T, plaintext, key, nonce []byte, chunkSize int) []byte {
+	t.Helper()
+	r, err := NewEncryptingReader(bytes.NewReader(plaintext), key, nonce, chunkSize)
+	require.NoError(t, err)
+	ciphertext, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return ciphertext
+}
+
+func decrypt(key, nonce, ciphertext []byte, chunkSize int) ([]byte, error) {
+	r, err := NewDecryptingReader(bytes.NewReader(ciphertext), key, nonce, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestChunkedRoundTrip(t *testing.T) {
+	key := make([]byte, KeySize)
+	nonce := make([]byte, NonceSize)
+	rand.Read(key)
+	rand.Read(nonce)
+
+	// Empty, shorter than a chunk, exactly one chunk, several chunks with a partial tail
+	for _, size := range []int{0, 10, 64, 64 * 3, 64*3 + 17} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+		ciphertext := encrypt(t, plaintext, key, nonce, 64)
+
+		got, err := decrypt(key, nonce, ciphertext, 64)
+		require.NoError(t, err, "size %d", size)
+		assert.Equal(t, plaintext, got, "size %d", size)
+	}
+}
+
+func TestChunkedTamperingDetected(t *testing.T) {
+	key := make([]byte, KeySize)
+	nonce := make([]byte, NonceSize)
+	rand.Read(key)
+	rand.Read(nonce)
+	plaintext := make([]byte, 64*3)
+	rand.Read(plaintext)
+	ciphertext := encrypt(t, plaintext, key, nonce, 64)
+	chunk := 64 + 16
+
+	flipped := bytes.Clone(ciphertext)
+	flipped[5] ^= 1
+	_, err := decrypt(key, nonce, flipped, 64)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	// Dropping the last chunk must not look like a shorter valid file
+	_, err = decrypt(key, nonce, ciphertext[:2*chunk], 64)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+
+	// Nor may chunks be reordered
+	swapped := append(append(bytes.Clone(ciphertext[chunk:2*chunk]), ciphertext[:chunk]...), ciphertext[2*chunk:]...)
+	_, err = decrypt(key, nonce, swapped, 64)
+	assert.ErrorIs(t, err, ErrInvalidCiphertext)
+}
+
+func TestLocalKeyProvider(t *testing.T) {
+	provider, err := LoadLocalKeyProvider(writeKeyfile(t))
+	require.NoError(t, err)
+	assert.True(t, provider.Enabled("regulated"))
+	assert.False(t, provider.Enabled("other"))
+
+	dataKey, params, err := NewDataKey(provider, "regulated")
+	require.NoError(t, err)
+	assert.Equal(t, "k2", params.KeyID)
+	assert.NotContains(t, string(params.WrappedKey), string(dataKey))
+
+	opened, err := OpenDataKey(provider, "regulated", params)
+	require.NoError(t, err)
+	assert.Equal(t, dataKey, opened)
+
+	_, err = provider.UnwrapKey("regulated", "k1", params.WrappedKey)
+	assert.Error(t, err)
+
+	_, _, err = NewDataKey(provider, "other")
+	assert.Error(t, err)
+}
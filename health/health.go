@@ -0,0 +1,129 @@
+// Package health reports whether the service is alive and whether its dependencies are
+// reachable enough for it to take traffic
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OliPou/s3are/internal/common"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// Check reports an error when a dependency cannot be reached
+type Check func(ctx context.Context) error
+
+// DependencyStatus is the outcome of the last check of a dependency
+type DependencyStatus struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+type Report struct {
+	Status       string                      `json:"status"`
+	Ready        bool                        `json:"ready"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+type dependency struct {
+	name  string
+	check Check
+	// Results are reused for ttl, checks of remote services cost a request each probe
+	ttl  time.Duration
+	mu   sync.Mutex
+	last DependencyStatus
+}
+
+// Checker runs the readiness checks of the service's dependencies
+type Checker struct {
+	// Checks taking longer than Timeout fail
+	Timeout      time.Duration
+	dependencies []*dependency
+	draining     atomic.Bool
+	now          func() time.Time
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{Timeout: timeout, now: time.Now}
+}
+
+// Add registers a dependency, its result is cached for ttl, checked on every probe when 0
+func (c *Checker) Add(name string, ttl time.Duration, check Check) {
+	c.dependencies = append(c.dependencies, &dependency{name: name, check: check, ttl: ttl})
+}
+
+// Drain makes the service report not ready from now on, for load balancers to stop
+// routing to it while in-flight requests finish
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+func (c *Checker) status(ctx context.Context, d *dependency) DependencyStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := c.now()
+	if !d.last.CheckedAt.IsZero() && now.Sub(d.last.CheckedAt) < d.ttl {
+		return d.last
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	d.last = DependencyStatus{Status: StatusOK, CheckedAt: now}
+	if err := d.check(ctx); err != nil {
+		d.last.Status = StatusUnavailable
+		d.last.Error = err.Error()
+	}
+	return d.last
+}
+
+// Check runs the checks of every dependency concurrently
+func (c *Checker) Check(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Ready: true, Dependencies: map[string]DependencyStatus{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, d := range c.dependencies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := c.status(ctx, d)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Dependencies[d.name] = status
+			if status.Status != StatusOK {
+				report.Status = StatusUnavailable
+				report.Ready = false
+			}
+		}()
+	}
+	wg.Wait()
+	if c.draining.Load() {
+		report.Status = StatusDraining
+		report.Ready = false
+	}
+	return report
+}
+
+// HandlerReadiness answers 503 until every dependency is reachable, and once draining
+func (c *Checker) HandlerReadiness(ctx *gin.Context) {
+	report := c.Check(ctx)
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	common.RespondWithJSON(ctx, status, report)
+}
+
+// HandlerLiveness answers as long as the process serves requests, dependencies going down
+// must not get it restarted
+func HandlerLiveness(c *gin.Context) {
+	common.RespondWithJSON(c, http.StatusOK, gin.H{"status": StatusOK})
+}
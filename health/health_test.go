@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCachesResults(t *testing.T) {
+	now := time.Unix(1767225600, 0)
+	checker := NewChecker(time.Second)
+	checker.now = func() time.Time { return now }
+	var pings, heads int
+	var headErr error
+	checker.Add("postgres", 0, func(ctx context.Context) error {
+		pings++
+		return nil
+	})
+	checker.Add("s3:uploads", 30*time.Second, func(ctx context.Context) error {
+		heads++
+		return headErr
+	})
+
+	report := checker.Check(context.Background())
+	assert.True(t, report.Ready)
+	assert.Equal(t, DependencyStatus{Status: StatusOK, CheckedAt: now}, report.Dependencies["s3:uploads"])
+
+	headErr = errors.New("NotFound: bucket does not exist")
+	now = now.Add(10 * time.Second)
+	report = checker.Check(context.Background())
+	assert.True(t, report.Ready)
+	assert.Equal(t, 2, pings)
+	assert.Equal(t, 1, heads)
+
+	now = now.Add(30 * time.Second)
+	report = checker.Check(context.Background())
+	assert.False(t, report.Ready)
+	assert.Equal(t, StatusUnavailable, report.Status)
+	assert.Equal(t, "NotFound: bucket does not exist", report.Dependencies["s3:uploads"].Error)
+	assert.Equal(t, StatusOK, report.Dependencies["postgres"].Status)
+}
+
+func TestCheckTimesOut(t *testing.T) {
+	checker := NewChecker(10 * time.Millisecond)
+	checker.Add("postgres", 0, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	report := checker.Check(context.Background())
+	assert.False(t, report.Ready)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Dependencies["postgres"].Error)
+}
+
+func TestHandlerReadiness(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	checker := NewChecker(time.Second)
+	checker.Add("postgres", 0, func(ctx context.Context) error { return nil })
+	router := gin.New()
+	router.GET("/readyz", checker.HandlerReadiness)
+	router.GET("/healthz", HandlerLiveness)
+	probe := func(path string) (int, Report) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var report Report
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, report
+	}
+
+	code, report := probe("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Dependencies["postgres"].Status)
+
+	// Draining keeps the process alive but takes it out of rotation
+	checker.Drain()
+	code, report = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDraining, report.Status)
+	code, report = probe("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Status)
+}
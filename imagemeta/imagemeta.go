@@ -0,0 +1,326 @@
+// Package imagemeta removes privacy sensitive metadata, EXIF with its GPS coordinates,
+// XMP, IPTC and comments, from JPEG and PNG images without re-encoding them.
+package imagemeta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Names of the removed metadata
+const (
+	EXIF    = "EXIF"
+	GPS     = "GPS"
+	XMP     = "XMP"
+	IPTC    = "IPTC"
+	Comment = "Comment"
+	Text    = "Text"
+)
+
+var ErrInvalidImage = errors.New("invalid image")
+
+// Supported reports whether images of this MIME type can be stripped
+func Supported(mimeType string) bool {
+	switch strings.TrimSpace(strings.Split(mimeType, ";")[0]) {
+	case "image/jpeg", "image/png":
+		return true
+	}
+	return false
+}
+
+// Strip copies the image in src to dst without its metadata and returns the names of
+// what was removed, sorted. The EXIF orientation of JPEGs is kept so photos are not
+// displayed rotated.
+func Strip(dst io.Writer, src io.Reader, mimeType string) ([]string, error) {
+	removed := map[string]bool{}
+	var err error
+	switch strings.TrimSpace(strings.Split(mimeType, ";")[0]) {
+	case "image/jpeg":
+		err = stripJPEG(dst, bufio.NewReader(src), removed)
+	case "image/png":
+		err = stripPNG(dst, bufio.NewReader(src), removed)
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %s", ErrInvalidImage, mimeType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(removed))
+	for name := range removed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+var (
+	exifHeader         = []byte("Exif\x00\x00")
+	xmpHeader          = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtensionHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+)
+
+const (
+	markerSOI   = 0xD8
+	markerEOI   = 0xD9
+	markerSOS   = 0xDA
+	markerAPP1  = 0xE1
+	markerAPP13 = 0xED
+	markerCOM   = 0xFE
+)
+
+func stripJPEG(dst io.Writer, src *bufio.Reader, removed map[string]bool) error {
+	var soi [2]byte
+	if _, err := io.ReadFull(src, soi[:]); err != nil || soi != [2]byte{0xFF, markerSOI} {
+		return fmt.Errorf("%w: missing JPEG start of image", ErrInvalidImage)
+	}
+	if _, err := dst.Write(soi[:]); err != nil {
+		return err
+	}
+	for {
+		marker, err := nextMarker(src)
+		if err != nil {
+			return err
+		}
+		// Markers without a payload
+		if marker == markerEOI || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			if _, err := dst.Write([]byte{0xFF, marker}); err != nil {
+				return err
+			}
+			if marker == markerEOI {
+				return nil
+			}
+			continue
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(src, length[:]); err != nil {
+			return fmt.Errorf("%w: truncated JPEG segment", ErrInvalidImage)
+		}
+		size := int(binary.BigEndian.Uint16(length[:]))
+		if size < 2 {
+			return fmt.Errorf("%w: invalid JPEG segment length", ErrInvalidImage)
+		}
+		payload := make([]byte, size-2)
+		if _, err := io.ReadFull(src, payload); err != nil {
+			return fmt.Errorf("%w: truncated JPEG segment", ErrInvalidImage)
+		}
+		switch marker {
+		case markerAPP1:
+			switch {
+			case bytes.HasPrefix(payload, exifHeader):
+				removed[EXIF] = true
+				info := readTIFF(payload[len(exifHeader):])
+				if info.gps {
+					removed[GPS] = true
+				}
+				if info.orientation > 1 {
+					if err := writeSegment(dst, markerAPP1, orientationExif(info.orientation)); err != nil {
+						return err
+					}
+				}
+			case bytes.HasPrefix(payload, xmpHeader), bytes.HasPrefix(payload, xmpExtensionHeader):
+				removed[XMP] = true
+			default:
+				removed["APP1"] = true
+			}
+			continue
+		case markerAPP13:
+			removed[IPTC] = true
+			continue
+		case markerCOM:
+			removed[Comment] = true
+			continue
+		}
+		if err := writeSegment(dst, marker, payload); err != nil {
+			return err
+		}
+		if marker == markerSOS {
+			// Entropy coded data and the remaining segments, metadata never follows
+			_, err := io.Copy(dst, src)
+			return err
+		}
+	}
+}
+
+func nextMarker(src *bufio.Reader) (byte, error) {
+	b, err := src.ReadByte()
+	if err != nil || b != 0xFF {
+		return 0, fmt.Errorf("%w: expected JPEG marker", ErrInvalidImage)
+	}
+	for {
+		// Markers may be preceded by any number of 0xFF fill bytes
+		b, err = src.ReadByte()
+		if err != nil {
+			return 0, fmt.Errorf("%w: truncated JPEG", ErrInvalidImage)
+		}
+		if b != 0xFF {
+			return b, nil
+		}
+	}
+}
+
+func writeSegment(dst io.Writer, marker byte, payload []byte) error {
+	header := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(payload)+2))
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+	_, err := dst.Write(payload)
+	return err
+}
+
+type tiffInfo struct {
+	gps         bool
+	orientation uint16
+}
+
+// readTIFF looks for the GPS pointer and the orientation in the first IFD of EXIF data
+func readTIFF(data []byte) tiffInfo {
+	var info tiffInfo
+	if len(data) < 8 {
+		return info
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return info
+	}
+	offset := int(order.Uint32(data[4:8]))
+	if offset < 8 || offset+2 > len(data) {
+		return info
+	}
+	count := int(order.Uint16(data[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(data) {
+			break
+		}
+		switch order.Uint16(data[entry:]) {
+		case 0x8825:
+			info.gps = true
+		case 0x0112:
+			info.orientation = order.Uint16(data[entry+8:])
+		}
+	}
+	return info
+}
+
+// orientationExif is a minimal EXIF segment holding nothing but the orientation
+func orientationExif(orientation uint16) []byte {
+	payload := append([]byte{}, exifHeader...)
+	payload = append(payload, 'I', 'I', 42, 0, 8, 0, 0, 0)
+	payload = append(payload, 1, 0)
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	payload = append(payload, entry...)
+	return append(payload, 0, 0, 0, 0)
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func stripPNG(dst io.Writer, src *bufio.Reader, removed map[string]bool) error {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(src, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return fmt.Errorf("%w: missing PNG signature", ErrInvalidImage)
+	}
+	if _, err := dst.Write(signature); err != nil {
+		return err
+	}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(src, header[:]); err != nil {
+			return fmt.Errorf("%w: truncated PNG", ErrInvalidImage)
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		chunkType := string(header[4:])
+		var name string
+		switch chunkType {
+		case "eXIf":
+			name = EXIF
+		case "tEXt", "zTXt":
+			name = Text
+		case "iTXt":
+			name = Text
+			keyword, err := src.Peek(int(min(length, 17)))
+			if err != nil {
+				return fmt.Errorf("%w: truncated PNG", ErrInvalidImage)
+			}
+			if string(keyword) == "XML:com.adobe.xmp" {
+				name = XMP
+			}
+		}
+		if name == "" {
+			if _, err := dst.Write(header[:]); err != nil {
+				return err
+			}
+			// Data and CRC
+			if _, err := io.CopyN(dst, src, length+4); err != nil {
+				return fmt.Errorf("%w: truncated PNG", ErrInvalidImage)
+			}
+			if chunkType == "IEND" {
+				return nil
+			}
+			continue
+		}
+		removed[name] = true
+		if chunkType == "eXIf" {
+			data := make([]byte, length)
+			if _, err := io.ReadFull(src, data); err != nil {
+				return fmt.Errorf("%w: truncated PNG", ErrInvalidImage)
+			}
+			if readTIFF(data).gps {
+				removed[GPS] = true
+			}
+			length = 0
+		}
+		if _, err := io.CopyN(io.Discard, src, length+4); err != nil {
+			return fmt.Errorf("%w: truncated PNG", ErrInvalidImage)
+		}
+	}
+}
+
+// Policy opts a consumer into metadata stripping
+type Policy struct {
+	Enabled bool `json:"enabled"`
+	// Keep the untouched upload under a private key, never handed out in download URLs
+	KeepOriginal bool `json:"keepOriginal,omitempty"`
+}
+
+// Policies holds the default policy and per consumer overrides
+type Policies struct {
+	Default   Policy            `json:"default"`
+	Consumers map[string]Policy `json:"consumers"`
+}
+
+func (p Policies) For(consumer string) Policy {
+	if policy, ok := p.Consumers[consumer]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+func LoadPolicies(path string) (Policies, error) {
+	var policies Policies
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policies, err
+	}
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return policies, fmt.Errorf("invalid metadata stripping policies: %w", err)
+	}
+	return policies, nil
+}
@@ -0,0 +1,83 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exifWithGPS is an EXIF segment with an orientation and a GPS IFD pointer
+func exifWithGPS() []byte {
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 2}
+	tiff = append(tiff, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 6, 0, 0)
+	tiff = append(tiff, 0x88, 0x25, 0, 4, 0, 0, 0, 1, 0, 0, 0, 38)
+	tiff = append(tiff, 0, 0, 0, 0)
+	return append(append([]byte{}, exifHeader...), tiff...)
+}
+
+func segment(marker byte, payload []byte) []byte {
+	var buf bytes.Buffer
+	writeSegment(&buf, marker, payload)
+	return buf.Bytes()
+}
+
+func TestStripJPEG(t *testing.T) {
+	var encoded bytes.Buffer
+	require.NoError(t, jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 16, 16)), nil))
+	original := encoded.Bytes()
+	var tagged []byte
+	tagged = append(tagged, original[:2]...)
+	tagged = append(tagged, segment(markerAPP1, exifWithGPS())...)
+	tagged = append(tagged, segment(markerAPP1, append(append([]byte{}, xmpHeader...), "<x:xmpmeta/>"...))...)
+	tagged = append(tagged, segment(markerCOM, []byte("taken at home"))...)
+	tagged = append(tagged, original[2:]...)
+
+	var stripped bytes.Buffer
+	removed, err := Strip(&stripped, bytes.NewReader(tagged), "image/jpeg")
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{Comment, EXIF, GPS, XMP}, removed)
+	assert.NotContains(t, stripped.String(), "taken at home")
+	assert.NotContains(t, stripped.String(), "xmpmeta")
+	// Only the orientation is left of the EXIF data
+	assert.Equal(t, tiffInfo{orientation: 6}, readTIFF(stripped.Bytes()[4+2+len(exifHeader):]))
+	_, err = jpeg.Decode(bytes.NewReader(stripped.Bytes()))
+	assert.NoError(t, err)
+
+	_, err = Strip(&stripped, bytes.NewReader([]byte("not a jpeg")), "image/jpeg")
+	assert.ErrorIs(t, err, ErrInvalidImage)
+}
+
+func chunk(chunkType string, data []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	out = append(out, chunkType...)
+	out = append(out, data...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(append([]byte(chunkType), data...)))
+}
+
+func TestStripPNG(t *testing.T) {
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 16, 16))))
+	original := encoded.Bytes()
+	iend := len(original) - 12
+	var tagged []byte
+	tagged = append(tagged, original[:iend]...)
+	tagged = append(tagged, chunk("tEXt", []byte("Author\x00someone"))...)
+	tagged = append(tagged, chunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"))...)
+	tagged = append(tagged, chunk("eXIf", exifWithGPS()[len(exifHeader):])...)
+	tagged = append(tagged, original[iend:]...)
+
+	var stripped bytes.Buffer
+	removed, err := Strip(&stripped, bytes.NewReader(tagged), "image/png")
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{EXIF, GPS, Text, XMP}, removed)
+	assert.Equal(t, original, stripped.Bytes())
+}
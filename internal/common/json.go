@@ -1,8 +1,7 @@
 package common
 
 import (
-	"log"
-
+	"github.com/OliPou/s3are/logging"
 	"github.com/gin-gonic/gin"
 )
 
@@ -24,7 +23,7 @@ func RespondWithJSON(c *gin.Context, status int, payload interface{}) {
 
 func RespondError(c *gin.Context, status int, message string) {
 	if status > 499 {
-		log.Printf("Responding with 5xx error: %s", message)
+		logging.FromContext(c).Error("responding with 5xx error", "message", message)
 	}
 	RespondWithJSON(c, status, map[string]string{"error": message})
 }
@@ -0,0 +1,217 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: downloadToken.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createDownloadToken = `-- name: CreateDownloadToken :one
+INSERT INTO download_token (
+    id,
+    token_hash,
+    transaction_uuid,
+    consumer,
+    user_name,
+    expires_at,
+    created_at
+) VALUES ($1, $2, $3, $4, $5, $6, NOW())
+RETURNING id, token_hash, transaction_uuid, consumer, user_name, expires_at, last_used_at, revoked_at, created_at
+`
+
+type CreateDownloadTokenParams struct {
+	ID              uuid.UUID
+	TokenHash       string
+	TransactionUuid uuid.UUID
+	Consumer        string
+	UserName        string
+	ExpiresAt       time.Time
+}
+
+func (q *Queries) CreateDownloadToken(ctx context.Context, arg CreateDownloadTokenParams) (DownloadToken, error) {
+	row := q.db.QueryRowContext(ctx, createDownloadToken,
+		arg.ID,
+		arg.TokenHash,
+		arg.TransactionUuid,
+		arg.Consumer,
+		arg.UserName,
+		arg.ExpiresAt,
+	)
+	var i DownloadToken
+	err := row.Scan(
+		&i.ID,
+		&i.TokenHash,
+		&i.TransactionUuid,
+		&i.Consumer,
+		&i.UserName,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getDownloadTokenByTokenHash = `-- name: GetDownloadTokenByTokenHash :one
+SELECT download_token.id, download_token.token_hash, download_token.transaction_uuid, download_token.consumer, download_token.user_name, download_token.expires_at, download_token.last_used_at, download_token.revoked_at, download_token.created_at, uploaded_file.transaction_uuid, uploaded_file.consumer, uploaded_file.user_name, uploaded_file.file_name, uploaded_file.file_size, uploaded_file.file_type, uploaded_file.upload_presigned_url, uploaded_file.status, uploaded_file.created_at, uploaded_file.updated_at, uploaded_file.upload_expiration_time, uploaded_file.sha256, uploaded_file.sse_mode, uploaded_file.sse_kms_key_id, uploaded_file.sse_customer_key_md5, uploaded_file.envelope_algorithm, uploaded_file.envelope_key_id, uploaded_file.envelope_wrapped_key, uploaded_file.envelope_nonce, uploaded_file.envelope_chunk_size, uploaded_file.metadata, uploaded_file.tags, uploaded_file.object_key, uploaded_file.bucket, uploaded_file.region, uploaded_file.storage_class, uploaded_file.storage_class_updated_at, uploaded_file.last_downloaded_at, uploaded_file.restore_status, uploaded_file.restore_tier, uploaded_file.restore_requested_at, uploaded_file.restore_expires_at, uploaded_file.retention_mode, uploaded_file.retain_until, uploaded_file.legal_hold, uploaded_file.logical_file_id, uploaded_file.version, uploaded_file.s3_version_id, uploaded_file.scan_status, uploaded_file.scan_signature, uploaded_file.scanned_at, uploaded_file.detected_type, uploaded_file.type_mismatch, uploaded_file.rendition_status, uploaded_file.stripped_metadata, uploaded_file.sanitized_at, uploaded_file.original_object_key, uploaded_file.extraction_status, uploaded_file.scan_attempts, uploaded_file.scan_attempted_at, uploaded_file.rendition_attempts, uploaded_file.rendition_attempted_at, uploaded_file.extraction_attempts, uploaded_file.extraction_attempted_at
+FROM download_token
+JOIN uploaded_file ON uploaded_file.transaction_uuid = download_token.transaction_uuid
+WHERE download_token.token_hash = $1
+`
+
+type GetDownloadTokenByTokenHashRow struct {
+	DownloadToken DownloadToken
+	UploadedFile  UploadedFile
+}
+
+func (q *Queries) GetDownloadTokenByTokenHash(ctx context.Context, tokenHash string) (GetDownloadTokenByTokenHashRow, error) {
+	row := q.db.QueryRowContext(ctx, getDownloadTokenByTokenHash, tokenHash)
+	var i GetDownloadTokenByTokenHashRow
+	err := row.Scan(
+		&i.DownloadToken.ID,
+		&i.DownloadToken.TokenHash,
+		&i.DownloadToken.TransactionUuid,
+		&i.DownloadToken.Consumer,
+		&i.DownloadToken.UserName,
+		&i.DownloadToken.ExpiresAt,
+		&i.DownloadToken.LastUsedAt,
+		&i.DownloadToken.RevokedAt,
+		&i.DownloadToken.CreatedAt,
+		&i.UploadedFile.TransactionUuid,
+		&i.UploadedFile.Consumer,
+		&i.UploadedFile.UserName,
+		&i.UploadedFile.FileName,
+		&i.UploadedFile.FileSize,
+		&i.UploadedFile.FileType,
+		&i.UploadedFile.UploadPresignedUrl,
+		&i.UploadedFile.Status,
+		&i.UploadedFile.CreatedAt,
+		&i.UploadedFile.UpdatedAt,
+		&i.UploadedFile.UploadExpirationTime,
+		&i.UploadedFile.Sha256,
+		&i.UploadedFile.SseMode,
+		&i.UploadedFile.SseKmsKeyID,
+		&i.UploadedFile.SseCustomerKeyMd5,
+		&i.UploadedFile.EnvelopeAlgorithm,
+		&i.UploadedFile.EnvelopeKeyID,
+		&i.UploadedFile.EnvelopeWrappedKey,
+		&i.UploadedFile.EnvelopeNonce,
+		&i.UploadedFile.EnvelopeChunkSize,
+		&i.UploadedFile.Metadata,
+		&i.UploadedFile.Tags,
+		&i.UploadedFile.ObjectKey,
+		&i.UploadedFile.Bucket,
+		&i.UploadedFile.Region,
+		&i.UploadedFile.StorageClass,
+		&i.UploadedFile.StorageClassUpdatedAt,
+		&i.UploadedFile.LastDownloadedAt,
+		&i.UploadedFile.RestoreStatus,
+		&i.UploadedFile.RestoreTier,
+		&i.UploadedFile.RestoreRequestedAt,
+		&i.UploadedFile.RestoreExpiresAt,
+		&i.UploadedFile.RetentionMode,
+		&i.UploadedFile.RetainUntil,
+		&i.UploadedFile.LegalHold,
+		&i.UploadedFile.LogicalFileID,
+		&i.UploadedFile.Version,
+		&i.UploadedFile.S3VersionID,
+		&i.UploadedFile.ScanStatus,
+		&i.UploadedFile.ScanSignature,
+		&i.UploadedFile.ScannedAt,
+		&i.UploadedFile.DetectedType,
+		&i.UploadedFile.TypeMismatch,
+		&i.UploadedFile.RenditionStatus,
+		pq.Array(&i.UploadedFile.StrippedMetadata),
+		&i.UploadedFile.SanitizedAt,
+		&i.UploadedFile.OriginalObjectKey,
+		&i.UploadedFile.ExtractionStatus,
+		&i.UploadedFile.ScanAttempts,
+		&i.UploadedFile.ScanAttemptedAt,
+		&i.UploadedFile.RenditionAttempts,
+		&i.UploadedFile.RenditionAttemptedAt,
+		&i.UploadedFile.ExtractionAttempts,
+		&i.UploadedFile.ExtractionAttemptedAt,
+	)
+	return i, err
+}
+
+const revokeDownloadToken = `-- name: RevokeDownloadToken :one
+UPDATE download_token
+SET revoked_at = COALESCE(revoked_at, NOW())
+WHERE id = $1 AND consumer = $2 AND user_name = $3
+RETURNING id, token_hash, transaction_uuid, consumer, user_name, expires_at, last_used_at, revoked_at, created_at
+`
+
+type RevokeDownloadTokenParams struct {
+	ID       uuid.UUID
+	Consumer string
+	UserName string
+}
+
+func (q *Queries) RevokeDownloadToken(ctx context.Context, arg RevokeDownloadTokenParams) (DownloadToken, error) {
+	row := q.db.QueryRowContext(ctx, revokeDownloadToken, arg.ID, arg.Consumer, arg.UserName)
+	var i DownloadToken
+	err := row.Scan(
+		&i.ID,
+		&i.TokenHash,
+		&i.TransactionUuid,
+		&i.Consumer,
+		&i.UserName,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const revokeFileDownloadTokens = `-- name: RevokeFileDownloadTokens :execrows
+UPDATE download_token
+SET revoked_at = NOW()
+WHERE transaction_uuid = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeFileDownloadTokens(ctx context.Context, transactionUuid uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeFileDownloadTokens, transactionUuid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeUserDownloadTokens = `-- name: RevokeUserDownloadTokens :execrows
+UPDATE download_token
+SET revoked_at = NOW()
+WHERE consumer = $1 AND user_name = $2 AND revoked_at IS NULL
+`
+
+type RevokeUserDownloadTokensParams struct {
+	Consumer string
+	UserName string
+}
+
+func (q *Queries) RevokeUserDownloadTokens(ctx context.Context, arg RevokeUserDownloadTokensParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeUserDownloadTokens, arg.Consumer, arg.UserName)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const touchDownloadToken = `-- name: TouchDownloadToken :exec
+UPDATE download_token
+SET last_used_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) TouchDownloadToken(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, touchDownloadToken, id)
+	return err
+}
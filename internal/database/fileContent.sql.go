@@ -0,0 +1,160 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: fileContent.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const searchUploadedFiles = `-- name: SearchUploadedFiles :many
+SELECT uploaded_file.transaction_uuid, uploaded_file.consumer, uploaded_file.user_name, uploaded_file.file_name, uploaded_file.file_size, uploaded_file.file_type, uploaded_file.upload_presigned_url, uploaded_file.status, uploaded_file.created_at, uploaded_file.updated_at, uploaded_file.upload_expiration_time, uploaded_file.sha256, uploaded_file.sse_mode, uploaded_file.sse_kms_key_id, uploaded_file.sse_customer_key_md5, uploaded_file.envelope_algorithm, uploaded_file.envelope_key_id, uploaded_file.envelope_wrapped_key, uploaded_file.envelope_nonce, uploaded_file.envelope_chunk_size, uploaded_file.metadata, uploaded_file.tags, uploaded_file.object_key, uploaded_file.bucket, uploaded_file.region, uploaded_file.storage_class, uploaded_file.storage_class_updated_at, uploaded_file.last_downloaded_at, uploaded_file.restore_status, uploaded_file.restore_tier, uploaded_file.restore_requested_at, uploaded_file.restore_expires_at, uploaded_file.retention_mode, uploaded_file.retain_until, uploaded_file.legal_hold, uploaded_file.logical_file_id, uploaded_file.version, uploaded_file.s3_version_id, uploaded_file.scan_status, uploaded_file.scan_signature, uploaded_file.scanned_at, uploaded_file.detected_type, uploaded_file.type_mismatch, uploaded_file.rendition_status, uploaded_file.stripped_metadata, uploaded_file.sanitized_at, uploaded_file.original_object_key, uploaded_file.extraction_status, uploaded_file.scan_attempts, uploaded_file.scan_attempted_at, uploaded_file.rendition_attempts, uploaded_file.rendition_attempted_at, uploaded_file.extraction_attempts, uploaded_file.extraction_attempted_at,
+    ts_rank(file_content.content_tsv, query)::REAL AS rank,
+    ts_headline(file_content.language::regconfig, file_content.content, query,
+        'StartSel=<mark>, StopSel=</mark>, MaxFragments=3, MaxWords=20, MinWords=5')::TEXT AS snippet
+FROM uploaded_file
+JOIN file_content ON file_content.transaction_uuid = uploaded_file.transaction_uuid,
+    websearch_to_tsquery($1::TEXT::regconfig, $2::TEXT) AS query
+WHERE uploaded_file.consumer = $3
+AND ($4::TEXT IS NULL OR uploaded_file.user_name = $4)
+AND file_content.content_tsv @@ query
+ORDER BY rank DESC, uploaded_file.created_at DESC
+LIMIT $6 OFFSET $5
+`
+
+type SearchUploadedFilesParams struct {
+	Language    string
+	Query       string
+	Consumer    string
+	UserName    sql.NullString
+	SkipResults int32
+	MaxResults  int32
+}
+
+type SearchUploadedFilesRow struct {
+	UploadedFile UploadedFile
+	Rank         float32
+	Snippet      string
+}
+
+func (q *Queries) SearchUploadedFiles(ctx context.Context, arg SearchUploadedFilesParams) ([]SearchUploadedFilesRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchUploadedFiles,
+		arg.Language,
+		arg.Query,
+		arg.Consumer,
+		arg.UserName,
+		arg.SkipResults,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchUploadedFilesRow
+	for rows.Next() {
+		var i SearchUploadedFilesRow
+		if err := rows.Scan(
+			&i.UploadedFile.TransactionUuid,
+			&i.UploadedFile.Consumer,
+			&i.UploadedFile.UserName,
+			&i.UploadedFile.FileName,
+			&i.UploadedFile.FileSize,
+			&i.UploadedFile.FileType,
+			&i.UploadedFile.UploadPresignedUrl,
+			&i.UploadedFile.Status,
+			&i.UploadedFile.CreatedAt,
+			&i.UploadedFile.UpdatedAt,
+			&i.UploadedFile.UploadExpirationTime,
+			&i.UploadedFile.Sha256,
+			&i.UploadedFile.SseMode,
+			&i.UploadedFile.SseKmsKeyID,
+			&i.UploadedFile.SseCustomerKeyMd5,
+			&i.UploadedFile.EnvelopeAlgorithm,
+			&i.UploadedFile.EnvelopeKeyID,
+			&i.UploadedFile.EnvelopeWrappedKey,
+			&i.UploadedFile.EnvelopeNonce,
+			&i.UploadedFile.EnvelopeChunkSize,
+			&i.UploadedFile.Metadata,
+			&i.UploadedFile.Tags,
+			&i.UploadedFile.ObjectKey,
+			&i.UploadedFile.Bucket,
+			&i.UploadedFile.Region,
+			&i.UploadedFile.StorageClass,
+			&i.UploadedFile.StorageClassUpdatedAt,
+			&i.UploadedFile.LastDownloadedAt,
+			&i.UploadedFile.RestoreStatus,
+			&i.UploadedFile.RestoreTier,
+			&i.UploadedFile.RestoreRequestedAt,
+			&i.UploadedFile.RestoreExpiresAt,
+			&i.UploadedFile.RetentionMode,
+			&i.UploadedFile.RetainUntil,
+			&i.UploadedFile.LegalHold,
+			&i.UploadedFile.LogicalFileID,
+			&i.UploadedFile.Version,
+			&i.UploadedFile.S3VersionID,
+			&i.UploadedFile.ScanStatus,
+			&i.UploadedFile.ScanSignature,
+			&i.UploadedFile.ScannedAt,
+			&i.UploadedFile.DetectedType,
+			&i.UploadedFile.TypeMismatch,
+			&i.UploadedFile.RenditionStatus,
+			pq.Array(&i.UploadedFile.StrippedMetadata),
+			&i.UploadedFile.SanitizedAt,
+			&i.UploadedFile.OriginalObjectKey,
+			&i.UploadedFile.ExtractionStatus,
+			&i.UploadedFile.ScanAttempts,
+			&i.UploadedFile.ScanAttemptedAt,
+			&i.UploadedFile.RenditionAttempts,
+			&i.UploadedFile.RenditionAttemptedAt,
+			&i.UploadedFile.ExtractionAttempts,
+			&i.UploadedFile.ExtractionAttemptedAt,
+			&i.Rank,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertFileContent = `-- name: UpsertFileContent :exec
+INSERT INTO file_content (
+    transaction_uuid,
+    language,
+    content,
+    content_tsv,
+    extracted_at
+) VALUES (
+    $1, $2, $3,
+    to_tsvector($2::regconfig, $3), NOW()
+)
+ON CONFLICT (transaction_uuid) DO UPDATE
+SET language = EXCLUDED.language,
+    content = EXCLUDED.content,
+    content_tsv = EXCLUDED.content_tsv,
+    extracted_at = EXCLUDED.extracted_at
+`
+
+type UpsertFileContentParams struct {
+	TransactionUuid uuid.UUID
+	Language        string
+	Content         string
+}
+
+func (q *Queries) UpsertFileContent(ctx context.Context, arg UpsertFileContentParams) error {
+	_, err := q.db.ExecContext(ctx, upsertFileContent, arg.TransactionUuid, arg.Language, arg.Content)
+	return err
+}
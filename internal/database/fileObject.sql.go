@@ -0,0 +1,301 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: fileObject.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const acquireFileObject = `-- name: AcquireFileObject :one
+UPDATE file_object
+SET
+    ref_count = ref_count + 1,
+    updated_at = NOW()
+WHERE consumer = $1 and sha256 = $2 and bucket = $3 and ref_count > 0
+RETURNING consumer, sha256, object_key, file_size, file_type, ref_count, created_at, updated_at, sse_mode, sse_kms_key_id, sse_customer_key_md5, bucket, region, storage_class
+`
+
+type AcquireFileObjectParams struct {
+	Consumer string
+	Sha256   string
+	Bucket   string
+}
+
+// Objects whose last reference was released are about to be deleted and can't be acquired
+func (q *Queries) AcquireFileObject(ctx context.Context, arg AcquireFileObjectParams) (FileObject, error) {
+	row := q.db.QueryRowContext(ctx, acquireFileObject, arg.Consumer, arg.Sha256, arg.Bucket)
+	var i FileObject
+	err := row.Scan(
+		&i.Consumer,
+		&i.Sha256,
+		&i.ObjectKey,
+		&i.FileSize,
+		&i.FileType,
+		&i.RefCount,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+	)
+	return i, err
+}
+
+const completeDeduplicatedUpload = `-- name: CompleteDeduplicatedUpload :one
+WITH linked AS (
+    INSERT INTO file_object (
+        consumer,
+        sha256,
+        object_key,
+        file_size,
+        file_type,
+        sse_mode,
+        sse_kms_key_id,
+        sse_customer_key_md5,
+        bucket,
+        region,
+        storage_class,
+        ref_count,
+        created_at
+    )
+    SELECT
+        pending.consumer,
+        $5::text,
+        pending.object_key,
+        $1::int,
+        $2::text,
+        pending.sse_mode,
+        pending.sse_kms_key_id,
+        pending.sse_customer_key_md5,
+        COALESCE(pending.bucket, ''),
+        pending.region,
+        pending.storage_class,
+        1,
+        NOW()
+    FROM uploaded_file AS pending
+    WHERE pending.transaction_uuid = $4 and pending.status = $6
+    FOR UPDATE
+    ON CONFLICT (consumer, bucket, sha256) DO UPDATE
+    SET
+        ref_count = file_object.ref_count + 1,
+        updated_at = NOW()
+    RETURNING consumer, sha256, object_key, file_size, file_type, ref_count, created_at, updated_at, sse_mode, sse_kms_key_id, sse_customer_key_md5, bucket, region, storage_class
+)
+UPDATE uploaded_file
+SET
+    object_key = linked.object_key,
+    sha256 = linked.sha256,
+    file_size = $1::int,
+    file_type = $2::text,
+    status = $3,
+    updated_at = NOW()
+FROM linked
+WHERE uploaded_file.transaction_uuid = $4
+RETURNING uploaded_file.transaction_uuid, uploaded_file.consumer, uploaded_file.user_name, uploaded_file.file_name, uploaded_file.file_size, uploaded_file.file_type, uploaded_file.upload_presigned_url, uploaded_file.status, uploaded_file.created_at, uploaded_file.updated_at, uploaded_file.upload_expiration_time, uploaded_file.sha256, uploaded_file.sse_mode, uploaded_file.sse_kms_key_id, uploaded_file.sse_customer_key_md5, uploaded_file.envelope_algorithm, uploaded_file.envelope_key_id, uploaded_file.envelope_wrapped_key, uploaded_file.envelope_nonce, uploaded_file.envelope_chunk_size, uploaded_file.metadata, uploaded_file.tags, uploaded_file.object_key, uploaded_file.bucket, uploaded_file.region, uploaded_file.storage_class, uploaded_file.storage_class_updated_at, uploaded_file.last_downloaded_at, uploaded_file.restore_status, uploaded_file.restore_tier, uploaded_file.restore_requested_at, uploaded_file.restore_expires_at, uploaded_file.retention_mode, uploaded_file.retain_until, uploaded_file.legal_hold, uploaded_file.logical_file_id, uploaded_file.version, uploaded_file.s3_version_id, uploaded_file.scan_status, uploaded_file.scan_signature, uploaded_file.scanned_at, uploaded_file.detected_type, uploaded_file.type_mismatch, uploaded_file.rendition_status, uploaded_file.stripped_metadata, uploaded_file.sanitized_at, uploaded_file.original_object_key, uploaded_file.extraction_status, uploaded_file.scan_attempts, uploaded_file.scan_attempted_at, uploaded_file.rendition_attempts, uploaded_file.rendition_attempted_at, uploaded_file.extraction_attempts, uploaded_file.extraction_attempted_at
+`
+
+type CompleteDeduplicatedUploadParams struct {
+	FileSize        sql.NullInt32
+	FileType        sql.NullString
+	CompletedStatus string
+	TransactionUuid uuid.UUID
+	Sha256          string
+	WaitingStatus   string
+}
+
+// Records a waiting upload as completed and takes its reference on the file object in one
+// statement, a failed or retried completion can't count twice. The object is created from
+// the upload unless the content is already stored, the upload then points at that object.
+// The row lock keeps concurrent completions of the same upload from both counting.
+func (q *Queries) CompleteDeduplicatedUpload(ctx context.Context, arg CompleteDeduplicatedUploadParams) (UploadedFile, error) {
+	row := q.db.QueryRowContext(ctx, completeDeduplicatedUpload,
+		arg.FileSize,
+		arg.FileType,
+		arg.CompletedStatus,
+		arg.TransactionUuid,
+		arg.Sha256,
+		arg.WaitingStatus,
+	)
+	var i UploadedFile
+	err := row.Scan(
+		&i.TransactionUuid,
+		&i.Consumer,
+		&i.UserName,
+		&i.FileName,
+		&i.FileSize,
+		&i.FileType,
+		&i.UploadPresignedUrl,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
+	)
+	return i, err
+}
+
+const deleteFileObjectByKey = `-- name: DeleteFileObjectByKey :exec
+DELETE FROM file_object
+WHERE consumer = $1 and bucket = $2 and object_key = $3
+`
+
+type DeleteFileObjectByKeyParams struct {
+	Consumer  string
+	Bucket    string
+	ObjectKey string
+}
+
+func (q *Queries) DeleteFileObjectByKey(ctx context.Context, arg DeleteFileObjectByKeyParams) error {
+	_, err := q.db.ExecContext(ctx, deleteFileObjectByKey, arg.Consumer, arg.Bucket, arg.ObjectKey)
+	return err
+}
+
+const deleteReleasedFileObject = `-- name: DeleteReleasedFileObject :one
+DELETE FROM file_object
+WHERE consumer = $1 and sha256 = $2 and bucket = $3 and ref_count <= 0
+RETURNING consumer, sha256, object_key, file_size, file_type, ref_count, created_at, updated_at, sse_mode, sse_kms_key_id, sse_customer_key_md5, bucket, region, storage_class
+`
+
+type DeleteReleasedFileObjectParams struct {
+	Consumer string
+	Sha256   string
+	Bucket   string
+}
+
+// Finds no row when an upload of the same content revived the object in the meantime
+func (q *Queries) DeleteReleasedFileObject(ctx context.Context, arg DeleteReleasedFileObjectParams) (FileObject, error) {
+	row := q.db.QueryRowContext(ctx, deleteReleasedFileObject, arg.Consumer, arg.Sha256, arg.Bucket)
+	var i FileObject
+	err := row.Scan(
+		&i.Consumer,
+		&i.Sha256,
+		&i.ObjectKey,
+		&i.FileSize,
+		&i.FileType,
+		&i.RefCount,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+	)
+	return i, err
+}
+
+const releaseFileObject = `-- name: ReleaseFileObject :one
+UPDATE file_object
+SET
+    ref_count = ref_count - 1,
+    updated_at = NOW()
+WHERE consumer = $1 and sha256 = $2 and bucket = $3
+RETURNING consumer, sha256, object_key, file_size, file_type, ref_count, created_at, updated_at, sse_mode, sse_kms_key_id, sse_customer_key_md5, bucket, region, storage_class
+`
+
+type ReleaseFileObjectParams struct {
+	Consumer string
+	Sha256   string
+	Bucket   string
+}
+
+// The row lock serializes concurrent releases, each sees the count it left
+func (q *Queries) ReleaseFileObject(ctx context.Context, arg ReleaseFileObjectParams) (FileObject, error) {
+	row := q.db.QueryRowContext(ctx, releaseFileObject, arg.Consumer, arg.Sha256, arg.Bucket)
+	var i FileObject
+	err := row.Scan(
+		&i.Consumer,
+		&i.Sha256,
+		&i.ObjectKey,
+		&i.FileSize,
+		&i.FileType,
+		&i.RefCount,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+	)
+	return i, err
+}
+
+const setFileObjectStorageClass = `-- name: SetFileObjectStorageClass :exec
+UPDATE file_object
+SET
+    storage_class = $4,
+    updated_at = NOW()
+WHERE consumer = $1 and bucket = $2 and object_key = $3
+`
+
+type SetFileObjectStorageClassParams struct {
+	Consumer     string
+	Bucket       string
+	ObjectKey    string
+	StorageClass string
+}
+
+func (q *Queries) SetFileObjectStorageClass(ctx context.Context, arg SetFileObjectStorageClassParams) error {
+	_, err := q.db.ExecContext(ctx, setFileObjectStorageClass,
+		arg.Consumer,
+		arg.Bucket,
+		arg.ObjectKey,
+		arg.StorageClass,
+	)
+	return err
+}
@@ -0,0 +1,74 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: logicalFile.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createLogicalFile = `-- name: CreateLogicalFile :one
+INSERT INTO logical_file (
+    id,
+    consumer,
+    user_name,
+    latest_version,
+    created_at
+) VALUES (
+    $1, $2, $3, 1, NOW()
+)
+RETURNING id, consumer, user_name, latest_version, created_at, updated_at
+`
+
+type CreateLogicalFileParams struct {
+	ID       uuid.UUID
+	Consumer string
+	UserName string
+}
+
+func (q *Queries) CreateLogicalFile(ctx context.Context, arg CreateLogicalFileParams) (LogicalFile, error) {
+	row := q.db.QueryRowContext(ctx, createLogicalFile, arg.ID, arg.Consumer, arg.UserName)
+	var i LogicalFile
+	err := row.Scan(
+		&i.ID,
+		&i.Consumer,
+		&i.UserName,
+		&i.LatestVersion,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const nextLogicalFileVersion = `-- name: NextLogicalFileVersion :one
+UPDATE logical_file
+SET
+    latest_version = latest_version + 1,
+    updated_at = NOW()
+WHERE id = $1 and consumer = $2 and user_name = $3
+RETURNING id, consumer, user_name, latest_version, created_at, updated_at
+`
+
+type NextLogicalFileVersionParams struct {
+	ID       uuid.UUID
+	Consumer string
+	UserName string
+}
+
+func (q *Queries) NextLogicalFileVersion(ctx context.Context, arg NextLogicalFileVersionParams) (LogicalFile, error) {
+	row := q.db.QueryRowContext(ctx, nextLogicalFileVersion, arg.ID, arg.Consumer, arg.UserName)
+	var i LogicalFile
+	err := row.Scan(
+		&i.ID,
+		&i.Consumer,
+		&i.UserName,
+		&i.LatestVersion,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
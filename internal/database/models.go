@@ -6,23 +6,162 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type DownloadToken struct {
+	ID              uuid.UUID
+	TokenHash       string
+	TransactionUuid uuid.UUID
+	Consumer        string
+	UserName        string
+	ExpiresAt       time.Time
+	LastUsedAt      sql.NullTime
+	RevokedAt       sql.NullTime
+	CreatedAt       time.Time
+}
+
+type FileContent struct {
+	TransactionUuid uuid.UUID
+	Language        string
+	Content         string
+	ContentTsv      interface{}
+	ExtractedAt     time.Time
+}
+
+type FileObject struct {
+	Consumer          string
+	Sha256            string
+	ObjectKey         string
+	FileSize          sql.NullInt32
+	FileType          sql.NullString
+	RefCount          int32
+	CreatedAt         time.Time
+	UpdatedAt         sql.NullTime
+	SseMode           sql.NullString
+	SseKmsKeyID       sql.NullString
+	SseCustomerKeyMd5 sql.NullString
+	Bucket            string
+	Region            sql.NullString
+	StorageClass      string
+}
+
+type LogicalFile struct {
+	ID            uuid.UUID
+	Consumer      string
+	UserName      string
+	LatestVersion int32
+	CreatedAt     time.Time
+	UpdatedAt     sql.NullTime
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt time.Time
+}
+
+type Rendition struct {
+	TransactionUuid uuid.UUID
+	Name            string
+	ObjectKey       string
+	Width           int32
+	Height          int32
+	ContentType     string
+	FileSize        int32
+	CreatedAt       time.Time
+}
+
+type ShareLink struct {
+	ID               uuid.UUID
+	TokenHash        string
+	TransactionUuid  uuid.UUID
+	CreatedBy        string
+	PasswordHash     sql.NullString
+	ExpiresAt        sql.NullTime
+	MaxDownloads     sql.NullInt32
+	DownloadCount    int32
+	AllowedIpRanges  []string
+	LastDownloadedAt sql.NullTime
+	RevokedAt        sql.NullTime
+	CreatedAt        time.Time
+}
+
+type ShareLinkDownload struct {
+	ID           int64
+	ShareLinkID  uuid.UUID
+	ClientIp     string
+	UserAgent    string
+	DownloadedAt time.Time
+}
+
+type StorageTransition struct {
+	ID               uuid.UUID
+	Consumer         string
+	Bucket           sql.NullString
+	ObjectKey        string
+	FromStorageClass string
+	ToStorageClass   string
+	TransitionedAt   time.Time
+}
+
 type UploadedFile struct {
-	TransactionUuid        uuid.UUID
-	Consumer               string
-	UserName               string
-	FileName               string
-	FileSize               sql.NullInt32
-	FileType               sql.NullString
-	UploadPresignedUrl     string
-	DownloadPresignedUrl   sql.NullString
-	Status                 string
-	CreatedAt              time.Time
-	UpdatedAt              sql.NullTime
-	DownloadExpirationTime sql.NullTime
-	UploadExpirationTime   sql.NullTime
+	TransactionUuid       uuid.UUID
+	Consumer              string
+	UserName              string
+	FileName              string
+	FileSize              sql.NullInt32
+	FileType              sql.NullString
+	UploadPresignedUrl    string
+	Status                string
+	CreatedAt             time.Time
+	UpdatedAt             sql.NullTime
+	UploadExpirationTime  sql.NullTime
+	Sha256                sql.NullString
+	SseMode               sql.NullString
+	SseKmsKeyID           sql.NullString
+	SseCustomerKeyMd5     sql.NullString
+	EnvelopeAlgorithm     sql.NullString
+	EnvelopeKeyID         sql.NullString
+	EnvelopeWrappedKey    []byte
+	EnvelopeNonce         []byte
+	EnvelopeChunkSize     sql.NullInt32
+	Metadata              json.RawMessage
+	Tags                  json.RawMessage
+	ObjectKey             string
+	Bucket                sql.NullString
+	Region                sql.NullString
+	StorageClass          string
+	StorageClassUpdatedAt sql.NullTime
+	LastDownloadedAt      sql.NullTime
+	RestoreStatus         sql.NullString
+	RestoreTier           sql.NullString
+	RestoreRequestedAt    sql.NullTime
+	RestoreExpiresAt      sql.NullTime
+	RetentionMode         sql.NullString
+	RetainUntil           sql.NullTime
+	LegalHold             bool
+	LogicalFileID         uuid.UUID
+	Version               int32
+	S3VersionID           sql.NullString
+	ScanStatus            sql.NullString
+	ScanSignature         sql.NullString
+	ScannedAt             sql.NullTime
+	DetectedType          sql.NullString
+	TypeMismatch          bool
+	RenditionStatus       sql.NullString
+	StrippedMetadata      []string
+	SanitizedAt           sql.NullTime
+	OriginalObjectKey     sql.NullString
+	ExtractionStatus      sql.NullString
+	ScanAttempts          int32
+	ScanAttemptedAt       sql.NullTime
+	RenditionAttempts     int32
+	RenditionAttemptedAt  sql.NullTime
+	ExtractionAttempts    int32
+	ExtractionAttemptedAt sql.NullTime
 }
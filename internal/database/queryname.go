@@ -0,0 +1,17 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+)
+
+// sqlc prefixes every query with its name
+var queryNameComment = regexp.MustCompile(`^-- name: (\w+)`)
+
+// QueryName is the sqlc name of query, "other" for queries not generated by sqlc
+func QueryName(query string) string {
+	if match := queryNameComment.FindStringSubmatch(strings.TrimSpace(query)); match != nil {
+		return match[1]
+	}
+	return "other"
+}
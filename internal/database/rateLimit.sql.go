@@ -0,0 +1,63 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: rateLimit.sql
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const deleteIdleRateLimitBuckets = `-- name: DeleteIdleRateLimitBuckets :execrows
+DELETE FROM rate_limit_bucket
+WHERE updated_at < $1
+`
+
+// Buckets idle long enough to be full again behave exactly like missing ones
+func (q *Queries) DeleteIdleRateLimitBuckets(ctx context.Context, idleSince time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteIdleRateLimitBuckets, idleSince)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const takeRateLimitToken = `-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_bucket (key, tokens, allowed, updated_at)
+VALUES ($1, $2::FLOAT8 - 1, TRUE, NOW())
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+        WHEN LEAST($2::FLOAT8, rate_limit_bucket.tokens
+            + EXTRACT(EPOCH FROM NOW() - rate_limit_bucket.updated_at)::FLOAT8 * $3::FLOAT8) >= 1
+        THEN LEAST($2::FLOAT8, rate_limit_bucket.tokens
+            + EXTRACT(EPOCH FROM NOW() - rate_limit_bucket.updated_at)::FLOAT8 * $3::FLOAT8) - 1
+        ELSE LEAST($2::FLOAT8, rate_limit_bucket.tokens
+            + EXTRACT(EPOCH FROM NOW() - rate_limit_bucket.updated_at)::FLOAT8 * $3::FLOAT8)
+    END,
+    allowed = LEAST($2::FLOAT8, rate_limit_bucket.tokens
+        + EXTRACT(EPOCH FROM NOW() - rate_limit_bucket.updated_at)::FLOAT8 * $3::FLOAT8) >= 1,
+    updated_at = NOW()
+RETURNING tokens, allowed
+`
+
+type TakeRateLimitTokenParams struct {
+	Key   string
+	Burst float64
+	Rate  float64
+}
+
+type TakeRateLimitTokenRow struct {
+	Tokens  float64
+	Allowed bool
+}
+
+// Refills the bucket for the time elapsed since its last use, then takes a token if
+// one is available. Runs as a single statement so concurrent replicas serialize on the row.
+func (q *Queries) TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (TakeRateLimitTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, takeRateLimitToken, arg.Key, arg.Burst, arg.Rate)
+	var i TakeRateLimitTokenRow
+	err := row.Scan(&i.Tokens, &i.Allowed)
+	return i, err
+}
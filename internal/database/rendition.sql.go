@@ -0,0 +1,107 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: rendition.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createRendition = `-- name: CreateRendition :one
+INSERT INTO rendition (
+    transaction_uuid,
+    name,
+    object_key,
+    width,
+    height,
+    content_type,
+    file_size,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, NOW()
+)
+ON CONFLICT (transaction_uuid, name) DO UPDATE
+SET object_key = EXCLUDED.object_key,
+    width = EXCLUDED.width,
+    height = EXCLUDED.height,
+    content_type = EXCLUDED.content_type,
+    file_size = EXCLUDED.file_size,
+    created_at = EXCLUDED.created_at
+RETURNING transaction_uuid, name, object_key, width, height, content_type, file_size, created_at
+`
+
+type CreateRenditionParams struct {
+	TransactionUuid uuid.UUID
+	Name            string
+	ObjectKey       string
+	Width           int32
+	Height          int32
+	ContentType     string
+	FileSize        int32
+}
+
+func (q *Queries) CreateRendition(ctx context.Context, arg CreateRenditionParams) (Rendition, error) {
+	row := q.db.QueryRowContext(ctx, createRendition,
+		arg.TransactionUuid,
+		arg.Name,
+		arg.ObjectKey,
+		arg.Width,
+		arg.Height,
+		arg.ContentType,
+		arg.FileSize,
+	)
+	var i Rendition
+	err := row.Scan(
+		&i.TransactionUuid,
+		&i.Name,
+		&i.ObjectKey,
+		&i.Width,
+		&i.Height,
+		&i.ContentType,
+		&i.FileSize,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listRenditions = `-- name: ListRenditions :many
+SELECT transaction_uuid, name, object_key, width, height, content_type, file_size, created_at FROM rendition
+WHERE transaction_uuid = $1
+ORDER BY width, name
+`
+
+func (q *Queries) ListRenditions(ctx context.Context, transactionUuid uuid.UUID) ([]Rendition, error) {
+	rows, err := q.db.QueryContext(ctx, listRenditions, transactionUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Rendition
+	for rows.Next() {
+		var i Rendition
+		if err := rows.Scan(
+			&i.TransactionUuid,
+			&i.Name,
+			&i.ObjectKey,
+			&i.Width,
+			&i.Height,
+			&i.ContentType,
+			&i.FileSize,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
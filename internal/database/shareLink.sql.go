@@ -0,0 +1,281 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: shareLink.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const claimShareLinkDownload = `-- name: ClaimShareLinkDownload :one
+UPDATE share_link
+SET download_count = download_count + 1,
+    last_downloaded_at = NOW()
+WHERE id = $1
+AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW())
+AND (max_downloads IS NULL OR download_count < max_downloads)
+RETURNING id, token_hash, transaction_uuid, created_by, password_hash, expires_at, max_downloads, download_count, allowed_ip_ranges, last_downloaded_at, revoked_at, created_at
+`
+
+// Counts a download unless the link was revoked, expired or used up in the meantime
+func (q *Queries) ClaimShareLinkDownload(ctx context.Context, id uuid.UUID) (ShareLink, error) {
+	row := q.db.QueryRowContext(ctx, claimShareLinkDownload, id)
+	var i ShareLink
+	err := row.Scan(
+		&i.ID,
+		&i.TokenHash,
+		&i.TransactionUuid,
+		&i.CreatedBy,
+		&i.PasswordHash,
+		&i.ExpiresAt,
+		&i.MaxDownloads,
+		&i.DownloadCount,
+		pq.Array(&i.AllowedIpRanges),
+		&i.LastDownloadedAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createShareLink = `-- name: CreateShareLink :one
+INSERT INTO share_link (
+    id,
+    token_hash,
+    transaction_uuid,
+    created_by,
+    password_hash,
+    expires_at,
+    max_downloads,
+    allowed_ip_ranges,
+    created_at
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+RETURNING id, token_hash, transaction_uuid, created_by, password_hash, expires_at, max_downloads, download_count, allowed_ip_ranges, last_downloaded_at, revoked_at, created_at
+`
+
+type CreateShareLinkParams struct {
+	ID              uuid.UUID
+	TokenHash       string
+	TransactionUuid uuid.UUID
+	CreatedBy       string
+	PasswordHash    sql.NullString
+	ExpiresAt       sql.NullTime
+	MaxDownloads    sql.NullInt32
+	AllowedIpRanges []string
+}
+
+func (q *Queries) CreateShareLink(ctx context.Context, arg CreateShareLinkParams) (ShareLink, error) {
+	row := q.db.QueryRowContext(ctx, createShareLink,
+		arg.ID,
+		arg.TokenHash,
+		arg.TransactionUuid,
+		arg.CreatedBy,
+		arg.PasswordHash,
+		arg.ExpiresAt,
+		arg.MaxDownloads,
+		pq.Array(arg.AllowedIpRanges),
+	)
+	var i ShareLink
+	err := row.Scan(
+		&i.ID,
+		&i.TokenHash,
+		&i.TransactionUuid,
+		&i.CreatedBy,
+		&i.PasswordHash,
+		&i.ExpiresAt,
+		&i.MaxDownloads,
+		&i.DownloadCount,
+		pq.Array(&i.AllowedIpRanges),
+		&i.LastDownloadedAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createShareLinkDownload = `-- name: CreateShareLinkDownload :exec
+INSERT INTO share_link_download (
+    share_link_id,
+    client_ip,
+    user_agent,
+    downloaded_at
+) VALUES ($1, $2, $3, NOW())
+`
+
+type CreateShareLinkDownloadParams struct {
+	ShareLinkID uuid.UUID
+	ClientIp    string
+	UserAgent   string
+}
+
+func (q *Queries) CreateShareLinkDownload(ctx context.Context, arg CreateShareLinkDownloadParams) error {
+	_, err := q.db.ExecContext(ctx, createShareLinkDownload, arg.ShareLinkID, arg.ClientIp, arg.UserAgent)
+	return err
+}
+
+const getShareLinkByTokenHash = `-- name: GetShareLinkByTokenHash :one
+SELECT share_link.id, share_link.token_hash, share_link.transaction_uuid, share_link.created_by, share_link.password_hash, share_link.expires_at, share_link.max_downloads, share_link.download_count, share_link.allowed_ip_ranges, share_link.last_downloaded_at, share_link.revoked_at, share_link.created_at, uploaded_file.transaction_uuid, uploaded_file.consumer, uploaded_file.user_name, uploaded_file.file_name, uploaded_file.file_size, uploaded_file.file_type, uploaded_file.upload_presigned_url, uploaded_file.status, uploaded_file.created_at, uploaded_file.updated_at, uploaded_file.upload_expiration_time, uploaded_file.sha256, uploaded_file.sse_mode, uploaded_file.sse_kms_key_id, uploaded_file.sse_customer_key_md5, uploaded_file.envelope_algorithm, uploaded_file.envelope_key_id, uploaded_file.envelope_wrapped_key, uploaded_file.envelope_nonce, uploaded_file.envelope_chunk_size, uploaded_file.metadata, uploaded_file.tags, uploaded_file.object_key, uploaded_file.bucket, uploaded_file.region, uploaded_file.storage_class, uploaded_file.storage_class_updated_at, uploaded_file.last_downloaded_at, uploaded_file.restore_status, uploaded_file.restore_tier, uploaded_file.restore_requested_at, uploaded_file.restore_expires_at, uploaded_file.retention_mode, uploaded_file.retain_until, uploaded_file.legal_hold, uploaded_file.logical_file_id, uploaded_file.version, uploaded_file.s3_version_id, uploaded_file.scan_status, uploaded_file.scan_signature, uploaded_file.scanned_at, uploaded_file.detected_type, uploaded_file.type_mismatch, uploaded_file.rendition_status, uploaded_file.stripped_metadata, uploaded_file.sanitized_at, uploaded_file.original_object_key, uploaded_file.extraction_status, uploaded_file.scan_attempts, uploaded_file.scan_attempted_at, uploaded_file.rendition_attempts, uploaded_file.rendition_attempted_at, uploaded_file.extraction_attempts, uploaded_file.extraction_attempted_at
+FROM share_link
+JOIN uploaded_file ON uploaded_file.transaction_uuid = share_link.transaction_uuid
+WHERE share_link.token_hash = $1
+`
+
+type GetShareLinkByTokenHashRow struct {
+	ShareLink    ShareLink
+	UploadedFile UploadedFile
+}
+
+func (q *Queries) GetShareLinkByTokenHash(ctx context.Context, tokenHash string) (GetShareLinkByTokenHashRow, error) {
+	row := q.db.QueryRowContext(ctx, getShareLinkByTokenHash, tokenHash)
+	var i GetShareLinkByTokenHashRow
+	err := row.Scan(
+		&i.ShareLink.ID,
+		&i.ShareLink.TokenHash,
+		&i.ShareLink.TransactionUuid,
+		&i.ShareLink.CreatedBy,
+		&i.ShareLink.PasswordHash,
+		&i.ShareLink.ExpiresAt,
+		&i.ShareLink.MaxDownloads,
+		&i.ShareLink.DownloadCount,
+		pq.Array(&i.ShareLink.AllowedIpRanges),
+		&i.ShareLink.LastDownloadedAt,
+		&i.ShareLink.RevokedAt,
+		&i.ShareLink.CreatedAt,
+		&i.UploadedFile.TransactionUuid,
+		&i.UploadedFile.Consumer,
+		&i.UploadedFile.UserName,
+		&i.UploadedFile.FileName,
+		&i.UploadedFile.FileSize,
+		&i.UploadedFile.FileType,
+		&i.UploadedFile.UploadPresignedUrl,
+		&i.UploadedFile.Status,
+		&i.UploadedFile.CreatedAt,
+		&i.UploadedFile.UpdatedAt,
+		&i.UploadedFile.UploadExpirationTime,
+		&i.UploadedFile.Sha256,
+		&i.UploadedFile.SseMode,
+		&i.UploadedFile.SseKmsKeyID,
+		&i.UploadedFile.SseCustomerKeyMd5,
+		&i.UploadedFile.EnvelopeAlgorithm,
+		&i.UploadedFile.EnvelopeKeyID,
+		&i.UploadedFile.EnvelopeWrappedKey,
+		&i.UploadedFile.EnvelopeNonce,
+		&i.UploadedFile.EnvelopeChunkSize,
+		&i.UploadedFile.Metadata,
+		&i.UploadedFile.Tags,
+		&i.UploadedFile.ObjectKey,
+		&i.UploadedFile.Bucket,
+		&i.UploadedFile.Region,
+		&i.UploadedFile.StorageClass,
+		&i.UploadedFile.StorageClassUpdatedAt,
+		&i.UploadedFile.LastDownloadedAt,
+		&i.UploadedFile.RestoreStatus,
+		&i.UploadedFile.RestoreTier,
+		&i.UploadedFile.RestoreRequestedAt,
+		&i.UploadedFile.RestoreExpiresAt,
+		&i.UploadedFile.RetentionMode,
+		&i.UploadedFile.RetainUntil,
+		&i.UploadedFile.LegalHold,
+		&i.UploadedFile.LogicalFileID,
+		&i.UploadedFile.Version,
+		&i.UploadedFile.S3VersionID,
+		&i.UploadedFile.ScanStatus,
+		&i.UploadedFile.ScanSignature,
+		&i.UploadedFile.ScannedAt,
+		&i.UploadedFile.DetectedType,
+		&i.UploadedFile.TypeMismatch,
+		&i.UploadedFile.RenditionStatus,
+		pq.Array(&i.UploadedFile.StrippedMetadata),
+		&i.UploadedFile.SanitizedAt,
+		&i.UploadedFile.OriginalObjectKey,
+		&i.UploadedFile.ExtractionStatus,
+		&i.UploadedFile.ScanAttempts,
+		&i.UploadedFile.ScanAttemptedAt,
+		&i.UploadedFile.RenditionAttempts,
+		&i.UploadedFile.RenditionAttemptedAt,
+		&i.UploadedFile.ExtractionAttempts,
+		&i.UploadedFile.ExtractionAttemptedAt,
+	)
+	return i, err
+}
+
+const listShareLinks = `-- name: ListShareLinks :many
+SELECT id, token_hash, transaction_uuid, created_by, password_hash, expires_at, max_downloads, download_count, allowed_ip_ranges, last_downloaded_at, revoked_at, created_at FROM share_link
+WHERE transaction_uuid = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListShareLinks(ctx context.Context, transactionUuid uuid.UUID) ([]ShareLink, error) {
+	rows, err := q.db.QueryContext(ctx, listShareLinks, transactionUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ShareLink
+	for rows.Next() {
+		var i ShareLink
+		if err := rows.Scan(
+			&i.ID,
+			&i.TokenHash,
+			&i.TransactionUuid,
+			&i.CreatedBy,
+			&i.PasswordHash,
+			&i.ExpiresAt,
+			&i.MaxDownloads,
+			&i.DownloadCount,
+			pq.Array(&i.AllowedIpRanges),
+			&i.LastDownloadedAt,
+			&i.RevokedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeShareLink = `-- name: RevokeShareLink :one
+UPDATE share_link
+SET revoked_at = COALESCE(revoked_at, NOW())
+WHERE id = $1 AND transaction_uuid = $2
+RETURNING id, token_hash, transaction_uuid, created_by, password_hash, expires_at, max_downloads, download_count, allowed_ip_ranges, last_downloaded_at, revoked_at, created_at
+`
+
+type RevokeShareLinkParams struct {
+	ID              uuid.UUID
+	TransactionUuid uuid.UUID
+}
+
+func (q *Queries) RevokeShareLink(ctx context.Context, arg RevokeShareLinkParams) (ShareLink, error) {
+	row := q.db.QueryRowContext(ctx, revokeShareLink, arg.ID, arg.TransactionUuid)
+	var i ShareLink
+	err := row.Scan(
+		&i.ID,
+		&i.TokenHash,
+		&i.TransactionUuid,
+		&i.CreatedBy,
+		&i.PasswordHash,
+		&i.ExpiresAt,
+		&i.MaxDownloads,
+		&i.DownloadCount,
+		pq.Array(&i.AllowedIpRanges),
+		&i.LastDownloadedAt,
+		&i.RevokedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
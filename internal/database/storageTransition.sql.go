@@ -0,0 +1,59 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: storageTransition.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const createStorageTransition = `-- name: CreateStorageTransition :one
+INSERT INTO storage_transition (
+    id,
+    consumer,
+    bucket,
+    object_key,
+    from_storage_class,
+    to_storage_class,
+    transitioned_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, NOW()
+)
+RETURNING id, consumer, bucket, object_key, from_storage_class, to_storage_class, transitioned_at
+`
+
+type CreateStorageTransitionParams struct {
+	ID               uuid.UUID
+	Consumer         string
+	Bucket           sql.NullString
+	ObjectKey        string
+	FromStorageClass string
+	ToStorageClass   string
+}
+
+func (q *Queries) CreateStorageTransition(ctx context.Context, arg CreateStorageTransitionParams) (StorageTransition, error) {
+	row := q.db.QueryRowContext(ctx, createStorageTransition,
+		arg.ID,
+		arg.Consumer,
+		arg.Bucket,
+		arg.ObjectKey,
+		arg.FromStorageClass,
+		arg.ToStorageClass,
+	)
+	var i StorageTransition
+	err := row.Scan(
+		&i.ID,
+		&i.Consumer,
+		&i.Bucket,
+		&i.ObjectKey,
+		&i.FromStorageClass,
+		&i.ToStorageClass,
+		&i.TransitionedAt,
+	)
+	return i, err
+}
@@ -8,10 +8,91 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const completeUploadedFileRestore = `-- name: CompleteUploadedFileRestore :one
+UPDATE uploaded_file
+SET
+    restore_status = $2,
+    restore_expires_at = $3,
+    updated_at = NOW()
+WHERE transaction_uuid = $1
+RETURNING transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at
+`
+
+type CompleteUploadedFileRestoreParams struct {
+	TransactionUuid  uuid.UUID
+	RestoreStatus    sql.NullString
+	RestoreExpiresAt sql.NullTime
+}
+
+func (q *Queries) CompleteUploadedFileRestore(ctx context.Context, arg CompleteUploadedFileRestoreParams) (UploadedFile, error) {
+	row := q.db.QueryRowContext(ctx, completeUploadedFileRestore, arg.TransactionUuid, arg.RestoreStatus, arg.RestoreExpiresAt)
+	var i UploadedFile
+	err := row.Scan(
+		&i.TransactionUuid,
+		&i.Consumer,
+		&i.UserName,
+		&i.FileName,
+		&i.FileSize,
+		&i.FileType,
+		&i.UploadPresignedUrl,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
+	)
+	return i, err
+}
+
 const createUploadedFile = `-- name: CreateUploadedFile :one
 INSERT INTO uploaded_file (
     transaction_uuid,
@@ -21,11 +102,26 @@ INSERT INTO uploaded_file (
     upload_presigned_url,
     upload_expiration_time,
     status,
+    sha256,
+    sse_mode,
+    sse_kms_key_id,
+    sse_customer_key_md5,
+    metadata,
+    tags,
+    object_key,
+    bucket,
+    region,
+    storage_class,
+    retention_mode,
+    retain_until,
+    logical_file_id,
+    version,
+    scan_status,
     created_at
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, NOW()
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, NOW()
 )
-RETURNING transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, download_presigned_url, status, created_at, updated_at, download_expiration_time, upload_expiration_time
+RETURNING transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at
 `
 
 type CreateUploadedFileParams struct {
@@ -36,6 +132,21 @@ type CreateUploadedFileParams struct {
 	UploadPresignedUrl   string
 	UploadExpirationTime sql.NullTime
 	Status               string
+	Sha256               sql.NullString
+	SseMode              sql.NullString
+	SseKmsKeyID          sql.NullString
+	SseCustomerKeyMd5    sql.NullString
+	Metadata             json.RawMessage
+	Tags                 json.RawMessage
+	ObjectKey            string
+	Bucket               sql.NullString
+	Region               sql.NullString
+	StorageClass         string
+	RetentionMode        sql.NullString
+	RetainUntil          sql.NullTime
+	LogicalFileID        uuid.UUID
+	Version              int32
+	ScanStatus           sql.NullString
 }
 
 func (q *Queries) CreateUploadedFile(ctx context.Context, arg CreateUploadedFileParams) (UploadedFile, error) {
@@ -47,6 +158,21 @@ func (q *Queries) CreateUploadedFile(ctx context.Context, arg CreateUploadedFile
 		arg.UploadPresignedUrl,
 		arg.UploadExpirationTime,
 		arg.Status,
+		arg.Sha256,
+		arg.SseMode,
+		arg.SseKmsKeyID,
+		arg.SseCustomerKeyMd5,
+		arg.Metadata,
+		arg.Tags,
+		arg.ObjectKey,
+		arg.Bucket,
+		arg.Region,
+		arg.StorageClass,
+		arg.RetentionMode,
+		arg.RetainUntil,
+		arg.LogicalFileID,
+		arg.Version,
+		arg.ScanStatus,
 	)
 	var i UploadedFile
 	err := row.Scan(
@@ -57,18 +183,380 @@ func (q *Queries) CreateUploadedFile(ctx context.Context, arg CreateUploadedFile
 		&i.FileSize,
 		&i.FileType,
 		&i.UploadPresignedUrl,
-		&i.DownloadPresignedUrl,
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.DownloadExpirationTime,
 		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
+	)
+	return i, err
+}
+
+const deleteUploadedFile = `-- name: DeleteUploadedFile :one
+DELETE FROM uploaded_file
+WHERE transaction_uuid = $1 and consumer = $2 and user_name = $3
+    and NOT legal_hold
+    and (retain_until IS NULL or retain_until <= NOW())
+RETURNING transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at
+`
+
+type DeleteUploadedFileParams struct {
+	TransactionUuid uuid.UUID
+	Consumer        string
+	UserName        string
+}
+
+func (q *Queries) DeleteUploadedFile(ctx context.Context, arg DeleteUploadedFileParams) (UploadedFile, error) {
+	row := q.db.QueryRowContext(ctx, deleteUploadedFile, arg.TransactionUuid, arg.Consumer, arg.UserName)
+	var i UploadedFile
+	err := row.Scan(
+		&i.TransactionUuid,
+		&i.Consumer,
+		&i.UserName,
+		&i.FileName,
+		&i.FileSize,
+		&i.FileType,
+		&i.UploadPresignedUrl,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
+	)
+	return i, err
+}
+
+const expireUploadedFileRestores = `-- name: ExpireUploadedFileRestores :exec
+UPDATE uploaded_file
+SET
+    restore_status = $1
+WHERE restore_status = $2 and restore_expires_at < $3::timestamp
+`
+
+type ExpireUploadedFileRestoresParams struct {
+	ExpiredStatus   sql.NullString
+	CompletedStatus sql.NullString
+	Now             time.Time
+}
+
+func (q *Queries) ExpireUploadedFileRestores(ctx context.Context, arg ExpireUploadedFileRestoresParams) error {
+	_, err := q.db.ExecContext(ctx, expireUploadedFileRestores, arg.ExpiredStatus, arg.CompletedStatus, arg.Now)
+	return err
+}
+
+const getConsumerUploadedFile = `-- name: GetConsumerUploadedFile :one
+SELECT transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at FROM uploaded_file
+WHERE transaction_uuid = $1 and consumer = $2
+LIMIT 1
+`
+
+type GetConsumerUploadedFileParams struct {
+	TransactionUuid uuid.UUID
+	Consumer        string
+}
+
+func (q *Queries) GetConsumerUploadedFile(ctx context.Context, arg GetConsumerUploadedFileParams) (UploadedFile, error) {
+	row := q.db.QueryRowContext(ctx, getConsumerUploadedFile, arg.TransactionUuid, arg.Consumer)
+	var i UploadedFile
+	err := row.Scan(
+		&i.TransactionUuid,
+		&i.Consumer,
+		&i.UserName,
+		&i.FileName,
+		&i.FileSize,
+		&i.FileType,
+		&i.UploadPresignedUrl,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
+	)
+	return i, err
+}
+
+const getConsumerUploadedFileByKey = `-- name: GetConsumerUploadedFileByKey :one
+SELECT transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at FROM uploaded_file
+WHERE object_key = $1 and consumer = $2
+ORDER BY created_at DESC
+LIMIT 1
+`
+
+type GetConsumerUploadedFileByKeyParams struct {
+	ObjectKey string
+	Consumer  string
+}
+
+func (q *Queries) GetConsumerUploadedFileByKey(ctx context.Context, arg GetConsumerUploadedFileByKeyParams) (UploadedFile, error) {
+	row := q.db.QueryRowContext(ctx, getConsumerUploadedFileByKey, arg.ObjectKey, arg.Consumer)
+	var i UploadedFile
+	err := row.Scan(
+		&i.TransactionUuid,
+		&i.Consumer,
+		&i.UserName,
+		&i.FileName,
+		&i.FileSize,
+		&i.FileType,
+		&i.UploadPresignedUrl,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
+	)
+	return i, err
+}
+
+const getFileVersion = `-- name: GetFileVersion :one
+SELECT transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at FROM uploaded_file
+WHERE logical_file_id = $1 and version = $2 and consumer = $3 and user_name = $4
+LIMIT 1
+`
+
+type GetFileVersionParams struct {
+	LogicalFileID uuid.UUID
+	Version       int32
+	Consumer      string
+	UserName      string
+}
+
+func (q *Queries) GetFileVersion(ctx context.Context, arg GetFileVersionParams) (UploadedFile, error) {
+	row := q.db.QueryRowContext(ctx, getFileVersion,
+		arg.LogicalFileID,
+		arg.Version,
+		arg.Consumer,
+		arg.UserName,
+	)
+	var i UploadedFile
+	err := row.Scan(
+		&i.TransactionUuid,
+		&i.Consumer,
+		&i.UserName,
+		&i.FileName,
+		&i.FileSize,
+		&i.FileType,
+		&i.UploadPresignedUrl,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
 	)
 	return i, err
 }
 
 const getUploadedFile = `-- name: GetUploadedFile :one
-SELECT transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, download_presigned_url, status, created_at, updated_at, download_expiration_time, upload_expiration_time FROM uploaded_file
+SELECT transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at FROM uploaded_file
 WHERE transaction_uuid = $1 and consumer = $2 and user_name = $3
 LIMIT 1
 `
@@ -90,36 +578,1255 @@ func (q *Queries) GetUploadedFile(ctx context.Context, arg GetUploadedFileParams
 		&i.FileSize,
 		&i.FileType,
 		&i.UploadPresignedUrl,
-		&i.DownloadPresignedUrl,
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.DownloadExpirationTime,
 		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
 	)
 	return i, err
 }
 
+const listFileVersions = `-- name: ListFileVersions :many
+SELECT transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at FROM uploaded_file
+WHERE logical_file_id = $1 and consumer = $2 and user_name = $3
+ORDER BY version DESC
+`
+
+type ListFileVersionsParams struct {
+	LogicalFileID uuid.UUID
+	Consumer      string
+	UserName      string
+}
+
+func (q *Queries) ListFileVersions(ctx context.Context, arg ListFileVersionsParams) ([]UploadedFile, error) {
+	rows, err := q.db.QueryContext(ctx, listFileVersions, arg.LogicalFileID, arg.Consumer, arg.UserName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UploadedFile
+	for rows.Next() {
+		var i UploadedFile
+		if err := rows.Scan(
+			&i.TransactionUuid,
+			&i.Consumer,
+			&i.UserName,
+			&i.FileName,
+			&i.FileSize,
+			&i.FileType,
+			&i.UploadPresignedUrl,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UploadExpirationTime,
+			&i.Sha256,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+			&i.SseCustomerKeyMd5,
+			&i.EnvelopeAlgorithm,
+			&i.EnvelopeKeyID,
+			&i.EnvelopeWrappedKey,
+			&i.EnvelopeNonce,
+			&i.EnvelopeChunkSize,
+			&i.Metadata,
+			&i.Tags,
+			&i.ObjectKey,
+			&i.Bucket,
+			&i.Region,
+			&i.StorageClass,
+			&i.StorageClassUpdatedAt,
+			&i.LastDownloadedAt,
+			&i.RestoreStatus,
+			&i.RestoreTier,
+			&i.RestoreRequestedAt,
+			&i.RestoreExpiresAt,
+			&i.RetentionMode,
+			&i.RetainUntil,
+			&i.LegalHold,
+			&i.LogicalFileID,
+			&i.Version,
+			&i.S3VersionID,
+			&i.ScanStatus,
+			&i.ScanSignature,
+			&i.ScannedAt,
+			&i.DetectedType,
+			&i.TypeMismatch,
+			&i.RenditionStatus,
+			pq.Array(&i.StrippedMetadata),
+			&i.SanitizedAt,
+			&i.OriginalObjectKey,
+			&i.ExtractionStatus,
+			&i.ScanAttempts,
+			&i.ScanAttemptedAt,
+			&i.RenditionAttempts,
+			&i.RenditionAttemptedAt,
+			&i.ExtractionAttempts,
+			&i.ExtractionAttemptedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listIdleObjects = `-- name: ListIdleObjects :many
+SELECT
+    consumer,
+    bucket,
+    region,
+    object_key,
+    storage_class,
+    sse_mode,
+    sse_kms_key_id,
+    sse_customer_key_md5,
+    retention_mode,
+    retain_until,
+    MAX(COALESCE(last_downloaded_at, updated_at, created_at))::timestamp AS last_accessed_at
+FROM uploaded_file
+WHERE status <> $1
+    and (consumer, COALESCE(bucket, ''), object_key) > ($2::text, $3::text, $4::text)
+GROUP BY consumer, bucket, region, object_key, storage_class, sse_mode, sse_kms_key_id, sse_customer_key_md5,
+    retention_mode, retain_until
+HAVING MAX(COALESCE(last_downloaded_at, updated_at, created_at)) < $5::timestamp
+ORDER BY consumer, COALESCE(bucket, ''), object_key
+LIMIT $6
+`
+
+type ListIdleObjectsParams struct {
+	WaitingStatus  string
+	AfterConsumer  string
+	AfterBucket    string
+	AfterObjectKey string
+	IdleSince      time.Time
+	MaxResults     int32
+}
+
+type ListIdleObjectsRow struct {
+	Consumer          string
+	Bucket            sql.NullString
+	Region            sql.NullString
+	ObjectKey         string
+	StorageClass      string
+	SseMode           sql.NullString
+	SseKmsKeyID       sql.NullString
+	SseCustomerKeyMd5 sql.NullString
+	RetentionMode     sql.NullString
+	RetainUntil       sql.NullTime
+	LastAccessedAt    time.Time
+}
+
+// Paged by key, moved objects keep matching and would shift an offset
+func (q *Queries) ListIdleObjects(ctx context.Context, arg ListIdleObjectsParams) ([]ListIdleObjectsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listIdleObjects,
+		arg.WaitingStatus,
+		arg.AfterConsumer,
+		arg.AfterBucket,
+		arg.AfterObjectKey,
+		arg.IdleSince,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListIdleObjectsRow
+	for rows.Next() {
+		var i ListIdleObjectsRow
+		if err := rows.Scan(
+			&i.Consumer,
+			&i.Bucket,
+			&i.Region,
+			&i.ObjectKey,
+			&i.StorageClass,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+			&i.SseCustomerKeyMd5,
+			&i.RetentionMode,
+			&i.RetainUntil,
+			&i.LastAccessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPendingExtractions = `-- name: ListPendingExtractions :many
+SELECT transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at FROM uploaded_file
+WHERE extraction_status = $1
+AND status <> $2
+AND (scan_status IS NULL OR scan_status = $3)
+AND (extraction_attempted_at IS NULL
+    OR extraction_attempted_at < NOW() - power(2, extraction_attempts) * interval '1 minute')
+ORDER BY updated_at
+LIMIT $4
+`
+
+type ListPendingExtractionsParams struct {
+	PendingStatus sql.NullString
+	WaitingStatus string
+	CleanStatus   sql.NullString
+	MaxResults    int32
+}
+
+// Documents whose text failed to extract back off for a minute doubled per attempt
+func (q *Queries) ListPendingExtractions(ctx context.Context, arg ListPendingExtractionsParams) ([]UploadedFile, error) {
+	rows, err := q.db.QueryContext(ctx, listPendingExtractions,
+		arg.PendingStatus,
+		arg.WaitingStatus,
+		arg.CleanStatus,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UploadedFile
+	for rows.Next() {
+		var i UploadedFile
+		if err := rows.Scan(
+			&i.TransactionUuid,
+			&i.Consumer,
+			&i.UserName,
+			&i.FileName,
+			&i.FileSize,
+			&i.FileType,
+			&i.UploadPresignedUrl,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UploadExpirationTime,
+			&i.Sha256,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+			&i.SseCustomerKeyMd5,
+			&i.EnvelopeAlgorithm,
+			&i.EnvelopeKeyID,
+			&i.EnvelopeWrappedKey,
+			&i.EnvelopeNonce,
+			&i.EnvelopeChunkSize,
+			&i.Metadata,
+			&i.Tags,
+			&i.ObjectKey,
+			&i.Bucket,
+			&i.Region,
+			&i.StorageClass,
+			&i.StorageClassUpdatedAt,
+			&i.LastDownloadedAt,
+			&i.RestoreStatus,
+			&i.RestoreTier,
+			&i.RestoreRequestedAt,
+			&i.RestoreExpiresAt,
+			&i.RetentionMode,
+			&i.RetainUntil,
+			&i.LegalHold,
+			&i.LogicalFileID,
+			&i.Version,
+			&i.S3VersionID,
+			&i.ScanStatus,
+			&i.ScanSignature,
+			&i.ScannedAt,
+			&i.DetectedType,
+			&i.TypeMismatch,
+			&i.RenditionStatus,
+			pq.Array(&i.StrippedMetadata),
+			&i.SanitizedAt,
+			&i.OriginalObjectKey,
+			&i.ExtractionStatus,
+			&i.ScanAttempts,
+			&i.ScanAttemptedAt,
+			&i.RenditionAttempts,
+			&i.RenditionAttemptedAt,
+			&i.ExtractionAttempts,
+			&i.ExtractionAttemptedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPendingRenditions = `-- name: ListPendingRenditions :many
+SELECT transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at FROM uploaded_file
+WHERE rendition_status = $1
+AND status <> $2
+AND (scan_status IS NULL OR scan_status = $3)
+AND (rendition_attempted_at IS NULL
+    OR rendition_attempted_at < NOW() - power(2, rendition_attempts) * interval '1 minute')
+ORDER BY updated_at
+LIMIT $4
+`
+
+type ListPendingRenditionsParams struct {
+	PendingStatus sql.NullString
+	WaitingStatus string
+	CleanStatus   sql.NullString
+	MaxResults    int32
+}
+
+// Files that failed to render back off for a minute doubled per attempt
+func (q *Queries) ListPendingRenditions(ctx context.Context, arg ListPendingRenditionsParams) ([]UploadedFile, error) {
+	rows, err := q.db.QueryContext(ctx, listPendingRenditions,
+		arg.PendingStatus,
+		arg.WaitingStatus,
+		arg.CleanStatus,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UploadedFile
+	for rows.Next() {
+		var i UploadedFile
+		if err := rows.Scan(
+			&i.TransactionUuid,
+			&i.Consumer,
+			&i.UserName,
+			&i.FileName,
+			&i.FileSize,
+			&i.FileType,
+			&i.UploadPresignedUrl,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UploadExpirationTime,
+			&i.Sha256,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+			&i.SseCustomerKeyMd5,
+			&i.EnvelopeAlgorithm,
+			&i.EnvelopeKeyID,
+			&i.EnvelopeWrappedKey,
+			&i.EnvelopeNonce,
+			&i.EnvelopeChunkSize,
+			&i.Metadata,
+			&i.Tags,
+			&i.ObjectKey,
+			&i.Bucket,
+			&i.Region,
+			&i.StorageClass,
+			&i.StorageClassUpdatedAt,
+			&i.LastDownloadedAt,
+			&i.RestoreStatus,
+			&i.RestoreTier,
+			&i.RestoreRequestedAt,
+			&i.RestoreExpiresAt,
+			&i.RetentionMode,
+			&i.RetainUntil,
+			&i.LegalHold,
+			&i.LogicalFileID,
+			&i.Version,
+			&i.S3VersionID,
+			&i.ScanStatus,
+			&i.ScanSignature,
+			&i.ScannedAt,
+			&i.DetectedType,
+			&i.TypeMismatch,
+			&i.RenditionStatus,
+			pq.Array(&i.StrippedMetadata),
+			&i.SanitizedAt,
+			&i.OriginalObjectKey,
+			&i.ExtractionStatus,
+			&i.ScanAttempts,
+			&i.ScanAttemptedAt,
+			&i.RenditionAttempts,
+			&i.RenditionAttemptedAt,
+			&i.ExtractionAttempts,
+			&i.ExtractionAttemptedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPendingRestores = `-- name: ListPendingRestores :many
+SELECT transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at FROM uploaded_file
+WHERE restore_status = $1
+ORDER BY restore_requested_at
+LIMIT $2
+`
+
+type ListPendingRestoresParams struct {
+	RestoreStatus sql.NullString
+	Limit         int32
+}
+
+func (q *Queries) ListPendingRestores(ctx context.Context, arg ListPendingRestoresParams) ([]UploadedFile, error) {
+	rows, err := q.db.QueryContext(ctx, listPendingRestores, arg.RestoreStatus, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UploadedFile
+	for rows.Next() {
+		var i UploadedFile
+		if err := rows.Scan(
+			&i.TransactionUuid,
+			&i.Consumer,
+			&i.UserName,
+			&i.FileName,
+			&i.FileSize,
+			&i.FileType,
+			&i.UploadPresignedUrl,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UploadExpirationTime,
+			&i.Sha256,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+			&i.SseCustomerKeyMd5,
+			&i.EnvelopeAlgorithm,
+			&i.EnvelopeKeyID,
+			&i.EnvelopeWrappedKey,
+			&i.EnvelopeNonce,
+			&i.EnvelopeChunkSize,
+			&i.Metadata,
+			&i.Tags,
+			&i.ObjectKey,
+			&i.Bucket,
+			&i.Region,
+			&i.StorageClass,
+			&i.StorageClassUpdatedAt,
+			&i.LastDownloadedAt,
+			&i.RestoreStatus,
+			&i.RestoreTier,
+			&i.RestoreRequestedAt,
+			&i.RestoreExpiresAt,
+			&i.RetentionMode,
+			&i.RetainUntil,
+			&i.LegalHold,
+			&i.LogicalFileID,
+			&i.Version,
+			&i.S3VersionID,
+			&i.ScanStatus,
+			&i.ScanSignature,
+			&i.ScannedAt,
+			&i.DetectedType,
+			&i.TypeMismatch,
+			&i.RenditionStatus,
+			pq.Array(&i.StrippedMetadata),
+			&i.SanitizedAt,
+			&i.OriginalObjectKey,
+			&i.ExtractionStatus,
+			&i.ScanAttempts,
+			&i.ScanAttemptedAt,
+			&i.RenditionAttempts,
+			&i.RenditionAttemptedAt,
+			&i.ExtractionAttempts,
+			&i.ExtractionAttemptedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPendingScans = `-- name: ListPendingScans :many
+SELECT transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at FROM uploaded_file
+WHERE transaction_uuid IN (
+    SELECT DISTINCT ON (bucket, object_key) transaction_uuid FROM uploaded_file AS candidate
+    WHERE candidate.scan_status = $1
+        and candidate.status <> $2
+        and (candidate.storage_class <> ALL($3::text[])
+            or (candidate.restore_status = $4 and candidate.restore_expires_at > NOW()))
+        and (candidate.scan_attempted_at IS NULL
+            or candidate.scan_attempted_at < NOW() - power(2, candidate.scan_attempts) * interval '1 minute')
+    ORDER BY bucket, object_key, created_at
+)
+ORDER BY created_at
+LIMIT $5
+`
+
+type ListPendingScansParams struct {
+	PendingStatus  sql.NullString
+	WaitingStatus  string
+	ArchiveClasses []string
+	RestoredStatus sql.NullString
+	MaxResults     int32
+}
+
+// The oldest transaction of each object, oldest objects first. Archived objects wait for
+// a restored copy, objects that failed to scan back off for a minute doubled per attempt.
+func (q *Queries) ListPendingScans(ctx context.Context, arg ListPendingScansParams) ([]UploadedFile, error) {
+	rows, err := q.db.QueryContext(ctx, listPendingScans,
+		arg.PendingStatus,
+		arg.WaitingStatus,
+		pq.Array(arg.ArchiveClasses),
+		arg.RestoredStatus,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UploadedFile
+	for rows.Next() {
+		var i UploadedFile
+		if err := rows.Scan(
+			&i.TransactionUuid,
+			&i.Consumer,
+			&i.UserName,
+			&i.FileName,
+			&i.FileSize,
+			&i.FileType,
+			&i.UploadPresignedUrl,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UploadExpirationTime,
+			&i.Sha256,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+			&i.SseCustomerKeyMd5,
+			&i.EnvelopeAlgorithm,
+			&i.EnvelopeKeyID,
+			&i.EnvelopeWrappedKey,
+			&i.EnvelopeNonce,
+			&i.EnvelopeChunkSize,
+			&i.Metadata,
+			&i.Tags,
+			&i.ObjectKey,
+			&i.Bucket,
+			&i.Region,
+			&i.StorageClass,
+			&i.StorageClassUpdatedAt,
+			&i.LastDownloadedAt,
+			&i.RestoreStatus,
+			&i.RestoreTier,
+			&i.RestoreRequestedAt,
+			&i.RestoreExpiresAt,
+			&i.RetentionMode,
+			&i.RetainUntil,
+			&i.LegalHold,
+			&i.LogicalFileID,
+			&i.Version,
+			&i.S3VersionID,
+			&i.ScanStatus,
+			&i.ScanSignature,
+			&i.ScannedAt,
+			&i.DetectedType,
+			&i.TypeMismatch,
+			&i.RenditionStatus,
+			pq.Array(&i.StrippedMetadata),
+			&i.SanitizedAt,
+			&i.OriginalObjectKey,
+			&i.ExtractionStatus,
+			&i.ScanAttempts,
+			&i.ScanAttemptedAt,
+			&i.RenditionAttempts,
+			&i.RenditionAttemptedAt,
+			&i.ExtractionAttempts,
+			&i.ExtractionAttemptedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUploadedFiles = `-- name: ListUploadedFiles :many
+SELECT transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at FROM uploaded_file
+WHERE consumer = $1
+    and ($2::text IS NULL or user_name = $2)
+    and metadata @> $3::jsonb
+    and metadata ?& $4::text[]
+    and tags @> $5::jsonb
+ORDER BY created_at DESC
+LIMIT $7 OFFSET $6
+`
+
+type ListUploadedFilesParams struct {
+	Consumer       string
+	UserName       sql.NullString
+	MetadataFilter json.RawMessage
+	MetadataKeys   []string
+	TagsFilter     json.RawMessage
+	SkipResults    int32
+	MaxResults     int32
+}
+
+func (q *Queries) ListUploadedFiles(ctx context.Context, arg ListUploadedFilesParams) ([]UploadedFile, error) {
+	rows, err := q.db.QueryContext(ctx, listUploadedFiles,
+		arg.Consumer,
+		arg.UserName,
+		arg.MetadataFilter,
+		pq.Array(arg.MetadataKeys),
+		arg.TagsFilter,
+		arg.SkipResults,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UploadedFile
+	for rows.Next() {
+		var i UploadedFile
+		if err := rows.Scan(
+			&i.TransactionUuid,
+			&i.Consumer,
+			&i.UserName,
+			&i.FileName,
+			&i.FileSize,
+			&i.FileType,
+			&i.UploadPresignedUrl,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UploadExpirationTime,
+			&i.Sha256,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+			&i.SseCustomerKeyMd5,
+			&i.EnvelopeAlgorithm,
+			&i.EnvelopeKeyID,
+			&i.EnvelopeWrappedKey,
+			&i.EnvelopeNonce,
+			&i.EnvelopeChunkSize,
+			&i.Metadata,
+			&i.Tags,
+			&i.ObjectKey,
+			&i.Bucket,
+			&i.Region,
+			&i.StorageClass,
+			&i.StorageClassUpdatedAt,
+			&i.LastDownloadedAt,
+			&i.RestoreStatus,
+			&i.RestoreTier,
+			&i.RestoreRequestedAt,
+			&i.RestoreExpiresAt,
+			&i.RetentionMode,
+			&i.RetainUntil,
+			&i.LegalHold,
+			&i.LogicalFileID,
+			&i.Version,
+			&i.S3VersionID,
+			&i.ScanStatus,
+			&i.ScanSignature,
+			&i.ScannedAt,
+			&i.DetectedType,
+			&i.TypeMismatch,
+			&i.RenditionStatus,
+			pq.Array(&i.StrippedMetadata),
+			&i.SanitizedAt,
+			&i.OriginalObjectKey,
+			&i.ExtractionStatus,
+			&i.ScanAttempts,
+			&i.ScanAttemptedAt,
+			&i.RenditionAttempts,
+			&i.RenditionAttemptedAt,
+			&i.ExtractionAttempts,
+			&i.ExtractionAttemptedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const quarantineObject = `-- name: QuarantineObject :exec
+UPDATE uploaded_file
+SET
+    object_key = $1,
+    scan_status = $2,
+    scan_signature = $3,
+    scanned_at = NOW()
+WHERE consumer = $4
+    and bucket IS NOT DISTINCT FROM $5
+    and object_key = $6
+`
+
+type QuarantineObjectParams struct {
+	QuarantineKey string
+	ScanStatus    sql.NullString
+	ScanSignature sql.NullString
+	Consumer      string
+	Bucket        sql.NullString
+	ObjectKey     string
+}
+
+func (q *Queries) QuarantineObject(ctx context.Context, arg QuarantineObjectParams) error {
+	_, err := q.db.ExecContext(ctx, quarantineObject,
+		arg.QuarantineKey,
+		arg.ScanStatus,
+		arg.ScanSignature,
+		arg.Consumer,
+		arg.Bucket,
+		arg.ObjectKey,
+	)
+	return err
+}
+
+const recordExtractionAttempt = `-- name: RecordExtractionAttempt :exec
+UPDATE uploaded_file
+SET extraction_attempts = extraction_attempts + 1, extraction_attempted_at = NOW()
+WHERE transaction_uuid = $1
+`
+
+func (q *Queries) RecordExtractionAttempt(ctx context.Context, transactionUuid uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, recordExtractionAttempt, transactionUuid)
+	return err
+}
+
+const recordObjectScanAttempt = `-- name: RecordObjectScanAttempt :exec
+UPDATE uploaded_file
+SET
+    scan_attempts = scan_attempts + 1,
+    scan_attempted_at = NOW()
+WHERE consumer = $1
+    and bucket IS NOT DISTINCT FROM $2
+    and object_key = $3
+    and status <> $4
+`
+
+type RecordObjectScanAttemptParams struct {
+	Consumer      string
+	Bucket        sql.NullString
+	ObjectKey     string
+	WaitingStatus string
+}
+
+func (q *Queries) RecordObjectScanAttempt(ctx context.Context, arg RecordObjectScanAttemptParams) error {
+	_, err := q.db.ExecContext(ctx, recordObjectScanAttempt,
+		arg.Consumer,
+		arg.Bucket,
+		arg.ObjectKey,
+		arg.WaitingStatus,
+	)
+	return err
+}
+
+const recordRenditionAttempt = `-- name: RecordRenditionAttempt :exec
+UPDATE uploaded_file
+SET rendition_attempts = rendition_attempts + 1, rendition_attempted_at = NOW()
+WHERE transaction_uuid = $1
+`
+
+func (q *Queries) RecordRenditionAttempt(ctx context.Context, transactionUuid uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, recordRenditionAttempt, transactionUuid)
+	return err
+}
+
+const recordUploadedFileDownload = `-- name: RecordUploadedFileDownload :exec
+UPDATE uploaded_file
+SET last_downloaded_at = NOW()
+WHERE transaction_uuid = $1
+`
+
+func (q *Queries) RecordUploadedFileDownload(ctx context.Context, transactionUuid uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, recordUploadedFileDownload, transactionUuid)
+	return err
+}
+
+const setObjectScanResult = `-- name: SetObjectScanResult :exec
+UPDATE uploaded_file
+SET
+    scan_status = $1,
+    scan_signature = $2,
+    scanned_at = NOW()
+WHERE consumer = $3
+    and bucket IS NOT DISTINCT FROM $4
+    and object_key = $5
+    and status <> $6
+`
+
+type SetObjectScanResultParams struct {
+	ScanStatus    sql.NullString
+	ScanSignature sql.NullString
+	Consumer      string
+	Bucket        sql.NullString
+	ObjectKey     string
+	WaitingStatus string
+}
+
+func (q *Queries) SetObjectScanResult(ctx context.Context, arg SetObjectScanResultParams) error {
+	_, err := q.db.ExecContext(ctx, setObjectScanResult,
+		arg.ScanStatus,
+		arg.ScanSignature,
+		arg.Consumer,
+		arg.Bucket,
+		arg.ObjectKey,
+		arg.WaitingStatus,
+	)
+	return err
+}
+
+const setObjectStorageClass = `-- name: SetObjectStorageClass :exec
+UPDATE uploaded_file
+SET
+    storage_class = $1,
+    storage_class_updated_at = NOW()
+WHERE consumer = $2
+    and bucket IS NOT DISTINCT FROM $3
+    and object_key = $4
+`
+
+type SetObjectStorageClassParams struct {
+	StorageClass string
+	Consumer     string
+	Bucket       sql.NullString
+	ObjectKey    string
+}
+
+func (q *Queries) SetObjectStorageClass(ctx context.Context, arg SetObjectStorageClassParams) error {
+	_, err := q.db.ExecContext(ctx, setObjectStorageClass,
+		arg.StorageClass,
+		arg.Consumer,
+		arg.Bucket,
+		arg.ObjectKey,
+	)
+	return err
+}
+
+const setUploadedFileDetectedType = `-- name: SetUploadedFileDetectedType :exec
+UPDATE uploaded_file
+SET detected_type = $2, type_mismatch = $3, rendition_status = $4, extraction_status = $5
+WHERE transaction_uuid = $1
+`
+
+type SetUploadedFileDetectedTypeParams struct {
+	TransactionUuid  uuid.UUID
+	DetectedType     sql.NullString
+	TypeMismatch     bool
+	RenditionStatus  sql.NullString
+	ExtractionStatus sql.NullString
+}
+
+func (q *Queries) SetUploadedFileDetectedType(ctx context.Context, arg SetUploadedFileDetectedTypeParams) error {
+	_, err := q.db.ExecContext(ctx, setUploadedFileDetectedType,
+		arg.TransactionUuid,
+		arg.DetectedType,
+		arg.TypeMismatch,
+		arg.RenditionStatus,
+		arg.ExtractionStatus,
+	)
+	return err
+}
+
+const setUploadedFileEnvelope = `-- name: SetUploadedFileEnvelope :one
+UPDATE uploaded_file
+SET
+    envelope_algorithm = $2,
+    envelope_key_id = $3,
+    envelope_wrapped_key = $4,
+    envelope_nonce = $5,
+    envelope_chunk_size = $6,
+    updated_at = NOW()
+WHERE transaction_uuid = $1
+RETURNING transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at
+`
+
+type SetUploadedFileEnvelopeParams struct {
+	TransactionUuid    uuid.UUID
+	EnvelopeAlgorithm  sql.NullString
+	EnvelopeKeyID      sql.NullString
+	EnvelopeWrappedKey []byte
+	EnvelopeNonce      []byte
+	EnvelopeChunkSize  sql.NullInt32
+}
+
+func (q *Queries) SetUploadedFileEnvelope(ctx context.Context, arg SetUploadedFileEnvelopeParams) (UploadedFile, error) {
+	row := q.db.QueryRowContext(ctx, setUploadedFileEnvelope,
+		arg.TransactionUuid,
+		arg.EnvelopeAlgorithm,
+		arg.EnvelopeKeyID,
+		arg.EnvelopeWrappedKey,
+		arg.EnvelopeNonce,
+		arg.EnvelopeChunkSize,
+	)
+	var i UploadedFile
+	err := row.Scan(
+		&i.TransactionUuid,
+		&i.Consumer,
+		&i.UserName,
+		&i.FileName,
+		&i.FileSize,
+		&i.FileType,
+		&i.UploadPresignedUrl,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
+	)
+	return i, err
+}
+
+const setUploadedFileExtractionStatus = `-- name: SetUploadedFileExtractionStatus :exec
+UPDATE uploaded_file
+SET extraction_status = $2
+WHERE transaction_uuid = $1
+`
+
+type SetUploadedFileExtractionStatusParams struct {
+	TransactionUuid  uuid.UUID
+	ExtractionStatus sql.NullString
+}
+
+func (q *Queries) SetUploadedFileExtractionStatus(ctx context.Context, arg SetUploadedFileExtractionStatusParams) error {
+	_, err := q.db.ExecContext(ctx, setUploadedFileExtractionStatus, arg.TransactionUuid, arg.ExtractionStatus)
+	return err
+}
+
+const setUploadedFileLegalHold = `-- name: SetUploadedFileLegalHold :one
+UPDATE uploaded_file
+SET
+    legal_hold = $2,
+    updated_at = NOW()
+WHERE transaction_uuid = $1
+RETURNING transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at
+`
+
+type SetUploadedFileLegalHoldParams struct {
+	TransactionUuid uuid.UUID
+	LegalHold       bool
+}
+
+func (q *Queries) SetUploadedFileLegalHold(ctx context.Context, arg SetUploadedFileLegalHoldParams) (UploadedFile, error) {
+	row := q.db.QueryRowContext(ctx, setUploadedFileLegalHold, arg.TransactionUuid, arg.LegalHold)
+	var i UploadedFile
+	err := row.Scan(
+		&i.TransactionUuid,
+		&i.Consumer,
+		&i.UserName,
+		&i.FileName,
+		&i.FileSize,
+		&i.FileType,
+		&i.UploadPresignedUrl,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
+	)
+	return i, err
+}
+
+const setUploadedFileRenditionStatus = `-- name: SetUploadedFileRenditionStatus :exec
+UPDATE uploaded_file
+SET rendition_status = $2
+WHERE transaction_uuid = $1
+`
+
+type SetUploadedFileRenditionStatusParams struct {
+	TransactionUuid uuid.UUID
+	RenditionStatus sql.NullString
+}
+
+func (q *Queries) SetUploadedFileRenditionStatus(ctx context.Context, arg SetUploadedFileRenditionStatusParams) error {
+	_, err := q.db.ExecContext(ctx, setUploadedFileRenditionStatus, arg.TransactionUuid, arg.RenditionStatus)
+	return err
+}
+
+const setUploadedFileRestore = `-- name: SetUploadedFileRestore :one
+UPDATE uploaded_file
+SET
+    restore_status = $2,
+    restore_tier = $3,
+    restore_requested_at = NOW(),
+    updated_at = NOW()
+WHERE transaction_uuid = $1
+RETURNING transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at
+`
+
+type SetUploadedFileRestoreParams struct {
+	TransactionUuid uuid.UUID
+	RestoreStatus   sql.NullString
+	RestoreTier     sql.NullString
+}
+
+func (q *Queries) SetUploadedFileRestore(ctx context.Context, arg SetUploadedFileRestoreParams) (UploadedFile, error) {
+	row := q.db.QueryRowContext(ctx, setUploadedFileRestore, arg.TransactionUuid, arg.RestoreStatus, arg.RestoreTier)
+	var i UploadedFile
+	err := row.Scan(
+		&i.TransactionUuid,
+		&i.Consumer,
+		&i.UserName,
+		&i.FileName,
+		&i.FileSize,
+		&i.FileType,
+		&i.UploadPresignedUrl,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
+	)
+	return i, err
+}
+
+const setUploadedFileS3Version = `-- name: SetUploadedFileS3Version :exec
+UPDATE uploaded_file
+SET s3_version_id = $2
+WHERE transaction_uuid = $1
+`
+
+type SetUploadedFileS3VersionParams struct {
+	TransactionUuid uuid.UUID
+	S3VersionID     sql.NullString
+}
+
+func (q *Queries) SetUploadedFileS3Version(ctx context.Context, arg SetUploadedFileS3VersionParams) error {
+	_, err := q.db.ExecContext(ctx, setUploadedFileS3Version, arg.TransactionUuid, arg.S3VersionID)
+	return err
+}
+
+const setUploadedFileSanitized = `-- name: SetUploadedFileSanitized :exec
+UPDATE uploaded_file
+SET stripped_metadata = $2, original_object_key = $3, sanitized_at = NOW()
+WHERE transaction_uuid = $1
+`
+
+type SetUploadedFileSanitizedParams struct {
+	TransactionUuid   uuid.UUID
+	StrippedMetadata  []string
+	OriginalObjectKey sql.NullString
+}
+
+func (q *Queries) SetUploadedFileSanitized(ctx context.Context, arg SetUploadedFileSanitizedParams) error {
+	_, err := q.db.ExecContext(ctx, setUploadedFileSanitized, arg.TransactionUuid, pq.Array(arg.StrippedMetadata), arg.OriginalObjectKey)
+	return err
+}
+
 const updateUploadedFile = `-- name: UpdateUploadedFile :one
 UPDATE uploaded_file
 SET
     file_size = $2,
     file_type = $3,
-    download_presigned_url = $4,
-    status = $5,
+    status = $4,
     updated_at = NOW(),
-    download_expiration_time = $6
+    object_key = $5
 WHERE transaction_uuid = $1
-RETURNING transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, download_presigned_url, status, created_at, updated_at, download_expiration_time, upload_expiration_time
+RETURNING transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at
 `
 
 type UpdateUploadedFileParams struct {
-	TransactionUuid        uuid.UUID
-	FileSize               sql.NullInt32
-	FileType               sql.NullString
-	DownloadPresignedUrl   sql.NullString
-	Status                 string
-	DownloadExpirationTime sql.NullTime
+	TransactionUuid uuid.UUID
+	FileSize        sql.NullInt32
+	FileType        sql.NullString
+	Status          string
+	ObjectKey       string
 }
 
 func (q *Queries) UpdateUploadedFile(ctx context.Context, arg UpdateUploadedFileParams) (UploadedFile, error) {
@@ -127,10 +1834,87 @@ func (q *Queries) UpdateUploadedFile(ctx context.Context, arg UpdateUploadedFile
 		arg.TransactionUuid,
 		arg.FileSize,
 		arg.FileType,
-		arg.DownloadPresignedUrl,
 		arg.Status,
-		arg.DownloadExpirationTime,
+		arg.ObjectKey,
+	)
+	var i UploadedFile
+	err := row.Scan(
+		&i.TransactionUuid,
+		&i.Consumer,
+		&i.UserName,
+		&i.FileName,
+		&i.FileSize,
+		&i.FileType,
+		&i.UploadPresignedUrl,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
 	)
+	return i, err
+}
+
+const updateUploadedFileMetadata = `-- name: UpdateUploadedFileMetadata :one
+UPDATE uploaded_file
+SET
+    metadata = $2,
+    tags = $3,
+    updated_at = NOW()
+WHERE transaction_uuid = $1
+RETURNING transaction_uuid, consumer, user_name, file_name, file_size, file_type, upload_presigned_url, status, created_at, updated_at, upload_expiration_time, sha256, sse_mode, sse_kms_key_id, sse_customer_key_md5, envelope_algorithm, envelope_key_id, envelope_wrapped_key, envelope_nonce, envelope_chunk_size, metadata, tags, object_key, bucket, region, storage_class, storage_class_updated_at, last_downloaded_at, restore_status, restore_tier, restore_requested_at, restore_expires_at, retention_mode, retain_until, legal_hold, logical_file_id, version, s3_version_id, scan_status, scan_signature, scanned_at, detected_type, type_mismatch, rendition_status, stripped_metadata, sanitized_at, original_object_key, extraction_status, scan_attempts, scan_attempted_at, rendition_attempts, rendition_attempted_at, extraction_attempts, extraction_attempted_at
+`
+
+type UpdateUploadedFileMetadataParams struct {
+	TransactionUuid uuid.UUID
+	Metadata        json.RawMessage
+	Tags            json.RawMessage
+}
+
+func (q *Queries) UpdateUploadedFileMetadata(ctx context.Context, arg UpdateUploadedFileMetadataParams) (UploadedFile, error) {
+	row := q.db.QueryRowContext(ctx, updateUploadedFileMetadata, arg.TransactionUuid, arg.Metadata, arg.Tags)
 	var i UploadedFile
 	err := row.Scan(
 		&i.TransactionUuid,
@@ -140,12 +1924,53 @@ func (q *Queries) UpdateUploadedFile(ctx context.Context, arg UpdateUploadedFile
 		&i.FileSize,
 		&i.FileType,
 		&i.UploadPresignedUrl,
-		&i.DownloadPresignedUrl,
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.DownloadExpirationTime,
 		&i.UploadExpirationTime,
+		&i.Sha256,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKeyMd5,
+		&i.EnvelopeAlgorithm,
+		&i.EnvelopeKeyID,
+		&i.EnvelopeWrappedKey,
+		&i.EnvelopeNonce,
+		&i.EnvelopeChunkSize,
+		&i.Metadata,
+		&i.Tags,
+		&i.ObjectKey,
+		&i.Bucket,
+		&i.Region,
+		&i.StorageClass,
+		&i.StorageClassUpdatedAt,
+		&i.LastDownloadedAt,
+		&i.RestoreStatus,
+		&i.RestoreTier,
+		&i.RestoreRequestedAt,
+		&i.RestoreExpiresAt,
+		&i.RetentionMode,
+		&i.RetainUntil,
+		&i.LegalHold,
+		&i.LogicalFileID,
+		&i.Version,
+		&i.S3VersionID,
+		&i.ScanStatus,
+		&i.ScanSignature,
+		&i.ScannedAt,
+		&i.DetectedType,
+		&i.TypeMismatch,
+		&i.RenditionStatus,
+		pq.Array(&i.StrippedMetadata),
+		&i.SanitizedAt,
+		&i.OriginalObjectKey,
+		&i.ExtractionStatus,
+		&i.ScanAttempts,
+		&i.ScanAttemptedAt,
+		&i.RenditionAttempts,
+		&i.RenditionAttemptedAt,
+		&i.ExtractionAttempts,
+		&i.ExtractionAttemptedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,155 @@
+// Package keylayout builds S3 object keys from a configurable template.
+//
+// Templates are made of literal text and placeholders:
+//
+//	{consumer}      the authenticated consumer
+//	{user}          the user the file belongs to
+//	{uuid}          the transaction UUID (required, it keeps keys unique)
+//	{yyyy} {mm} {dd} the request date (UTC)
+//	{name}          the file name without its extension
+//	{ext}           the file extension
+//	{sanitizedName} the file name with its extension
+//
+// Every substituted value is sanitized so that it cannot introduce path
+// separators, relative segments or characters that need escaping in URLs.
+package keylayout
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultTemplate = "{consumer}/{yyyy}/{mm}/{uuid}/{sanitizedName}"
+	// S3 keys are limited to 1024 bytes
+	MaxKeyLength = 1024
+	// Default limit for a single sanitized value
+	DefaultMaxSegmentLength = 128
+)
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{[a-zA-Z]+\}`)
+	unsafeChars        = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	literalPattern     = regexp.MustCompile(`^[A-Za-z0-9._/-]*$`)
+)
+
+var placeholders = map[string]bool{
+	"{consumer}":      true,
+	"{user}":          true,
+	"{uuid}":          true,
+	"{yyyy}":          true,
+	"{mm}":            true,
+	"{dd}":            true,
+	"{name}":          true,
+	"{ext}":           true,
+	"{sanitizedName}": true,
+}
+
+// Fields are the values a key can be built from
+type Fields struct {
+	Consumer        string
+	UserName        string
+	TransactionUUID uuid.UUID
+	FileName        string
+	Extension       string
+	Time            time.Time
+}
+
+type Layout struct {
+	template         string
+	maxSegmentLength int
+}
+
+// New validates a template. maxSegmentLength bounds each substituted value,
+// DefaultMaxSegmentLength is used when it is not positive.
+func New(template string, maxSegmentLength int) (*Layout, error) {
+	if template == "" {
+		template = DefaultTemplate
+	}
+	if maxSegmentLength <= 0 {
+		maxSegmentLength = DefaultMaxSegmentLength
+	}
+	if !strings.Contains(template, "{uuid}") {
+		return nil, fmt.Errorf("key template %q must contain {uuid}", template)
+	}
+	if strings.HasPrefix(template, "/") || strings.Contains(template, "//") {
+		return nil, fmt.Errorf("key template %q must not contain empty path segments", template)
+	}
+	for _, p := range placeholderPattern.FindAllString(template, -1) {
+		if !placeholders[p] {
+			return nil, fmt.Errorf("unknown placeholder %s in key template", p)
+		}
+	}
+	literal := placeholderPattern.ReplaceAllString(template, "")
+	if !literalPattern.MatchString(literal) {
+		return nil, fmt.Errorf("key template %q contains unsafe characters", template)
+	}
+	for _, segment := range strings.Split(template, "/") {
+		if segment == "." || segment == ".." {
+			return nil, fmt.Errorf("key template %q must not contain relative segments", template)
+		}
+	}
+	return &Layout{template: template, maxSegmentLength: maxSegmentLength}, nil
+}
+
+// Default returns the layout built from DefaultTemplate
+func Default() *Layout {
+	layout, _ := New(DefaultTemplate, DefaultMaxSegmentLength)
+	return layout
+}
+
+// Key builds the object key for a file
+func (l *Layout) Key(f Fields) (string, error) {
+	t := f.Time.UTC()
+	name := l.sanitize(f.FileName)
+	ext := l.sanitize(strings.TrimPrefix(f.Extension, "."))
+	sanitizedName := name
+	if f.Extension != "" {
+		sanitizedName = name + "." + ext
+	}
+	replacer := strings.NewReplacer(
+		"{consumer}", l.sanitize(f.Consumer),
+		"{user}", l.sanitize(f.UserName),
+		"{uuid}", f.TransactionUUID.String(),
+		"{yyyy}", fmt.Sprintf("%04d", t.Year()),
+		"{mm}", fmt.Sprintf("%02d", int(t.Month())),
+		"{dd}", fmt.Sprintf("%02d", t.Day()),
+		"{name}", name,
+		"{ext}", ext,
+		"{sanitizedName}", sanitizedName,
+	)
+	key := replacer.Replace(l.template)
+	if len(key) > MaxKeyLength {
+		return "", fmt.Errorf("object key is %d bytes, the limit is %d", len(key), MaxKeyLength)
+	}
+	return key, nil
+}
+
+// sanitize maps a value onto a safe single path segment
+func (l *Layout) sanitize(value string) string {
+	return SanitizeSegment(value, l.maxSegmentLength)
+}
+
+// SanitizeSegment replaces every run of characters outside [A-Za-z0-9._-] with a
+// single '_', strips leading dots so that no hidden or relative segment can be
+// produced and truncates the result to maxLength bytes.
+func SanitizeSegment(value string, maxLength int) string {
+	if !utf8.ValidString(value) {
+		value = strings.ToValidUTF8(value, "_")
+	}
+	sanitized := unsafeChars.ReplaceAllString(value, "_")
+	sanitized = strings.TrimLeft(sanitized, ".")
+	if len(sanitized) > maxLength {
+		sanitized = sanitized[:maxLength]
+	}
+	sanitized = strings.TrimRight(sanitized, ".")
+	if sanitized == "" || sanitized == "_" {
+		return "file"
+	}
+	return sanitized
+}
@@ -0,0 +1,77 @@
+package keylayout
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fields = Fields{
+	Consumer:        "acme",
+	UserName:        "jane.doe@example.com",
+	TransactionUUID: uuid.MustParse("550e8400-e29b-41d4-a716-446655440000"),
+	FileName:        "Q1 report_final (v2)",
+	Extension:       "pdf",
+	Time:            time.Date(2024, 3, 9, 23, 0, 0, 0, time.UTC),
+}
+
+func TestDefaultLayout(t *testing.T) {
+	key, err := Default().Key(fields)
+	require.NoError(t, err)
+	assert.Equal(t, "acme/2024/03/550e8400-e29b-41d4-a716-446655440000/Q1_report_final_v2_.pdf", key)
+}
+
+func TestKeyEscaping(t *testing.T) {
+	layout, err := New("{consumer}/{user}/{uuid}/{name}.{ext}", 0)
+	require.NoError(t, err)
+
+	f := fields
+	f.Consumer = "../../etc"
+	f.UserName = "a/b\\c"
+	f.FileName = "..\x00évil?name#"
+	f.Extension = ".tar.gz"
+	key, err := layout.Key(f)
+	require.NoError(t, err)
+	assert.Equal(t, "_.._etc/a_b_c/550e8400-e29b-41d4-a716-446655440000/_vil_name_.tar.gz", key)
+	for _, segment := range strings.Split(key, "/") {
+		assert.NotContains(t, []string{"", ".", ".."}, segment)
+	}
+
+	f.FileName = "..."
+	key, err = layout.Key(f)
+	require.NoError(t, err)
+	assert.Contains(t, key, "/file.tar.gz")
+}
+
+func TestKeyLengthLimits(t *testing.T) {
+	layout, err := New("{uuid}/{sanitizedName}", 16)
+	require.NoError(t, err)
+	f := fields
+	f.FileName = strings.Repeat("a", 500)
+	key, err := layout.Key(f)
+	require.NoError(t, err)
+	assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000/"+strings.Repeat("a", 16)+".pdf", key)
+
+	layout, err = New(strings.Repeat("{name}/", 10)+"{uuid}", 128)
+	require.NoError(t, err)
+	_, err = layout.Key(f)
+	assert.Error(t, err)
+}
+
+func TestInvalidTemplates(t *testing.T) {
+	for _, template := range []string{
+		"{consumer}/{sanitizedName}",
+		"{consumer}/{uuid}/{unknown}",
+		"/{uuid}",
+		"{consumer}//{uuid}",
+		"{consumer}/../{uuid}",
+		"{consumer} {uuid}",
+	} {
+		_, err := New(template, 0)
+		assert.Error(t, err, template)
+	}
+}
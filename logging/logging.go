@@ -0,0 +1,80 @@
+// Package logging builds the service's JSON slog logger and carries request-scoped
+// loggers through contexts.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+)
+
+// ContextKey is where gin contexts keep the request logger, gin resolves string keys
+// with c.Get
+const ContextKey = "logger"
+
+// TransactionKey is where handlers of requests creating a transaction record its UUID
+// for the request log
+const TransactionKey = "transactionUuid"
+
+type contextKey struct{}
+
+// signatureParam matches the query parameters that make a presigned S3 or signed
+// CloudFront URL usable by whoever reads it
+var signatureParam = regexp.MustCompile(`(?i)\b(X-Amz-Signature|X-Amz-Credential|X-Amz-Security-Token|Signature|Policy)=[^&\s"']+`)
+
+// Redact blanks out the signatures of presigned and signed URLs found in s
+func Redact(s string) string {
+	return signatureParam.ReplaceAllString(s, "${1}=REDACTED")
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			return slog.String(a.Key, Redact(v.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, Redact(v.String()))
+		}
+	}
+	return a
+}
+
+// New logs JSON lines to w, redacting URL signatures from every message and attribute
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}))
+}
+
+// ParseLevel reads debug, info, warn or error, info when empty
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext is the logger of the request ctx belongs to, the default logger outside requests
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(ContextKey).(*slog.Logger); ok {
+			return logger
+		}
+		if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
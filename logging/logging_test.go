@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedact(t *testing.T) {
+	url := "https://bucket.s3.amazonaws.com/key?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=AKIA%2F20260101&X-Amz-Signature=abc123&X-Amz-Expires=60"
+	assert.Equal(t,
+		"https://bucket.s3.amazonaws.com/key?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=REDACTED&X-Amz-Signature=REDACTED&X-Amz-Expires=60",
+		Redact(url))
+	assert.Equal(t,
+		"https://d1.cloudfront.net/key?Expires=1767225600&Signature=REDACTED&Key-Pair-Id=K1",
+		Redact("https://d1.cloudfront.net/key?Expires=1767225600&Signature=s1~g-&Key-Pair-Id=K1"))
+}
+
+func TestNewRedactsAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+	logger.Debug("hidden")
+	logger.Error("error generating download URL",
+		"url", "https://d1.cloudfront.net/key?Policy=eyJ9&Signature=sig",
+		"error", errors.New(`Get "https://bucket.s3.amazonaws.com/key?X-Amz-Signature=sig": EOF`))
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "ERROR", entry["level"])
+	assert.Equal(t, "https://d1.cloudfront.net/key?Policy=REDACTED&Signature=REDACTED", entry["url"])
+	assert.Equal(t, `Get "https://bucket.s3.amazonaws.com/key?X-Amz-Signature=REDACTED": EOF`, entry["error"])
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Same(t, slog.Default(), FromContext(context.Background()))
+	logger := New(&bytes.Buffer{}, slog.LevelInfo)
+	assert.Same(t, logger, FromContext(WithLogger(context.Background(), logger)))
+}
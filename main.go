@@ -1,18 +1,41 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/OliPou/s3are/internal/common"
+	"github.com/OliPou/s3are/clamav"
+	"github.com/OliPou/s3are/cloudfront"
+	"github.com/OliPou/s3are/config"
+	"github.com/OliPou/s3are/contenttype"
+	"github.com/OliPou/s3are/envelope"
+	"github.com/OliPou/s3are/health"
+	"github.com/OliPou/s3are/imagemeta"
 	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/keylayout"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/metrics"
 	"github.com/OliPou/s3are/middleware"
+	"github.com/OliPou/s3are/migrations"
+	"github.com/OliPou/s3are/ratelimit"
 	s3uploadfile "github.com/OliPou/s3are/s3UploadFile"
 	"github.com/OliPou/s3are/s3client"
+	"github.com/OliPou/s3are/textextract"
+	"github.com/OliPou/s3are/thumbnail"
+	"github.com/OliPou/s3are/tracing"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -23,25 +46,66 @@ func main() {
 	// Set Gin to release mode
 	gin.SetMode(gin.ReleaseMode)
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		fmt.Println("Error loading .env file:", err)
-		// Continue execution as .env file might not exist in production
-	}
+	envErr := godotenv.Load()
 
-	// Get PORT from environment variables with default fallback
-	portString := os.Getenv("PORT")
-	if portString == "" {
-		portString = "8080"
+	// Settings come from the config file, overridden by environment variables
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON config file, overridden by environment variables")
+	printConfig := flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [migrate up|down|status|version]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if *printConfig {
+		effective, err := cfg.YAML()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(effective)
+		return
 	}
 
-	var ginRouterGroupName string = os.Getenv("GIN_ROUTER_GROUP_NAME")
+	// JSON logs, the level was validated with the config
+	logLevel, _ := logging.ParseLevel(cfg.Log.Level)
+	logger := logging.New(os.Stdout, logLevel)
+	slog.SetDefault(logger)
+	if envErr != nil {
+		// Continue execution as .env file might not exist in production
+		logger.Info("no .env file loaded", "error", envErr)
+	}
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(cfg, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	dbUrl := os.Getenv("DB_URL")
+	traceExporter, err := tracing.NewExporter(context.Background(), cfg.Tracing.Exporter, os.Stdout)
+	if err != nil {
+		log.Fatal("Failed to create trace exporter:", err)
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), traceExporter)
+	if err != nil {
+		log.Fatal("Failed to set up tracing:", err)
+	}
 
-	if dbUrl == "" {
-		log.Fatal("DB_URL not found in environment variables")
+	// SIGTERM and SIGINT stop the workers and drain the servers
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var workers sync.WaitGroup
+	startWorker := func(worker func(context.Context, *s3uploadfile.ApiConfig, time.Duration), apiCfg *s3uploadfile.ApiConfig, interval time.Duration) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker(ctx, apiCfg, interval)
+		}()
 	}
-	db, err := sql.Open("postgres", dbUrl)
+
+	db, err := sql.Open("postgres", cfg.Database.URL)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -50,54 +114,220 @@ func main() {
 	if err := checkDatabase(db); err != nil {
 		log.Fatal("Database is not ready:", err)
 	}
-	region := os.Getenv("AWS_REGION")
-	bucket := os.Getenv("S3_BUCKET")
-	if region == "" || bucket == "" {
-		log.Fatal("AWS_REGION or S3_BUCKET not found in environment variables")
-	}
-
-	s3Client, err := s3client.NewS3Client(region, bucket)
+	migrator, err := migrations.New(db)
 	if err != nil {
 		log.Fatal(err)
 	}
-	dbQueries := database.New(db)
+	if cfg.Database.AutoMigrate {
+		if err := migrateUp(ctx, migrator); err != nil {
+			log.Fatal("Failed to migrate the database:", err)
+		}
+	}
+	// Queries would fail on missing tables and columns, better not to start at all
+	if err := migrator.Check(ctx); err != nil {
+		log.Fatal(err)
+	}
+	// Consumers are routed to their own buckets when a routing file is given,
+	// otherwise every file goes to the configured bucket
+	var s3Router *s3client.Router
+	var s3Client s3client.S3ClientInterface
+	// Every bucket the service may store in, checked for readiness
+	var bucketClients []*s3client.S3Client
+	if cfg.S3.RoutingFile != "" {
+		routingConfig, err := s3client.LoadRoutingConfig(cfg.S3.RoutingFile)
+		if err != nil {
+			log.Fatal("Failed to load S3 routing config:", err)
+		}
+		s3Router, err = s3client.NewRouter(routingConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Files recorded before routing was enabled live in the default bucket
+		s3Client, err = s3Router.Client(routingConfig.Default.Location)
+		if err != nil {
+			log.Fatal(err)
+		}
+		bucketClients, err = s3Router.Clients()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		bucketClient, err := s3client.NewS3Client(cfg.S3.Region, cfg.S3.Bucket)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s3Client = bucketClient
+		bucketClients = []*s3client.S3Client{bucketClient}
+	}
+
+	checker := health.NewChecker(cfg.Health.Timeout)
+	checker.Add("postgres", 0, db.PingContext)
+	for _, client := range bucketClients {
+		checker.Add("s3:"+client.Bucket, cfg.Health.BucketCheckTTL, client.HeadBucket)
+	}
+	metrics.RegisterDBStats(db)
+	dbQueries := database.New(tracing.DB{DBTX: metrics.DB{DBTX: db}})
+
+	// Per-consumer server-side encryption, objects are left unencrypted by the service when unset
+	var encryptionPolicies s3client.EncryptionPolicies
+	if cfg.S3.EncryptionFile != "" {
+		encryptionPolicies, err = s3client.LoadEncryptionPolicies(cfg.S3.EncryptionFile)
+		if err != nil {
+			log.Fatal("Failed to load encryption policies:", err)
+		}
+	}
 
 	apiCfg := &s3uploadfile.ApiConfig{
-		DB:       dbQueries,
-		S3Client: s3Client,
+		DB:         dbQueries,
+		S3Client:   s3Client,
+		Encryption: encryptionPolicies,
+	}
+	if s3Router != nil {
+		apiCfg.Router = s3Router
+	}
+
+	// Everything is stored as STANDARD and never transitioned when unset
+	if cfg.S3.StorageClassFile != "" {
+		apiCfg.StorageClasses, err = s3client.LoadStorageClassPolicies(cfg.S3.StorageClassFile)
+		if err != nil {
+			log.Fatal("Failed to load storage class policies:", err)
+		}
+	}
+	// Object Lock retention for records-management consumers, the bucket must have Object Lock enabled
+	if cfg.S3.RetentionFile != "" {
+		apiCfg.Retention, err = s3client.LoadRetentionPolicies(cfg.S3.RetentionFile)
+		if err != nil {
+			log.Fatal("Failed to load retention policies:", err)
+		}
+	}
+	// Uploads of any type are accepted when unset, the detected type is recorded either way
+	if cfg.Uploads.ContentTypeFile != "" {
+		apiCfg.ContentTypes, err = contenttype.LoadPolicies(cfg.Uploads.ContentTypeFile)
+		if err != nil {
+			log.Fatal("Failed to load content type policies:", err)
+		}
+	}
+	// Record S3 version IDs of uploads when the buckets have versioning enabled
+	apiCfg.BucketVersioning = cfg.S3.BucketVersioning
+
+	// Text of documents is indexed for search with the consumer's language, "simple" by default
+	if cfg.Search.LanguageFile != "" {
+		apiCfg.SearchLanguages, err = textextract.LoadLanguages(cfg.Search.LanguageFile)
+		if err != nil {
+			log.Fatal("Failed to load search languages:", err)
+		}
+	}
+
+	// Object keys default to keylayout.DefaultTemplate
+	if cfg.Uploads.ObjectKeyTemplate != "" {
+		keyLayout, err := keylayout.New(cfg.Uploads.ObjectKeyTemplate, 0)
+		if err != nil {
+			log.Fatal("Invalid object key template:", err)
+		}
+		apiCfg.KeyLayout = keyLayout
+	}
+
+	// Consumers listed in the keyfile get client-side envelope encryption
+	if cfg.Uploads.EnvelopeKeyfile != "" {
+		keyProvider, err := envelope.LoadLocalKeyProvider(cfg.Uploads.EnvelopeKeyfile)
+		if err != nil {
+			log.Fatal("Failed to load envelope keyfile:", err)
+		}
+		apiCfg.KeyProvider = keyProvider
 	}
 
-	fmt.Printf("Server starting on port: %s\n", portString)
+	// New uploads are withheld until clamd scanned them clean, infected ones are quarantined
+	if cfg.Scan.ClamdAddress != "" {
+		scanner, err := clamav.New(cfg.Scan.ClamdAddress)
+		if err != nil {
+			log.Fatal("Invalid clamd address:", err)
+		}
+		if err := scanner.Ping(context.Background()); err != nil {
+			log.Fatal("Can't reach clamd:", err)
+		}
+		apiCfg.Scanner = scanner
+		apiCfg.QuarantinePrefix = cfg.Scan.QuarantinePrefix
+	}
 
-	// Initialize the router
-	router := gin.Default()
+	// Consumers opted into EXIF, GPS and XMP stripping of their JPEG and PNG uploads
+	if cfg.Uploads.MetadataStrippingFile != "" {
+		apiCfg.MetadataStripping, err = imagemeta.LoadPolicies(cfg.Uploads.MetadataStrippingFile)
+		if err != nil {
+			log.Fatal("Failed to load metadata stripping policies:", err)
+		}
+	}
+
+	// Consumers whose downloads are signed for a CloudFront distribution instead of presigned on S3
+	if cfg.CloudFront.DistributionsFile != "" {
+		apiCfg.CloudFront, err = cloudfront.LoadDistributions(cfg.CloudFront.DistributionsFile)
+		if err != nil {
+			log.Fatal("Failed to load CloudFront distributions:", err)
+		}
+	}
+
+	// Thumbnails of JPEG, PNG and GIF uploads
+	if len(cfg.Thumbnails.Sizes) > 0 {
+		apiCfg.ThumbnailSizes, err = thumbnail.ParseSizes(strings.Join(cfg.Thumbnails.Sizes, ","))
+		if err != nil {
+			log.Fatal("Invalid thumbnail sizes:", err)
+		}
+	}
+
+	// Initialize the router, requests are logged by RequestLogger rather than gin
+	router := gin.New()
+	// Client IPs gate share links and key rate limits, X-Forwarded-For is only believed
+	// from the configured proxies
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("Invalid trusted proxies:", err)
+	}
+	// Services get the request's span through the gin context they are given
+	router.ContextWithFallback = true
+	router.Use(gin.Recovery(), middleware.Tracing(), middleware.RequestLogger(logger), middleware.Metrics())
 
 	// Configure CORS
-	config := cors.DefaultConfig()
+	corsConfig := cors.DefaultConfig()
 
-	// Get allowed origins from environment variable or use default
-	allowedOrigins := os.Getenv("ALLOWED_ORIGINS")
-	if allowedOrigins == "" {
+	if len(cfg.Server.AllowedOrigins) == 0 {
 		// For development, you might want to allow all origins
-		config.AllowAllOrigins = true
+		corsConfig.AllowAllOrigins = true
 	} else {
-		config.AllowOrigins = []string{allowedOrigins}
+		corsConfig.AllowOrigins = cfg.Server.AllowedOrigins
 	}
 
 	// Additional CORS configurations
-	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{
 		"Origin",
 		"Content-Length",
 		"Content-Type",
 		"Authorization",
+		middleware.RequestIDHeader,
 	}
-	config.AllowCredentials = true
-	config.ExposeHeaders = []string{"Content-Length"}
-	config.MaxAge = 12 * 60 * 60 // 12 hours
+	corsConfig.AllowCredentials = true
+	corsConfig.ExposeHeaders = []string{"Content-Length", middleware.RequestIDHeader}
+	corsConfig.MaxAge = 12 * 60 * 60 // 12 hours
 
 	// Add CORS middleware
-	router.Use(cors.New(config))
+	router.Use(cors.New(corsConfig))
+
+	// Metrics go to their own admin port when one is configured, keeping them off the
+	// port exposed to consumers
+	servers := []*http.Server{{
+		Addr:              ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:           router,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+	}}
+	if cfg.Metrics.Port != 0 {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/metrics", metrics.Handler())
+		servers = append(servers, &http.Server{
+			Addr:              ":" + strconv.Itoa(cfg.Metrics.Port),
+			Handler:           adminMux,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		})
+	} else {
+		router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	}
 
 	// Define routes
 	// router.GET("/ping", func(c *gin.Context) {
@@ -106,17 +336,111 @@ func main() {
 	// 	})
 	// })
 
-	v1Router := router.Group(fmt.Sprintf("/%s", ginRouterGroupName))
-	v1Router.GET("/healthz", handlerHealthz)
+	// Probes stay out of the rate limited group, a throttled probe restarts healthy pods
+	probeRouter := router.Group(fmt.Sprintf("/%s", cfg.Server.RouterGroup))
+	probeRouter.GET("/healthz", health.HandlerLiveness)
+	probeRouter.GET("/readyz", checker.HandlerReadiness)
+
+	v1Router := router.Group(fmt.Sprintf("/%s", cfg.Server.RouterGroup))
+	// Token bucket limits per consumer, user and client IP, e.g. on POST /upload-file-request
+	if cfg.RateLimit.RulesFile != "" {
+		rateLimits, err := ratelimit.LoadRules(cfg.RateLimit.RulesFile)
+		if err != nil {
+			log.Fatal("Failed to load rate limits:", err)
+		}
+		var limiter ratelimit.Limiter
+		switch cfg.RateLimit.Store {
+		case "memory":
+			limiter = ratelimit.NewMemoryLimiter()
+		case "postgres":
+			postgresLimiter := ratelimit.PostgresLimiter{Store: dbQueries}
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				postgresLimiter.StartPruner(ctx, 10*time.Minute, rateLimits.MaxRefill())
+			}()
+			limiter = postgresLimiter
+		}
+		v1Router.Use(middleware.RateLimit(limiter, rateLimits, v1Router.BasePath()))
+	}
 	v1Router.POST("/upload-file-request", middleware.Auth(apiCfg.HandlerRequestUpload))
 	v1Router.PUT("/file-uploaded", middleware.Auth(apiCfg.HandlerRequestUploadCompleted))
 	v1Router.GET("/file-status", middleware.Auth(apiCfg.HandlerFileStatus))
+	v1Router.DELETE("/file", middleware.Auth(apiCfg.HandlerDeleteFile))
+	v1Router.PUT("/file-content", middleware.Auth(apiCfg.HandlerUploadFileContent))
+	v1Router.GET("/file-content", middleware.Auth(apiCfg.HandlerDownloadFileContent))
+	v1Router.PATCH("/file-metadata", middleware.Auth(apiCfg.HandlerUpdateFileMetadata))
+	v1Router.GET("/files", middleware.Auth(apiCfg.HandlerListFiles))
+	v1Router.GET("/file-search", middleware.Auth(apiCfg.HandlerSearchFiles))
+	v1Router.GET("/file-rendition-cookies", middleware.Auth(apiCfg.HandlerRenditionCookies))
+	v1Router.POST("/share-links", middleware.Auth(apiCfg.HandlerCreateShareLink))
+	v1Router.GET("/share-links", middleware.Auth(apiCfg.HandlerListShareLinks))
+	v1Router.DELETE("/share-link", middleware.Auth(apiCfg.HandlerRevokeShareLink))
+	// Redeemed by recipients outside the system, the token is the credential
+	v1Router.GET("/share/:token", apiCfg.HandlerRedeemShareLink)
+	v1Router.POST("/download-tokens", middleware.Auth(apiCfg.HandlerCreateDownloadToken))
+	v1Router.DELETE("/download-tokens", middleware.Auth(apiCfg.HandlerRevokeDownloadTokens))
+	v1Router.GET("/download/:token", apiCfg.HandlerRedeemDownloadToken)
+	v1Router.POST("/file-restore", middleware.Auth(apiCfg.HandlerRequestRestore))
+	v1Router.PUT("/file-legal-hold", middleware.Auth(apiCfg.HandlerSetLegalHold))
+	v1Router.GET("/file-versions", middleware.Auth(apiCfg.HandlerListFileVersions))
+	v1Router.GET("/file-version", middleware.Auth(apiCfg.HandlerGetFileVersion))
+
+	// Workers only start once apiCfg is complete, they read it concurrently with the handlers
+	if _, ok := apiCfg.StorageClasses.MinTransitionAge(); ok {
+		startWorker(s3uploadfile.StartStorageTransitionWorker, apiCfg, cfg.S3.TransitionInterval)
+	}
+	// Restores of archived files are polled until S3 reports the temporary copy available
+	startWorker(s3uploadfile.StartRestoreWorker, apiCfg, cfg.S3.RestoreCheckInterval)
+	// Text of documents is indexed for search
+	startWorker(s3uploadfile.StartExtractionWorker, apiCfg, cfg.Search.ExtractionInterval)
+	if apiCfg.Scanner != nil {
+		startWorker(s3uploadfile.StartScanWorker, apiCfg, cfg.Scan.Interval)
+	}
+	if len(apiCfg.ThumbnailSizes) > 0 {
+		startWorker(s3uploadfile.StartRenditionWorker, apiCfg, cfg.Thumbnails.Interval)
+	}
 
-	// Start the server
-	if err := router.Run(":" + portString); err != nil {
-		fmt.Printf("Failed to start server: %v\n", err)
-		os.Exit(1)
+	// Start the servers
+	for _, server := range servers {
+		go func() {
+			logger.Info("server starting", "addr", server.Addr)
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("failed to start server", "addr", server.Addr, "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	stop()
+	logger.Info("shutting down", "timeout", cfg.Server.ShutdownTimeout.String())
+	checker.Drain()
+	time.Sleep(cfg.Server.DrainDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error("error draining server", "addr", server.Addr, "error", err)
+		}
+	}
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		logger.Error("background workers did not stop in time")
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("error flushing traces", "error", err)
 	}
+	if err := db.Close(); err != nil {
+		logger.Error("error closing database", "error", err)
+	}
+	logger.Info("server stopped")
 }
 
 // checkDatabase tries to ping the database until it succeeds or times out
@@ -126,19 +450,56 @@ func checkDatabase(db *sql.DB) error {
 		if err == nil {
 			return nil
 		}
-		fmt.Println("Waiting for database to be ready...")
+		slog.Info("waiting for database to be ready", "error", err)
 		time.Sleep(2 * time.Second)
 	}
 	return fmt.Errorf("database is not ready")
 }
 
-func handlerHealthz(c *gin.Context) {
-	status := struct {
-		Status string `json:"status"`
-		Ready  bool   `json:"ready"`
-	}{
-		Status: "ok",
-		Ready:  true,
+// runMigrate runs the migrate subcommand: up, down, status or version
+func runMigrate(cfg config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: migrate up|down|status|version")
+	}
+	ctx := context.Background()
+	db, err := sql.Open("postgres", cfg.Database.URL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx, migrator)
+	case "down":
+		result, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info("rolled back migration", "version", result.Source.Version, "duration_ms", result.Duration.Milliseconds())
+		return nil
+	case "status":
+		return migrator.PrintStatus(ctx, os.Stdout)
+	case "version":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version %d, expected %d\n", version, migrator.Expected())
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q, use up, down, status or version", args[0])
+	}
+}
+
+// migrateUp applies the pending migrations, waiting for other replicas migrating at the same time
+func migrateUp(ctx context.Context, migrator *migrations.Migrator) error {
+	results, err := migrator.Up(ctx)
+	for _, result := range results {
+		slog.Info("applied migration", "version", result.Source.Version, "duration_ms", result.Duration.Milliseconds())
 	}
-	common.RespondWithJSON(c, http.StatusOK, status)
+	return err
 }
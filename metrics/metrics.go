@@ -0,0 +1,161 @@
+// Package metrics holds the service's Prometheus collectors and the /metrics handler
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "s3are"
+
+// Registry gathers the service's collectors, with Go runtime and process metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method, matched route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	UploadRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_requests_total",
+		Help:      "Upload requests by consumer.",
+	}, []string{"consumer"})
+	UploadCompletions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_completions_total",
+		Help:      "Uploads completed by consumer.",
+	}, []string{"consumer"})
+	UploadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_failures_total",
+		Help:      "Upload requests and completions that failed, by consumer and stage.",
+	}, []string{"consumer", "stage"})
+	PresignDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "presign_duration_seconds",
+		Help:      "Time spent presigning or signing URLs, by operation.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	}, []string{"operation"})
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of database queries by sqlc query name.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query"})
+	WorkerLastRun = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_last_run_timestamp_seconds",
+		Help:      "Unix time the background worker last finished a run.",
+	}, []string{"worker"})
+	WorkerLastRunDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_last_run_duration_seconds",
+		Help:      "How long the last run of the background worker took.",
+	}, []string{"worker"})
+	WorkerLastRunItems = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_last_run_items",
+		Help:      "Items the last run of the background worker processed.",
+	}, []string{"worker"})
+	WorkerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_errors_total",
+		Help:      "Background worker runs that failed.",
+	}, []string{"worker"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestDuration,
+		UploadRequests,
+		UploadCompletions,
+		UploadFailures,
+		PresignDuration,
+		DBQueryDuration,
+		WorkerLastRun,
+		WorkerLastRunDuration,
+		WorkerLastRunItems,
+		WorkerErrors,
+	)
+}
+
+// Handler serves the metrics of Registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDBStats exposes the connection pool statistics of db
+func RegisterDBStats(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// ObserveUploadRequest counts an upload request of consumer, failed when err is set
+func ObserveUploadRequest(consumer string, err error) {
+	UploadRequests.WithLabelValues(consumer).Inc()
+	if err != nil {
+		UploadFailures.WithLabelValues(consumer, "request").Inc()
+	}
+}
+
+// ObserveUploadCompletion counts an upload of consumer completing, failed when err is set
+func ObserveUploadCompletion(consumer string, err error) {
+	if err != nil {
+		UploadFailures.WithLabelValues(consumer, "completion").Inc()
+		return
+	}
+	UploadCompletions.WithLabelValues(consumer).Inc()
+}
+
+// ObservePresign records the time since start spent signing a URL for operation
+func ObservePresign(operation string, start time.Time) {
+	PresignDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// ObserveWorkerRun records a run of worker started at start that processed items
+func ObserveWorkerRun(worker string, start time.Time, items int, err error) {
+	if err != nil {
+		WorkerErrors.WithLabelValues(worker).Inc()
+		return
+	}
+	now := time.Now()
+	WorkerLastRun.WithLabelValues(worker).Set(float64(now.Unix()))
+	WorkerLastRunDuration.WithLabelValues(worker).Set(now.Sub(start).Seconds())
+	WorkerLastRunItems.WithLabelValues(worker).Set(float64(items))
+}
+
+// DB times the queries run through a sqlc DBTX
+type DB struct {
+	database.DBTX
+}
+
+func observeQuery(query string, start time.Time) {
+	DBQueryDuration.WithLabelValues(database.QueryName(query)).Observe(time.Since(start).Seconds())
+}
+
+func (db DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(query, time.Now())
+	return db.DBTX.ExecContext(ctx, query, args...)
+}
+
+func (db DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer observeQuery(query, time.Now())
+	return db.DBTX.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext only times the query up to its first row, sql.Row scans lazily
+func (db DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer observeQuery(query, time.Now())
+	return db.DBTX.QueryRowContext(ctx, query, args...)
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDBTX struct{}
+
+func (fakeDBTX) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (fakeDBTX) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, nil
+}
+
+func (fakeDBTX) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+
+func (fakeDBTX) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestDBObservesQueriesByName(t *testing.T) {
+	db := DB{DBTX: fakeDBTX{}}
+	_, _ = db.ExecContext(context.Background(), "-- name: DeleteUploadedFile :exec\nDELETE FROM uploaded_file WHERE id = $1")
+	_, _ = db.QueryContext(context.Background(), "SELECT 1")
+
+	assert.Equal(t, uint64(1), histogramCount(t, "DeleteUploadedFile"))
+	assert.Equal(t, uint64(1), histogramCount(t, "other"))
+}
+
+func histogramCount(t *testing.T, query string) uint64 {
+	t.Helper()
+	families, err := Registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "s3are_db_query_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if m.GetLabel()[0].GetValue() == query {
+				return m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return 0
+}
+
+func TestObserveUploads(t *testing.T) {
+	ObserveUploadRequest("c1", nil)
+	ObserveUploadRequest("c1", errors.New("boom"))
+	ObserveUploadCompletion("c1", nil)
+	ObserveUploadCompletion("c1", errors.New("boom"))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(UploadRequests.WithLabelValues("c1")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(UploadCompletions.WithLabelValues("c1")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(UploadFailures.WithLabelValues("c1", "request")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(UploadFailures.WithLabelValues("c1", "completion")))
+}
+
+func TestObserveWorkerRun(t *testing.T) {
+	ObserveWorkerRun("scan", time.Now().Add(-time.Second), 3, nil)
+	ObserveWorkerRun("scan", time.Now(), 0, errors.New("boom"))
+
+	// Failed runs keep the gauges of the last successful one
+	assert.Equal(t, 3.0, testutil.ToFloat64(WorkerLastRunItems.WithLabelValues("scan")))
+	assert.GreaterOrEqual(t, testutil.ToFloat64(WorkerLastRunDuration.WithLabelValues("scan")), 1.0)
+	assert.Equal(t, 1.0, testutil.ToFloat64(WorkerErrors.WithLabelValues("scan")))
+}
+
+func TestHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), "go_goroutines"))
+}
@@ -0,0 +1,26 @@
+// middleware/metrics.go
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/OliPou/s3are/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics records the latency of each request by its matched route, unmatched paths are
+// grouped so scanners cannot blow up the series count
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
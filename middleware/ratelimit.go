@@ -0,0 +1,118 @@
+// middleware/ratelimit.go
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OliPou/s3are/auth"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// JSON bodies are only peeked at this far for the userName of the request
+const maxUserNamePeek = 64 << 10
+
+type rateLimitCheck struct {
+	rate *ratelimit.Rate
+	key  string
+}
+
+// RateLimit enforces the rules of each route of the group at basePath. Requests go
+// through when the limiter fails, an unavailable store must not take the API down.
+func RateLimit(limiter ratelimit.Limiter, rules ratelimit.Rules, basePath string) gin.HandlerFunc {
+	basePath = strings.TrimSuffix(basePath, "/")
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + strings.TrimPrefix(c.FullPath(), basePath)
+		rule := rules.For(route)
+		var checks []rateLimitCheck
+		consumer, consumerErr := auth.GetConsumer(c.Request.Header)
+		if rule.Consumer != nil && consumerErr == nil {
+			checks = append(checks, rateLimitCheck{rule.Consumer, route + "|consumer|" + consumer})
+		}
+		if rule.User != nil && consumerErr == nil {
+			if userName := requestUserName(c); userName != "" {
+				checks = append(checks, rateLimitCheck{rule.User, route + "|user|" + consumer + "|" + userName})
+			}
+		}
+		if rule.IP != nil {
+			// ClientIP only follows X-Forwarded-For from the engine's trusted proxies,
+			// otherwise a client would get a fresh bucket with every header it makes up
+			checks = append(checks, rateLimitCheck{rule.IP, route + "|ip|" + c.ClientIP()})
+		}
+
+		var tightest *ratelimit.Result
+		for _, check := range checks {
+			result, err := limiter.Take(c, check.key, *check.rate)
+			if err != nil {
+				logging.FromContext(c).Error("error checking rate limit", "error", err)
+				continue
+			}
+			if tightest == nil || tighter(result, *tightest) {
+				tightest = &result
+			}
+		}
+		if tightest == nil {
+			c.Next()
+			return
+		}
+		c.Header("RateLimit-Limit", strconv.Itoa(tightest.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(seconds(tightest.Reset)))
+		if !tightest.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Max(1, float64(seconds(tightest.RetryAfter))))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// tighter reports whether a is the limit the client should be told about rather than b
+func tighter(a ratelimit.Result, b ratelimit.Result) bool {
+	if a.Allowed != b.Allowed {
+		return !a.Allowed
+	}
+	if !a.Allowed {
+		return a.RetryAfter > b.RetryAfter
+	}
+	return a.Remaining < b.Remaining
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// requestUserName finds the userName of a request in its query or JSON body, leaving the
+// body intact for the handler
+func requestUserName(c *gin.Context) string {
+	if userName := c.Query("userName"); userName != "" {
+		return userName
+	}
+	if c.Request.Body == nil || !strings.HasPrefix(c.ContentType(), "application/json") {
+		return ""
+	}
+	body := c.Request.Body
+	peeked, err := io.ReadAll(io.LimitReader(body, maxUserNamePeek))
+	c.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peeked), body), body}
+	if err != nil {
+		return ""
+	}
+	var params struct {
+		UserName string `json:"userName"`
+	}
+	if json.Unmarshal(peeked, &params) != nil {
+		return ""
+	}
+	return params.UserName
+}
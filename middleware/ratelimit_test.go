@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OliPou/s3are/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitPerUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	perUser := ratelimit.NewRate(1, time.Minute, 1)
+	rules := ratelimit.Rules{Routes: map[string]ratelimit.Rule{
+		"POST /upload-file-request": {User: &perUser},
+	}}
+	router := gin.New()
+	v1Router := router.Group("/v1")
+	v1Router.Use(RateLimit(ratelimit.NewMemoryLimiter(), rules, v1Router.BasePath()))
+	var bodies []string
+	v1Router.POST("/upload-file-request", Auth(func(c *gin.Context, consumer string) {
+		var params struct {
+			UserName string `json:"userName"`
+		}
+		_ = c.ShouldBindJSON(&params)
+		bodies = append(bodies, params.UserName)
+		c.Status(http.StatusCreated)
+	}))
+	request := func(userName string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/upload-file-request", strings.NewReader(`{"userName":"`+userName+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-consumer-username", "consumer")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("alice")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = request("alice")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusCreated, request("bob").Code)
+	// The handler still reads the body the middleware peeked at
+	assert.Equal(t, []string{"alice", "bob"}, bodies)
+}
+
+func TestRateLimitPerIPIgnoresUntrustedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	perIP := ratelimit.NewRate(2, time.Minute, 2)
+	rules := ratelimit.Rules{Routes: map[string]ratelimit.Rule{
+		"GET /share/:token": {IP: &perIP},
+	}}
+	router := gin.New()
+	assert.NoError(t, router.SetTrustedProxies(nil))
+	v1Router := router.Group("/v1")
+	v1Router.Use(RateLimit(ratelimit.NewMemoryLimiter(), rules, v1Router.BasePath()))
+	v1Router.GET("/share/:token", func(c *gin.Context) {
+		c.Status(http.StatusFound)
+	})
+	request := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/share/token", nil)
+		req.RemoteAddr = "192.0.2.1:4711"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusFound, request("203.0.113.1"))
+	assert.Equal(t, http.StatusFound, request("203.0.113.2"))
+	// A new made up address is still the same peer
+	assert.Equal(t, http.StatusTooManyRequests, request("203.0.113.3"))
+}
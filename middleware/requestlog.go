@@ -0,0 +1,70 @@
+// middleware/requestlog.go
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/OliPou/s3are/auth"
+	"github.com/OliPou/s3are/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// Caller supplied request IDs are kept when they are safe to log and echo back
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestLogger gives each request an ID, taken from X-Request-ID when the caller sent
+// one, and a logger carrying it that handlers and services get with logging.FromContext.
+// Each request is logged once completed.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		attrs := []any{"request_id", requestID}
+		// Ties the logs of the request to its trace when Tracing runs first
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.IsValid() {
+			attrs = append(attrs, "trace_id", spanContext.TraceID().String())
+		}
+		if consumer, err := auth.GetConsumer(c.Request.Header); err == nil {
+			attrs = append(attrs, "consumer", consumer)
+		}
+		transactionUuid := c.Query("transactionUuid")
+		if transactionUuid != "" {
+			attrs = append(attrs, "transaction_uuid", transactionUuid)
+		}
+		requestLogger := logger.With(attrs...)
+		c.Set(logging.ContextKey, requestLogger)
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), requestLogger))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		// The matched route rather than the path, paths of redemption endpoints carry tokens
+		completed := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Int64("latency_ms", time.Since(start).Milliseconds()),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if created := c.GetString(logging.TransactionKey); created != "" && transactionUuid == "" {
+			completed = append(completed, slog.String("transaction_uuid", created))
+		}
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		requestLogger.LogAttrs(c.Request.Context(), level, "request completed", completed...)
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OliPou/s3are/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	router := gin.New()
+	router.Use(RequestLogger(logging.New(&buf, slog.LevelInfo)))
+	router.GET("/v1/download/:token", func(c *gin.Context) {
+		logging.FromContext(c.Request.Context()).Info("redeeming token")
+		c.Status(http.StatusFound)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/download/secret?transactionUuid=00000000-0000-0000-0000-000000000001", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	req.Header.Set("x-consumer-username", "consumer")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "req-1", w.Header().Get(RequestIDHeader))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var service, completed map[string]any
+	require.NoError(t, json.Unmarshal(lines[0], &service))
+	require.NoError(t, json.Unmarshal(lines[1], &completed))
+	assert.Equal(t, "req-1", service["request_id"])
+	assert.Equal(t, "consumer", service["consumer"])
+	assert.Equal(t, "/v1/download/:token", completed["route"])
+	assert.Equal(t, float64(http.StatusFound), completed["status"])
+	assert.Equal(t, "00000000-0000-0000-0000-000000000001", completed["transaction_uuid"])
+	assert.Contains(t, completed, "latency_ms")
+
+	// IDs unsafe to echo are replaced
+	req = httptest.NewRequest(http.MethodGet, "/v1/download/secret", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Len(t, w.Header().Get(RequestIDHeader), 36)
+}
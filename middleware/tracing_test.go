@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OliPou/s3are/s3client"
+	"github.com/OliPou/s3are/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type deletingS3Client struct {
+	s3client.S3ClientInterface
+}
+
+func (deletingS3Client) DeleteObject(key string) error {
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := tracing.InMemory()
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(Tracing())
+	router.DELETE("/v1/file", func(c *gin.Context) {
+		_ = s3client.WithTracing(c, deletingS3Client{}).DeleteObject("consumer/file.pdf")
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodDelete, "/v1/file", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	s3Span, serverSpan := spans[0], spans[1]
+	assert.Equal(t, "S3.DeleteObject", s3Span.Name)
+	assert.Equal(t, serverSpan.SpanContext.SpanID(), s3Span.Parent.SpanID())
+	assert.Equal(t, "DELETE /v1/file", serverSpan.Name)
+	assert.Equal(t, trace.SpanKindServer, serverSpan.SpanKind)
+	// The caller's trace is continued
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", serverSpan.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", serverSpan.Parent.SpanID().String())
+}
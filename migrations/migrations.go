@@ -0,0 +1,95 @@
+// Package migrations applies the schema migrations embedded in the binary, recording them
+// in goose's version table so databases migrated with the goose CLI carry on
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/OliPou/s3are/sql/schema"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// ErrOutdated is returned by Check when the database misses migrations the code relies on
+var ErrOutdated = errors.New("database schema is older than this version of s3are expects")
+
+// Migrator runs the embedded migrations against a Postgres database. Up and Down hold a
+// Postgres advisory lock, replicas migrating on startup wait for each other.
+type Migrator struct {
+	provider *goose.Provider
+}
+
+func New(db *sql.DB) (*Migrator, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, schema.FS,
+		goose.WithSessionLocker(locker),
+		goose.WithDisableGlobalRegistry(true))
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded migrations: %w", err)
+	}
+	return &Migrator{provider: provider}, nil
+}
+
+// Expected is the version of the latest embedded migration, the schema the code is built for
+func (m *Migrator) Expected() int64 {
+	sources := m.provider.ListSources()
+	if len(sources) == 0 {
+		return 0
+	}
+	return sources[len(sources)-1].Version
+}
+
+// Version is the version of the last migration applied to the database, 0 on an empty one
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	return m.provider.GetDBVersion(ctx)
+}
+
+// Up applies every pending migration, in order
+func (m *Migrator) Up(ctx context.Context) ([]*goose.MigrationResult, error) {
+	return m.provider.Up(ctx)
+}
+
+// Down rolls the last applied migration back
+func (m *Migrator) Down(ctx context.Context) (*goose.MigrationResult, error) {
+	return m.provider.Down(ctx)
+}
+
+// Check fails with ErrOutdated while migrations are pending. A database ahead of the code
+// is accepted, for a deployment to be rolled back without rolling the schema back.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version < m.Expected() {
+		return fmt.Errorf("%w: at version %d, expected %d, apply them with migrate up", ErrOutdated, version, m.Expected())
+	}
+	return nil
+}
+
+// PrintStatus writes every embedded migration with when it was applied
+func (m *Migrator) PrintStatus(ctx context.Context, w io.Writer) error {
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "VERSION\tSTATE\tAPPLIED AT\tMIGRATION")
+	for _, status := range statuses {
+		appliedAt := ""
+		if status.State == goose.StateApplied {
+			appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\n", status.Source.Version, status.State, appliedAt, status.Source.Path)
+	}
+	return table.Flush()
+}
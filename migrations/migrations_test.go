@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"database/sql"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/OliPou/s3are/sql/schema"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	// Opening does not connect, the provider only reads the embedded files
+	db, err := sql.Open("postgres", "postgres://localhost/s3are?sslmode=disable")
+	require.NoError(t, err)
+	defer db.Close()
+	migrator, err := New(db)
+	require.NoError(t, err)
+
+	sources := migrator.provider.ListSources()
+	require.NotEmpty(t, sources)
+	for i, source := range sources {
+		assert.Equal(t, int64(i+1), source.Version, "migrations are numbered without gaps")
+		data, err := fs.ReadFile(schema.FS, source.Path)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(data), "-- +goose Up"), source.Path)
+		assert.Contains(t, string(data), "-- +goose Down", source.Path)
+	}
+	assert.Equal(t, sources[len(sources)-1].Version, migrator.Expected())
+}
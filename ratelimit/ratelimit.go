@@ -0,0 +1,258 @@
+// Package ratelimit implements token bucket rate limits, kept in memory for a single
+// replica or in Postgres to be shared across replicas.
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/metrics"
+)
+
+// Rate allows Requests per Per on average, in bursts of up to Burst requests
+type Rate struct {
+	Requests int `json:"requests"`
+	// Duration string, e.g. "1m"
+	Per string `json:"per"`
+	// Bucket size, Requests when zero
+	Burst int `json:"burst,omitempty"`
+
+	per time.Duration
+}
+
+func (r Rate) load() (Rate, error) {
+	per, err := time.ParseDuration(r.Per)
+	if err != nil || per <= 0 {
+		return r, fmt.Errorf("invalid per %q", r.Per)
+	}
+	if r.Requests <= 0 || r.Burst < 0 {
+		return r, fmt.Errorf("requests must be positive")
+	}
+	r.per = per
+	return r, nil
+}
+
+// NewRate is a Rate built in code rather than read from a file
+func NewRate(requests int, per time.Duration, burst int) Rate {
+	return Rate{Requests: requests, Per: per.String(), Burst: burst, per: per}
+}
+
+func (r Rate) burst() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return float64(r.Requests)
+}
+
+// perSecond is the refill rate of the bucket
+func (r Rate) perSecond() float64 {
+	return float64(r.Requests) / r.per.Seconds()
+}
+
+// Result is the state of a bucket after a request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Until the bucket is full again
+	Reset time.Duration
+	// Until the next request is allowed, zero when allowed
+	RetryAfter time.Duration
+}
+
+func newResult(rate Rate, tokens float64, allowed bool) Result {
+	result := Result{
+		Allowed:   allowed,
+		Limit:     int(rate.burst()),
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     time.Duration((rate.burst() - tokens) / rate.perSecond() * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate.perSecond() * float64(time.Second))
+	}
+	return result
+}
+
+type Limiter interface {
+	// Take takes a token from the bucket of key
+	Take(ctx context.Context, key string, rate Rate) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// Once idle this long the bucket is full and can be forgotten
+	idle time.Duration
+}
+
+// MemoryLimiter keeps buckets in the process, each replica enforces its own limits
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	takes   int
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// pruneEvery is how many takes go by between sweeps of the idle buckets
+const pruneEvery = 10000
+
+func (l *MemoryLimiter) Take(ctx context.Context, key string, rate Rate) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.takes++
+	if l.takes%pruneEvery == 0 {
+		for k, b := range l.buckets {
+			if now.Sub(b.updated) > b.idle {
+				delete(l.buckets, k)
+			}
+		}
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rate.burst(), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(rate.burst(), b.tokens+now.Sub(b.updated).Seconds()*rate.perSecond())
+	b.updated = now
+	b.idle = time.Duration(rate.burst() / rate.perSecond() * float64(time.Second))
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return newResult(rate, b.tokens, allowed), nil
+}
+
+type Store interface {
+	TakeRateLimitToken(context.Context, database.TakeRateLimitTokenParams) (database.TakeRateLimitTokenRow, error)
+	DeleteIdleRateLimitBuckets(context.Context, time.Time) (int64, error)
+}
+
+// PostgresLimiter keeps buckets in the rate_limit_bucket table, shared by every replica
+type PostgresLimiter struct {
+	Store Store
+}
+
+func (l PostgresLimiter) Take(ctx context.Context, key string, rate Rate) (Result, error) {
+	row, err := l.Store.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: rate.burst(),
+		Rate:  rate.perSecond(),
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(rate, row.Tokens, row.Allowed), nil
+}
+
+// StartPruner deletes buckets idle for longer than idle every interval, idle must be at
+// least the time the slowest configured bucket takes to refill
+func (l PostgresLimiter) StartPruner(ctx context.Context, interval time.Duration, idle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			n, err := l.Store.DeleteIdleRateLimitBuckets(ctx, start.Add(-idle))
+			metrics.ObserveWorkerRun("rate_limit_pruner", start, int(n), err)
+			if err != nil {
+				logging.FromContext(ctx).Error("error pruning rate limit buckets", "error", err)
+			}
+		}
+	}
+}
+
+// Rule limits a route per consumer, per user and per client IP, nil rates are unlimited
+type Rule struct {
+	Consumer *Rate `json:"consumer,omitempty"`
+	User     *Rate `json:"user,omitempty"`
+	IP       *Rate `json:"ip,omitempty"`
+}
+
+func (r Rule) load() (Rule, error) {
+	for name, rate := range map[string]**Rate{"consumer": &r.Consumer, "user": &r.User, "ip": &r.IP} {
+		if *rate == nil {
+			continue
+		}
+		loaded, err := (*rate).load()
+		if err != nil {
+			return r, fmt.Errorf("%s: %w", name, err)
+		}
+		*rate = &loaded
+	}
+	return r, nil
+}
+
+// MaxRefill is how long the slowest bucket of the rule takes to fill up
+func (r Rule) MaxRefill() time.Duration {
+	var longest time.Duration
+	for _, rate := range []*Rate{r.Consumer, r.User, r.IP} {
+		if rate == nil {
+			continue
+		}
+		if refill := time.Duration(rate.burst() / rate.perSecond() * float64(time.Second)); refill > longest {
+			longest = refill
+		}
+	}
+	return longest
+}
+
+// Rules are keyed by method and route relative to the API's base path, e.g.
+// "POST /upload-file-request". Default applies to routes without their own rule.
+type Rules struct {
+	Default Rule            `json:"default"`
+	Routes  map[string]Rule `json:"routes"`
+}
+
+func (r Rules) For(route string) Rule {
+	if rule, ok := r.Routes[route]; ok {
+		return rule
+	}
+	return r.Default
+}
+
+// MaxRefill is how long the slowest configured bucket takes to fill up
+func (r Rules) MaxRefill() time.Duration {
+	longest := r.Default.MaxRefill()
+	for _, rule := range r.Routes {
+		if refill := rule.MaxRefill(); refill > longest {
+			longest = refill
+		}
+	}
+	return longest
+}
+
+// LoadRules reads per-route rate limits from a JSON file
+func LoadRules(path string) (Rules, error) {
+	var rules Rules
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("invalid rate limits: %w", err)
+	}
+	if rules.Default, err = rules.Default.load(); err != nil {
+		return rules, fmt.Errorf("default rate limit: %w", err)
+	}
+	for route, rule := range rules.Routes {
+		if rules.Routes[route], err = rule.load(); err != nil {
+			return rules, fmt.Errorf("rate limit of %s: %w", route, err)
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryLimiterRefills(t *testing.T) {
+	now := time.Unix(1767225600, 0)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	rate := NewRate(60, time.Minute, 2)
+	ctx := context.Background()
+
+	result, err := limiter.Take(ctx, "key", rate)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second}, result)
+	result, _ = limiter.Take(ctx, "key", rate)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	result, _ = limiter.Take(ctx, "key", rate)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+
+	// Other keys have their own bucket
+	result, _ = limiter.Take(ctx, "other", rate)
+	assert.True(t, result.Allowed)
+
+	now = now.Add(500 * time.Millisecond)
+	result, _ = limiter.Take(ctx, "key", rate)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+	now = now.Add(500 * time.Millisecond)
+	result, _ = limiter.Take(ctx, "key", rate)
+	assert.True(t, result.Allowed)
+}
+
+type fakeStore struct {
+	params database.TakeRateLimitTokenParams
+	row    database.TakeRateLimitTokenRow
+}
+
+func (s *fakeStore) TakeRateLimitToken(ctx context.Context, arg database.TakeRateLimitTokenParams) (database.TakeRateLimitTokenRow, error) {
+	s.params = arg
+	return s.row, nil
+}
+
+func (s *fakeStore) DeleteIdleRateLimitBuckets(ctx context.Context, idleSince time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestPostgresLimiter(t *testing.T) {
+	store := &fakeStore{row: database.TakeRateLimitTokenRow{Tokens: 0.25, Allowed: false}}
+	limiter := PostgresLimiter{Store: store}
+
+	result, err := limiter.Take(context.Background(), "POST /upload-file-request|consumer|c1", NewRate(10, time.Second, 20))
+	require.NoError(t, err)
+	assert.Equal(t, database.TakeRateLimitTokenParams{Key: "POST /upload-file-request|consumer|c1", Burst: 20, Rate: 10}, store.params)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 20, result.Limit)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 75*time.Millisecond, result.RetryAfter)
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"default": {"ip": {"requests": 600, "per": "1m"}},
+		"routes": {
+			"POST /upload-file-request": {
+				"consumer": {"requests": 100, "per": "1m", "burst": 20},
+				"user": {"requests": 10, "per": "1h"}
+			}
+		}
+	}`), 0o600))
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+
+	upload := rules.For("POST /upload-file-request")
+	assert.Nil(t, upload.IP)
+	assert.Equal(t, 20.0, upload.Consumer.burst())
+	assert.InDelta(t, 100.0/60, upload.Consumer.perSecond(), 1e-9)
+	assert.NotNil(t, rules.For("GET /files").IP)
+	assert.Equal(t, time.Hour, rules.MaxRefill())
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"routes": {"GET /files": {"user": {"requests": 10, "per": "soon"}}}}`), 0o600))
+	_, err = LoadRules(path)
+	assert.Error(t, err)
+}
@@ -1,6 +1,115 @@
 package s3uploadfile
 
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/OliPou/s3are/cloudfront"
+	"github.com/OliPou/s3are/contenttype"
+	"github.com/OliPou/s3are/envelope"
+	"github.com/OliPou/s3are/imagemeta"
+	"github.com/OliPou/s3are/keylayout"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/metrics"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/OliPou/s3are/textextract"
+	"github.com/OliPou/s3are/thumbnail"
+)
+
 type ApiConfig struct {
-	S3Client S3ClientInterface
-	DB       DBInterface
+	S3Client   S3ClientInterface
+	DB         DBInterface
+	Encryption s3client.EncryptionPolicies
+	// Storage classes consumers may choose and when idle objects move to colder ones
+	StorageClasses s3client.StorageClassPolicies
+	// Object Lock retention applied to new uploads of records-management consumers
+	Retention s3client.RetentionPolicies
+	// Set when the buckets have S3 versioning enabled, each upload's version ID is then
+	// recorded and downloads are pinned to it
+	BucketVersioning bool
+	// Optional, consumers it holds a master key for only get the proxy upload/download path
+	KeyProvider envelope.KeyProvider
+	// Object key layout, keylayout.DefaultTemplate when nil
+	KeyLayout *keylayout.Layout
+	// Optional, routes consumers to their own bucket. S3Client is the default bucket's client
+	// and still serves files recorded without a bucket.
+	Router S3RouterInterface
+	// Optional, new uploads are withheld until scanned clean when set
+	Scanner Scanner
+	// Where infected objects are moved, DefaultQuarantinePrefix when empty
+	QuarantinePrefix string
+	// File types consumers may store, checked against the sniffed content of every upload
+	ContentTypes contenttype.Policies
+	// Consumers whose JPEG and PNG uploads are stripped of EXIF, GPS and XMP metadata
+	MetadataStripping imagemeta.Policies
+	// Thumbnails rendered for JPEG, PNG and GIF uploads, none when empty
+	ThumbnailSizes []thumbnail.Size
+	// Text search configuration documents are indexed and searched with, "simple" by default
+	SearchLanguages textextract.Languages
+	// Consumers whose downloads are served by a CloudFront distribution instead of S3
+	CloudFront cloudfront.Distributions
+}
+
+func (apiCfg *ApiConfig) keyLayout() *keylayout.Layout {
+	if apiCfg.KeyLayout == nil {
+		return keylayout.Default()
+	}
+	return apiCfg.KeyLayout
+}
+
+func (apiCfg *ApiConfig) envelopeEnabled(consumer string) bool {
+	return apiCfg.KeyProvider != nil && apiCfg.KeyProvider.Enabled(consumer)
+}
+
+// resolveLocation picks where a new file of the consumer is stored. Without a router
+// every file goes to the default bucket, which satisfies no residency requirement.
+func (apiCfg *ApiConfig) resolveLocation(ctx context.Context, consumer string, residency string) (s3client.Location, S3ClientInterface, error) {
+	if apiCfg.Router == nil {
+		if residency != "" {
+			return s3client.Location{}, nil, ErrUnknownResidency
+		}
+		return s3client.Location{}, s3client.WithTracing(ctx, apiCfg.S3Client), nil
+	}
+	location, err := apiCfg.Router.Resolve(consumer, residency)
+	if err != nil {
+		return s3client.Location{}, nil, fmt.Errorf("%w: %v", ErrUnknownResidency, err)
+	}
+	client, err := apiCfg.Router.Client(location)
+	if err != nil {
+		logging.FromContext(ctx).Error("error creating S3 client", "error", err)
+		return s3client.Location{}, nil, fmt.Errorf("error creating S3 client")
+	}
+	return location, s3client.WithTracing(ctx, client), nil
+}
+
+// s3ClientAt returns the client for the bucket a file was recorded in, traced under ctx
+func (apiCfg *ApiConfig) s3ClientAt(ctx context.Context, bucket sql.NullString, region sql.NullString) (S3ClientInterface, error) {
+	if !bucket.Valid || apiCfg.Router == nil {
+		return s3client.WithTracing(ctx, apiCfg.S3Client), nil
+	}
+	client, err := apiCfg.Router.Client(s3client.Location{Bucket: bucket.String, Region: region.String})
+	if err != nil {
+		logging.FromContext(ctx).Error("error creating S3 client", "error", err)
+		return nil, fmt.Errorf("error creating S3 client")
+	}
+	return s3client.WithTracing(ctx, client), nil
+}
+
+// downloadURL signs a CloudFront URL when the consumer's downloads go through a
+// distribution and an S3 presigned URL otherwise. CloudFront cannot forward SSE-C keys
+// or pin an S3 version, such objects are always presigned.
+func (apiCfg *ApiConfig) downloadURL(consumer string, s3Client S3ClientInterface, key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+	defer metrics.ObservePresign("download", time.Now())
+	distribution := apiCfg.CloudFront.For(consumer)
+	if !distribution.Enabled() || opts.Encryption.Mode == s3client.EncryptionSSEC || opts.VersionID != "" {
+		return s3Client.GeneratePresignedDownloadURL(key, expirationTime, opts)
+	}
+	duration := s3client.PresignedURLDuration(expirationTime)
+	signedURL, err := distribution.SignURL(key, time.Now().Add(duration))
+	if err != nil {
+		return "", time.Duration(0), err
+	}
+	return signedURL, duration, nil
 }
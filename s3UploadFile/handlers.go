@@ -1,11 +1,17 @@
 package s3uploadfile
 
 import (
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
 
+	"github.com/OliPou/s3are/contenttype"
 	"github.com/OliPou/s3are/internal/common"
 	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/metrics"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -18,11 +24,22 @@ func (apiCfg *ApiConfig) HandlerRequestUpload(c *gin.Context, consumer string) {
 
 	// Generate UUID first so we can use it in the filename
 	uploadInfo, err := UploadRequest(c, params, consumer, apiCfg, uuid.New)
+	metrics.ObserveUploadRequest(consumer, err)
+	if errors.Is(err, ErrInvalidMetadata) || errors.Is(err, ErrInvalidFileName) ||
+		errors.Is(err, ErrUnknownResidency) || errors.Is(err, ErrStorageClassNotAllowed) {
+		common.RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, ErrLogicalFileNotFound) {
+		common.RespondError(c, http.StatusNotFound, err.Error())
+		return
+	}
 	if err != nil {
 		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error generating presigned URL: %v", err))
 		return
 	}
 
+	c.Set(logging.TransactionKey, uploadInfo.TransactionUuid.String())
 	common.RespondWithJSON(c, http.StatusCreated, uploadInfo)
 }
 
@@ -31,7 +48,32 @@ func (apiCfg *ApiConfig) HandlerRequestUploadCompleted(c *gin.Context, consumer
 	if err := common.ValidateRequest(c, &params); err != nil {
 		return
 	}
-	uploadedFile, err := UploadedCompleted(c, params, apiCfg)
+	uploadedFile, err := UploadedCompleted(c, params, consumer, apiCfg)
+	metrics.ObserveUploadCompletion(consumer, err)
+	if errors.Is(err, ErrFileNotFound) {
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	}
+	if errors.Is(err, ErrProxyUploadRequired) {
+		common.RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, ErrLogicalFileNotFound) {
+		common.RespondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, contenttype.ErrTypeNotAllowed) || errors.Is(err, contenttype.ErrTypeMismatch) {
+		common.RespondError(c, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	if errors.Is(err, ErrImageNotSanitized) {
+		common.RespondError(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if errors.Is(err, ErrFileAlreadyUploaded) {
+		common.RespondError(c, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
 		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error generating presigned URL: %v", err))
 		return
@@ -51,7 +93,6 @@ func (apiCfg *ApiConfig) HandlerFileStatus(c *gin.Context, consumer string) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "userName is required"})
 		return
 	}
-	fmt.Printf("getUploadedFileParams: %s, consumer: %s\n", transactionUuid, consumer)
 	uploadedFile, err := apiCfg.DB.GetUploadedFile(c, database.GetUploadedFileParams{
 		TransactionUuid: transactionUuid,
 		Consumer:        consumer,
@@ -62,6 +103,573 @@ func (apiCfg *ApiConfig) HandlerFileStatus(c *gin.Context, consumer string) {
 		common.RespondWithJSON(c, http.StatusOK, fmt.Sprintf("TransactionUuid not found"))
 		return
 	}
+	// The status is returned either way, without a download URL when it can't be signed
+	result := withDownloadURL(c, DatabaseUploadFileToUploadFile(uploadedFile), uploadedFile, false, apiCfg)
+	// Handing out the download URL counts as an access for storage class transitions
+	if result.DownloadPresignedUrl != "" {
+		recordDownload(c, uploadedFile, apiCfg)
+	}
+	result.Renditions, err = renditionsOf(c, uploadedFile, apiCfg)
+	if err != nil {
+		common.RespondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusOK, result)
+}
+
+func (apiCfg *ApiConfig) HandlerDeleteFile(c *gin.Context, consumer string) {
+	transactionUuid, err := uuid.Parse(c.Query("transactionUuid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transactionUuid"})
+		return
+	}
+	userName := c.Query("userName")
+	if userName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userName is required"})
+		return
+	}
+	deletedFile, err := DeleteFile(c, transactionUuid, consumer, userName, apiCfg)
+	if errors.Is(err, ErrFileNotFound) {
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	}
+	if errors.Is(err, ErrFileLocked) {
+		common.RespondError(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error deleting file: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusOK, deletedFile)
+}
+
+func (apiCfg *ApiConfig) HandlerUploadFileContent(c *gin.Context, consumer string) {
+	transactionUuid, err := uuid.Parse(c.Query("transactionUuid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transactionUuid"})
+		return
+	}
+	userName := c.Query("userName")
+	if userName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userName is required"})
+		return
+	}
+	uploadedFile, err := UploadFileContent(c, transactionUuid, consumer, userName, c.Request.Body, c.ContentType(), apiCfg)
+	metrics.ObserveUploadCompletion(consumer, err)
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	case errors.Is(err, ErrFileAlreadyUploaded):
+		common.RespondError(c, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, ErrPresignedUploadRequired):
+		common.RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, contenttype.ErrTypeNotAllowed), errors.Is(err, contenttype.ErrTypeMismatch):
+		common.RespondError(c, http.StatusUnsupportedMediaType, err.Error())
+		return
+	case errors.Is(err, ErrImageNotSanitized):
+		common.RespondError(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	case err != nil:
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error uploading file: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusOK, uploadedFile)
+}
+
+func (apiCfg *ApiConfig) HandlerDownloadFileContent(c *gin.Context, consumer string) {
+	transactionUuid, err := uuid.Parse(c.Query("transactionUuid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transactionUuid"})
+		return
+	}
+	userName := c.Query("userName")
+	if userName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userName is required"})
+		return
+	}
+	uploadedFile, body, err := DownloadFileContent(c, transactionUuid, consumer, userName, apiCfg)
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	case errors.Is(err, ErrFileNotUploaded), errors.Is(err, ErrFileArchived), errors.Is(err, ErrFileNotScanned), errors.Is(err, ErrFileInfected):
+		common.RespondError(c, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error downloading file: %v", err))
+		return
+	}
+	defer body.Close()
+
+	contentLength := int64(-1)
+	if uploadedFile.FileSize.Valid {
+		contentLength = int64(uploadedFile.FileSize.Int32)
+	}
+	contentType := uploadedFile.FileType.String
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(http.StatusOK, contentLength, contentType, body, nil)
+}
+
+func (apiCfg *ApiConfig) HandlerRequestRestore(c *gin.Context, consumer string) {
+	transactionUuid, err := uuid.Parse(c.Query("transactionUuid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transactionUuid"})
+		return
+	}
+	var params RestoreParams
+	if err := common.ValidateRequest(c, &params); err != nil {
+		return
+	}
+	uploadedFile, err := RequestRestore(c, transactionUuid, consumer, params, apiCfg)
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	case errors.Is(err, ErrFileNotUploaded), errors.Is(err, ErrFileNotArchived):
+		common.RespondError(c, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, ErrInvalidRestoreTier):
+		common.RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error requesting restore: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusAccepted, uploadedFile)
+}
+
+func (apiCfg *ApiConfig) HandlerSetLegalHold(c *gin.Context, consumer string) {
+	transactionUuid, err := uuid.Parse(c.Query("transactionUuid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transactionUuid"})
+		return
+	}
+	var params LegalHoldParams
+	if err := common.ValidateRequest(c, &params); err != nil {
+		return
+	}
+	uploadedFile, err := SetLegalHold(c, transactionUuid, consumer, params, apiCfg)
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	case errors.Is(err, ErrFileNotUploaded):
+		common.RespondError(c, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error setting legal hold: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusOK, uploadedFile)
+}
+
+func (apiCfg *ApiConfig) HandlerUpdateFileMetadata(c *gin.Context, consumer string) {
+	transactionUuid, err := uuid.Parse(c.Query("transactionUuid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transactionUuid"})
+		return
+	}
+	var params UpdateMetadataParams
+	if err := common.ValidateRequest(c, &params); err != nil {
+		return
+	}
+	uploadedFile, err := UpdateFileMetadata(c, transactionUuid, consumer, params, apiCfg)
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	case errors.Is(err, ErrFileNotUploaded), errors.Is(err, ErrFileArchived):
+		common.RespondError(c, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, ErrInvalidMetadata):
+		common.RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error updating metadata: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusOK, uploadedFile)
+}
+
+// HandlerListFiles lists the consumer's files. Filters are given as query parameters:
+// metadata[key]=value, tags[key]=value and metadataKey=key (repeatable).
+func (apiCfg *ApiConfig) HandlerListFiles(c *gin.Context, consumer string) {
+	params := ListFilesParams{
+		UserName:     c.Query("userName"),
+		Metadata:     c.QueryMap("metadata"),
+		MetadataKeys: c.QueryArray("metadataKey"),
+		Tags:         c.QueryMap("tags"),
+	}
+	var err error
+	if limit := c.Query("limit"); limit != "" {
+		if params.Limit, err = strconv.Atoi(limit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+	if offset := c.Query("offset"); offset != "" {
+		if params.Offset, err = strconv.Atoi(offset); err != nil || params.Offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+			return
+		}
+	}
+	files, err := ListFiles(c, consumer, params, apiCfg)
+	if err != nil {
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error listing files: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusOK, files)
+}
+
+func (apiCfg *ApiConfig) HandlerSearchFiles(c *gin.Context, consumer string) {
+	params := SearchFilesParams{
+		UserName: c.Query("userName"),
+		Query:    c.Query("q"),
+	}
+	if params.Query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	var err error
+	if limit := c.Query("limit"); limit != "" {
+		if params.Limit, err = strconv.Atoi(limit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+	if offset := c.Query("offset"); offset != "" {
+		if params.Offset, err = strconv.Atoi(offset); err != nil || params.Offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+			return
+		}
+	}
+	results, err := SearchFiles(c, consumer, params, apiCfg)
+	if err != nil {
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error searching files: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusOK, results)
+}
+
+func (apiCfg *ApiConfig) HandlerCreateShareLink(c *gin.Context, consumer string) {
+	transactionUuid, err := uuid.Parse(c.Query("transactionUuid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transactionUuid"})
+		return
+	}
+	var params CreateShareLinkParams
+	if err := common.ValidateRequest(c, &params); err != nil {
+		return
+	}
+	shareLink, err := CreateShareLink(c, transactionUuid, consumer, params, apiCfg)
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	case errors.Is(err, ErrInvalidShareIPRange), errors.Is(err, ErrSharePasswordTooLong):
+		common.RespondError(c, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, ErrFileNotUploaded):
+		common.RespondError(c, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error creating share link: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusCreated, shareLink)
+}
+
+func (apiCfg *ApiConfig) HandlerListShareLinks(c *gin.Context, consumer string) {
+	transactionUuid, err := uuid.Parse(c.Query("transactionUuid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transactionUuid"})
+		return
+	}
+	userName := c.Query("userName")
+	if userName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userName is required"})
+		return
+	}
+	shareLinks, err := ListShareLinks(c, transactionUuid, consumer, userName, apiCfg)
+	if errors.Is(err, ErrFileNotFound) {
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	}
+	if err != nil {
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error listing share links: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusOK, shareLinks)
+}
+
+func (apiCfg *ApiConfig) HandlerRevokeShareLink(c *gin.Context, consumer string) {
+	transactionUuid, err := uuid.Parse(c.Query("transactionUuid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transactionUuid"})
+		return
+	}
+	shareLinkId, err := uuid.Parse(c.Query("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	userName := c.Query("userName")
+	if userName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userName is required"})
+		return
+	}
+	shareLink, err := RevokeShareLink(c, transactionUuid, shareLinkId, consumer, userName, apiCfg)
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	case errors.Is(err, ErrShareLinkNotFound):
+		common.RespondError(c, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error revoking share link: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusOK, shareLink)
+}
+
+// HandlerRedeemShareLink serves share links to anonymous recipients, it is not behind the auth middleware
+func (apiCfg *ApiConfig) HandlerRedeemShareLink(c *gin.Context) {
+	download, err := RedeemShareLink(c, c.Param("token"), c.GetHeader(SharePasswordHeader), c.ClientIP(), c.Request.UserAgent(), apiCfg)
+	switch {
+	case errors.Is(err, ErrShareLinkNotFound):
+		common.RespondError(c, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, ErrInvalidSharePassword):
+		common.RespondError(c, http.StatusUnauthorized, err.Error())
+		return
+	case errors.Is(err, ErrShareLinkForbidden):
+		common.RespondError(c, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, ErrShareLinkRevoked), errors.Is(err, ErrShareLinkExpired), errors.Is(err, ErrShareLinkExhausted):
+		common.RespondError(c, http.StatusGone, err.Error())
+		return
+	case errors.Is(err, ErrFileNotUploaded), errors.Is(err, ErrFileArchived), errors.Is(err, ErrFileNotScanned), errors.Is(err, ErrFileInfected):
+		common.RespondError(c, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error redeeming share link: %v", err))
+		return
+	}
 
-	common.RespondWithJSON(c, http.StatusOK, DatabaseUploadFileToUploadFile(uploadedFile))
+	serveSharedDownload(c, download)
+}
+
+// serveSharedDownload redirects to the freshly presigned URL or streams the file
+func serveSharedDownload(c *gin.Context, download SharedDownload) {
+	c.Header("Cache-Control", "no-store")
+	if download.Body == nil {
+		c.Redirect(http.StatusFound, download.RedirectUrl)
+		return
+	}
+	defer download.Body.Close()
+
+	uploadedFile := download.UploadedFile
+	contentLength := int64(-1)
+	if uploadedFile.FileSize.Valid {
+		contentLength = int64(uploadedFile.FileSize.Int32)
+	}
+	contentType := uploadedFile.FileType.String
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	extraHeaders := map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": uploadedFile.FileName}),
+	}
+	c.DataFromReader(http.StatusOK, contentLength, contentType, download.Body, extraHeaders)
+}
+
+func (apiCfg *ApiConfig) HandlerCreateDownloadToken(c *gin.Context, consumer string) {
+	transactionUuid, err := uuid.Parse(c.Query("transactionUuid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transactionUuid"})
+		return
+	}
+	var params CreateDownloadTokenParams
+	if err := common.ValidateRequest(c, &params); err != nil {
+		return
+	}
+	downloadToken, err := CreateDownloadToken(c, transactionUuid, consumer, params, apiCfg)
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	case errors.Is(err, ErrFileNotUploaded):
+		common.RespondError(c, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error creating download token: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusCreated, downloadToken)
+}
+
+// HandlerRevokeDownloadTokens revokes the token given by id, every token of the file given
+// by transactionUuid, or every token of the user when neither is given
+func (apiCfg *ApiConfig) HandlerRevokeDownloadTokens(c *gin.Context, consumer string) {
+	userName := c.Query("userName")
+	if userName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userName is required"})
+		return
+	}
+	var revoked RevokedDownloadTokens
+	var err error
+	switch {
+	case c.Query("id") != "":
+		downloadTokenId, parseErr := uuid.Parse(c.Query("id"))
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		revoked, err = RevokeDownloadToken(c, downloadTokenId, consumer, userName, apiCfg)
+	case c.Query("transactionUuid") != "":
+		transactionUuid, parseErr := uuid.Parse(c.Query("transactionUuid"))
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transactionUuid"})
+			return
+		}
+		revoked, err = RevokeFileDownloadTokens(c, transactionUuid, consumer, userName, apiCfg)
+	default:
+		revoked, err = RevokeUserDownloadTokens(c, consumer, userName, apiCfg)
+	}
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	case errors.Is(err, ErrDownloadTokenNotFound):
+		common.RespondError(c, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error revoking download tokens: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusOK, revoked)
+}
+
+// HandlerRedeemDownloadToken is not behind the auth middleware, the token is the credential
+func (apiCfg *ApiConfig) HandlerRedeemDownloadToken(c *gin.Context) {
+	download, err := RedeemDownloadToken(c, c.Param("token"), apiCfg)
+	switch {
+	case errors.Is(err, ErrDownloadTokenNotFound):
+		common.RespondError(c, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, ErrDownloadTokenRevoked), errors.Is(err, ErrDownloadTokenExpired):
+		common.RespondError(c, http.StatusGone, err.Error())
+		return
+	case errors.Is(err, ErrFileNotUploaded), errors.Is(err, ErrFileArchived), errors.Is(err, ErrFileNotScanned), errors.Is(err, ErrFileInfected):
+		common.RespondError(c, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error redeeming download token: %v", err))
+		return
+	}
+
+	serveSharedDownload(c, download)
+}
+
+func (apiCfg *ApiConfig) HandlerRenditionCookies(c *gin.Context, consumer string) {
+	transactionUuid, err := uuid.Parse(c.Query("transactionUuid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid transactionUuid"})
+		return
+	}
+	userName := c.Query("userName")
+	if userName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userName is required"})
+		return
+	}
+	renditionCookies, err := SignRenditionCookies(c, transactionUuid, consumer, userName, apiCfg)
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		common.RespondError(c, http.StatusNotFound, "TransactionUuid not found")
+		return
+	case errors.Is(err, ErrCloudFrontDisabled), errors.Is(err, ErrRenditionsNotReady), errors.Is(err, ErrFileNotScanned), errors.Is(err, ErrFileInfected):
+		common.RespondError(c, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error signing rendition cookies: %v", err))
+		return
+	}
+
+	for _, cookie := range renditionCookies.Cookies {
+		http.SetCookie(c.Writer, cookie)
+	}
+	common.RespondWithJSON(c, http.StatusOK, renditionCookies)
+}
+
+func (apiCfg *ApiConfig) HandlerListFileVersions(c *gin.Context, consumer string) {
+	logicalFileId, err := uuid.Parse(c.Query("logicalFileId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid logicalFileId"})
+		return
+	}
+	userName := c.Query("userName")
+	if userName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userName is required"})
+		return
+	}
+	versions, err := ListFileVersions(c, logicalFileId, consumer, userName, apiCfg)
+	if errors.Is(err, ErrLogicalFileNotFound) {
+		common.RespondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error listing versions: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusOK, versions)
+}
+
+func (apiCfg *ApiConfig) HandlerGetFileVersion(c *gin.Context, consumer string) {
+	logicalFileId, err := uuid.Parse(c.Query("logicalFileId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid logicalFileId"})
+		return
+	}
+	version, err := strconv.ParseInt(c.Query("version"), 10, 32)
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+		return
+	}
+	userName := c.Query("userName")
+	if userName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "userName is required"})
+		return
+	}
+	uploadedFile, err := GetFileVersion(c, logicalFileId, int32(version), consumer, userName, apiCfg)
+	if errors.Is(err, ErrVersionNotFound) {
+		common.RespondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		common.RespondError(c, http.StatusInternalServerError, fmt.Sprintf("Error getting version: %v", err))
+		return
+	}
+
+	common.RespondWithJSON(c, http.StatusOK, uploadedFile)
 }
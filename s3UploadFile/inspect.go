@@ -0,0 +1,81 @@
+package s3uploadfile
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/OliPou/s3are/contenttype"
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/gin-gonic/gin"
+)
+
+// inspectsUploads reports whether uploads of consumer must be read before they are
+// accepted, to check their type or strip their metadata
+func (apiCfg *ApiConfig) inspectsUploads(consumer string) bool {
+	return apiCfg.ContentTypes.For(consumer).Restricts() || apiCfg.MetadataStripping.For(consumer).Enabled
+}
+
+// inspectUploadedObject sniffs the first bytes of an object uploaded with a presigned URL.
+// Objects the consumer's policy refuses are deleted so the transaction can be uploaded again.
+// Returns the detected MIME type, empty for archived objects that cannot be read until
+// restored. Only consumers whose uploads are not inspected may upload to an archive class.
+func inspectUploadedObject(c *gin.Context, existingFile database.UploadedFile, declaredType string, getOpts s3client.GetObjectOptions, s3Client S3ClientInterface, apiCfg *ApiConfig) (string, error) {
+	if archiveBlocked(existingFile, time.Now()) != nil {
+		return "", nil
+	}
+	body, err := s3Client.GetObjectRange(existingFile.ObjectKey, 0, contenttype.SniffLength, getOpts)
+	if err != nil {
+		logging.FromContext(c).Error("error reading object header", "error", err)
+		return "", fmt.Errorf("error inspecting uploaded file")
+	}
+	header, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		logging.FromContext(c).Error("error reading object header", "error", err)
+		return "", fmt.Errorf("error inspecting uploaded file")
+	}
+	detectedType, err := recordDetectedType(c, existingFile, header, declaredType, apiCfg)
+	if errors.Is(err, contenttype.ErrTypeNotAllowed) || errors.Is(err, contenttype.ErrTypeMismatch) {
+		if deleteErr := s3Client.DeleteObject(existingFile.ObjectKey); deleteErr != nil {
+			logging.FromContext(c).Error("error deleting rejected object", "error", deleteErr)
+		}
+	}
+	return detectedType, err
+}
+
+// sniffContent returns the leading bytes of a proxied upload without consuming them
+func sniffContent(body io.Reader) ([]byte, io.Reader, error) {
+	buffered := bufio.NewReaderSize(body, contenttype.SniffLength)
+	header, err := buffered.Peek(contenttype.SniffLength)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	return header, buffered, nil
+}
+
+// recordDetectedType checks the detected type against the consumer's policy and stores it
+func recordDetectedType(c *gin.Context, existingFile database.UploadedFile, header []byte, declaredType string, apiCfg *ApiConfig) (string, error) {
+	detection := contenttype.Detect(header, path.Ext(existingFile.FileName), declaredType)
+	if err := apiCfg.ContentTypes.For(existingFile.Consumer).Check(detection); err != nil {
+		return "", err
+	}
+	err := apiCfg.DB.SetUploadedFileDetectedType(c, database.SetUploadedFileDetectedTypeParams{
+		TransactionUuid:  existingFile.TransactionUuid,
+		DetectedType:     sql.NullString{String: detection.MIME, Valid: true},
+		TypeMismatch:     detection.Mismatch,
+		RenditionStatus:  apiCfg.initialRenditionStatus(existingFile.Consumer, detection.MIME),
+		ExtractionStatus: apiCfg.initialExtractionStatus(existingFile.Consumer, detection.MIME),
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error recording detected type", "error", err)
+		return "", fmt.Errorf("error recording detected type")
+	}
+	return detection.MIME, nil
+}
@@ -2,18 +2,90 @@ package s3uploadfile
 
 import (
 	"context"
+	"io"
 	"time"
 
 	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/google/uuid"
 )
 
 type DBInterface interface {
 	CreateUploadedFile(context.Context, database.CreateUploadedFileParams) (database.UploadedFile, error)
 	UpdateUploadedFile(context.Context, database.UpdateUploadedFileParams) (database.UploadedFile, error)
 	GetUploadedFile(context.Context, database.GetUploadedFileParams) (database.UploadedFile, error)
+	GetConsumerUploadedFile(context.Context, database.GetConsumerUploadedFileParams) (database.UploadedFile, error)
+	GetConsumerUploadedFileByKey(context.Context, database.GetConsumerUploadedFileByKeyParams) (database.UploadedFile, error)
+	DeleteUploadedFile(context.Context, database.DeleteUploadedFileParams) (database.UploadedFile, error)
+	CompleteDeduplicatedUpload(context.Context, database.CompleteDeduplicatedUploadParams) (database.UploadedFile, error)
+	AcquireFileObject(context.Context, database.AcquireFileObjectParams) (database.FileObject, error)
+	ReleaseFileObject(context.Context, database.ReleaseFileObjectParams) (database.FileObject, error)
+	DeleteReleasedFileObject(context.Context, database.DeleteReleasedFileObjectParams) (database.FileObject, error)
+	SetUploadedFileEnvelope(context.Context, database.SetUploadedFileEnvelopeParams) (database.UploadedFile, error)
+	UpdateUploadedFileMetadata(context.Context, database.UpdateUploadedFileMetadataParams) (database.UploadedFile, error)
+	ListUploadedFiles(context.Context, database.ListUploadedFilesParams) ([]database.UploadedFile, error)
+	RecordUploadedFileDownload(context.Context, uuid.UUID) error
+	ListIdleObjects(context.Context, database.ListIdleObjectsParams) ([]database.ListIdleObjectsRow, error)
+	SetObjectStorageClass(context.Context, database.SetObjectStorageClassParams) error
+	SetFileObjectStorageClass(context.Context, database.SetFileObjectStorageClassParams) error
+	CreateStorageTransition(context.Context, database.CreateStorageTransitionParams) (database.StorageTransition, error)
+	SetUploadedFileRestore(context.Context, database.SetUploadedFileRestoreParams) (database.UploadedFile, error)
+	ListPendingRestores(context.Context, database.ListPendingRestoresParams) ([]database.UploadedFile, error)
+	CompleteUploadedFileRestore(context.Context, database.CompleteUploadedFileRestoreParams) (database.UploadedFile, error)
+	ExpireUploadedFileRestores(context.Context, database.ExpireUploadedFileRestoresParams) error
+	SetUploadedFileLegalHold(context.Context, database.SetUploadedFileLegalHoldParams) (database.UploadedFile, error)
+	CreateLogicalFile(context.Context, database.CreateLogicalFileParams) (database.LogicalFile, error)
+	NextLogicalFileVersion(context.Context, database.NextLogicalFileVersionParams) (database.LogicalFile, error)
+	ListFileVersions(context.Context, database.ListFileVersionsParams) ([]database.UploadedFile, error)
+	GetFileVersion(context.Context, database.GetFileVersionParams) (database.UploadedFile, error)
+	SetUploadedFileS3Version(context.Context, database.SetUploadedFileS3VersionParams) error
+	SetUploadedFileDetectedType(context.Context, database.SetUploadedFileDetectedTypeParams) error
+	SetUploadedFileSanitized(context.Context, database.SetUploadedFileSanitizedParams) error
+	ListPendingRenditions(context.Context, database.ListPendingRenditionsParams) ([]database.UploadedFile, error)
+	SetUploadedFileRenditionStatus(context.Context, database.SetUploadedFileRenditionStatusParams) error
+	RecordRenditionAttempt(context.Context, uuid.UUID) error
+	ListPendingExtractions(context.Context, database.ListPendingExtractionsParams) ([]database.UploadedFile, error)
+	SetUploadedFileExtractionStatus(context.Context, database.SetUploadedFileExtractionStatusParams) error
+	RecordExtractionAttempt(context.Context, uuid.UUID) error
+	UpsertFileContent(context.Context, database.UpsertFileContentParams) error
+	SearchUploadedFiles(context.Context, database.SearchUploadedFilesParams) ([]database.SearchUploadedFilesRow, error)
+	CreateRendition(context.Context, database.CreateRenditionParams) (database.Rendition, error)
+	ListRenditions(context.Context, uuid.UUID) ([]database.Rendition, error)
+	ListPendingScans(context.Context, database.ListPendingScansParams) ([]database.UploadedFile, error)
+	SetObjectScanResult(context.Context, database.SetObjectScanResultParams) error
+	RecordObjectScanAttempt(context.Context, database.RecordObjectScanAttemptParams) error
+	QuarantineObject(context.Context, database.QuarantineObjectParams) error
+	DeleteFileObjectByKey(context.Context, database.DeleteFileObjectByKeyParams) error
+	CreateShareLink(context.Context, database.CreateShareLinkParams) (database.ShareLink, error)
+	GetShareLinkByTokenHash(context.Context, string) (database.GetShareLinkByTokenHashRow, error)
+	ListShareLinks(context.Context, uuid.UUID) ([]database.ShareLink, error)
+	RevokeShareLink(context.Context, database.RevokeShareLinkParams) (database.ShareLink, error)
+	ClaimShareLinkDownload(context.Context, uuid.UUID) (database.ShareLink, error)
+	CreateShareLinkDownload(context.Context, database.CreateShareLinkDownloadParams) error
+	CreateDownloadToken(context.Context, database.CreateDownloadTokenParams) (database.DownloadToken, error)
+	GetDownloadTokenByTokenHash(context.Context, string) (database.GetDownloadTokenByTokenHashRow, error)
+	TouchDownloadToken(context.Context, uuid.UUID) error
+	RevokeDownloadToken(context.Context, database.RevokeDownloadTokenParams) (database.DownloadToken, error)
+	RevokeFileDownloadTokens(context.Context, uuid.UUID) (int64, error)
+	RevokeUserDownloadTokens(context.Context, database.RevokeUserDownloadTokensParams) (int64, error)
 }
 
 type S3ClientInterface interface {
-	GeneratePresignedURL(key string, expirationTime *int) (string, time.Duration, error)
-	GeneratePresignedDownloadURL(key string, expirationTime *int) (string, time.Duration, error)
+	GeneratePresignedURL(key string, expirationTime *int, opts s3client.PutObjectOptions) (string, time.Duration, error)
+	GeneratePresignedDownloadURL(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error)
+	GetObjectInfo(key string, opts s3client.GetObjectOptions) (s3client.ObjectInfo, error)
+	DeleteObject(key string) error
+	UploadObject(key string, body io.Reader, opts s3client.PutObjectOptions) error
+	GetObject(key string, opts s3client.GetObjectOptions) (io.ReadCloser, error)
+	GetObjectRange(key string, offset int64, length int64, opts s3client.GetObjectOptions) (io.ReadCloser, error)
+	ReplaceObjectMetadata(key string, opts s3client.PutObjectOptions) (string, error)
+	ChangeStorageClass(key string, opts s3client.PutObjectOptions) error
+	RestoreObject(key string, tier string, days int) error
+	SetLegalHold(key string, enabled bool) error
+	MoveObject(key string, destinationKey string, opts s3client.PutObjectOptions) error
+}
+
+type S3RouterInterface interface {
+	Resolve(consumer string, residency string) (s3client.Location, error)
+	Client(location s3client.Location) (s3client.S3ClientInterface, error)
 }
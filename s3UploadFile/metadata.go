@@ -0,0 +1,221 @@
+package s3uploadfile
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// S3 limits, see the user-defined metadata and object tagging documentation
+const (
+	maxMetadataSize = 2048
+	maxTags         = 10
+	maxTagKeyLen    = 128
+	maxTagValueLen  = 256
+	maxListResults  = 1000
+)
+
+var (
+	ErrInvalidMetadata = errors.New("invalid metadata")
+
+	metadataKeyPattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+	tagPattern         = regexp.MustCompile(`^[\pL\pN\s+\-=._:/@]*$`)
+)
+
+// normalizeMetadata lowercases metadata keys as S3 does and checks metadata and tags
+// fit within the S3 limits
+func normalizeMetadata(metadata map[string]string, tags map[string]string) (map[string]string, error) {
+	normalized := make(map[string]string, len(metadata))
+	size := 0
+	for k, v := range metadata {
+		key := strings.ToLower(k)
+		if !metadataKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("%w: metadata key %q may only contain letters, digits, '-' and '_'", ErrInvalidMetadata, k)
+		}
+		for _, r := range v {
+			if r < 0x20 || r > 0x7e {
+				return nil, fmt.Errorf("%w: metadata value of %q must be printable ASCII", ErrInvalidMetadata, k)
+			}
+		}
+		normalized[key] = v
+		size += len(key) + len(v)
+	}
+	if size > maxMetadataSize {
+		return nil, fmt.Errorf("%w: metadata exceeds %d bytes", ErrInvalidMetadata, maxMetadataSize)
+	}
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidMetadata, maxTags)
+	}
+	for k, v := range tags {
+		if k == "" || len(k) > maxTagKeyLen || len(v) > maxTagValueLen {
+			return nil, fmt.Errorf("%w: tag %q exceeds the allowed key or value length", ErrInvalidMetadata, k)
+		}
+		if !tagPattern.MatchString(k) || !tagPattern.MatchString(v) {
+			return nil, fmt.Errorf("%w: tag %q contains unsupported characters", ErrInvalidMetadata, k)
+		}
+	}
+	return normalized, nil
+}
+
+func encodeMetadata(m map[string]string) json.RawMessage {
+	if m == nil {
+		m = map[string]string{}
+	}
+	data, _ := json.Marshal(m)
+	return data
+}
+
+func decodeMetadata(data json.RawMessage) map[string]string {
+	m := map[string]string{}
+	if len(data) > 0 {
+		_ = json.Unmarshal(data, &m)
+	}
+	return m
+}
+
+// UpdateFileMetadata replaces the metadata and/or tags of an uploaded file, both in
+// the database and on the S3 object. Archived objects must be restored first, S3 can't
+// copy them.
+func UpdateFileMetadata(c *gin.Context, transactionUuid uuid.UUID, consumer string, params UpdateMetadataParams, apiCfg *ApiConfig) (UploadedFile, error) {
+	existingFile, err := apiCfg.DB.GetUploadedFile(c, database.GetUploadedFileParams{
+		TransactionUuid: transactionUuid,
+		Consumer:        consumer,
+		UserName:        params.UserName,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UploadedFile{}, ErrFileNotFound
+		}
+		logging.FromContext(c).Error("error getting uploaded file", "error", err)
+		return UploadedFile{}, fmt.Errorf("error getting uploaded file")
+	}
+	// The presigned upload URL is signed with the metadata given at request time
+	if existingFile.Status == StatusWaitingFile {
+		return UploadedFile{}, ErrFileNotUploaded
+	}
+	metadata := decodeMetadata(existingFile.Metadata)
+	tags := decodeMetadata(existingFile.Tags)
+	if params.Metadata != nil {
+		metadata = params.Metadata
+	}
+	if params.Tags != nil {
+		tags = params.Tags
+	}
+	metadata, err = normalizeMetadata(metadata, tags)
+	if err != nil {
+		return UploadedFile{}, err
+	}
+
+	// Deduplicated objects are shared between transactions and keep the metadata of their first upload
+	if !existingFile.Sha256.Valid {
+		if err := archiveBlocked(existingFile, time.Now()); err != nil {
+			return UploadedFile{}, err
+		}
+		getOpts, err := getObjectOptions(consumer, existingFile.SseMode, existingFile.SseCustomerKeyMd5, apiCfg)
+		if err != nil {
+			return UploadedFile{}, err
+		}
+		putOpts := putObjectOptions(consumer, existingFile, getOpts, apiCfg)
+		putOpts.Metadata = metadata
+		putOpts.Tags = tags
+		s3Client, err := apiCfg.s3ClientAt(c, existingFile.Bucket, existingFile.Region)
+		if err != nil {
+			return UploadedFile{}, err
+		}
+		versionID, err := s3Client.ReplaceObjectMetadata(existingFile.ObjectKey, putOpts)
+		if err != nil {
+			logging.FromContext(c).Error("error replacing object metadata", "error", err)
+			return UploadedFile{}, fmt.Errorf("error updating object metadata")
+		}
+		// Downloads are pinned to the stored version, which still holds the previous metadata
+		if versionID != "" {
+			err = apiCfg.DB.SetUploadedFileS3Version(c, database.SetUploadedFileS3VersionParams{
+				TransactionUuid: transactionUuid,
+				S3VersionID:     sql.NullString{String: versionID, Valid: true},
+			})
+			if err != nil {
+				logging.FromContext(c).Error("error recording object version", "error", err)
+				return UploadedFile{}, fmt.Errorf("error recording object version")
+			}
+		}
+	}
+	uploadedFile, err := apiCfg.DB.UpdateUploadedFileMetadata(c, database.UpdateUploadedFileMetadataParams{
+		TransactionUuid: transactionUuid,
+		Metadata:        encodeMetadata(metadata),
+		Tags:            encodeMetadata(tags),
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error updating uploaded file metadata", "error", err)
+		return UploadedFile{}, fmt.Errorf("error updating uploaded file metadata")
+	}
+	return DatabaseUploadFileToUploadFile(uploadedFile), nil
+}
+
+// ListFiles returns the consumer's files whose metadata and tags contain the given
+// key/value pairs and metadata keys
+func ListFiles(c *gin.Context, consumer string, params ListFilesParams, apiCfg *ApiConfig) ([]UploadedFile, error) {
+	limit := params.Limit
+	if limit <= 0 || limit > maxListResults {
+		limit = maxListResults
+	}
+	metadataKeys := make([]string, 0, len(params.MetadataKeys))
+	for _, k := range params.MetadataKeys {
+		metadataKeys = append(metadataKeys, strings.ToLower(k))
+	}
+	metadataFilter := make(map[string]string, len(params.Metadata))
+	for k, v := range params.Metadata {
+		metadataFilter[strings.ToLower(k)] = v
+	}
+	uploadedFiles, err := apiCfg.DB.ListUploadedFiles(c, database.ListUploadedFilesParams{
+		Consumer:       consumer,
+		UserName:       nullString(params.UserName),
+		MetadataFilter: encodeMetadata(metadataFilter),
+		MetadataKeys:   metadataKeys,
+		TagsFilter:     encodeMetadata(params.Tags),
+		SkipResults:    int32(params.Offset),
+		MaxResults:     int32(limit),
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error listing uploaded files", "error", err)
+		return nil, fmt.Errorf("error listing uploaded files")
+	}
+	files := make([]UploadedFile, 0, len(uploadedFiles))
+	for _, f := range uploadedFiles {
+		files = append(files, DatabaseUploadFileToUploadFile(f))
+	}
+	return files, nil
+}
+
+// putObjectOptions rebuilds the options an object was written with from its record
+func putObjectOptions(consumer string, uploadedFile database.UploadedFile, getOpts s3client.GetObjectOptions, apiCfg *ApiConfig) s3client.PutObjectOptions {
+	return s3client.PutObjectOptions{
+		Encryption:   recordedEncryption(consumer, uploadedFile.SseMode, uploadedFile.SseKmsKeyID, getOpts, apiCfg),
+		Metadata:     decodeMetadata(uploadedFile.Metadata),
+		Tags:         decodeMetadata(uploadedFile.Tags),
+		StorageClass: uploadedFile.StorageClass,
+		ObjectLock:   objectLock(uploadedFile.RetentionMode, uploadedFile.RetainUntil),
+	}
+}
+
+// recordedEncryption rebuilds the encryption an object was stored with, for requests
+// that write it again
+func recordedEncryption(consumer string, sseMode sql.NullString, sseKmsKeyID sql.NullString, getOpts s3client.GetObjectOptions, apiCfg *ApiConfig) s3client.Encryption {
+	if sseMode.String == s3client.EncryptionSSEC {
+		return getOpts.Encryption
+	}
+	return s3client.Encryption{
+		Mode:             sseMode.String,
+		KMSKeyID:         sseKmsKeyID.String,
+		BucketKeyEnabled: apiCfg.Encryption.For(consumer).BucketKeyEnabled,
+	}
+}
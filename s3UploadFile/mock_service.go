@@ -2,30 +2,137 @@ package s3uploadfile
 
 import (
 	"context"
+	"io"
 	"time"
 
 	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/google/uuid"
 )
 
 // Mock S3 Client
 type MockS3Client struct {
-	GeneratePresignedURLFunc         func(key string, expirationTime *int) (string, time.Duration, error)
-	GeneratePresignedDownloadURLFunc func(key string, expirationTime *int) (string, time.Duration, error)
+	GeneratePresignedURLFunc         func(key string, expirationTime *int, opts s3client.PutObjectOptions) (string, time.Duration, error)
+	GeneratePresignedDownloadURLFunc func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error)
+	GetObjectInfoFunc                func(key string, opts s3client.GetObjectOptions) (s3client.ObjectInfo, error)
+	DeleteObjectFunc                 func(key string) error
+	UploadObjectFunc                 func(key string, body io.Reader, opts s3client.PutObjectOptions) error
+	GetObjectFunc                    func(key string, opts s3client.GetObjectOptions) (io.ReadCloser, error)
+	ReplaceObjectMetadataFunc        func(key string, opts s3client.PutObjectOptions) (string, error)
+	ChangeStorageClassFunc           func(key string, opts s3client.PutObjectOptions) error
+	RestoreObjectFunc                func(key string, tier string, days int) error
+	SetLegalHoldFunc                 func(key string, enabled bool) error
+	MoveObjectFunc                   func(key string, destinationKey string, opts s3client.PutObjectOptions) error
+	GetObjectRangeFunc               func(key string, offset int64, length int64, opts s3client.GetObjectOptions) (io.ReadCloser, error)
 }
 
-func (m *MockS3Client) GeneratePresignedURL(key string, expirationTime *int) (string, time.Duration, error) {
-	return m.GeneratePresignedURLFunc(key, nil)
+func (m *MockS3Client) GeneratePresignedURL(key string, expirationTime *int, opts s3client.PutObjectOptions) (string, time.Duration, error) {
+	return m.GeneratePresignedURLFunc(key, expirationTime, opts)
 }
 
-func (m *MockS3Client) GeneratePresignedDownloadURL(key string, expirationTime *int) (string, time.Duration, error) {
-	return m.GeneratePresignedDownloadURLFunc(key, nil)
+func (m *MockS3Client) GeneratePresignedDownloadURL(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+	return m.GeneratePresignedDownloadURLFunc(key, expirationTime, opts)
+}
+
+func (m *MockS3Client) GetObjectInfo(key string, opts s3client.GetObjectOptions) (s3client.ObjectInfo, error) {
+	return m.GetObjectInfoFunc(key, opts)
+}
+
+func (m *MockS3Client) DeleteObject(key string) error {
+	return m.DeleteObjectFunc(key)
+}
+
+func (m *MockS3Client) UploadObject(key string, body io.Reader, opts s3client.PutObjectOptions) error {
+	return m.UploadObjectFunc(key, body, opts)
+}
+
+func (m *MockS3Client) GetObject(key string, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+	return m.GetObjectFunc(key, opts)
+}
+
+func (m *MockS3Client) ReplaceObjectMetadata(key string, opts s3client.PutObjectOptions) (string, error) {
+	return m.ReplaceObjectMetadataFunc(key, opts)
+}
+
+func (m *MockS3Client) ChangeStorageClass(key string, opts s3client.PutObjectOptions) error {
+	return m.ChangeStorageClassFunc(key, opts)
+}
+
+func (m *MockS3Client) RestoreObject(key string, tier string, days int) error {
+	return m.RestoreObjectFunc(key, tier, days)
+}
+
+func (m *MockS3Client) SetLegalHold(key string, enabled bool) error {
+	return m.SetLegalHoldFunc(key, enabled)
+}
+
+func (m *MockS3Client) MoveObject(key string, destinationKey string, opts s3client.PutObjectOptions) error {
+	return m.MoveObjectFunc(key, destinationKey, opts)
+}
+
+func (m *MockS3Client) GetObjectRange(key string, offset int64, length int64, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+	return m.GetObjectRangeFunc(key, offset, length, opts)
 }
 
 // Mock DB
 type MockDB struct {
-	CreateUploadedFileFunc func(ctx context.Context, arg database.CreateUploadedFileParams) (database.UploadedFile, error)
-	UpdateUploadedFileFunc func(ctx context.Context, arg database.UpdateUploadedFileParams) (database.UploadedFile, error)
-	GetUploadedFileFunc    func(ctx context.Context, arg database.GetUploadedFileParams) (database.UploadedFile, error)
+	CreateUploadedFileFunc              func(ctx context.Context, arg database.CreateUploadedFileParams) (database.UploadedFile, error)
+	UpdateUploadedFileFunc              func(ctx context.Context, arg database.UpdateUploadedFileParams) (database.UploadedFile, error)
+	GetUploadedFileFunc                 func(ctx context.Context, arg database.GetUploadedFileParams) (database.UploadedFile, error)
+	GetConsumerUploadedFileFunc         func(ctx context.Context, arg database.GetConsumerUploadedFileParams) (database.UploadedFile, error)
+	GetConsumerUploadedFileByKeyFunc    func(ctx context.Context, arg database.GetConsumerUploadedFileByKeyParams) (database.UploadedFile, error)
+	DeleteUploadedFileFunc              func(ctx context.Context, arg database.DeleteUploadedFileParams) (database.UploadedFile, error)
+	CompleteDeduplicatedUploadFunc      func(ctx context.Context, arg database.CompleteDeduplicatedUploadParams) (database.UploadedFile, error)
+	AcquireFileObjectFunc               func(ctx context.Context, arg database.AcquireFileObjectParams) (database.FileObject, error)
+	ReleaseFileObjectFunc               func(ctx context.Context, arg database.ReleaseFileObjectParams) (database.FileObject, error)
+	DeleteReleasedFileObjectFunc        func(ctx context.Context, arg database.DeleteReleasedFileObjectParams) (database.FileObject, error)
+	SetUploadedFileEnvelopeFunc         func(ctx context.Context, arg database.SetUploadedFileEnvelopeParams) (database.UploadedFile, error)
+	UpdateUploadedFileMetadataFunc      func(ctx context.Context, arg database.UpdateUploadedFileMetadataParams) (database.UploadedFile, error)
+	ListUploadedFilesFunc               func(ctx context.Context, arg database.ListUploadedFilesParams) ([]database.UploadedFile, error)
+	RecordUploadedFileDownloadFunc      func(ctx context.Context, transactionUuid uuid.UUID) error
+	ListIdleObjectsFunc                 func(ctx context.Context, arg database.ListIdleObjectsParams) ([]database.ListIdleObjectsRow, error)
+	SetObjectStorageClassFunc           func(ctx context.Context, arg database.SetObjectStorageClassParams) error
+	SetFileObjectStorageClassFunc       func(ctx context.Context, arg database.SetFileObjectStorageClassParams) error
+	CreateStorageTransitionFunc         func(ctx context.Context, arg database.CreateStorageTransitionParams) (database.StorageTransition, error)
+	SetUploadedFileRestoreFunc          func(ctx context.Context, arg database.SetUploadedFileRestoreParams) (database.UploadedFile, error)
+	ListPendingRestoresFunc             func(ctx context.Context, arg database.ListPendingRestoresParams) ([]database.UploadedFile, error)
+	CompleteUploadedFileRestoreFunc     func(ctx context.Context, arg database.CompleteUploadedFileRestoreParams) (database.UploadedFile, error)
+	ExpireUploadedFileRestoresFunc      func(ctx context.Context, arg database.ExpireUploadedFileRestoresParams) error
+	SetUploadedFileLegalHoldFunc        func(ctx context.Context, arg database.SetUploadedFileLegalHoldParams) (database.UploadedFile, error)
+	CreateLogicalFileFunc               func(ctx context.Context, arg database.CreateLogicalFileParams) (database.LogicalFile, error)
+	NextLogicalFileVersionFunc          func(ctx context.Context, arg database.NextLogicalFileVersionParams) (database.LogicalFile, error)
+	ListFileVersionsFunc                func(ctx context.Context, arg database.ListFileVersionsParams) ([]database.UploadedFile, error)
+	GetFileVersionFunc                  func(ctx context.Context, arg database.GetFileVersionParams) (database.UploadedFile, error)
+	SetUploadedFileS3VersionFunc        func(ctx context.Context, arg database.SetUploadedFileS3VersionParams) error
+	ListPendingScansFunc                func(ctx context.Context, arg database.ListPendingScansParams) ([]database.UploadedFile, error)
+	SetObjectScanResultFunc             func(ctx context.Context, arg database.SetObjectScanResultParams) error
+	RecordObjectScanAttemptFunc         func(ctx context.Context, arg database.RecordObjectScanAttemptParams) error
+	QuarantineObjectFunc                func(ctx context.Context, arg database.QuarantineObjectParams) error
+	DeleteFileObjectByKeyFunc           func(ctx context.Context, arg database.DeleteFileObjectByKeyParams) error
+	SetUploadedFileDetectedTypeFunc     func(ctx context.Context, arg database.SetUploadedFileDetectedTypeParams) error
+	ListPendingRenditionsFunc           func(ctx context.Context, arg database.ListPendingRenditionsParams) ([]database.UploadedFile, error)
+	SetUploadedFileRenditionStatusFunc  func(ctx context.Context, arg database.SetUploadedFileRenditionStatusParams) error
+	RecordRenditionAttemptFunc          func(ctx context.Context, transactionUuid uuid.UUID) error
+	CreateRenditionFunc                 func(ctx context.Context, arg database.CreateRenditionParams) (database.Rendition, error)
+	ListRenditionsFunc                  func(ctx context.Context, transactionUuid uuid.UUID) ([]database.Rendition, error)
+	SetUploadedFileSanitizedFunc        func(ctx context.Context, arg database.SetUploadedFileSanitizedParams) error
+	ListPendingExtractionsFunc          func(ctx context.Context, arg database.ListPendingExtractionsParams) ([]database.UploadedFile, error)
+	SetUploadedFileExtractionStatusFunc func(ctx context.Context, arg database.SetUploadedFileExtractionStatusParams) error
+	RecordExtractionAttemptFunc         func(ctx context.Context, transactionUuid uuid.UUID) error
+	UpsertFileContentFunc               func(ctx context.Context, arg database.UpsertFileContentParams) error
+	SearchUploadedFilesFunc             func(ctx context.Context, arg database.SearchUploadedFilesParams) ([]database.SearchUploadedFilesRow, error)
+	CreateShareLinkFunc                 func(ctx context.Context, arg database.CreateShareLinkParams) (database.ShareLink, error)
+	GetShareLinkByTokenHashFunc         func(ctx context.Context, tokenHash string) (database.GetShareLinkByTokenHashRow, error)
+	ListShareLinksFunc                  func(ctx context.Context, transactionUuid uuid.UUID) ([]database.ShareLink, error)
+	RevokeShareLinkFunc                 func(ctx context.Context, arg database.RevokeShareLinkParams) (database.ShareLink, error)
+	ClaimShareLinkDownloadFunc          func(ctx context.Context, id uuid.UUID) (database.ShareLink, error)
+	CreateShareLinkDownloadFunc         func(ctx context.Context, arg database.CreateShareLinkDownloadParams) error
+	CreateDownloadTokenFunc             func(ctx context.Context, arg database.CreateDownloadTokenParams) (database.DownloadToken, error)
+	GetDownloadTokenByTokenHashFunc     func(ctx context.Context, tokenHash string) (database.GetDownloadTokenByTokenHashRow, error)
+	TouchDownloadTokenFunc              func(ctx context.Context, id uuid.UUID) error
+	RevokeDownloadTokenFunc             func(ctx context.Context, arg database.RevokeDownloadTokenParams) (database.DownloadToken, error)
+	RevokeFileDownloadTokensFunc        func(ctx context.Context, transactionUuid uuid.UUID) (int64, error)
+	RevokeUserDownloadTokensFunc        func(ctx context.Context, arg database.RevokeUserDownloadTokensParams) (int64, error)
 }
 
 func (m *MockDB) CreateUploadedFile(ctx context.Context, arg database.CreateUploadedFileParams) (database.UploadedFile, error) {
@@ -40,8 +147,240 @@ func (m *MockDB) GetUploadedFile(ctx context.Context, arg database.GetUploadedFi
 	return m.GetUploadedFileFunc(ctx, arg)
 }
 
+func (m *MockDB) GetConsumerUploadedFile(ctx context.Context, arg database.GetConsumerUploadedFileParams) (database.UploadedFile, error) {
+	return m.GetConsumerUploadedFileFunc(ctx, arg)
+}
+
+func (m *MockDB) GetConsumerUploadedFileByKey(ctx context.Context, arg database.GetConsumerUploadedFileByKeyParams) (database.UploadedFile, error) {
+	return m.GetConsumerUploadedFileByKeyFunc(ctx, arg)
+}
+
+func (m *MockDB) DeleteUploadedFile(ctx context.Context, arg database.DeleteUploadedFileParams) (database.UploadedFile, error) {
+	return m.DeleteUploadedFileFunc(ctx, arg)
+}
+
+func (m *MockDB) CompleteDeduplicatedUpload(ctx context.Context, arg database.CompleteDeduplicatedUploadParams) (database.UploadedFile, error) {
+	return m.CompleteDeduplicatedUploadFunc(ctx, arg)
+}
+
+func (m *MockDB) AcquireFileObject(ctx context.Context, arg database.AcquireFileObjectParams) (database.FileObject, error) {
+	return m.AcquireFileObjectFunc(ctx, arg)
+}
+
+func (m *MockDB) ReleaseFileObject(ctx context.Context, arg database.ReleaseFileObjectParams) (database.FileObject, error) {
+	return m.ReleaseFileObjectFunc(ctx, arg)
+}
+
+func (m *MockDB) DeleteReleasedFileObject(ctx context.Context, arg database.DeleteReleasedFileObjectParams) (database.FileObject, error) {
+	return m.DeleteReleasedFileObjectFunc(ctx, arg)
+}
+
+func (m *MockDB) SetUploadedFileEnvelope(ctx context.Context, arg database.SetUploadedFileEnvelopeParams) (database.UploadedFile, error) {
+	return m.SetUploadedFileEnvelopeFunc(ctx, arg)
+}
+
+func (m *MockDB) UpdateUploadedFileMetadata(ctx context.Context, arg database.UpdateUploadedFileMetadataParams) (database.UploadedFile, error) {
+	return m.UpdateUploadedFileMetadataFunc(ctx, arg)
+}
+
+func (m *MockDB) ListUploadedFiles(ctx context.Context, arg database.ListUploadedFilesParams) ([]database.UploadedFile, error) {
+	return m.ListUploadedFilesFunc(ctx, arg)
+}
+
+func (m *MockDB) RecordUploadedFileDownload(ctx context.Context, transactionUuid uuid.UUID) error {
+	return m.RecordUploadedFileDownloadFunc(ctx, transactionUuid)
+}
+
+func (m *MockDB) ListIdleObjects(ctx context.Context, arg database.ListIdleObjectsParams) ([]database.ListIdleObjectsRow, error) {
+	return m.ListIdleObjectsFunc(ctx, arg)
+}
+
+func (m *MockDB) SetObjectStorageClass(ctx context.Context, arg database.SetObjectStorageClassParams) error {
+	return m.SetObjectStorageClassFunc(ctx, arg)
+}
+
+func (m *MockDB) SetFileObjectStorageClass(ctx context.Context, arg database.SetFileObjectStorageClassParams) error {
+	return m.SetFileObjectStorageClassFunc(ctx, arg)
+}
+
+func (m *MockDB) CreateStorageTransition(ctx context.Context, arg database.CreateStorageTransitionParams) (database.StorageTransition, error) {
+	return m.CreateStorageTransitionFunc(ctx, arg)
+}
+
+func (m *MockDB) SetUploadedFileRestore(ctx context.Context, arg database.SetUploadedFileRestoreParams) (database.UploadedFile, error) {
+	return m.SetUploadedFileRestoreFunc(ctx, arg)
+}
+
+func (m *MockDB) ListPendingRestores(ctx context.Context, arg database.ListPendingRestoresParams) ([]database.UploadedFile, error) {
+	return m.ListPendingRestoresFunc(ctx, arg)
+}
+
+func (m *MockDB) CompleteUploadedFileRestore(ctx context.Context, arg database.CompleteUploadedFileRestoreParams) (database.UploadedFile, error) {
+	return m.CompleteUploadedFileRestoreFunc(ctx, arg)
+}
+
+func (m *MockDB) ExpireUploadedFileRestores(ctx context.Context, arg database.ExpireUploadedFileRestoresParams) error {
+	return m.ExpireUploadedFileRestoresFunc(ctx, arg)
+}
+
+func (m *MockDB) SetUploadedFileLegalHold(ctx context.Context, arg database.SetUploadedFileLegalHoldParams) (database.UploadedFile, error) {
+	return m.SetUploadedFileLegalHoldFunc(ctx, arg)
+}
+
+func (m *MockDB) CreateLogicalFile(ctx context.Context, arg database.CreateLogicalFileParams) (database.LogicalFile, error) {
+	return m.CreateLogicalFileFunc(ctx, arg)
+}
+
+func (m *MockDB) NextLogicalFileVersion(ctx context.Context, arg database.NextLogicalFileVersionParams) (database.LogicalFile, error) {
+	return m.NextLogicalFileVersionFunc(ctx, arg)
+}
+
+func (m *MockDB) ListFileVersions(ctx context.Context, arg database.ListFileVersionsParams) ([]database.UploadedFile, error) {
+	return m.ListFileVersionsFunc(ctx, arg)
+}
+
+func (m *MockDB) GetFileVersion(ctx context.Context, arg database.GetFileVersionParams) (database.UploadedFile, error) {
+	return m.GetFileVersionFunc(ctx, arg)
+}
+
+func (m *MockDB) SetUploadedFileS3Version(ctx context.Context, arg database.SetUploadedFileS3VersionParams) error {
+	return m.SetUploadedFileS3VersionFunc(ctx, arg)
+}
+
+func (m *MockDB) ListPendingScans(ctx context.Context, arg database.ListPendingScansParams) ([]database.UploadedFile, error) {
+	return m.ListPendingScansFunc(ctx, arg)
+}
+
+func (m *MockDB) SetObjectScanResult(ctx context.Context, arg database.SetObjectScanResultParams) error {
+	return m.SetObjectScanResultFunc(ctx, arg)
+}
+
+func (m *MockDB) RecordObjectScanAttempt(ctx context.Context, arg database.RecordObjectScanAttemptParams) error {
+	return m.RecordObjectScanAttemptFunc(ctx, arg)
+}
+
+func (m *MockDB) QuarantineObject(ctx context.Context, arg database.QuarantineObjectParams) error {
+	return m.QuarantineObjectFunc(ctx, arg)
+}
+
+func (m *MockDB) DeleteFileObjectByKey(ctx context.Context, arg database.DeleteFileObjectByKeyParams) error {
+	return m.DeleteFileObjectByKeyFunc(ctx, arg)
+}
+
+func (m *MockDB) SetUploadedFileDetectedType(ctx context.Context, arg database.SetUploadedFileDetectedTypeParams) error {
+	return m.SetUploadedFileDetectedTypeFunc(ctx, arg)
+}
+
+func (m *MockDB) ListPendingRenditions(ctx context.Context, arg database.ListPendingRenditionsParams) ([]database.UploadedFile, error) {
+	return m.ListPendingRenditionsFunc(ctx, arg)
+}
+
+func (m *MockDB) SetUploadedFileRenditionStatus(ctx context.Context, arg database.SetUploadedFileRenditionStatusParams) error {
+	return m.SetUploadedFileRenditionStatusFunc(ctx, arg)
+}
+
+func (m *MockDB) RecordRenditionAttempt(ctx context.Context, transactionUuid uuid.UUID) error {
+	return m.RecordRenditionAttemptFunc(ctx, transactionUuid)
+}
+
+func (m *MockDB) CreateRendition(ctx context.Context, arg database.CreateRenditionParams) (database.Rendition, error) {
+	return m.CreateRenditionFunc(ctx, arg)
+}
+
+func (m *MockDB) ListRenditions(ctx context.Context, transactionUuid uuid.UUID) ([]database.Rendition, error) {
+	return m.ListRenditionsFunc(ctx, transactionUuid)
+}
+
+func (m *MockDB) SetUploadedFileSanitized(ctx context.Context, arg database.SetUploadedFileSanitizedParams) error {
+	return m.SetUploadedFileSanitizedFunc(ctx, arg)
+}
+
+func (m *MockDB) ListPendingExtractions(ctx context.Context, arg database.ListPendingExtractionsParams) ([]database.UploadedFile, error) {
+	return m.ListPendingExtractionsFunc(ctx, arg)
+}
+
+func (m *MockDB) SetUploadedFileExtractionStatus(ctx context.Context, arg database.SetUploadedFileExtractionStatusParams) error {
+	return m.SetUploadedFileExtractionStatusFunc(ctx, arg)
+}
+
+func (m *MockDB) RecordExtractionAttempt(ctx context.Context, transactionUuid uuid.UUID) error {
+	return m.RecordExtractionAttemptFunc(ctx, transactionUuid)
+}
+
+func (m *MockDB) UpsertFileContent(ctx context.Context, arg database.UpsertFileContentParams) error {
+	return m.UpsertFileContentFunc(ctx, arg)
+}
+
+func (m *MockDB) SearchUploadedFiles(ctx context.Context, arg database.SearchUploadedFilesParams) ([]database.SearchUploadedFilesRow, error) {
+	return m.SearchUploadedFilesFunc(ctx, arg)
+}
+
+func (m *MockDB) CreateShareLink(ctx context.Context, arg database.CreateShareLinkParams) (database.ShareLink, error) {
+	return m.CreateShareLinkFunc(ctx, arg)
+}
+
+func (m *MockDB) GetShareLinkByTokenHash(ctx context.Context, tokenHash string) (database.GetShareLinkByTokenHashRow, error) {
+	return m.GetShareLinkByTokenHashFunc(ctx, tokenHash)
+}
+
+func (m *MockDB) ListShareLinks(ctx context.Context, transactionUuid uuid.UUID) ([]database.ShareLink, error) {
+	return m.ListShareLinksFunc(ctx, transactionUuid)
+}
+
+func (m *MockDB) RevokeShareLink(ctx context.Context, arg database.RevokeShareLinkParams) (database.ShareLink, error) {
+	return m.RevokeShareLinkFunc(ctx, arg)
+}
+
+func (m *MockDB) ClaimShareLinkDownload(ctx context.Context, id uuid.UUID) (database.ShareLink, error) {
+	return m.ClaimShareLinkDownloadFunc(ctx, id)
+}
+
+func (m *MockDB) CreateShareLinkDownload(ctx context.Context, arg database.CreateShareLinkDownloadParams) error {
+	return m.CreateShareLinkDownloadFunc(ctx, arg)
+}
+
+func (m *MockDB) CreateDownloadToken(ctx context.Context, arg database.CreateDownloadTokenParams) (database.DownloadToken, error) {
+	return m.CreateDownloadTokenFunc(ctx, arg)
+}
+
+func (m *MockDB) GetDownloadTokenByTokenHash(ctx context.Context, tokenHash string) (database.GetDownloadTokenByTokenHashRow, error) {
+	return m.GetDownloadTokenByTokenHashFunc(ctx, tokenHash)
+}
+
+func (m *MockDB) TouchDownloadToken(ctx context.Context, id uuid.UUID) error {
+	return m.TouchDownloadTokenFunc(ctx, id)
+}
+
+func (m *MockDB) RevokeDownloadToken(ctx context.Context, arg database.RevokeDownloadTokenParams) (database.DownloadToken, error) {
+	return m.RevokeDownloadTokenFunc(ctx, arg)
+}
+
+func (m *MockDB) RevokeFileDownloadTokens(ctx context.Context, transactionUuid uuid.UUID) (int64, error) {
+	return m.RevokeFileDownloadTokensFunc(ctx, transactionUuid)
+}
+
+func (m *MockDB) RevokeUserDownloadTokens(ctx context.Context, arg database.RevokeUserDownloadTokensParams) (int64, error) {
+	return m.RevokeUserDownloadTokensFunc(ctx, arg)
+}
+
 // Verify that MockDB implements DBInterface
 var _ DBInterface = (*MockDB)(nil)
 
 // Verify that MockS3Client implements S3ClientInterface
 var _ S3ClientInterface = (*MockS3Client)(nil)
+
+type MockS3Router struct {
+	ResolveFunc func(consumer string, residency string) (s3client.Location, error)
+	ClientFunc  func(location s3client.Location) (s3client.S3ClientInterface, error)
+}
+
+func (m *MockS3Router) Resolve(consumer string, residency string) (s3client.Location, error) {
+	return m.ResolveFunc(consumer, residency)
+}
+
+func (m *MockS3Router) Client(location s3client.Location) (s3client.S3ClientInterface, error) {
+	return m.ClientFunc(location)
+}
+
+// Verify that MockS3Router implements S3RouterInterface
+var _ S3RouterInterface = (*MockS3Router)(nil)
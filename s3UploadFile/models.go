@@ -8,19 +8,57 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	StatusWaitingFile    = "Waiting file"
+	StatusFileUploaded   = "File Uploaded"
+	StatusAlreadyPresent = "File already present"
+)
+
 type UploadedFile struct {
 	TransactionUuid      uuid.UUID
 	Consumer             string
 	UserName             string
 	FileName             string
+	ObjectKey            string
 	FileSize             sql.NullInt32
 	FileType             sql.NullString
 	UploadPresignedUrl   string
-	DownloadPresignedUrl string
 	Status               string
 	CreatedAt            time.Time
 	UpdatedAt            time.Time
 	UploadExpirationTime time.Time
+	Sha256               string
+	Encryption           string
+	KmsKeyId             string
+	ClientEncryption     string
+	Metadata             map[string]string
+	Tags                 map[string]string
+	Bucket               string
+	Region               string
+	StorageClass         string
+	RestoreStatus        string
+	RestoreExpiresAt     time.Time
+	RetentionMode        string
+	RetainUntil          time.Time
+	LegalHold            bool
+	LogicalFileId        uuid.UUID
+	Version              int32
+	S3VersionId          string
+	ScanStatus           string
+	ScanSignature        string
+	DetectedType         string
+	TypeMismatch         bool
+	RenditionStatus      string
+	ExtractionStatus     string
+	StrippedMetadata     []string
+	SanitizedAt          time.Time
+	// The unsanitized upload is kept privately
+	OriginalKept bool
+	// Short-lived, minted for each upload, file status and file version response
+	DownloadPresignedUrl   string
+	DownloadExpirationTime time.Time
+	// Presigned thumbnails, only filled in by the file status
+	Renditions []Rendition `json:",omitempty"`
 }
 
 func DatabaseUploadFileToUploadFile(dbUploadFile database.UploadedFile) UploadedFile {
@@ -29,14 +67,40 @@ func DatabaseUploadFileToUploadFile(dbUploadFile database.UploadedFile) Uploaded
 		Consumer:             dbUploadFile.Consumer,
 		UserName:             dbUploadFile.UserName,
 		FileName:             dbUploadFile.FileName,
+		ObjectKey:            dbUploadFile.ObjectKey,
 		FileSize:             dbUploadFile.FileSize,
 		FileType:             dbUploadFile.FileType,
 		UploadPresignedUrl:   dbUploadFile.UploadPresignedUrl,
-		DownloadPresignedUrl: dbUploadFile.DownloadPresignedUrl.String,
 		Status:               dbUploadFile.Status,
 		CreatedAt:            dbUploadFile.CreatedAt,
 		UpdatedAt:            dbUploadFile.UpdatedAt.Time,
 		UploadExpirationTime: dbUploadFile.UploadExpirationTime.Time,
+		Sha256:               dbUploadFile.Sha256.String,
+		Encryption:           dbUploadFile.SseMode.String,
+		KmsKeyId:             dbUploadFile.SseKmsKeyID.String,
+		ClientEncryption:     dbUploadFile.EnvelopeAlgorithm.String,
+		Metadata:             decodeMetadata(dbUploadFile.Metadata),
+		Tags:                 decodeMetadata(dbUploadFile.Tags),
+		Bucket:               dbUploadFile.Bucket.String,
+		Region:               dbUploadFile.Region.String,
+		StorageClass:         dbUploadFile.StorageClass,
+		RestoreStatus:        dbUploadFile.RestoreStatus.String,
+		RestoreExpiresAt:     dbUploadFile.RestoreExpiresAt.Time,
+		RetentionMode:        dbUploadFile.RetentionMode.String,
+		RetainUntil:          dbUploadFile.RetainUntil.Time,
+		LegalHold:            dbUploadFile.LegalHold,
+		LogicalFileId:        dbUploadFile.LogicalFileID,
+		Version:              dbUploadFile.Version,
+		S3VersionId:          dbUploadFile.S3VersionID.String,
+		ScanStatus:           dbUploadFile.ScanStatus.String,
+		ScanSignature:        dbUploadFile.ScanSignature.String,
+		DetectedType:         dbUploadFile.DetectedType.String,
+		TypeMismatch:         dbUploadFile.TypeMismatch,
+		RenditionStatus:      dbUploadFile.RenditionStatus.String,
+		ExtractionStatus:     dbUploadFile.ExtractionStatus.String,
+		StrippedMetadata:     dbUploadFile.StrippedMetadata,
+		SanitizedAt:          dbUploadFile.SanitizedAt.Time,
+		OriginalKept:         dbUploadFile.OriginalObjectKey.Valid,
 	}
 }
 
@@ -45,10 +109,83 @@ type UploadsFileParams struct {
 	FileName               string `json:"fileName" binding:"required"`
 	FileExtention          string `json:"fileExtention" binding:"required"`
 	LinkExpirationDuration *int   `json:"linkExpirationDuration,omitempty"`
+	// Hex encoded SHA-256 of the file, enables deduplication of identical uploads
+	Sha256 *string `json:"sha256,omitempty" binding:"omitempty,len=64,hexadecimal"`
+	// Business identifiers, written to S3 as x-amz-meta-* headers and object tags
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	// Data-residency tag selecting one of the consumer's configured buckets, e.g. "eu"
+	Residency string `json:"residency,omitempty"`
+	// STANDARD_IA, INTELLIGENT_TIERING, GLACIER_IR or DEEP_ARCHIVE when the consumer's policy allows it
+	StorageClass string `json:"storageClass,omitempty"`
+	// Adds the upload as a new version of an existing logical file instead of starting a new one
+	LogicalFileId *uuid.UUID `json:"logicalFileId,omitempty"`
 }
 
 type UploadCompletedParams struct {
-	FileName string `json:"fileName" binding:"required"`
+	TransactionUuid *uuid.UUID `json:"transactionUuid" binding:"required_without=FileName"`
+	// Deprecated: object key returned by the upload request, use TransactionUuid
+	FileName string `json:"fileName" binding:"required_without=TransactionUuid"`
 	FileSize int64  `json:"fileSize" binding:"required"`
 	FileType string `json:"fileType" binding:"required"`
 }
+
+type RestoreParams struct {
+	UserName string `json:"userName" binding:"required"`
+	// Bulk, Standard (default) or Expedited, which DEEP_ARCHIVE does not support
+	Tier string `json:"tier,omitempty" binding:"omitempty,oneof=Bulk Standard Expedited"`
+	// How long the restored copy stays available, 1 day by default
+	Days int `json:"days,omitempty" binding:"omitempty,min=1,max=30"`
+}
+
+type LegalHoldParams struct {
+	UserName string `json:"userName" binding:"required"`
+	Enabled  *bool  `json:"enabled" binding:"required"`
+}
+
+type CreateShareLinkParams struct {
+	UserName string `json:"userName" binding:"required"`
+	// Optional, recipients send it in the X-Share-Password header
+	Password string `json:"password,omitempty" binding:"omitempty,min=8"`
+	// Seconds the link stays usable, forever when omitted
+	ExpiresIn    int   `json:"expiresIn,omitempty" binding:"omitempty,min=1"`
+	MaxDownloads int32 `json:"maxDownloads,omitempty" binding:"omitempty,min=1"`
+	// CIDR ranges or single addresses allowed to redeem the link, any when empty
+	AllowedIpRanges []string `json:"allowedIpRanges,omitempty"`
+}
+
+type CreateDownloadTokenParams struct {
+	UserName string `json:"userName" binding:"required"`
+	// Seconds the token stays usable, 24 hours by default and 7 days at most
+	ExpiresIn int `json:"expiresIn,omitempty" binding:"omitempty,min=1"`
+}
+
+type UpdateMetadataParams struct {
+	UserName string `json:"userName" binding:"required"`
+	// A nil map leaves the current values untouched, an empty one clears them
+	Metadata map[string]string `json:"metadata"`
+	Tags     map[string]string `json:"tags"`
+}
+
+type SearchFilesParams struct {
+	UserName string
+	Query    string
+	Limit    int
+	Offset   int
+}
+
+type SearchResult struct {
+	UploadedFile
+	Rank float32
+	// Matching fragments of the document, matches wrapped in <mark></mark>
+	Snippet string
+}
+
+type ListFilesParams struct {
+	UserName     string
+	Metadata     map[string]string
+	MetadataKeys []string
+	Tags         map[string]string
+	Limit        int
+	Offset       int
+}
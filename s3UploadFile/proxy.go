@@ -0,0 +1,239 @@
+package s3uploadfile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/OliPou/s3are/envelope"
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrFileAlreadyUploaded     = errors.New("file already uploaded")
+	ErrFileNotUploaded         = errors.New("file not uploaded yet")
+	ErrPresignedUploadRequired = errors.New("deduplicated files must be uploaded with the presigned URL")
+)
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// UploadFileContent streams a file through the service to S3, encrypting it
+// client-side first when the consumer requires envelope encryption.
+func UploadFileContent(c *gin.Context, transactionUuid uuid.UUID, consumer string, userName string, body io.Reader, contentType string, apiCfg *ApiConfig) (UploadedFile, error) {
+	existingFile, err := apiCfg.DB.GetUploadedFile(c, database.GetUploadedFileParams{
+		TransactionUuid: transactionUuid,
+		Consumer:        consumer,
+		UserName:        userName,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UploadedFile{}, ErrFileNotFound
+		}
+		logging.FromContext(c).Error("error getting uploaded file", "error", err)
+		return UploadedFile{}, fmt.Errorf("error getting uploaded file")
+	}
+	if existingFile.Status != StatusWaitingFile {
+		return UploadedFile{}, ErrFileAlreadyUploaded
+	}
+	if existingFile.Sha256.Valid {
+		return UploadedFile{}, ErrPresignedUploadRequired
+	}
+	getOpts, err := getObjectOptions(consumer, existingFile.SseMode, existingFile.SseCustomerKeyMd5, apiCfg)
+	if err != nil {
+		return UploadedFile{}, err
+	}
+	putOpts := putObjectOptions(consumer, existingFile, getOpts, apiCfg)
+	s3Client, err := apiCfg.s3ClientAt(c, existingFile.Bucket, existingFile.Region)
+	if err != nil {
+		return UploadedFile{}, err
+	}
+
+	header, body, err := sniffContent(body)
+	if err != nil {
+		logging.FromContext(c).Error("error reading upload", "error", err)
+		return UploadedFile{}, fmt.Errorf("error reading upload")
+	}
+	detectedType, err := recordDetectedType(c, existingFile, header, contentType, apiCfg)
+	if err != nil {
+		return UploadedFile{}, err
+	}
+
+	envelopeEncrypted := apiCfg.envelopeEnabled(consumer)
+	// Ciphertext cannot be rewritten once stored, envelope encrypted images are stripped
+	// on the way in and their original is never kept
+	var stripper *strippingReader
+	if envelopeEncrypted && apiCfg.stripsMetadata(consumer, detectedType) {
+		stripper = newStrippingReader(body, detectedType)
+		defer stripper.Close()
+		body = stripper
+	}
+	counter := &countingReader{r: body}
+	var reader io.Reader = counter
+	if envelopeEncrypted {
+		dataKey, envelopeParams, err := envelope.NewDataKey(apiCfg.KeyProvider, consumer)
+		if err != nil {
+			logging.FromContext(c).Error("error generating data key", "error", err)
+			return UploadedFile{}, fmt.Errorf("error generating data key")
+		}
+		// The wrapped key is recorded before anything reaches S3 so no ciphertext is ever orphaned
+		_, err = apiCfg.DB.SetUploadedFileEnvelope(c, database.SetUploadedFileEnvelopeParams{
+			TransactionUuid:    transactionUuid,
+			EnvelopeAlgorithm:  sql.NullString{String: envelope.Algorithm, Valid: true},
+			EnvelopeKeyID:      sql.NullString{String: envelopeParams.KeyID, Valid: true},
+			EnvelopeWrappedKey: envelopeParams.WrappedKey,
+			EnvelopeNonce:      envelopeParams.Nonce,
+			EnvelopeChunkSize:  sql.NullInt32{Int32: int32(envelopeParams.ChunkSize), Valid: true},
+		})
+		if err != nil {
+			logging.FromContext(c).Error("error storing data key", "error", err)
+			return UploadedFile{}, fmt.Errorf("error storing data key")
+		}
+		reader, err = envelope.NewEncryptingReader(counter, dataKey, envelopeParams.Nonce, envelopeParams.ChunkSize)
+		if err != nil {
+			return UploadedFile{}, err
+		}
+	}
+	if err := s3Client.UploadObject(existingFile.ObjectKey, reader, putOpts); err != nil {
+		if stripper != nil {
+			if err := stripper.failure(); err != nil {
+				return UploadedFile{}, err
+			}
+		}
+		logging.FromContext(c).Error("error uploading object", "error", err)
+		return UploadedFile{}, fmt.Errorf("error uploading file")
+	}
+	fileSize := counter.n
+	var removed []string
+	if stripper != nil {
+		if removed, err = stripper.result(); err != nil {
+			return UploadedFile{}, err
+		}
+	}
+	switch {
+	case len(removed) > 0:
+		if err := recordSanitized(c, existingFile, removed, sql.NullString{}, apiCfg); err != nil {
+			return UploadedFile{}, err
+		}
+	case !envelopeEncrypted:
+		sanitizedSize, _, err := sanitizeObject(c, existingFile, detectedType, getOpts, s3Client, apiCfg)
+		if err != nil {
+			return UploadedFile{}, err
+		}
+		if sanitizedSize > 0 {
+			fileSize = sanitizedSize
+		}
+	}
+	recordS3Version(c, transactionUuid, existingFile.ObjectKey, getOpts, s3Client, apiCfg)
+
+	uploadedFile, err := apiCfg.DB.UpdateUploadedFile(c, database.UpdateUploadedFileParams{
+		TransactionUuid: transactionUuid,
+		ObjectKey:       existingFile.ObjectKey,
+		FileSize: sql.NullInt32{
+			Int32: int32(fileSize),
+			Valid: true,
+		},
+		FileType: nullString(contentType),
+		Status:   StatusFileUploaded,
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error updating uploaded file", "error", err)
+		return UploadedFile{}, fmt.Errorf("error updating uploaded file: %w", err)
+	}
+	return withDownloadURL(c, DatabaseUploadFileToUploadFile(uploadedFile), uploadedFile, false, apiCfg), nil
+}
+
+// DownloadFileContent streams a file from S3 through the service, decrypting envelope
+// encrypted files on the way. The caller must close the returned body.
+func DownloadFileContent(c *gin.Context, transactionUuid uuid.UUID, consumer string, userName string, apiCfg *ApiConfig) (UploadedFile, io.ReadCloser, error) {
+	uploadedFile, err := apiCfg.DB.GetUploadedFile(c, database.GetUploadedFileParams{
+		TransactionUuid: transactionUuid,
+		Consumer:        consumer,
+		UserName:        userName,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UploadedFile{}, nil, ErrFileNotFound
+		}
+		logging.FromContext(c).Error("error getting uploaded file", "error", err)
+		return UploadedFile{}, nil, fmt.Errorf("error getting uploaded file")
+	}
+	if uploadedFile.Status == StatusWaitingFile {
+		return UploadedFile{}, nil, ErrFileNotUploaded
+	}
+	if err := downloadBlocked(uploadedFile, time.Now()); err != nil {
+		return UploadedFile{}, nil, err
+	}
+	body, err := openObject(c, uploadedFile, apiCfg)
+	if err != nil {
+		return UploadedFile{}, nil, err
+	}
+	recordDownload(c, uploadedFile, apiCfg)
+	return DatabaseUploadFileToUploadFile(uploadedFile), body, nil
+}
+
+// openObject streams the plaintext of a stored file, decrypting envelope encrypted
+// files on the way. The caller must close the returned body.
+func openObject(ctx context.Context, uploadedFile database.UploadedFile, apiCfg *ApiConfig) (io.ReadCloser, error) {
+	consumer := uploadedFile.Consumer
+	getOpts, err := getObjectOptions(consumer, uploadedFile.SseMode, uploadedFile.SseCustomerKeyMd5, apiCfg)
+	if err != nil {
+		return nil, err
+	}
+	var dataKey []byte
+	if uploadedFile.EnvelopeAlgorithm.Valid {
+		if uploadedFile.EnvelopeAlgorithm.String != envelope.Algorithm || apiCfg.KeyProvider == nil {
+			return nil, ErrEncryptionKeyUnavailable
+		}
+		dataKey, err = envelope.OpenDataKey(apiCfg.KeyProvider, consumer, envelopeParams(uploadedFile))
+		if err != nil {
+			logging.FromContext(ctx).Error("error opening data key", "error", err)
+			return nil, ErrEncryptionKeyUnavailable
+		}
+	}
+	getOpts.VersionID = uploadedFile.S3VersionID.String
+	s3Client, err := apiCfg.s3ClientAt(ctx, uploadedFile.Bucket, uploadedFile.Region)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s3Client.GetObject(uploadedFile.ObjectKey, getOpts)
+	if err != nil {
+		logging.FromContext(ctx).Error("error getting object", "error", err)
+		return nil, fmt.Errorf("error downloading file")
+	}
+	if dataKey == nil {
+		return body, nil
+	}
+	plaintext, err := envelope.NewDecryptingReader(body, dataKey, uploadedFile.EnvelopeNonce, int(uploadedFile.EnvelopeChunkSize.Int32))
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{plaintext, body}, nil
+}
+
+func envelopeParams(uploadedFile database.UploadedFile) envelope.Params {
+	return envelope.Params{
+		KeyID:      uploadedFile.EnvelopeKeyID.String,
+		WrappedKey: uploadedFile.EnvelopeWrappedKey,
+		Nonce:      uploadedFile.EnvelopeNonce,
+		ChunkSize:  int(uploadedFile.EnvelopeChunkSize.Int32),
+	}
+}
@@ -0,0 +1,258 @@
+package s3uploadfile
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/metrics"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/OliPou/s3are/thumbnail"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	RenditionPending = "Pending"
+	RenditionDone    = "Done"
+	RenditionFailed  = "Failed"
+	// The original was archived, it is not restored for its thumbnails
+	RenditionSkipped = "Skipped"
+
+	// Renditions are stored under renditions/<transaction uuid>/<size name>
+	renditionPrefix = "renditions/"
+	// Larger originals are not rendered
+	maxRenditionSource = 64 << 20
+	renditionBatchSize = 10
+	// Files that failed to render this many times are given up on as Failed
+	maxRenditionAttempts = 10
+)
+
+var (
+	ErrRenditionsNotReady = errors.New("renditions are not rendered yet")
+	ErrCloudFrontDisabled = errors.New("downloads of this consumer are not served by CloudFront")
+)
+
+type Rendition struct {
+	Name                   string
+	Width                  int32
+	Height                 int32
+	ContentType            string
+	FileSize               int32
+	DownloadPresignedUrl   string
+	DownloadExpirationTime time.Time
+}
+
+// initialRenditionStatus marks completed images for the rendition worker. Envelope
+// encrypted files are skipped, their previews would be stored in the clear.
+func (apiCfg *ApiConfig) initialRenditionStatus(consumer string, detectedType string) sql.NullString {
+	if len(apiCfg.ThumbnailSizes) == 0 || apiCfg.envelopeEnabled(consumer) || !thumbnail.Supported(detectedType) {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: RenditionPending, Valid: true}
+}
+
+func renditionKey(transactionUuid uuid.UUID, name string, extension string) string {
+	return renditionPrefix + transactionUuid.String() + "/" + name + extension
+}
+
+// RunRenditions renders the thumbnails of completed images and returns how many were processed
+func RunRenditions(ctx context.Context, apiCfg *ApiConfig) (int, error) {
+	pending, err := apiCfg.DB.ListPendingRenditions(ctx, database.ListPendingRenditionsParams{
+		PendingStatus: sql.NullString{String: RenditionPending, Valid: true},
+		WaitingStatus: StatusWaitingFile,
+		CleanStatus:   sql.NullString{String: ScanClean, Valid: true},
+		MaxResults:    renditionBatchSize,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("error listing pending renditions", "error", err)
+		return 0, fmt.Errorf("error listing pending renditions")
+	}
+	rendered := 0
+	for _, uploadedFile := range pending {
+		status := RenditionDone
+		// Archived originals can only be read once restored
+		if archiveBlocked(uploadedFile, time.Now()) != nil {
+			status = RenditionSkipped
+		} else if err := renderFile(ctx, uploadedFile, apiCfg); err != nil {
+			logging.FromContext(ctx).Error("error rendering", "transaction_uuid", uploadedFile.TransactionUuid, "error", err)
+			unrenderable := errors.Is(err, thumbnail.ErrUnsupportedImage) || errors.Is(err, thumbnail.ErrImageTooLarge)
+			if !unrenderable && uploadedFile.RenditionAttempts+1 < maxRenditionAttempts {
+				// Retried after a backoff, the rest of the queue goes first
+				if err := apiCfg.DB.RecordRenditionAttempt(ctx, uploadedFile.TransactionUuid); err != nil {
+					logging.FromContext(ctx).Error("error recording rendition attempt", "error", err)
+				}
+				continue
+			}
+			status = RenditionFailed
+		}
+		err := apiCfg.DB.SetUploadedFileRenditionStatus(ctx, database.SetUploadedFileRenditionStatusParams{
+			TransactionUuid: uploadedFile.TransactionUuid,
+			RenditionStatus: sql.NullString{String: status, Valid: true},
+		})
+		if err != nil {
+			logging.FromContext(ctx).Error("error recording rendition status", "error", err)
+			continue
+		}
+		rendered++
+	}
+	return rendered, nil
+}
+
+func renderFile(ctx context.Context, uploadedFile database.UploadedFile, apiCfg *ApiConfig) error {
+	body, err := openObject(ctx, uploadedFile, apiCfg)
+	if err != nil {
+		return err
+	}
+	src, err := io.ReadAll(io.LimitReader(body, maxRenditionSource+1))
+	body.Close()
+	if err != nil {
+		return err
+	}
+	if len(src) > maxRenditionSource {
+		return fmt.Errorf("%w: larger than %d bytes", thumbnail.ErrImageTooLarge, maxRenditionSource)
+	}
+	renditions, err := thumbnail.Render(src, apiCfg.ThumbnailSizes)
+	if err != nil {
+		return err
+	}
+	getOpts, err := getObjectOptions(uploadedFile.Consumer, uploadedFile.SseMode, uploadedFile.SseCustomerKeyMd5, apiCfg)
+	if err != nil {
+		return err
+	}
+	s3Client, err := apiCfg.s3ClientAt(ctx, uploadedFile.Bucket, uploadedFile.Region)
+	if err != nil {
+		return err
+	}
+	// Renditions are encrypted like their original
+	putOpts := s3client.PutObjectOptions{Encryption: putObjectOptions(uploadedFile.Consumer, uploadedFile, getOpts, apiCfg).Encryption}
+	for _, rendition := range renditions {
+		key := renditionKey(uploadedFile.TransactionUuid, rendition.Name, rendition.Extension)
+		if err := s3Client.UploadObject(key, bytes.NewReader(rendition.Data), putOpts); err != nil {
+			return err
+		}
+		_, err := apiCfg.DB.CreateRendition(ctx, database.CreateRenditionParams{
+			TransactionUuid: uploadedFile.TransactionUuid,
+			Name:            rendition.Name,
+			ObjectKey:       key,
+			Width:           int32(rendition.Width),
+			Height:          int32(rendition.Height),
+			ContentType:     rendition.ContentType,
+			FileSize:        int32(len(rendition.Data)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renditionsOf presigns a download URL for each rendition of a file
+func renditionsOf(ctx context.Context, uploadedFile database.UploadedFile, apiCfg *ApiConfig) ([]Rendition, error) {
+	if uploadedFile.RenditionStatus.String != RenditionDone {
+		return nil, nil
+	}
+	dbRenditions, err := apiCfg.DB.ListRenditions(ctx, uploadedFile.TransactionUuid)
+	if err != nil {
+		logging.FromContext(ctx).Error("error listing renditions", "error", err)
+		return nil, fmt.Errorf("error listing renditions")
+	}
+	getOpts, err := getObjectOptions(uploadedFile.Consumer, uploadedFile.SseMode, uploadedFile.SseCustomerKeyMd5, apiCfg)
+	if err != nil {
+		return nil, err
+	}
+	s3Client, err := apiCfg.s3ClientAt(ctx, uploadedFile.Bucket, uploadedFile.Region)
+	if err != nil {
+		return nil, err
+	}
+	renditions := make([]Rendition, 0, len(dbRenditions))
+	expiration := redirectURLExpiration
+	for _, dbRendition := range dbRenditions {
+		presignedURL, duration, err := apiCfg.downloadURL(uploadedFile.Consumer, s3Client, dbRendition.ObjectKey, &expiration, getOpts)
+		if err != nil {
+			logging.FromContext(ctx).Error("error generating presigned URL", "error", err)
+			return nil, fmt.Errorf("error generating presigned URL")
+		}
+		renditions = append(renditions, Rendition{
+			Name:                   dbRendition.Name,
+			Width:                  dbRendition.Width,
+			Height:                 dbRendition.Height,
+			ContentType:            dbRendition.ContentType,
+			FileSize:               dbRendition.FileSize,
+			DownloadPresignedUrl:   presignedURL,
+			DownloadExpirationTime: time.Now().Add(duration),
+		})
+	}
+	return renditions, nil
+}
+
+// RenditionCookies grants access to a whole directory of renditions at once
+type RenditionCookies struct {
+	// Key prefix the cookies are valid for, relative to the distribution's domain
+	Prefix    string
+	ExpiresAt time.Time
+	Cookies   []*http.Cookie `json:"-"`
+}
+
+// SignRenditionCookies signs CloudFront cookies for the directory of a file's renditions
+func SignRenditionCookies(c *gin.Context, transactionUuid uuid.UUID, consumer string, userName string, apiCfg *ApiConfig) (RenditionCookies, error) {
+	uploadedFile, err := ownedFile(c, transactionUuid, consumer, userName, apiCfg)
+	if err != nil {
+		return RenditionCookies{}, err
+	}
+	distribution := apiCfg.CloudFront.For(consumer)
+	// CloudFront cannot forward the customer key of SSE-C objects
+	if !distribution.Enabled() || uploadedFile.SseMode.String == s3client.EncryptionSSEC {
+		return RenditionCookies{}, ErrCloudFrontDisabled
+	}
+	if err := scanBlocked(uploadedFile); err != nil {
+		return RenditionCookies{}, err
+	}
+	if uploadedFile.RenditionStatus.String != RenditionDone {
+		return RenditionCookies{}, ErrRenditionsNotReady
+	}
+	prefix := renditionKey(uploadedFile.TransactionUuid, "", "")
+	expiresAt := time.Now().Add(s3client.DefaultPresignedURLExpiration)
+	cookies, err := distribution.SignCookies(prefix, expiresAt)
+	if err != nil {
+		logging.FromContext(c).Error("error signing rendition cookies", "error", err)
+		return RenditionCookies{}, fmt.Errorf("error signing rendition cookies")
+	}
+	return RenditionCookies{Prefix: prefix, ExpiresAt: expiresAt, Cookies: cookies}, nil
+}
+
+// deleteRenditions removes the rendition objects of a deleted transaction, their rows
+// go with the transaction
+func deleteRenditions(ctx context.Context, renditions []database.Rendition, s3Client S3ClientInterface) {
+	for _, rendition := range renditions {
+		if err := s3Client.DeleteObject(rendition.ObjectKey); err != nil {
+			logging.FromContext(ctx).Error("error deleting rendition", "object_key", rendition.ObjectKey, "error", err)
+		}
+	}
+}
+
+// StartRenditionWorker runs RunRenditions every interval until ctx is done
+func StartRenditionWorker(ctx context.Context, apiCfg *ApiConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			n, err := RunRenditions(ctx, apiCfg)
+			metrics.ObserveWorkerRun("rendition", start, n, err)
+			if err == nil && n > 0 {
+				logging.FromContext(ctx).Info("rendered thumbnails", "files", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package s3uploadfile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/metrics"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	RestoreInProgress = "Restore in progress"
+	RestoreCompleted  = "Restored"
+	RestoreExpired    = "Restore expired"
+
+	restoreBatchSize = 100
+)
+
+var (
+	ErrFileNotArchived    = errors.New("file is not archived")
+	ErrFileArchived       = errors.New("file is archived, request a restore first")
+	ErrInvalidRestoreTier = errors.New("invalid restore tier")
+)
+
+// downloadBlocked explains why an object cannot be read yet, nil when it can
+func downloadBlocked(uploadedFile database.UploadedFile, now time.Time) error {
+	if err := scanBlocked(uploadedFile); err != nil {
+		return err
+	}
+	return archiveBlocked(uploadedFile, now)
+}
+
+// archiveBlocked refuses archived objects unless a restored copy exists
+func archiveBlocked(uploadedFile database.UploadedFile, now time.Time) error {
+	if !s3client.IsArchiveStorageClass(uploadedFile.StorageClass) {
+		return nil
+	}
+	if uploadedFile.RestoreStatus.String == RestoreCompleted && uploadedFile.RestoreExpiresAt.Time.After(now) {
+		return nil
+	}
+	return ErrFileArchived
+}
+
+func downloadAvailable(uploadedFile database.UploadedFile, now time.Time) bool {
+	return downloadBlocked(uploadedFile, now) == nil
+}
+
+// RequestRestore asks S3 for a temporary copy of an archived file. Download URLs are
+// only issued once S3 reports the copy available.
+func RequestRestore(c *gin.Context, transactionUuid uuid.UUID, consumer string, params RestoreParams, apiCfg *ApiConfig) (UploadedFile, error) {
+	existingFile, err := apiCfg.DB.GetUploadedFile(c, database.GetUploadedFileParams{
+		TransactionUuid: transactionUuid,
+		Consumer:        consumer,
+		UserName:        params.UserName,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UploadedFile{}, ErrFileNotFound
+		}
+		logging.FromContext(c).Error("error getting uploaded file", "error", err)
+		return UploadedFile{}, fmt.Errorf("error getting uploaded file")
+	}
+	if existingFile.Status == StatusWaitingFile {
+		return UploadedFile{}, ErrFileNotUploaded
+	}
+	if !s3client.IsArchiveStorageClass(existingFile.StorageClass) {
+		return UploadedFile{}, ErrFileNotArchived
+	}
+	tier := params.Tier
+	if tier == "" {
+		tier = "Standard"
+	}
+	if err := s3client.ValidateRestoreTier(existingFile.StorageClass, tier); err != nil {
+		return UploadedFile{}, fmt.Errorf("%w: %v", ErrInvalidRestoreTier, err)
+	}
+	days := params.Days
+	if days == 0 {
+		days = 1
+	}
+	s3Client, err := apiCfg.s3ClientAt(c, existingFile.Bucket, existingFile.Region)
+	if err != nil {
+		return UploadedFile{}, err
+	}
+	if err := s3Client.RestoreObject(existingFile.ObjectKey, tier, days); err != nil {
+		logging.FromContext(c).Error("error restoring object", "error", err)
+		return UploadedFile{}, fmt.Errorf("error requesting restore")
+	}
+	uploadedFile, err := apiCfg.DB.SetUploadedFileRestore(c, database.SetUploadedFileRestoreParams{
+		TransactionUuid: transactionUuid,
+		RestoreStatus:   sql.NullString{String: RestoreInProgress, Valid: true},
+		RestoreTier:     sql.NullString{String: tier, Valid: true},
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error recording restore", "error", err)
+		return UploadedFile{}, fmt.Errorf("error recording restore")
+	}
+	// An already restored copy only has its expiry extended, it stays available
+	if restored, err := checkRestore(c, uploadedFile, apiCfg); err == nil {
+		uploadedFile = restored
+	}
+	return DatabaseUploadFileToUploadFile(uploadedFile), nil
+}
+
+// checkRestore records a restore as completed once S3 reports the temporary copy
+// available, the file status then hands out download URLs again
+func checkRestore(ctx context.Context, uploadedFile database.UploadedFile, apiCfg *ApiConfig) (database.UploadedFile, error) {
+	getOpts, err := getObjectOptions(uploadedFile.Consumer, uploadedFile.SseMode, uploadedFile.SseCustomerKeyMd5, apiCfg)
+	if err != nil {
+		return uploadedFile, err
+	}
+	s3Client, err := apiCfg.s3ClientAt(ctx, uploadedFile.Bucket, uploadedFile.Region)
+	if err != nil {
+		return uploadedFile, err
+	}
+	objectInfo, err := s3Client.GetObjectInfo(uploadedFile.ObjectKey, getOpts)
+	if err != nil {
+		return uploadedFile, err
+	}
+	if objectInfo.RestoreInProgress || objectInfo.RestoreExpiryDate.IsZero() {
+		return uploadedFile, nil
+	}
+	return apiCfg.DB.CompleteUploadedFileRestore(ctx, database.CompleteUploadedFileRestoreParams{
+		TransactionUuid:  uploadedFile.TransactionUuid,
+		RestoreStatus:    sql.NullString{String: RestoreCompleted, Valid: true},
+		RestoreExpiresAt: sql.NullTime{Time: objectInfo.RestoreExpiryDate, Valid: true},
+	})
+}
+
+// RunRestoreChecks polls S3 for pending restores and expires restored copies that S3
+// has deleted again. It returns how many restores completed.
+func RunRestoreChecks(ctx context.Context, apiCfg *ApiConfig, now time.Time) (int, error) {
+	err := apiCfg.DB.ExpireUploadedFileRestores(ctx, database.ExpireUploadedFileRestoresParams{
+		ExpiredStatus:   sql.NullString{String: RestoreExpired, Valid: true},
+		CompletedStatus: sql.NullString{String: RestoreCompleted, Valid: true},
+		Now:             now,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("error expiring restores", "error", err)
+		return 0, fmt.Errorf("error expiring restores")
+	}
+	pending, err := apiCfg.DB.ListPendingRestores(ctx, database.ListPendingRestoresParams{
+		RestoreStatus: sql.NullString{String: RestoreInProgress, Valid: true},
+		Limit:         restoreBatchSize,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("error listing pending restores", "error", err)
+		return 0, fmt.Errorf("error listing pending restores")
+	}
+	completed := 0
+	for _, uploadedFile := range pending {
+		restored, err := checkRestore(ctx, uploadedFile, apiCfg)
+		if err != nil {
+			logging.FromContext(ctx).Error("error checking restore of", "transaction_uuid", uploadedFile.TransactionUuid, "error", err)
+			continue
+		}
+		if restored.RestoreStatus.String == RestoreCompleted {
+			completed++
+		}
+	}
+	return completed, nil
+}
+
+// StartRestoreWorker runs RunRestoreChecks every interval until ctx is done
+func StartRestoreWorker(ctx context.Context, apiCfg *ApiConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			start := time.Now()
+			n, err := RunRestoreChecks(ctx, apiCfg, now)
+			metrics.ObserveWorkerRun("restore", start, n, err)
+			if err == nil && n > 0 {
+				logging.FromContext(ctx).Info("restored archived files", "files", n)
+			}
+		}
+	}
+}
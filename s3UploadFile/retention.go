@@ -0,0 +1,72 @@
+package s3uploadfile
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var ErrFileLocked = errors.New("file is locked")
+
+// lockError explains why a file cannot be deleted, nil when it can
+func lockError(uploadedFile database.UploadedFile, now time.Time) error {
+	if uploadedFile.LegalHold {
+		return fmt.Errorf("%w: under legal hold", ErrFileLocked)
+	}
+	if uploadedFile.RetainUntil.Valid && uploadedFile.RetainUntil.Time.After(now) {
+		return fmt.Errorf("%w: under %s retention until %s", ErrFileLocked,
+			uploadedFile.RetentionMode.String, uploadedFile.RetainUntil.Time.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// objectLock is the lock recorded for a file, rewritten on every copy of its object
+func objectLock(retentionMode sql.NullString, retainUntil sql.NullTime) s3client.ObjectLock {
+	if !retentionMode.Valid {
+		return s3client.ObjectLock{}
+	}
+	return s3client.ObjectLock{Mode: retentionMode.String, RetainUntil: retainUntil.Time}
+}
+
+// SetLegalHold places or releases a legal hold on an uploaded file
+func SetLegalHold(c *gin.Context, transactionUuid uuid.UUID, consumer string, params LegalHoldParams, apiCfg *ApiConfig) (UploadedFile, error) {
+	existingFile, err := apiCfg.DB.GetUploadedFile(c, database.GetUploadedFileParams{
+		TransactionUuid: transactionUuid,
+		Consumer:        consumer,
+		UserName:        params.UserName,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UploadedFile{}, ErrFileNotFound
+		}
+		logging.FromContext(c).Error("error getting uploaded file", "error", err)
+		return UploadedFile{}, fmt.Errorf("error getting uploaded file")
+	}
+	if existingFile.Status == StatusWaitingFile {
+		return UploadedFile{}, ErrFileNotUploaded
+	}
+	s3Client, err := apiCfg.s3ClientAt(c, existingFile.Bucket, existingFile.Region)
+	if err != nil {
+		return UploadedFile{}, err
+	}
+	if err := s3Client.SetLegalHold(existingFile.ObjectKey, *params.Enabled); err != nil {
+		logging.FromContext(c).Error("error setting legal hold", "error", err)
+		return UploadedFile{}, fmt.Errorf("error setting legal hold")
+	}
+	uploadedFile, err := apiCfg.DB.SetUploadedFileLegalHold(c, database.SetUploadedFileLegalHoldParams{
+		TransactionUuid: transactionUuid,
+		LegalHold:       *params.Enabled,
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error recording legal hold", "error", err)
+		return UploadedFile{}, fmt.Errorf("error recording legal hold")
+	}
+	return DatabaseUploadFileToUploadFile(uploadedFile), nil
+}
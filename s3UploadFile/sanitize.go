@@ -0,0 +1,138 @@
+package s3uploadfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/OliPou/s3are/imagemeta"
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Kept originals are stored under originals/<object key>
+	originalPrefix = "originals/"
+	// Larger images are refused rather than stored with their metadata
+	maxSanitizeSource = 64 << 20
+)
+
+var ErrImageNotSanitized = errors.New("image metadata could not be removed")
+
+func (apiCfg *ApiConfig) stripsMetadata(consumer string, detectedType string) bool {
+	return apiCfg.MetadataStripping.For(consumer).Enabled && imagemeta.Supported(detectedType)
+}
+
+// sanitizeObject rewrites a freshly uploaded image without its metadata when the consumer
+// opted in, the original is first moved under a private key if the policy keeps it.
+// Returns the size and hex SHA-256 of the rewritten object, 0 and "" when it was left untouched.
+func sanitizeObject(c *gin.Context, existingFile database.UploadedFile, detectedType string, getOpts s3client.GetObjectOptions, s3Client S3ClientInterface, apiCfg *ApiConfig) (int64, string, error) {
+	if !apiCfg.stripsMetadata(existingFile.Consumer, detectedType) {
+		return 0, "", nil
+	}
+	body, err := s3Client.GetObject(existingFile.ObjectKey, getOpts)
+	if err != nil {
+		logging.FromContext(c).Error("error reading uploaded image", "error", err)
+		return 0, "", fmt.Errorf("error reading uploaded image")
+	}
+	var stripped bytes.Buffer
+	source := &countingReader{r: io.LimitReader(body, maxSanitizeSource+1)}
+	removed, err := imagemeta.Strip(&stripped, source, detectedType)
+	body.Close()
+	if source.n > maxSanitizeSource {
+		return 0, "", fmt.Errorf("%w: larger than %d bytes", ErrImageNotSanitized, maxSanitizeSource)
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %v", ErrImageNotSanitized, err)
+	}
+	if len(removed) == 0 {
+		return 0, "", nil
+	}
+
+	putOpts := putObjectOptions(existingFile.Consumer, existingFile, getOpts, apiCfg)
+	originalKey := sql.NullString{}
+	if apiCfg.MetadataStripping.For(existingFile.Consumer).KeepOriginal {
+		originalKey = sql.NullString{String: originalPrefix + existingFile.ObjectKey, Valid: true}
+		if err := s3Client.MoveObject(existingFile.ObjectKey, originalKey.String, putOpts); err != nil {
+			logging.FromContext(c).Error("error keeping original image", "error", err)
+			return 0, "", fmt.Errorf("error keeping original image")
+		}
+	}
+	size := int64(stripped.Len())
+	checksum := sha256.Sum256(stripped.Bytes())
+	if err := s3Client.UploadObject(existingFile.ObjectKey, &stripped, putOpts); err != nil {
+		logging.FromContext(c).Error("error uploading sanitized image", "error", err)
+		if originalKey.Valid {
+			if err := s3Client.MoveObject(originalKey.String, existingFile.ObjectKey, putOpts); err != nil {
+				logging.FromContext(c).Error("error putting back original image", "error", err)
+			}
+		}
+		return 0, "", fmt.Errorf("error uploading sanitized image")
+	}
+	if err := recordSanitized(c, existingFile, removed, originalKey, apiCfg); err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(checksum[:]), nil
+}
+
+func recordSanitized(c *gin.Context, existingFile database.UploadedFile, removed []string, originalKey sql.NullString, apiCfg *ApiConfig) error {
+	err := apiCfg.DB.SetUploadedFileSanitized(c, database.SetUploadedFileSanitizedParams{
+		TransactionUuid:   existingFile.TransactionUuid,
+		StrippedMetadata:  removed,
+		OriginalObjectKey: originalKey,
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error recording sanitized image", "error", err)
+		return fmt.Errorf("error recording sanitized image")
+	}
+	return nil
+}
+
+// strippingReader removes image metadata on the fly, for envelope encrypted uploads that
+// cannot be rewritten once stored. The outcome is published when done is closed, before
+// the pipe is, so a reader that hit the end or a stripping error can rely on it.
+type strippingReader struct {
+	*io.PipeReader
+	done    chan struct{}
+	removed []string
+	err     error
+}
+
+func newStrippingReader(src io.Reader, detectedType string) *strippingReader {
+	pr, pw := io.Pipe()
+	r := &strippingReader{PipeReader: pr, done: make(chan struct{})}
+	go func() {
+		removed, err := imagemeta.Strip(pw, src, detectedType)
+		if err != nil {
+			err = fmt.Errorf("%w: %v", ErrImageNotSanitized, err)
+		}
+		r.removed, r.err = removed, err
+		close(r.done)
+		pw.CloseWithError(err)
+	}()
+	return r
+}
+
+// result waits for the stripping to finish and reports what was removed, only once the
+// reader was fully read, the stripping would otherwise stay blocked on the pipe
+func (r *strippingReader) result() ([]string, error) {
+	<-r.done
+	return r.removed, r.err
+}
+
+// failure returns the stripping error that interrupted reading, nil when reading stopped
+// for another reason and the stripping is still running
+func (r *strippingReader) failure() error {
+	select {
+	case <-r.done:
+		return r.err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,203 @@
+package s3uploadfile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/OliPou/s3are/clamav"
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/metrics"
+	"github.com/OliPou/s3are/s3client"
+)
+
+const (
+	ScanPending  = "Pending"
+	ScanClean    = "Clean"
+	ScanInfected = "Infected"
+	// clamd could not scan the file, e.g. because it exceeds its StreamMaxLength
+	ScanFailed = "Failed"
+
+	DefaultQuarantinePrefix = "quarantine/"
+
+	scanBatchSize = 20
+	// Objects that could not be read or sent to clamd this many times are given up on as Failed
+	maxScanAttempts = 10
+)
+
+var (
+	ErrFileNotScanned = errors.New("file has not passed the virus scan")
+	ErrFileInfected   = errors.New("file is infected")
+)
+
+// Scanner checks a stream for malware, *clamav.Client implements it
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (clamav.Result, error)
+}
+
+// initialScanStatus is recorded on new transactions, files are only scanned when a scanner is configured
+func (apiCfg *ApiConfig) initialScanStatus() sql.NullString {
+	if apiCfg.Scanner == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: ScanPending, Valid: true}
+}
+
+func (apiCfg *ApiConfig) quarantinePrefix() string {
+	if apiCfg.QuarantinePrefix == "" {
+		return DefaultQuarantinePrefix
+	}
+	return apiCfg.QuarantinePrefix
+}
+
+// scanBlocked withholds files until they are scanned clean
+func scanBlocked(uploadedFile database.UploadedFile) error {
+	switch uploadedFile.ScanStatus.String {
+	case "", ScanClean:
+		return nil
+	case ScanInfected:
+		return fmt.Errorf("%w: %s", ErrFileInfected, uploadedFile.ScanSignature.String)
+	}
+	return ErrFileNotScanned
+}
+
+// RunScans scans uploaded objects waiting for a verdict and returns how many were scanned.
+// Every transaction sharing a deduplicated object gets the verdict of that object.
+func RunScans(ctx context.Context, apiCfg *ApiConfig) (int, error) {
+	pending, err := apiCfg.DB.ListPendingScans(ctx, database.ListPendingScansParams{
+		PendingStatus:  sql.NullString{String: ScanPending, Valid: true},
+		WaitingStatus:  StatusWaitingFile,
+		ArchiveClasses: s3client.ArchiveStorageClasses,
+		RestoredStatus: sql.NullString{String: RestoreCompleted, Valid: true},
+		MaxResults:     scanBatchSize,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("error listing pending scans", "error", err)
+		return 0, fmt.Errorf("error listing pending scans")
+	}
+	scanned := 0
+	for _, uploadedFile := range pending {
+		done, err := scanObject(ctx, uploadedFile, apiCfg)
+		if err != nil {
+			logging.FromContext(ctx).Error("error scanning", "transaction_uuid", uploadedFile.TransactionUuid, "error", err)
+			if err := recordScanAttempt(ctx, uploadedFile, err, apiCfg); err != nil {
+				logging.FromContext(ctx).Error("error recording scan attempt", "error", err)
+			}
+		}
+		if done {
+			scanned++
+		}
+	}
+	return scanned, nil
+}
+
+func scanObject(ctx context.Context, uploadedFile database.UploadedFile, apiCfg *ApiConfig) (bool, error) {
+	// Archived objects can only be read, and scanned, once restored
+	if archiveBlocked(uploadedFile, time.Now()) != nil {
+		return false, nil
+	}
+	body, err := openObject(ctx, uploadedFile, apiCfg)
+	if err != nil {
+		return false, err
+	}
+	result, err := apiCfg.Scanner.Scan(ctx, body)
+	body.Close()
+	if errors.Is(err, clamav.ErrScanFailed) {
+		return true, setScanResult(ctx, uploadedFile, ScanFailed, err.Error(), apiCfg)
+	}
+	if err != nil {
+		return false, err
+	}
+	if result.Infected {
+		return true, quarantineObject(ctx, uploadedFile, result.Signature, apiCfg)
+	}
+	return true, setScanResult(ctx, uploadedFile, ScanClean, "", apiCfg)
+}
+
+// recordScanAttempt backs a failed object off, it is only retried after a delay and given
+// up on as Failed after maxScanAttempts
+func recordScanAttempt(ctx context.Context, uploadedFile database.UploadedFile, scanErr error, apiCfg *ApiConfig) error {
+	if uploadedFile.ScanAttempts+1 >= maxScanAttempts {
+		return setScanResult(ctx, uploadedFile, ScanFailed, scanErr.Error(), apiCfg)
+	}
+	return apiCfg.DB.RecordObjectScanAttempt(ctx, database.RecordObjectScanAttemptParams{
+		Consumer:      uploadedFile.Consumer,
+		Bucket:        uploadedFile.Bucket,
+		ObjectKey:     uploadedFile.ObjectKey,
+		WaitingStatus: StatusWaitingFile,
+	})
+}
+
+// setScanResult records the verdict on every transaction of the object, the file status
+// hands out download URLs for clean files from then on
+func setScanResult(ctx context.Context, uploadedFile database.UploadedFile, status string, signature string, apiCfg *ApiConfig) error {
+	return apiCfg.DB.SetObjectScanResult(ctx, database.SetObjectScanResultParams{
+		ScanStatus:    sql.NullString{String: status, Valid: true},
+		ScanSignature: nullString(signature),
+		Consumer:      uploadedFile.Consumer,
+		Bucket:        uploadedFile.Bucket,
+		ObjectKey:     uploadedFile.ObjectKey,
+		WaitingStatus: StatusWaitingFile,
+	})
+}
+
+// quarantineObject moves an infected object under the quarantine prefix, out of reach
+// of every transaction referencing it and of future deduplication
+func quarantineObject(ctx context.Context, uploadedFile database.UploadedFile, signature string, apiCfg *ApiConfig) error {
+	getOpts, err := getObjectOptions(uploadedFile.Consumer, uploadedFile.SseMode, uploadedFile.SseCustomerKeyMd5, apiCfg)
+	if err != nil {
+		return err
+	}
+	s3Client, err := apiCfg.s3ClientAt(ctx, uploadedFile.Bucket, uploadedFile.Region)
+	if err != nil {
+		return err
+	}
+	quarantineKey := apiCfg.quarantinePrefix() + uploadedFile.ObjectKey
+	putOpts := putObjectOptions(uploadedFile.Consumer, uploadedFile, getOpts, apiCfg)
+	if err := s3Client.MoveObject(uploadedFile.ObjectKey, quarantineKey, s3client.PutObjectOptions{
+		Encryption:   putOpts.Encryption,
+		StorageClass: putOpts.StorageClass,
+		ObjectLock:   putOpts.ObjectLock,
+	}); err != nil {
+		return err
+	}
+	err = apiCfg.DB.QuarantineObject(ctx, database.QuarantineObjectParams{
+		QuarantineKey: quarantineKey,
+		ScanStatus:    sql.NullString{String: ScanInfected, Valid: true},
+		ScanSignature: nullString(signature),
+		Consumer:      uploadedFile.Consumer,
+		Bucket:        uploadedFile.Bucket,
+		ObjectKey:     uploadedFile.ObjectKey,
+	})
+	if err != nil {
+		return err
+	}
+	return apiCfg.DB.DeleteFileObjectByKey(ctx, database.DeleteFileObjectByKeyParams{
+		Consumer:  uploadedFile.Consumer,
+		Bucket:    uploadedFile.Bucket.String,
+		ObjectKey: uploadedFile.ObjectKey,
+	})
+}
+
+// StartScanWorker runs RunScans every interval until ctx is done
+func StartScanWorker(ctx context.Context, apiCfg *ApiConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			n, err := RunScans(ctx, apiCfg)
+			metrics.ObserveWorkerRun("scan", start, n, err)
+			if err == nil && n > 0 {
+				logging.FromContext(ctx).Info("scanned uploaded files", "files", n)
+			}
+		}
+	}
+}
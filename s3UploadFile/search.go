@@ -0,0 +1,145 @@
+package s3uploadfile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/metrics"
+	"github.com/OliPou/s3are/textextract"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ExtractionPending = "Pending"
+	ExtractionDone    = "Done"
+	ExtractionFailed  = "Failed"
+	// The document was archived, it is not restored to be indexed
+	ExtractionSkipped = "Skipped"
+
+	extractionBatchSize = 20
+	// Documents that failed to extract this many times are given up on as Failed
+	maxExtractionAttempts = 10
+)
+
+// initialExtractionStatus marks completed documents for the extraction worker. The
+// content of envelope encrypted files must not be stored in the clear.
+func (apiCfg *ApiConfig) initialExtractionStatus(consumer string, detectedType string) sql.NullString {
+	if apiCfg.envelopeEnabled(consumer) || !textextract.Supported(detectedType) {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: ExtractionPending, Valid: true}
+}
+
+// RunExtractions indexes the text of completed documents and returns how many were processed
+func RunExtractions(ctx context.Context, apiCfg *ApiConfig) (int, error) {
+	pending, err := apiCfg.DB.ListPendingExtractions(ctx, database.ListPendingExtractionsParams{
+		PendingStatus: sql.NullString{String: ExtractionPending, Valid: true},
+		WaitingStatus: StatusWaitingFile,
+		CleanStatus:   sql.NullString{String: ScanClean, Valid: true},
+		MaxResults:    extractionBatchSize,
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("error listing pending extractions", "error", err)
+		return 0, fmt.Errorf("error listing pending extractions")
+	}
+	extracted := 0
+	for _, uploadedFile := range pending {
+		status := ExtractionDone
+		// Archived documents can only be read once restored
+		if archiveBlocked(uploadedFile, time.Now()) != nil {
+			status = ExtractionSkipped
+		} else if err := extractText(ctx, uploadedFile, apiCfg); err != nil {
+			logging.FromContext(ctx).Error("error extracting text of", "transaction_uuid", uploadedFile.TransactionUuid, "error", err)
+			unsupported := errors.Is(err, textextract.ErrUnsupportedDocument)
+			if !unsupported && uploadedFile.ExtractionAttempts+1 < maxExtractionAttempts {
+				// Retried after a backoff, the rest of the queue goes first
+				if err := apiCfg.DB.RecordExtractionAttempt(ctx, uploadedFile.TransactionUuid); err != nil {
+					logging.FromContext(ctx).Error("error recording extraction attempt", "error", err)
+				}
+				continue
+			}
+			status = ExtractionFailed
+		}
+		err := apiCfg.DB.SetUploadedFileExtractionStatus(ctx, database.SetUploadedFileExtractionStatusParams{
+			TransactionUuid:  uploadedFile.TransactionUuid,
+			ExtractionStatus: sql.NullString{String: status, Valid: true},
+		})
+		if err != nil {
+			logging.FromContext(ctx).Error("error recording extraction status", "error", err)
+			continue
+		}
+		extracted++
+	}
+	return extracted, nil
+}
+
+func extractText(ctx context.Context, uploadedFile database.UploadedFile, apiCfg *ApiConfig) error {
+	body, err := openObject(ctx, uploadedFile, apiCfg)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	text, err := textextract.Extract(body, uploadedFile.DetectedType.String)
+	if err != nil {
+		return err
+	}
+	return apiCfg.DB.UpsertFileContent(ctx, database.UpsertFileContentParams{
+		TransactionUuid: uploadedFile.TransactionUuid,
+		Language:        apiCfg.SearchLanguages.For(uploadedFile.Consumer),
+		Content:         text,
+	})
+}
+
+// SearchFiles finds the consumer's documents matching a web search style query, e.g.
+// `"annual report" -draft`, best matches first
+func SearchFiles(c *gin.Context, consumer string, params SearchFilesParams, apiCfg *ApiConfig) ([]SearchResult, error) {
+	limit := params.Limit
+	if limit <= 0 || limit > maxListResults {
+		limit = maxListResults
+	}
+	rows, err := apiCfg.DB.SearchUploadedFiles(c, database.SearchUploadedFilesParams{
+		Language:    apiCfg.SearchLanguages.For(consumer),
+		Query:       params.Query,
+		Consumer:    consumer,
+		UserName:    nullString(params.UserName),
+		SkipResults: int32(params.Offset),
+		MaxResults:  int32(limit),
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error searching uploaded files", "error", err)
+		return nil, fmt.Errorf("error searching uploaded files")
+	}
+	results := make([]SearchResult, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, SearchResult{
+			UploadedFile: DatabaseUploadFileToUploadFile(row.UploadedFile),
+			Rank:         row.Rank,
+			Snippet:      row.Snippet,
+		})
+	}
+	return results, nil
+}
+
+// StartExtractionWorker runs RunExtractions every interval until ctx is done
+func StartExtractionWorker(ctx context.Context, apiCfg *ApiConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			n, err := RunExtractions(ctx, apiCfg)
+			metrics.ObserveWorkerRun("extraction", start, n, err)
+			if err == nil && n > 0 {
+				logging.FromContext(ctx).Info("extracted text", "files", n)
+			}
+		}
+	}
+}
@@ -2,15 +2,31 @@ package s3uploadfile
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/keylayout"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/metrics"
+	"github.com/OliPou/s3are/s3client"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+var (
+	ErrFileNotFound             = errors.New("file not found")
+	ErrEncryptionKeyUnavailable = errors.New("encryption key for this file is no longer configured")
+	ErrProxyUploadRequired      = errors.New("files of this consumer must be uploaded through the service")
+	ErrInvalidFileName          = errors.New("invalid file name")
+	ErrUnknownResidency         = errors.New("no bucket configured for this residency")
+	ErrStorageClassNotAllowed   = errors.New("storage class not allowed")
+)
+
 type UUIDGenerator func() uuid.UUID
 
 func UploadRequest(c *gin.Context, params UploadsFileParams, consumer string, apiCfg *ApiConfig, generateUUID UUIDGenerator) (UploadedFile, error) {
@@ -18,79 +34,455 @@ func UploadRequest(c *gin.Context, params UploadsFileParams, consumer string, ap
 	var duration time.Duration
 	var err error
 	transactionUUID := generateUUID()
-	fileName := fmt.Sprintf("%s_%s_%s_%s.%s",
-		transactionUUID.String(),
-		consumer,
-		params.UserName,
-		params.FileName,
-		params.FileExtention,
-	)
-	// if params.LinkExpirationDuration > 0 {
-	presignedURL, duration, err = apiCfg.S3Client.GeneratePresignedURL(fileName, params.LinkExpirationDuration)
-	if err != nil {
-		fmt.Printf("error generating presigned URL: %v", err)
-		return UploadedFile{}, fmt.Errorf("error generating presigned URL")
-	}
-	// } else {
-	// 	presignedURL, duration, err = apiCfg.S3Client.GeneratePresignedURL(fileName, nil)
-	// 	if err != nil {
-	// 		fmt.Printf("error generating presigned URL: %v", err)
-	// 		return UploadedFile{}, fmt.Errorf("error generating presigned URL")
-	// 	}
-	// }
+	metadata, err := normalizeMetadata(params.Metadata, params.Tags)
+	if err != nil {
+		return UploadedFile{}, err
+	}
+	params.Metadata = metadata
+	storageClass, err := apiCfg.StorageClasses.For(consumer).Resolve(params.StorageClass)
+	if err != nil {
+		return UploadedFile{}, fmt.Errorf("%w: %v", ErrStorageClassNotAllowed, err)
+	}
+	// Archived objects can't be read until restored, too late to refuse or sanitize them
+	if s3client.IsArchiveStorageClass(storageClass) && apiCfg.inspectsUploads(consumer) {
+		return UploadedFile{}, fmt.Errorf("%w: uploads of this consumer are inspected, %s objects can't be read", ErrStorageClassNotAllowed, storageClass)
+	}
+	location, s3Client, err := apiCfg.resolveLocation(c, consumer, params.Residency)
+	if err != nil {
+		return UploadedFile{}, err
+	}
+	retention := apiCfg.Retention.For(consumer)
+	lock := s3client.ObjectLock{}
+	if retention.Enabled() {
+		lock = s3client.ObjectLock{Mode: retention.Mode, RetainUntil: retention.RetainUntil(time.Now())}
+	}
+	sha256 := sql.NullString{}
+	// Deduplication relies on S3 checksums of the plaintext, which envelope encrypted files never expose
+	if params.Sha256 != nil && !apiCfg.envelopeEnabled(consumer) {
+		sha256 = sql.NullString{String: strings.ToLower(*params.Sha256), Valid: true}
+	}
+	// Retained files are records of their own and never link to an existing object
+	if sha256.Valid && !retention.Enabled() {
+		fileObject, err := apiCfg.DB.AcquireFileObject(c, database.AcquireFileObjectParams{
+			Consumer: consumer,
+			Sha256:   sha256.String,
+			Bucket:   location.Bucket,
+		})
+		if err == nil {
+			return linkExistingObject(c, transactionUUID, params, consumer, fileObject, s3Client, apiCfg)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			logging.FromContext(c).Error("error looking up file object", "error", err)
+			return UploadedFile{}, fmt.Errorf("error looking up existing file")
+		}
+	}
+	objectKey, err := apiCfg.keyLayout().Key(keylayout.Fields{
+		Consumer:        consumer,
+		UserName:        params.UserName,
+		TransactionUUID: transactionUUID,
+		FileName:        params.FileName,
+		Extension:       params.FileExtention,
+		Time:            time.Now(),
+	})
+	if err != nil {
+		return UploadedFile{}, fmt.Errorf("%w: %v", ErrInvalidFileName, err)
+	}
+	encryption := apiCfg.Encryption.For(consumer)
+	opts := s3client.PutObjectOptions{
+		Encryption:   encryption,
+		Metadata:     params.Metadata,
+		Tags:         params.Tags,
+		StorageClass: storageClass,
+		ObjectLock:   lock,
+	}
+	if sha256.Valid {
+		opts.ChecksumSHA256, err = hexToBase64(sha256.String)
+		if err != nil {
+			return UploadedFile{}, fmt.Errorf("invalid sha256: %w", err)
+		}
+	}
+	// Envelope encrypted files are uploaded through the service, S3 must never see their plaintext
+	if !apiCfg.envelopeEnabled(consumer) {
+		start := time.Now()
+		presignedURL, duration, err = s3Client.GeneratePresignedURL(objectKey, params.LinkExpirationDuration, opts)
+		metrics.ObservePresign("upload", start)
+		if err != nil {
+			logging.FromContext(c).Error("error generating presigned URL", "error", err)
+			return UploadedFile{}, fmt.Errorf("error generating presigned URL")
+		}
+	}
 	expirationTime := sql.NullTime{
 		Time:  time.Now().Add(duration),
-		Valid: true,
+		Valid: presignedURL != "",
+	}
+	// Allocated last, a failed request must not leave a logical file or a version gap behind
+	version, err := allocateVersion(c, transactionUUID, consumer, params, apiCfg)
+	if err != nil {
+		return UploadedFile{}, err
 	}
 	uploadedFile, err := apiCfg.DB.CreateUploadedFile(c, database.CreateUploadedFileParams{
 		TransactionUuid:      transactionUUID,
 		Consumer:             consumer,
 		UserName:             params.UserName,
-		FileName:             fileName,
+		FileName:             displayFileName(params),
+		ObjectKey:            objectKey,
 		UploadPresignedUrl:   presignedURL,
 		UploadExpirationTime: expirationTime,
-		Status:               "Waiting file",
+		Status:               StatusWaitingFile,
+		Sha256:               sha256,
+		SseMode:              nullString(encryption.Mode),
+		SseKmsKeyID:          nullString(encryption.KMSKeyID),
+		SseCustomerKeyMd5:    nullString(encryption.CustomerKeyMD5()),
+		Metadata:             encodeMetadata(params.Metadata),
+		Tags:                 encodeMetadata(params.Tags),
+		Bucket:               nullString(location.Bucket),
+		Region:               nullString(location.Region),
+		StorageClass:         storageClass,
+		RetentionMode:        nullString(lock.Mode),
+		RetainUntil:          sql.NullTime{Time: lock.RetainUntil, Valid: lock.Mode != ""},
+		LogicalFileID:        version.LogicalFileID,
+		Version:              version.Version,
+		ScanStatus:           apiCfg.initialScanStatus(),
 	})
 	if err != nil {
-		fmt.Printf("Error creating uploaded file: %v", err)
+		logging.FromContext(c).Error("error creating uploaded file", "error", err)
 		return UploadedFile{}, fmt.Errorf("error creating uploaded file")
 	}
 	return DatabaseUploadFileToUploadFile(uploadedFile), nil
 }
 
-func UploadedCompleted(c *gin.Context, params UploadCompletedParams, apiCfg *ApiConfig) (UploadedFile, error) {
-	presignedURL, duration, _ := apiCfg.S3Client.GeneratePresignedDownloadURL(string(params.FileName), nil)
-	expirationTime := sql.NullTime{
-		Time:  time.Now().Add(duration),
-		Valid: true,
+// linkExistingObject records a new transaction pointing at an already stored object.
+// The caller must already hold a reference on fileObject, it is released on failure.
+func linkExistingObject(c *gin.Context, transactionUUID uuid.UUID, params UploadsFileParams, consumer string, fileObject database.FileObject, s3Client S3ClientInterface, apiCfg *ApiConfig) (UploadedFile, error) {
+	release := func() {
+		if err := releaseFileObject(c, consumer, fileObject.Sha256, fileObject.Bucket, s3Client, apiCfg); err != nil {
+			logging.FromContext(c).Error("error releasing file object", "error", err)
+		}
 	}
-	inputFileName := strings.Split(params.FileName, "_")
-	uuidStr := inputFileName[0]
-	transactionUuid, err := uuid.Parse(uuidStr)
+	version, err := allocateVersion(c, transactionUUID, consumer, params, apiCfg)
 	if err != nil {
-		fmt.Printf("Error updating uploaded file: %v", err)
-		return UploadedFile{}, fmt.Errorf("error updating uploaded file")
+		release()
+		return UploadedFile{}, err
+	}
+	_, err = apiCfg.DB.CreateUploadedFile(c, database.CreateUploadedFileParams{
+		TransactionUuid:   transactionUUID,
+		Consumer:          consumer,
+		UserName:          params.UserName,
+		FileName:          displayFileName(params),
+		ObjectKey:         fileObject.ObjectKey,
+		Status:            StatusAlreadyPresent,
+		Sha256:            sql.NullString{String: fileObject.Sha256, Valid: true},
+		SseMode:           fileObject.SseMode,
+		SseKmsKeyID:       fileObject.SseKmsKeyID,
+		SseCustomerKeyMd5: fileObject.SseCustomerKeyMd5,
+		Metadata:          encodeMetadata(params.Metadata),
+		Tags:              encodeMetadata(params.Tags),
+		Bucket:            nullString(fileObject.Bucket),
+		Region:            fileObject.Region,
+		// The shared object keeps the class it was first stored with
+		StorageClass:  fileObject.StorageClass,
+		LogicalFileID: version.LogicalFileID,
+		Version:       version.Version,
+		ScanStatus:    apiCfg.initialScanStatus(),
+	})
+	if err != nil {
+		release()
+		logging.FromContext(c).Error("error creating uploaded file", "error", err)
+		return UploadedFile{}, fmt.Errorf("error creating uploaded file")
 	}
 	uploadedFile, err := apiCfg.DB.UpdateUploadedFile(c, database.UpdateUploadedFileParams{
-		TransactionUuid: transactionUuid,
-		FileSize: sql.NullInt32{
-			Int32: int32(params.FileSize),
-			Valid: true,
-		},
-		FileType: sql.NullString{
-			String: params.FileType,
-			Valid:  true,
-		},
-		DownloadPresignedUrl: sql.NullString{
-			String: presignedURL,
-			Valid:  true,
-		},
-		Status:                 "File Uploaded",
-		DownloadExpirationTime: expirationTime,
+		TransactionUuid: transactionUUID,
+		ObjectKey:       fileObject.ObjectKey,
+		FileSize:        fileObject.FileSize,
+		FileType:        fileObject.FileType,
+		Status:          StatusAlreadyPresent,
 	})
 	if err != nil {
-		fmt.Println("Error updating uploaded file:", err)
+		logging.FromContext(c).Error("error updating uploaded file", "error", err)
 		return UploadedFile{}, fmt.Errorf("error updating uploaded file: %w", err)
 	}
-	return DatabaseUploadFileToUploadFile(uploadedFile), nil
+	return withDownloadURL(c, DatabaseUploadFileToUploadFile(uploadedFile), uploadedFile, false, apiCfg), nil
+}
+
+func UploadedCompleted(c *gin.Context, params UploadCompletedParams, consumer string, apiCfg *ApiConfig) (UploadedFile, error) {
+	if apiCfg.envelopeEnabled(consumer) {
+		return UploadedFile{}, ErrProxyUploadRequired
+	}
+	fileSize := sql.NullInt32{
+		Int32: int32(params.FileSize),
+		Valid: true,
+	}
+	fileType := sql.NullString{
+		String: params.FileType,
+		Valid:  true,
+	}
+	var existingFile database.UploadedFile
+	var err error
+	if params.TransactionUuid != nil {
+		existingFile, err = apiCfg.DB.GetConsumerUploadedFile(c, database.GetConsumerUploadedFileParams{
+			TransactionUuid: *params.TransactionUuid,
+			Consumer:        consumer,
+		})
+	} else {
+		// Deprecated: clients that only know the object key
+		existingFile, err = apiCfg.DB.GetConsumerUploadedFileByKey(c, database.GetConsumerUploadedFileByKeyParams{
+			ObjectKey: params.FileName,
+			Consumer:  consumer,
+		})
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UploadedFile{}, ErrFileNotFound
+		}
+		logging.FromContext(c).Error("error getting uploaded file", "error", err)
+		return UploadedFile{}, fmt.Errorf("error getting uploaded file")
+	}
+	transactionUuid := existingFile.TransactionUuid
+	objectKey := existingFile.ObjectKey
+	getOpts, err := getObjectOptions(consumer, existingFile.SseMode, existingFile.SseCustomerKeyMd5, apiCfg)
+	if err != nil {
+		return UploadedFile{}, err
+	}
+	s3Client, err := apiCfg.s3ClientAt(c, existingFile.Bucket, existingFile.Region)
+	if err != nil {
+		return UploadedFile{}, err
+	}
+	if existingFile.Status == StatusWaitingFile {
+		detectedType, err := inspectUploadedObject(c, existingFile, params.FileType, getOpts, s3Client, apiCfg)
+		if err != nil {
+			return UploadedFile{}, err
+		}
+		if err := verifyUploadedObject(c, existingFile, getOpts, s3Client); err != nil {
+			return UploadedFile{}, err
+		}
+		sanitizedSize, sanitizedSha256, err := sanitizeObject(c, existingFile, detectedType, getOpts, s3Client, apiCfg)
+		if err != nil {
+			return UploadedFile{}, err
+		}
+		if sanitizedSize > 0 {
+			fileSize = sql.NullInt32{Int32: int32(sanitizedSize), Valid: true}
+			// Deduplicated on the content actually stored, never on the image with its metadata
+			if existingFile.Sha256.Valid {
+				existingFile.Sha256.String = sanitizedSha256
+			}
+		}
+	}
+	var uploadedFile database.UploadedFile
+	// Recorded for deduplication last, once nothing else can fail
+	if existingFile.Status == StatusWaitingFile && existingFile.Sha256.Valid {
+		uploadedFile, err = completeDeduplicatedUpload(c, existingFile, fileSize, fileType, s3Client, apiCfg)
+		if err != nil {
+			return UploadedFile{}, err
+		}
+	} else {
+		uploadedFile, err = apiCfg.DB.UpdateUploadedFile(c, database.UpdateUploadedFileParams{
+			TransactionUuid: transactionUuid,
+			ObjectKey:       objectKey,
+			FileSize:        fileSize,
+			FileType:        fileType,
+			Status:          StatusFileUploaded,
+		})
+		if err != nil {
+			logging.FromContext(c).Error("error updating uploaded file", "error", err)
+			return UploadedFile{}, fmt.Errorf("error updating uploaded file: %w", err)
+		}
+	}
+	if existingFile.Status == StatusWaitingFile {
+		recordS3Version(c, transactionUuid, uploadedFile.ObjectKey, getOpts, s3Client, apiCfg)
+	}
+	return withDownloadURL(c, DatabaseUploadFileToUploadFile(uploadedFile), uploadedFile, false, apiCfg), nil
+}
+
+// verifyUploadedObject checks the uploaded object carries the encryption recorded at
+// request time and, in dedup mode, matches its declared checksum
+func verifyUploadedObject(c *gin.Context, existingFile database.UploadedFile, getOpts s3client.GetObjectOptions, s3Client S3ClientInterface) error {
+	if !existingFile.Sha256.Valid && !existingFile.SseMode.Valid {
+		return nil
+	}
+	objectInfo, err := s3Client.GetObjectInfo(existingFile.ObjectKey, getOpts)
+	if err != nil {
+		logging.FromContext(c).Error("error getting object info", "error", err)
+		return fmt.Errorf("error verifying uploaded file")
+	}
+	recordedEncryption := s3client.Encryption{
+		Mode:     existingFile.SseMode.String,
+		KMSKeyID: existingFile.SseKmsKeyID.String,
+	}
+	if recordedEncryption.Mode == s3client.EncryptionSSEC {
+		recordedEncryption = getOpts.Encryption
+	}
+	if !recordedEncryption.Matches(objectInfo) {
+		return fmt.Errorf("uploaded file is not encrypted with %s as required", recordedEncryption.Mode)
+	}
+	if !existingFile.Sha256.Valid {
+		return nil
+	}
+	expectedChecksum, err := hexToBase64(existingFile.Sha256.String)
+	if err != nil {
+		return fmt.Errorf("invalid sha256: %w", err)
+	}
+	if objectInfo.ChecksumSHA256 != expectedChecksum {
+		return fmt.Errorf("uploaded file does not match declared sha256")
+	}
+	return nil
+}
+
+// completeDeduplicatedUpload records the upload as completed together with its reference
+// on the file object. When an identical object was stored concurrently the new upload is
+// dropped in favour of the existing one.
+func completeDeduplicatedUpload(c *gin.Context, existingFile database.UploadedFile, fileSize sql.NullInt32, fileType sql.NullString, s3Client S3ClientInterface, apiCfg *ApiConfig) (database.UploadedFile, error) {
+	uploadedFile, err := apiCfg.DB.CompleteDeduplicatedUpload(c, database.CompleteDeduplicatedUploadParams{
+		TransactionUuid: existingFile.TransactionUuid,
+		Sha256:          existingFile.Sha256.String,
+		FileSize:        fileSize,
+		FileType:        fileType,
+		CompletedStatus: StatusFileUploaded,
+		WaitingStatus:   StatusWaitingFile,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// A concurrent completion of the same upload got there first and holds the reference
+		return database.UploadedFile{}, ErrFileAlreadyUploaded
+	}
+	if err != nil {
+		logging.FromContext(c).Error("error completing uploaded file", "error", err)
+		return database.UploadedFile{}, fmt.Errorf("error updating uploaded file")
+	}
+	if uploadedFile.ObjectKey != existingFile.ObjectKey {
+		if err := s3Client.DeleteObject(existingFile.ObjectKey); err != nil {
+			logging.FromContext(c).Error("error deleting duplicate object", "error", err)
+		}
+	}
+	return uploadedFile, nil
+}
+
+// DeleteFile removes a transaction. The S3 object is only deleted once no other
+// transaction references it.
+func DeleteFile(c *gin.Context, transactionUuid uuid.UUID, consumer string, userName string, apiCfg *ApiConfig) (UploadedFile, error) {
+	// Rendition rows are deleted along with the transaction, their objects afterwards
+	renditions, err := apiCfg.DB.ListRenditions(c, transactionUuid)
+	if err != nil {
+		logging.FromContext(c).Error("error listing renditions", "error", err)
+		return UploadedFile{}, fmt.Errorf("error deleting uploaded file")
+	}
+	deletedFile, err := apiCfg.DB.DeleteUploadedFile(c, database.DeleteUploadedFileParams{
+		TransactionUuid: transactionUuid,
+		Consumer:        consumer,
+		UserName:        userName,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// Locked files are kept by the delete, tell them apart from missing ones
+		return UploadedFile{}, deleteRefusal(c, transactionUuid, consumer, userName, apiCfg)
+	}
+	if err != nil {
+		logging.FromContext(c).Error("error deleting uploaded file", "error", err)
+		return UploadedFile{}, fmt.Errorf("error deleting uploaded file")
+	}
+	s3Client, err := apiCfg.s3ClientAt(c, deletedFile.Bucket, deletedFile.Region)
+	if err != nil {
+		return UploadedFile{}, err
+	}
+	deleteRenditions(c, renditions, s3Client)
+	// The original goes with the transaction that kept it
+	if deletedFile.OriginalObjectKey.Valid {
+		if err := s3Client.DeleteObject(deletedFile.OriginalObjectKey.String); err != nil {
+			logging.FromContext(c).Error("error deleting original image", "error", err)
+		}
+	}
+	switch {
+	case deletedFile.ScanStatus.String == ScanInfected:
+		// Quarantined objects may be shared by several transactions and are kept for
+		// investigation, a lifecycle rule on the quarantine prefix expires them
+		return DatabaseUploadFileToUploadFile(deletedFile), nil
+	case deletedFile.Sha256.Valid && deletedFile.Status != StatusWaitingFile:
+		err = releaseFileObject(c, consumer, deletedFile.Sha256.String, deletedFile.Bucket.String, s3Client, apiCfg)
+	default:
+		err = s3Client.DeleteObject(deletedFile.ObjectKey)
+	}
+	if err != nil {
+		logging.FromContext(c).Error("error deleting object", "error", err)
+		return UploadedFile{}, fmt.Errorf("error deleting object")
+	}
+	return DatabaseUploadFileToUploadFile(deletedFile), nil
+}
+
+func deleteRefusal(c *gin.Context, transactionUuid uuid.UUID, consumer string, userName string, apiCfg *ApiConfig) error {
+	existingFile, err := apiCfg.DB.GetUploadedFile(c, database.GetUploadedFileParams{
+		TransactionUuid: transactionUuid,
+		Consumer:        consumer,
+		UserName:        userName,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrFileNotFound
+	}
+	if err != nil {
+		logging.FromContext(c).Error("error getting uploaded file", "error", err)
+		return fmt.Errorf("error deleting uploaded file")
+	}
+	if err := lockError(existingFile, time.Now()); err != nil {
+		return err
+	}
+	// The lock expired between both queries
+	return fmt.Errorf("%w: try again", ErrFileLocked)
+}
+
+// releaseFileObject drops one reference on a stored object and deletes it from its
+// bucket when the last reference goes. Released objects can't be acquired any more, an
+// upload of the same content stored meanwhile revives the row and keeps the object.
+func releaseFileObject(c *gin.Context, consumer string, sha256 string, bucket string, s3Client S3ClientInterface, apiCfg *ApiConfig) error {
+	fileObject, err := apiCfg.DB.ReleaseFileObject(c, database.ReleaseFileObjectParams{
+		Consumer: consumer,
+		Sha256:   sha256,
+		Bucket:   bucket,
+	})
+	if err != nil {
+		return err
+	}
+	if fileObject.RefCount > 0 {
+		return nil
+	}
+	fileObject, err = apiCfg.DB.DeleteReleasedFileObject(c, database.DeleteReleasedFileObjectParams{
+		Consumer: consumer,
+		Sha256:   sha256,
+		Bucket:   bucket,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s3Client.DeleteObject(fileObject.ObjectKey)
+}
+
+// getObjectOptions rebuilds the options needed to read an object from the encryption
+// recorded for it. SSE-C objects can only be read while the consumer still holds the key.
+func getObjectOptions(consumer string, sseMode sql.NullString, sseCustomerKeyMd5 sql.NullString, apiCfg *ApiConfig) (s3client.GetObjectOptions, error) {
+	if sseMode.String != s3client.EncryptionSSEC {
+		return s3client.GetObjectOptions{}, nil
+	}
+	encryption := apiCfg.Encryption.For(consumer)
+	if encryption.Mode != s3client.EncryptionSSEC || encryption.CustomerKeyMD5() != sseCustomerKeyMd5.String {
+		return s3client.GetObjectOptions{}, ErrEncryptionKeyUnavailable
+	}
+	return s3client.GetObjectOptions{Encryption: encryption}, nil
+}
+
+// displayFileName is the name the file is presented with, it never reaches the object key unsanitized
+func displayFileName(params UploadsFileParams) string {
+	if params.FileExtention == "" {
+		return params.FileName
+	}
+	return params.FileName + "." + strings.TrimPrefix(params.FileExtention, ".")
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func hexToBase64(hexStr string) (string, error) {
+	raw, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
 }
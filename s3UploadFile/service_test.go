@@ -1,12 +1,38 @@
 package s3uploadfile
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/OliPou/s3are/clamav"
+	"github.com/OliPou/s3are/cloudfront"
+	"github.com/OliPou/s3are/contenttype"
+	"github.com/OliPou/s3are/envelope"
+	"github.com/OliPou/s3are/imagemeta"
 	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/OliPou/s3are/textextract"
+	"github.com/OliPou/s3are/thumbnail"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -21,13 +47,17 @@ func TestUploadRequest(t *testing.T) {
 
 	// Setup mock S3 client
 	mockS3Client := &MockS3Client{
-		GeneratePresignedURLFunc: func(key string, expirationTime ...time.Duration) (string, error) {
-			return "http://mock-presigned-url", nil
+		GeneratePresignedURLFunc: func(key string, expirationTime *int, opts s3client.PutObjectOptions) (string, time.Duration, error) {
+			assert.Regexp(t, `^test-consumer/\d{4}/\d{2}/`+fixedUUID.String()+`/test-file\.txt$`, key)
+			return "http://mock-presigned-url", time.Hour, nil
 		},
 	}
 
 	// Setup mock DB
 	mockDB := &MockDB{
+		CreateLogicalFileFunc: func(ctx context.Context, arg database.CreateLogicalFileParams) (database.LogicalFile, error) {
+			return database.LogicalFile{ID: arg.ID, LatestVersion: 1}, nil
+		},
 		CreateUploadedFileFunc: func(ctx context.Context, arg database.CreateUploadedFileParams) (database.UploadedFile, error) {
 			return database.UploadedFile{
 				TransactionUuid:    fixedUUID,
@@ -75,22 +105,35 @@ func TestUploadedCompleted(t *testing.T) {
 	// Setup mock DB
 	// Setup mock S3 client
 	mockS3Client := &MockS3Client{
-		GeneratePresignedDownloadURLFunc: func(key string, expirationTime ...time.Duration) (string, error) {
-			return "http://mock-presigned-url", nil
+		GetObjectRangeFunc: func(key string, offset int64, length int64, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("plain text content")), nil
+		},
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			return "http://mock-presigned-url", time.Hour, nil
 		},
 	}
 	mockDB := &MockDB{
+		SetUploadedFileDetectedTypeFunc: func(ctx context.Context, arg database.SetUploadedFileDetectedTypeParams) error {
+			return nil
+		},
+		GetConsumerUploadedFileFunc: func(ctx context.Context, arg database.GetConsumerUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid: fixedUUID,
+				Consumer:        "test-consumer",
+				ObjectKey:       fileName,
+				Status:          "Waiting file",
+			}, nil
+		},
 		UpdateUploadedFileFunc: func(ctx context.Context, arg database.UpdateUploadedFileParams) (database.UploadedFile, error) {
 			return database.UploadedFile{
-				TransactionUuid:      fixedUUID,
-				Consumer:             "test-consumer",
-				UserName:             "test-user",
-				FileName:             "test-file.txt",
-				FileSize:             sql.NullInt32{Int32: 1000, Valid: true},
-				FileType:             sql.NullString{String: "text/plain", Valid: true},
-				DownloadPresignedUrl: sql.NullString{String: "https://s3.download", Valid: true},
-				Status:               "File Uploaded",
-				CreatedAt:            time.Now(),
+				TransactionUuid: fixedUUID,
+				Consumer:        "test-consumer",
+				UserName:        "test-user",
+				FileName:        "test-file.txt",
+				FileSize:        sql.NullInt32{Int32: 1000, Valid: true},
+				FileType:        sql.NullString{String: "text/plain", Valid: true},
+				Status:          "File Uploaded",
+				CreatedAt:       time.Now(),
 			}, nil
 		},
 	}
@@ -106,13 +149,13 @@ func TestUploadedCompleted(t *testing.T) {
 
 	// Test parameters
 	params := UploadCompletedParams{
-		FileName: fileName,
-		FileSize: 782,
-		FileType: "text/plain",
+		TransactionUuid: &fixedUUID,
+		FileSize:        782,
+		FileType:        "text/plain",
 	}
 
 	// Execute test
-	result, err := UploadedCompleted(c, params, apiCfg)
+	result, err := UploadedCompleted(c, params, "test-consumer", apiCfg)
 
 	// Assertions
 	assert.NoError(t, err)
@@ -120,6 +163,9 @@ func TestUploadedCompleted(t *testing.T) {
 	assert.Equal(t, "File Uploaded", result.Status)
 	assert.Equal(t, int32(1000), result.FileSize.Int32)
 	assert.Equal(t, "text/plain", result.FileType.String)
+	// Minted for the response, not stored with the file
+	assert.Equal(t, "http://mock-presigned-url", result.DownloadPresignedUrl)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), result.DownloadExpirationTime, time.Minute)
 }
 
 func TestGetUploadedFile(t *testing.T) {
@@ -164,3 +210,1903 @@ func TestGetUploadedFile(t *testing.T) {
 	assert.Equal(t, "test-user", result.UserName)
 	assert.Equal(t, "File Uploaded", result.Status)
 }
+
+func TestFileStatusMintsShortLivedURL(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	var signedExpiration int
+	var signErr error
+	downloads := 0
+	mockS3Client := &MockS3Client{
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			signedExpiration = *expirationTime
+			if signErr != nil {
+				return "", 0, signErr
+			}
+			return "http://short-lived-url", time.Minute, nil
+		},
+	}
+	mockDB := &MockDB{
+		GetUploadedFileFunc: func(ctx context.Context, arg database.GetUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid: fixedUUID,
+				Consumer:        "test-consumer",
+				UserName:        "test-user",
+				ObjectKey:       "test-key",
+				Status:          StatusFileUploaded,
+				StorageClass:    "STANDARD",
+			}, nil
+		},
+		RecordUploadedFileDownloadFunc: func(ctx context.Context, transactionUuid uuid.UUID) error {
+			downloads++
+			return nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+	}
+	router := gin.New()
+	router.GET("/status", func(c *gin.Context) { apiCfg.HandlerFileStatus(c, "test-consumer") })
+
+	status := func() UploadedFile {
+		req := httptest.NewRequest(http.MethodGet, "/status?transactionUuid="+fixedUUID.String()+"&userName=test-user", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var result UploadedFile
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result
+	}
+
+	result := status()
+	assert.Equal(t, "http://short-lived-url", result.DownloadPresignedUrl)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), result.DownloadExpirationTime, 10*time.Second)
+	assert.Equal(t, redirectURLExpiration, signedExpiration)
+	assert.Equal(t, 1, downloads)
+
+	// The status is still served when the URL can't be signed
+	signErr = errors.New("signing failed")
+	result = status()
+	assert.Empty(t, result.DownloadPresignedUrl)
+	assert.Equal(t, StatusFileUploaded, result.Status)
+	assert.Equal(t, 1, downloads)
+}
+
+func TestUploadRequestDeduplicated(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	sha256 := "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08"
+	existingKey := "0c5b2f3e-1111-4b6f-9c3e-2a1b3c4d5e6f_test-consumer_other-user_test-file.txt"
+
+	mockS3Client := &MockS3Client{
+		GeneratePresignedURLFunc: func(key string, expirationTime *int, opts s3client.PutObjectOptions) (string, time.Duration, error) {
+			t.Fatal("no upload URL should be issued for an already present file")
+			return "", 0, nil
+		},
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			assert.Equal(t, existingKey, key)
+			return "http://mock-download-url", time.Hour, nil
+		},
+	}
+	var created database.CreateUploadedFileParams
+	mockDB := &MockDB{
+		CreateLogicalFileFunc: func(ctx context.Context, arg database.CreateLogicalFileParams) (database.LogicalFile, error) {
+			return database.LogicalFile{ID: arg.ID, LatestVersion: 1}, nil
+		},
+		AcquireFileObjectFunc: func(ctx context.Context, arg database.AcquireFileObjectParams) (database.FileObject, error) {
+			assert.Equal(t, strings.ToLower(sha256), arg.Sha256)
+			return database.FileObject{
+				Consumer:  arg.Consumer,
+				Sha256:    arg.Sha256,
+				ObjectKey: existingKey,
+				FileSize:  sql.NullInt32{Int32: 1000, Valid: true},
+				RefCount:  2,
+			}, nil
+		},
+		CreateUploadedFileFunc: func(ctx context.Context, arg database.CreateUploadedFileParams) (database.UploadedFile, error) {
+			created = arg
+			return database.UploadedFile{TransactionUuid: arg.TransactionUuid}, nil
+		},
+		UpdateUploadedFileFunc: func(ctx context.Context, arg database.UpdateUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid: arg.TransactionUuid,
+				Consumer:        created.Consumer,
+				UserName:        created.UserName,
+				ObjectKey:       arg.ObjectKey,
+				FileSize:        arg.FileSize,
+				Status:          arg.Status,
+				Sha256:          created.Sha256,
+			}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+	}
+	c, _ := gin.CreateTestContext(nil)
+
+	params := UploadsFileParams{
+		UserName:      "test-user",
+		FileName:      "test-file",
+		FileExtention: "txt",
+		Sha256:        &sha256,
+	}
+	result, err := UploadRequest(c, params, "test-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+
+	assert.NoError(t, err)
+	assert.Equal(t, StatusAlreadyPresent, result.Status)
+	assert.Equal(t, existingKey, result.ObjectKey)
+	assert.Equal(t, "http://mock-download-url", result.DownloadPresignedUrl)
+	assert.Equal(t, "", created.UploadPresignedUrl)
+}
+
+func TestDeleteFileReleasesSharedObject(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	sha256 := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	deletedObjects := []string{}
+	refCount := int32(2)
+	rowExists := true
+	// Simulates an upload of the same content storing it right after a release
+	revive := false
+
+	mockS3Client := &MockS3Client{
+		DeleteObjectFunc: func(key string) error {
+			deletedObjects = append(deletedObjects, key)
+			return nil
+		},
+	}
+	mockDB := &MockDB{
+		ListRenditionsFunc: func(ctx context.Context, transactionUuid uuid.UUID) ([]database.Rendition, error) {
+			return nil, nil
+		},
+		DeleteUploadedFileFunc: func(ctx context.Context, arg database.DeleteUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid: arg.TransactionUuid,
+				Consumer:        arg.Consumer,
+				UserName:        arg.UserName,
+				ObjectKey:       "shared-key",
+				Status:          StatusFileUploaded,
+				Sha256:          sql.NullString{String: sha256, Valid: true},
+			}, nil
+		},
+		ReleaseFileObjectFunc: func(ctx context.Context, arg database.ReleaseFileObjectParams) (database.FileObject, error) {
+			refCount--
+			released := database.FileObject{ObjectKey: "shared-key", RefCount: refCount}
+			if revive {
+				refCount++
+			}
+			return released, nil
+		},
+		DeleteReleasedFileObjectFunc: func(ctx context.Context, arg database.DeleteReleasedFileObjectParams) (database.FileObject, error) {
+			if !rowExists || refCount > 0 {
+				return database.FileObject{}, sql.ErrNoRows
+			}
+			rowExists = false
+			return database.FileObject{ObjectKey: "shared-key"}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+	}
+	c, _ := gin.CreateTestContext(nil)
+
+	// Another transaction still references the object
+	_, err := DeleteFile(c, fixedUUID, "test-consumer", "test-user", apiCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), refCount)
+	assert.Empty(t, deletedObjects)
+
+	// The last reference goes but a new upload links to the object before it is deleted
+	revive = true
+	_, err = DeleteFile(c, fixedUUID, "test-consumer", "test-user", apiCfg)
+	assert.NoError(t, err)
+	assert.True(t, rowExists)
+	assert.Empty(t, deletedObjects)
+
+	// Last reference goes, the object is removed from S3
+	revive = false
+	_, err = DeleteFile(c, fixedUUID, "test-consumer", "test-user", apiCfg)
+	assert.NoError(t, err)
+	assert.False(t, rowExists)
+	assert.Equal(t, []string{"shared-key"}, deletedObjects)
+}
+
+func TestUploadedCompletedRequiresEncryption(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	fileName := fixedUUID.String() + "_oly_filename.txt"
+
+	mockS3Client := &MockS3Client{
+		GetObjectRangeFunc: func(key string, offset int64, length int64, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("plain text content")), nil
+		},
+		GetObjectInfoFunc: func(key string, opts s3client.GetObjectOptions) (s3client.ObjectInfo, error) {
+			return s3client.ObjectInfo{ServerSideEncryption: "AES256"}, nil
+		},
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			return "http://mock-presigned-url", time.Hour, nil
+		},
+	}
+	mockDB := &MockDB{
+		SetUploadedFileDetectedTypeFunc: func(ctx context.Context, arg database.SetUploadedFileDetectedTypeParams) error {
+			return nil
+		},
+		GetConsumerUploadedFileFunc: func(ctx context.Context, arg database.GetConsumerUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid: fixedUUID,
+				Consumer:        arg.Consumer,
+				ObjectKey:       fileName,
+				Status:          StatusWaitingFile,
+				SseMode:         sql.NullString{String: s3client.EncryptionSSEKMS, Valid: true},
+				SseKmsKeyID:     sql.NullString{String: "1234abcd-12ab-34cd-56ef-1234567890ab", Valid: true},
+			}, nil
+		},
+		UpdateUploadedFileFunc: func(ctx context.Context, arg database.UpdateUploadedFileParams) (database.UploadedFile, error) {
+			t.Fatal("a file without the required encryption must not be marked uploaded")
+			return database.UploadedFile{}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		DB:       mockDB,
+		S3Client: mockS3Client,
+	}
+	c, _ := gin.CreateTestContext(nil)
+
+	params := UploadCompletedParams{
+		TransactionUuid: &fixedUUID,
+		FileSize:        782,
+		FileType:        "text/plain",
+	}
+	_, err := UploadedCompleted(c, params, "test-consumer", apiCfg)
+	assert.Error(t, err)
+
+	// Same key reported as a full ARN is accepted
+	mockS3Client.GetObjectInfoFunc = func(key string, opts s3client.GetObjectOptions) (s3client.ObjectInfo, error) {
+		return s3client.ObjectInfo{
+			ServerSideEncryption: "aws:kms",
+			KMSKeyID:             "arn:aws:kms:eu-west-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab",
+		}, nil
+	}
+	mockDB.UpdateUploadedFileFunc = func(ctx context.Context, arg database.UpdateUploadedFileParams) (database.UploadedFile, error) {
+		return database.UploadedFile{TransactionUuid: arg.TransactionUuid, Status: arg.Status}, nil
+	}
+	result, err := UploadedCompleted(c, params, "test-consumer", apiCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusFileUploaded, result.Status)
+}
+
+func TestFileContentEnvelopeRoundTrip(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	masterKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, envelope.KeySize))
+	keyfile := filepath.Join(t.TempDir(), "keys.json")
+	err := os.WriteFile(keyfile, []byte(`{"test-consumer": {"activeKeyId": "k1", "keys": {"k1": "`+masterKey+`"}}}`), 0600)
+	assert.NoError(t, err)
+	keyProvider, err := envelope.LoadLocalKeyProvider(keyfile)
+	assert.NoError(t, err)
+
+	row := database.UploadedFile{
+		TransactionUuid: fixedUUID,
+		Consumer:        "test-consumer",
+		UserName:        "test-user",
+		ObjectKey:       "key",
+		Status:          StatusWaitingFile,
+	}
+	var stored bytes.Buffer
+	downloads := 0
+	mockS3Client := &MockS3Client{
+		UploadObjectFunc: func(key string, body io.Reader, opts s3client.PutObjectOptions) error {
+			_, err := io.Copy(&stored, body)
+			return err
+		},
+		GetObjectFunc: func(key string, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(stored.Bytes())), nil
+		},
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			t.Fatal("envelope encrypted files must not get presigned download URLs")
+			return "", 0, nil
+		},
+	}
+	mockDB := &MockDB{
+		SetUploadedFileDetectedTypeFunc: func(ctx context.Context, arg database.SetUploadedFileDetectedTypeParams) error {
+			return nil
+		},
+		GetUploadedFileFunc: func(ctx context.Context, arg database.GetUploadedFileParams) (database.UploadedFile, error) {
+			return row, nil
+		},
+		SetUploadedFileEnvelopeFunc: func(ctx context.Context, arg database.SetUploadedFileEnvelopeParams) (database.UploadedFile, error) {
+			row.EnvelopeAlgorithm = arg.EnvelopeAlgorithm
+			row.EnvelopeKeyID = arg.EnvelopeKeyID
+			row.EnvelopeWrappedKey = arg.EnvelopeWrappedKey
+			row.EnvelopeNonce = arg.EnvelopeNonce
+			row.EnvelopeChunkSize = arg.EnvelopeChunkSize
+			return row, nil
+		},
+		UpdateUploadedFileFunc: func(ctx context.Context, arg database.UpdateUploadedFileParams) (database.UploadedFile, error) {
+			row.FileSize = arg.FileSize
+			row.FileType = arg.FileType
+			row.Status = arg.Status
+			return row, nil
+		},
+		RecordUploadedFileDownloadFunc: func(ctx context.Context, transactionUuid uuid.UUID) error {
+			downloads++
+			return nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		DB:          mockDB,
+		S3Client:    mockS3Client,
+		KeyProvider: keyProvider,
+	}
+	c, _ := gin.CreateTestContext(nil)
+
+	plaintext := bytes.Repeat([]byte("confidential "), 20000)
+	result, err := UploadFileContent(c, fixedUUID, "test-consumer", "test-user", bytes.NewReader(plaintext), "text/plain", apiCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusFileUploaded, result.Status)
+	assert.Equal(t, envelope.Algorithm, result.ClientEncryption)
+	assert.Equal(t, int32(len(plaintext)), result.FileSize.Int32)
+	assert.Empty(t, result.DownloadPresignedUrl)
+	assert.False(t, bytes.Contains(stored.Bytes(), []byte("confidential")))
+
+	_, body, err := DownloadFileContent(c, fixedUUID, "test-consumer", "test-user", apiCfg)
+	assert.NoError(t, err)
+	defer body.Close()
+	downloaded, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, downloaded)
+	assert.Equal(t, 1, downloads)
+}
+
+func TestUploadRequestMetadata(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	var signed s3client.PutObjectOptions
+	mockS3Client := &MockS3Client{
+		GeneratePresignedURLFunc: func(key string, expirationTime *int, opts s3client.PutObjectOptions) (string, time.Duration, error) {
+			signed = opts
+			return "http://mock-presigned-url", time.Hour, nil
+		},
+	}
+	mockDB := &MockDB{
+		CreateLogicalFileFunc: func(ctx context.Context, arg database.CreateLogicalFileParams) (database.LogicalFile, error) {
+			return database.LogicalFile{ID: arg.ID, LatestVersion: 1}, nil
+		},
+		CreateUploadedFileFunc: func(ctx context.Context, arg database.CreateUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid: arg.TransactionUuid,
+				Status:          arg.Status,
+				Metadata:        arg.Metadata,
+				Tags:            arg.Tags,
+			}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+	}
+	c, _ := gin.CreateTestContext(nil)
+
+	params := UploadsFileParams{
+		UserName:      "test-user",
+		FileName:      "contract",
+		FileExtention: "pdf",
+		Metadata:      map[string]string{"Order-Id": "A-1234", "document_type": "contract"},
+		Tags:          map[string]string{"case": "2024/17"},
+	}
+	result, err := UploadRequest(c, params, "test-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"order-id": "A-1234", "document_type": "contract"}, signed.Metadata)
+	assert.Equal(t, map[string]string{"case": "2024/17"}, signed.Tags)
+	assert.Equal(t, map[string]string{"order-id": "A-1234", "document_type": "contract"}, result.Metadata)
+	assert.Equal(t, map[string]string{"case": "2024/17"}, result.Tags)
+
+	params.Metadata = map[string]string{"bad key": "value"}
+	_, err = UploadRequest(c, params, "test-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.ErrorIs(t, err, ErrInvalidMetadata)
+
+	params.Metadata = map[string]string{"note": strings.Repeat("x", 3000)}
+	_, err = UploadRequest(c, params, "test-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.ErrorIs(t, err, ErrInvalidMetadata)
+}
+
+func TestUpdateFileMetadataRecordsNewVersion(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	storedFile := database.UploadedFile{
+		TransactionUuid: fixedUUID,
+		Consumer:        "test-consumer",
+		ObjectKey:       "contract-key",
+		Status:          StatusFileUploaded,
+		S3VersionID:     sql.NullString{String: "v1", Valid: true},
+	}
+	var replaced s3client.PutObjectOptions
+	mockS3Client := &MockS3Client{
+		ReplaceObjectMetadataFunc: func(key string, opts s3client.PutObjectOptions) (string, error) {
+			replaced = opts
+			return "v2", nil
+		},
+	}
+	mockDB := &MockDB{
+		GetUploadedFileFunc: func(ctx context.Context, arg database.GetUploadedFileParams) (database.UploadedFile, error) {
+			return storedFile, nil
+		},
+		SetUploadedFileS3VersionFunc: func(ctx context.Context, arg database.SetUploadedFileS3VersionParams) error {
+			storedFile.S3VersionID = arg.S3VersionID
+			return nil
+		},
+		UpdateUploadedFileMetadataFunc: func(ctx context.Context, arg database.UpdateUploadedFileMetadataParams) (database.UploadedFile, error) {
+			storedFile.Metadata = arg.Metadata
+			return storedFile, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+	}
+	c, _ := gin.CreateTestContext(nil)
+	params := UpdateMetadataParams{
+		UserName: "test-user",
+		Metadata: map[string]string{"Order-Id": "A-1234"},
+	}
+
+	// Downloads follow the copy holding the new metadata
+	result, err := UpdateFileMetadata(c, fixedUUID, "test-consumer", params, apiCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"order-id": "A-1234"}, replaced.Metadata)
+	assert.Equal(t, "v2", result.S3VersionId)
+
+	// An archived object can't be copied until it is restored
+	storedFile.StorageClass = s3client.ArchiveStorageClasses[0]
+	mockS3Client.ReplaceObjectMetadataFunc = func(key string, opts s3client.PutObjectOptions) (string, error) {
+		t.Fatal("archived objects must not be copied")
+		return "", nil
+	}
+	_, err = UpdateFileMetadata(c, fixedUUID, "test-consumer", params, apiCfg)
+	assert.ErrorIs(t, err, ErrFileArchived)
+}
+
+func TestUploadRequestRoutesResidency(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	euLocation := s3client.Location{Bucket: "eu-bucket", Region: "eu-west-3"}
+
+	defaultClient := &MockS3Client{
+		GeneratePresignedURLFunc: func(key string, expirationTime *int, opts s3client.PutObjectOptions) (string, time.Duration, error) {
+			t.Fatal("the default bucket must not be used for a routed consumer")
+			return "", 0, nil
+		},
+	}
+	euClient := &MockS3Client{
+		GeneratePresignedURLFunc: func(key string, expirationTime *int, opts s3client.PutObjectOptions) (string, time.Duration, error) {
+			return "http://eu-upload-url", time.Hour, nil
+		},
+	}
+	router := &MockS3Router{
+		ResolveFunc: func(consumer string, residency string) (s3client.Location, error) {
+			if residency != "eu" {
+				return s3client.Location{}, errors.New("unknown residency")
+			}
+			return euLocation, nil
+		},
+		ClientFunc: func(location s3client.Location) (s3client.S3ClientInterface, error) {
+			assert.Equal(t, euLocation, location)
+			return euClient, nil
+		},
+	}
+	mockDB := &MockDB{
+		CreateLogicalFileFunc: func(ctx context.Context, arg database.CreateLogicalFileParams) (database.LogicalFile, error) {
+			return database.LogicalFile{ID: arg.ID, LatestVersion: 1}, nil
+		},
+		CreateUploadedFileFunc: func(ctx context.Context, arg database.CreateUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid:    arg.TransactionUuid,
+				UploadPresignedUrl: arg.UploadPresignedUrl,
+				Bucket:             arg.Bucket,
+				Region:             arg.Region,
+			}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: defaultClient,
+		DB:       mockDB,
+		Router:   router,
+	}
+	c, _ := gin.CreateTestContext(nil)
+
+	params := UploadsFileParams{
+		UserName:      "test-user",
+		FileName:      "test-file",
+		FileExtention: "txt",
+		Residency:     "eu",
+	}
+	result, err := UploadRequest(c, params, "test-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://eu-upload-url", result.UploadPresignedUrl)
+	assert.Equal(t, "eu-bucket", result.Bucket)
+	assert.Equal(t, "eu-west-3", result.Region)
+
+	params.Residency = "us"
+	_, err = UploadRequest(c, params, "test-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.ErrorIs(t, err, ErrUnknownResidency)
+}
+
+func TestDeleteFileUsesRecordedBucket(t *testing.T) {
+	transactionUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+
+	var deletedKey string
+	euClient := &MockS3Client{
+		DeleteObjectFunc: func(key string) error {
+			deletedKey = key
+			return nil
+		},
+	}
+	router := &MockS3Router{
+		ClientFunc: func(location s3client.Location) (s3client.S3ClientInterface, error) {
+			assert.Equal(t, s3client.Location{Bucket: "eu-bucket", Region: "eu-west-3"}, location)
+			return euClient, nil
+		},
+	}
+	mockDB := &MockDB{
+		ListRenditionsFunc: func(ctx context.Context, transactionUuid uuid.UUID) ([]database.Rendition, error) {
+			return nil, nil
+		},
+		DeleteUploadedFileFunc: func(ctx context.Context, arg database.DeleteUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid: arg.TransactionUuid,
+				ObjectKey:       "test-key",
+				Status:          StatusFileUploaded,
+				Bucket:          sql.NullString{String: "eu-bucket", Valid: true},
+				Region:          sql.NullString{String: "eu-west-3", Valid: true},
+			}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: &MockS3Client{},
+		DB:       mockDB,
+		Router:   router,
+	}
+	c, _ := gin.CreateTestContext(nil)
+
+	_, err := DeleteFile(c, transactionUUID, "test-consumer", "test-user", apiCfg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "test-key", deletedKey)
+}
+
+func TestUploadRequestStorageClass(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+
+	var signedClass string
+	mockS3Client := &MockS3Client{
+		GeneratePresignedURLFunc: func(key string, expirationTime *int, opts s3client.PutObjectOptions) (string, time.Duration, error) {
+			signedClass = opts.StorageClass
+			return "http://mock-url", time.Hour, nil
+		},
+	}
+	mockDB := &MockDB{
+		CreateLogicalFileFunc: func(ctx context.Context, arg database.CreateLogicalFileParams) (database.LogicalFile, error) {
+			return database.LogicalFile{ID: arg.ID, LatestVersion: 1}, nil
+		},
+		CreateUploadedFileFunc: func(ctx context.Context, arg database.CreateUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{TransactionUuid: arg.TransactionUuid, StorageClass: arg.StorageClass}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+		StorageClasses: s3client.StorageClassPolicies{
+			Consumers: map[string]s3client.StorageClassPolicy{
+				"archive-consumer": {Allowed: []string{"STANDARD_IA", "DEEP_ARCHIVE"}},
+			},
+		},
+	}
+	c, _ := gin.CreateTestContext(nil)
+	params := UploadsFileParams{
+		UserName:      "test-user",
+		FileName:      "test-file",
+		FileExtention: "txt",
+	}
+
+	result, err := UploadRequest(c, params, "archive-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.NoError(t, err)
+	assert.Equal(t, "STANDARD", result.StorageClass)
+
+	params.StorageClass = "DEEP_ARCHIVE"
+	result, err = UploadRequest(c, params, "archive-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.NoError(t, err)
+	assert.Equal(t, "DEEP_ARCHIVE", result.StorageClass)
+	assert.Equal(t, "DEEP_ARCHIVE", signedClass)
+
+	_, err = UploadRequest(c, params, "test-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.ErrorIs(t, err, ErrStorageClassNotAllowed)
+
+	// Uploads checked against a type policy or stripped of metadata must be readable
+	apiCfg.ContentTypes = contenttype.Policies{Consumers: map[string]contenttype.Policy{
+		"archive-consumer": {Allowed: []string{"application/pdf"}},
+	}}
+	_, err = UploadRequest(c, params, "archive-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.ErrorIs(t, err, ErrStorageClassNotAllowed)
+	apiCfg.ContentTypes = contenttype.Policies{}
+	apiCfg.MetadataStripping = imagemeta.Policies{Default: imagemeta.Policy{Enabled: true}}
+	_, err = UploadRequest(c, params, "archive-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.ErrorIs(t, err, ErrStorageClassNotAllowed)
+	params.StorageClass = "STANDARD_IA"
+	_, err = UploadRequest(c, params, "archive-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.NoError(t, err)
+}
+
+func TestRunStorageTransitions(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	objects := []database.ListIdleObjectsRow{
+		{Consumer: "test-consumer", ObjectKey: "idle-100-days", StorageClass: "STANDARD", LastAccessedAt: now.AddDate(0, 0, -100)},
+		{Consumer: "test-consumer", ObjectKey: "idle-400-days", StorageClass: "STANDARD_IA", LastAccessedAt: now.AddDate(0, 0, -400)},
+		{Consumer: "test-consumer", ObjectKey: "archived", StorageClass: "DEEP_ARCHIVE", LastAccessedAt: now.AddDate(0, 0, -400)},
+		{Consumer: "other-consumer", ObjectKey: "no-policy", StorageClass: "STANDARD", LastAccessedAt: now.AddDate(0, 0, -400)},
+	}
+	moved := map[string]string{}
+	mockS3Client := &MockS3Client{
+		ChangeStorageClassFunc: func(key string, opts s3client.PutObjectOptions) error {
+			moved[key] = opts.StorageClass
+			return nil
+		},
+	}
+	recorded := map[string]string{}
+	mockDB := &MockDB{
+		ListIdleObjectsFunc: func(ctx context.Context, arg database.ListIdleObjectsParams) ([]database.ListIdleObjectsRow, error) {
+			assert.Equal(t, now.AddDate(0, 0, -90), arg.IdleSince)
+			return objects, nil
+		},
+		SetObjectStorageClassFunc: func(ctx context.Context, arg database.SetObjectStorageClassParams) error {
+			recorded[arg.ObjectKey] = arg.StorageClass
+			return nil
+		},
+		SetFileObjectStorageClassFunc: func(ctx context.Context, arg database.SetFileObjectStorageClassParams) error {
+			return nil
+		},
+		CreateStorageTransitionFunc: func(ctx context.Context, arg database.CreateStorageTransitionParams) (database.StorageTransition, error) {
+			return database.StorageTransition{}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+		StorageClasses: s3client.StorageClassPolicies{
+			Consumers: map[string]s3client.StorageClassPolicy{
+				"test-consumer": {Transitions: []s3client.Transition{
+					{AfterDays: 90, StorageClass: "STANDARD_IA"},
+					{AfterDays: 365, StorageClass: "GLACIER_IR"},
+				}},
+			},
+		},
+	}
+
+	n, err := RunStorageTransitions(context.Background(), apiCfg, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, map[string]string{"idle-100-days": "STANDARD_IA", "idle-400-days": "GLACIER_IR"}, moved)
+	assert.Equal(t, moved, recorded)
+}
+
+func TestRunStorageTransitionsPagesByKey(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	firstBatch := make([]database.ListIdleObjectsRow, transitionBatchSize)
+	for i := range firstBatch {
+		firstBatch[i] = database.ListIdleObjectsRow{
+			Consumer:       "test-consumer",
+			Bucket:         sql.NullString{String: "test-bucket", Valid: true},
+			ObjectKey:      fmt.Sprintf("key-%03d", i),
+			StorageClass:   "STANDARD",
+			LastAccessedAt: now.AddDate(0, 0, -100),
+		}
+	}
+	var pages []database.ListIdleObjectsParams
+	mockDB := &MockDB{
+		ListIdleObjectsFunc: func(ctx context.Context, arg database.ListIdleObjectsParams) ([]database.ListIdleObjectsRow, error) {
+			pages = append(pages, arg)
+			if arg.AfterObjectKey == "" {
+				return firstBatch, nil
+			}
+			return []database.ListIdleObjectsRow{{Consumer: "test-consumer", ObjectKey: "last-key", StorageClass: "STANDARD", LastAccessedAt: now.AddDate(0, 0, -100)}}, nil
+		},
+		SetObjectStorageClassFunc: func(ctx context.Context, arg database.SetObjectStorageClassParams) error {
+			return nil
+		},
+		SetFileObjectStorageClassFunc: func(ctx context.Context, arg database.SetFileObjectStorageClassParams) error {
+			return nil
+		},
+		CreateStorageTransitionFunc: func(ctx context.Context, arg database.CreateStorageTransitionParams) (database.StorageTransition, error) {
+			return database.StorageTransition{}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: &MockS3Client{
+			ChangeStorageClassFunc: func(key string, opts s3client.PutObjectOptions) error {
+				return nil
+			},
+		},
+		DB: mockDB,
+		StorageClasses: s3client.StorageClassPolicies{
+			Default: s3client.StorageClassPolicy{Transitions: []s3client.Transition{{AfterDays: 90, StorageClass: "STANDARD_IA"}}},
+		},
+	}
+
+	n, err := RunStorageTransitions(context.Background(), apiCfg, now)
+
+	assert.NoError(t, err)
+	assert.Equal(t, transitionBatchSize+1, n)
+	// Moved objects still match, the next page starts after the last key seen
+	assert.Len(t, pages, 2)
+	assert.Equal(t, "test-consumer", pages[1].AfterConsumer)
+	assert.Equal(t, "test-bucket", pages[1].AfterBucket)
+	assert.Equal(t, "key-099", pages[1].AfterObjectKey)
+}
+
+func TestRequestRestore(t *testing.T) {
+	transactionUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	row := database.UploadedFile{
+		TransactionUuid: transactionUUID,
+		Consumer:        "test-consumer",
+		UserName:        "test-user",
+		ObjectKey:       "test-key",
+		Status:          StatusFileUploaded,
+		StorageClass:    "DEEP_ARCHIVE",
+	}
+	restoreExpiry := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	restoring := true
+	var signedExpiration int
+	mockS3Client := &MockS3Client{
+		RestoreObjectFunc: func(key string, tier string, days int) error {
+			assert.Equal(t, "Bulk", tier)
+			assert.Equal(t, 2, days)
+			return nil
+		},
+		GetObjectInfoFunc: func(key string, opts s3client.GetObjectOptions) (s3client.ObjectInfo, error) {
+			if restoring {
+				return s3client.ObjectInfo{RestoreInProgress: true}, nil
+			}
+			return s3client.ObjectInfo{RestoreExpiryDate: restoreExpiry}, nil
+		},
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			signedExpiration = *expirationTime
+			return "http://restored-url", time.Minute, nil
+		},
+	}
+	mockDB := &MockDB{
+		GetUploadedFileFunc: func(ctx context.Context, arg database.GetUploadedFileParams) (database.UploadedFile, error) {
+			return row, nil
+		},
+		SetUploadedFileRestoreFunc: func(ctx context.Context, arg database.SetUploadedFileRestoreParams) (database.UploadedFile, error) {
+			row.RestoreStatus = arg.RestoreStatus
+			row.RestoreTier = arg.RestoreTier
+			return row, nil
+		},
+		ExpireUploadedFileRestoresFunc: func(ctx context.Context, arg database.ExpireUploadedFileRestoresParams) error {
+			return nil
+		},
+		ListPendingRestoresFunc: func(ctx context.Context, arg database.ListPendingRestoresParams) ([]database.UploadedFile, error) {
+			return []database.UploadedFile{row}, nil
+		},
+		CompleteUploadedFileRestoreFunc: func(ctx context.Context, arg database.CompleteUploadedFileRestoreParams) (database.UploadedFile, error) {
+			row.RestoreStatus = arg.RestoreStatus
+			row.RestoreExpiresAt = arg.RestoreExpiresAt
+			return row, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+	}
+	c, _ := gin.CreateTestContext(nil)
+
+	_, err := RequestRestore(c, transactionUUID, "test-consumer", RestoreParams{UserName: "test-user", Tier: "Expedited"}, apiCfg)
+	assert.ErrorIs(t, err, ErrInvalidRestoreTier)
+
+	result, err := RequestRestore(c, transactionUUID, "test-consumer", RestoreParams{UserName: "test-user", Tier: "Bulk", Days: 2}, apiCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, RestoreInProgress, result.RestoreStatus)
+	assert.Empty(t, result.DownloadPresignedUrl)
+
+	restoring = false
+	n, err := RunRestoreChecks(context.Background(), apiCfg, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	result = DatabaseUploadFileToUploadFile(row)
+	assert.Equal(t, RestoreCompleted, result.RestoreStatus)
+	assert.Equal(t, restoreExpiry, result.RestoreExpiresAt)
+	// The restored copy is served with a URL minted when asked for, not one stored with the file
+	assert.Empty(t, result.DownloadPresignedUrl)
+	downloadURL, _, err := freshDownloadURL(c, row, false, apiCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://restored-url", downloadURL)
+	assert.Equal(t, redirectURLExpiration, signedExpiration)
+}
+
+func TestRestoreWithholdsURLUntilScanned(t *testing.T) {
+	row := database.UploadedFile{
+		TransactionUuid: uuid.MustParse("660e8400-e29b-41d4-a716-446655440000"),
+		Consumer:        "test-consumer",
+		UserName:        "test-user",
+		ObjectKey:       "test-key",
+		Status:          StatusFileUploaded,
+		StorageClass:    "DEEP_ARCHIVE",
+		RestoreStatus:   sql.NullString{String: RestoreInProgress, Valid: true},
+		ScanStatus:      sql.NullString{String: ScanPending, Valid: true},
+	}
+	restoreExpiry := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	mockS3Client := &MockS3Client{
+		GetObjectInfoFunc: func(key string, opts s3client.GetObjectOptions) (s3client.ObjectInfo, error) {
+			return s3client.ObjectInfo{RestoreExpiryDate: restoreExpiry}, nil
+		},
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			t.Error("no download URL before the file is scanned clean")
+			return "http://restored-url", time.Hour, nil
+		},
+	}
+	mockDB := &MockDB{
+		ExpireUploadedFileRestoresFunc: func(ctx context.Context, arg database.ExpireUploadedFileRestoresParams) error {
+			return nil
+		},
+		ListPendingRestoresFunc: func(ctx context.Context, arg database.ListPendingRestoresParams) ([]database.UploadedFile, error) {
+			return []database.UploadedFile{row}, nil
+		},
+		CompleteUploadedFileRestoreFunc: func(ctx context.Context, arg database.CompleteUploadedFileRestoreParams) (database.UploadedFile, error) {
+			row.RestoreStatus = arg.RestoreStatus
+			row.RestoreExpiresAt = arg.RestoreExpiresAt
+			return row, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+	}
+
+	n, err := RunRestoreChecks(context.Background(), apiCfg, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, RestoreCompleted, row.RestoreStatus.String)
+	downloadURL, _, err := freshDownloadURL(context.Background(), row, false, apiCfg)
+	assert.NoError(t, err)
+	assert.Empty(t, downloadURL)
+
+	row.ScanStatus = sql.NullString{String: ScanInfected, Valid: true}
+	downloadURL, _, err = freshDownloadURL(context.Background(), row, false, apiCfg)
+	assert.NoError(t, err)
+	assert.Empty(t, downloadURL)
+}
+
+func TestUploadRequestRetention(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	sha256 := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	var signedLock s3client.ObjectLock
+	mockS3Client := &MockS3Client{
+		GeneratePresignedURLFunc: func(key string, expirationTime *int, opts s3client.PutObjectOptions) (string, time.Duration, error) {
+			signedLock = opts.ObjectLock
+			return "http://mock-url", time.Hour, nil
+		},
+	}
+	mockDB := &MockDB{
+		CreateLogicalFileFunc: func(ctx context.Context, arg database.CreateLogicalFileParams) (database.LogicalFile, error) {
+			return database.LogicalFile{ID: arg.ID, LatestVersion: 1}, nil
+		},
+		AcquireFileObjectFunc: func(ctx context.Context, arg database.AcquireFileObjectParams) (database.FileObject, error) {
+			t.Fatal("retained files must not be deduplicated")
+			return database.FileObject{}, nil
+		},
+		CreateUploadedFileFunc: func(ctx context.Context, arg database.CreateUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid: arg.TransactionUuid,
+				RetentionMode:   arg.RetentionMode,
+				RetainUntil:     arg.RetainUntil,
+			}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+		Retention: s3client.RetentionPolicies{
+			Consumers: map[string]s3client.Retention{
+				"records": {Mode: "COMPLIANCE", Days: 365},
+			},
+		},
+	}
+	c, _ := gin.CreateTestContext(nil)
+	params := UploadsFileParams{
+		UserName:      "test-user",
+		FileName:      "contract",
+		FileExtention: "pdf",
+		Sha256:        &sha256,
+	}
+
+	result, err := UploadRequest(c, params, "records", apiCfg, func() uuid.UUID { return fixedUUID })
+
+	assert.NoError(t, err)
+	assert.Equal(t, "COMPLIANCE", result.RetentionMode)
+	assert.Equal(t, "COMPLIANCE", signedLock.Mode)
+	assert.Equal(t, signedLock.RetainUntil, result.RetainUntil)
+	assert.WithinDuration(t, time.Now().AddDate(1, 0, 0), result.RetainUntil, time.Minute)
+}
+
+func TestDeleteFileRefusedWhileLocked(t *testing.T) {
+	transactionUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	row := database.UploadedFile{
+		TransactionUuid: transactionUUID,
+		Status:          StatusFileUploaded,
+		RetentionMode:   sql.NullString{String: "GOVERNANCE", Valid: true},
+		RetainUntil:     sql.NullTime{Time: time.Now().Add(24 * time.Hour), Valid: true},
+	}
+	mockDB := &MockDB{
+		ListRenditionsFunc: func(ctx context.Context, transactionUuid uuid.UUID) ([]database.Rendition, error) {
+			return nil, nil
+		},
+		DeleteUploadedFileFunc: func(ctx context.Context, arg database.DeleteUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{}, sql.ErrNoRows
+		},
+		GetUploadedFileFunc: func(ctx context.Context, arg database.GetUploadedFileParams) (database.UploadedFile, error) {
+			return row, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: &MockS3Client{},
+		DB:       mockDB,
+	}
+	c, _ := gin.CreateTestContext(nil)
+
+	_, err := DeleteFile(c, transactionUUID, "test-consumer", "test-user", apiCfg)
+	assert.ErrorIs(t, err, ErrFileLocked)
+	assert.Contains(t, err.Error(), "GOVERNANCE retention")
+
+	row.RetentionMode = sql.NullString{}
+	row.RetainUntil = sql.NullTime{}
+	row.LegalHold = true
+	_, err = DeleteFile(c, transactionUUID, "test-consumer", "test-user", apiCfg)
+	assert.ErrorIs(t, err, ErrFileLocked)
+	assert.Contains(t, err.Error(), "legal hold")
+}
+
+func TestUploadRequestNewVersion(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	logicalFileID := uuid.MustParse("0c5b2f3e-1111-4b6f-9c3e-2a1b3c4d5e6f")
+
+	mockS3Client := &MockS3Client{
+		GeneratePresignedURLFunc: func(key string, expirationTime *int, opts s3client.PutObjectOptions) (string, time.Duration, error) {
+			return "http://mock-url", time.Hour, nil
+		},
+	}
+	mockDB := &MockDB{
+		NextLogicalFileVersionFunc: func(ctx context.Context, arg database.NextLogicalFileVersionParams) (database.LogicalFile, error) {
+			if arg.ID != logicalFileID || arg.UserName != "test-user" {
+				return database.LogicalFile{}, sql.ErrNoRows
+			}
+			return database.LogicalFile{ID: arg.ID, LatestVersion: 3}, nil
+		},
+		CreateUploadedFileFunc: func(ctx context.Context, arg database.CreateUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid: arg.TransactionUuid,
+				LogicalFileID:   arg.LogicalFileID,
+				Version:         arg.Version,
+			}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+	}
+	c, _ := gin.CreateTestContext(nil)
+	params := UploadsFileParams{
+		UserName:      "test-user",
+		FileName:      "contract",
+		FileExtention: "pdf",
+		LogicalFileId: &logicalFileID,
+	}
+
+	result, err := UploadRequest(c, params, "test-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.NoError(t, err)
+	assert.Equal(t, logicalFileID, result.LogicalFileId)
+	assert.Equal(t, int32(3), result.Version)
+
+	params.UserName = "other-user"
+	_, err = UploadRequest(c, params, "test-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.ErrorIs(t, err, ErrLogicalFileNotFound)
+
+	// A request failing before the transaction is recorded allocates no version
+	allocated := 0
+	mockDB.NextLogicalFileVersionFunc = func(ctx context.Context, arg database.NextLogicalFileVersionParams) (database.LogicalFile, error) {
+		allocated++
+		return database.LogicalFile{ID: arg.ID, LatestVersion: 4}, nil
+	}
+	mockS3Client.GeneratePresignedURLFunc = func(key string, expirationTime *int, opts s3client.PutObjectOptions) (string, time.Duration, error) {
+		return "", 0, errors.New("signing failed")
+	}
+	params.UserName = "test-user"
+	_, err = UploadRequest(c, params, "test-consumer", apiCfg, func() uuid.UUID { return fixedUUID })
+	assert.Error(t, err)
+	assert.Equal(t, 0, allocated)
+}
+
+func TestGetFileVersionPinsS3Version(t *testing.T) {
+	logicalFileID := uuid.MustParse("0c5b2f3e-1111-4b6f-9c3e-2a1b3c4d5e6f")
+
+	mockS3Client := &MockS3Client{
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			assert.Equal(t, "v1-key", key)
+			assert.Equal(t, "s3-version-1", opts.VersionID)
+			assert.Equal(t, redirectURLExpiration, *expirationTime)
+			return "http://version-1-url", time.Minute, nil
+		},
+	}
+	mockDB := &MockDB{
+		GetFileVersionFunc: func(ctx context.Context, arg database.GetFileVersionParams) (database.UploadedFile, error) {
+			if arg.Version != 1 {
+				return database.UploadedFile{}, sql.ErrNoRows
+			}
+			return database.UploadedFile{
+				LogicalFileID: arg.LogicalFileID,
+				Version:       1,
+				ObjectKey:     "v1-key",
+				Status:        StatusFileUploaded,
+				StorageClass:  "STANDARD",
+				S3VersionID:   sql.NullString{String: "s3-version-1", Valid: true},
+			}, nil
+		},
+		RecordUploadedFileDownloadFunc: func(ctx context.Context, transactionUuid uuid.UUID) error {
+			return nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+	}
+	c, _ := gin.CreateTestContext(nil)
+
+	result, err := GetFileVersion(c, logicalFileID, 1, "test-consumer", "test-user", apiCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://version-1-url", result.DownloadPresignedUrl)
+	assert.Equal(t, "s3-version-1", result.S3VersionId)
+
+	_, err = GetFileVersion(c, logicalFileID, 2, "test-consumer", "test-user", apiCfg)
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+}
+
+type fakeScanner map[string]clamav.Result
+
+func (f fakeScanner) Scan(ctx context.Context, r io.Reader) (clamav.Result, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return clamav.Result{}, err
+	}
+	return f[string(content)], nil
+}
+
+func TestRunScans(t *testing.T) {
+	bucket := sql.NullString{String: "test-bucket", Valid: true}
+	pending := []database.UploadedFile{
+		{Consumer: "test-consumer", ObjectKey: "clean-key", Bucket: bucket, Status: StatusFileUploaded, ScanStatus: sql.NullString{String: ScanPending, Valid: true}},
+		{Consumer: "test-consumer", ObjectKey: "infected-key", Bucket: bucket, Status: StatusFileUploaded, ScanStatus: sql.NullString{String: ScanPending, Valid: true}},
+	}
+	moved := map[string]string{}
+	mockS3Client := &MockS3Client{
+		GetObjectFunc: func(key string, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(key)), nil
+		},
+		MoveObjectFunc: func(key string, destinationKey string, opts s3client.PutObjectOptions) error {
+			moved[key] = destinationKey
+			return nil
+		},
+	}
+	var results []database.SetObjectScanResultParams
+	var quarantined []database.QuarantineObjectParams
+	var forgotten []database.DeleteFileObjectByKeyParams
+	mockDB := &MockDB{
+		ListPendingScansFunc: func(ctx context.Context, arg database.ListPendingScansParams) ([]database.UploadedFile, error) {
+			assert.Equal(t, ScanPending, arg.PendingStatus.String)
+			return pending, nil
+		},
+		SetObjectScanResultFunc: func(ctx context.Context, arg database.SetObjectScanResultParams) error {
+			results = append(results, arg)
+			return nil
+		},
+		QuarantineObjectFunc: func(ctx context.Context, arg database.QuarantineObjectParams) error {
+			quarantined = append(quarantined, arg)
+			return nil
+		},
+		DeleteFileObjectByKeyFunc: func(ctx context.Context, arg database.DeleteFileObjectByKeyParams) error {
+			forgotten = append(forgotten, arg)
+			return nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+		Scanner:  fakeScanner{"infected-key": {Infected: true, Signature: "Eicar-Test-Signature"}},
+	}
+
+	n, err := RunScans(context.Background(), apiCfg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "clean-key", results[0].ObjectKey)
+		assert.Equal(t, ScanClean, results[0].ScanStatus.String)
+	}
+	assert.Equal(t, map[string]string{"infected-key": "quarantine/infected-key"}, moved)
+	if assert.Len(t, quarantined, 1) {
+		assert.Equal(t, "quarantine/infected-key", quarantined[0].QuarantineKey)
+		assert.Equal(t, "Eicar-Test-Signature", quarantined[0].ScanSignature.String)
+	}
+	assert.Equal(t, []database.DeleteFileObjectByKeyParams{{Consumer: "test-consumer", Bucket: "test-bucket", ObjectKey: "infected-key"}}, forgotten)
+
+	// Until then the files could not be downloaded
+	assert.ErrorIs(t, downloadBlocked(pending[0], time.Now()), ErrFileNotScanned)
+}
+
+func TestRunScansBacksOffUnreadableObjects(t *testing.T) {
+	bucket := sql.NullString{String: "test-bucket", Valid: true}
+	pending := []database.UploadedFile{
+		{Consumer: "test-consumer", ObjectKey: "first-failure", Bucket: bucket, Status: StatusFileUploaded, ScanStatus: sql.NullString{String: ScanPending, Valid: true}},
+		{Consumer: "test-consumer", ObjectKey: "last-failure", Bucket: bucket, Status: StatusFileUploaded, ScanStatus: sql.NullString{String: ScanPending, Valid: true}, ScanAttempts: maxScanAttempts - 1},
+	}
+	mockS3Client := &MockS3Client{
+		GetObjectFunc: func(key string, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			return nil, errors.New("access denied")
+		},
+	}
+	var attempted []string
+	var results []database.SetObjectScanResultParams
+	mockDB := &MockDB{
+		ListPendingScansFunc: func(ctx context.Context, arg database.ListPendingScansParams) ([]database.UploadedFile, error) {
+			// Archived objects stay out of the queue until restored
+			assert.Equal(t, s3client.ArchiveStorageClasses, arg.ArchiveClasses)
+			assert.Equal(t, RestoreCompleted, arg.RestoredStatus.String)
+			return pending, nil
+		},
+		RecordObjectScanAttemptFunc: func(ctx context.Context, arg database.RecordObjectScanAttemptParams) error {
+			attempted = append(attempted, arg.ObjectKey)
+			return nil
+		},
+		SetObjectScanResultFunc: func(ctx context.Context, arg database.SetObjectScanResultParams) error {
+			results = append(results, arg)
+			return nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+		Scanner:  fakeScanner{},
+	}
+
+	n, err := RunScans(context.Background(), apiCfg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, []string{"first-failure"}, attempted)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "last-failure", results[0].ObjectKey)
+		assert.Equal(t, ScanFailed, results[0].ScanStatus.String)
+	}
+}
+
+func TestUploadedCompletedRejectsDisallowedType(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	deleted := ""
+	mockS3Client := &MockS3Client{
+		GetObjectRangeFunc: func(key string, offset int64, length int64, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			assert.Equal(t, int64(0), offset)
+			return io.NopCloser(strings.NewReader("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")), nil
+		},
+		DeleteObjectFunc: func(key string) error {
+			deleted = key
+			return nil
+		},
+	}
+	mockDB := &MockDB{
+		GetConsumerUploadedFileFunc: func(ctx context.Context, arg database.GetConsumerUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid: fixedUUID,
+				Consumer:        arg.Consumer,
+				FileName:        "photo.jpg",
+				ObjectKey:       "test-key",
+				Status:          StatusWaitingFile,
+			}, nil
+		},
+		UpdateUploadedFileFunc: func(ctx context.Context, arg database.UpdateUploadedFileParams) (database.UploadedFile, error) {
+			t.Fatal("a rejected file must not be marked uploaded")
+			return database.UploadedFile{}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		DB:       mockDB,
+		S3Client: mockS3Client,
+		ContentTypes: contenttype.Policies{
+			Default: contenttype.Policy{Allowed: []string{"image/*"}},
+		},
+	}
+	c, _ := gin.CreateTestContext(nil)
+	params := UploadCompletedParams{
+		TransactionUuid: &fixedUUID,
+		FileSize:        782,
+		FileType:        "image/jpeg",
+	}
+
+	_, err := UploadedCompleted(c, params, "test-consumer", apiCfg)
+
+	assert.ErrorIs(t, err, contenttype.ErrTypeNotAllowed)
+	assert.Equal(t, "test-key", deleted)
+}
+
+func TestRunRenditions(t *testing.T) {
+	transactionUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	var original bytes.Buffer
+	assert.NoError(t, png.Encode(&original, image.NewRGBA(image.Rect(0, 0, 800, 400))))
+	uploaded := map[string][]byte{}
+	mockS3Client := &MockS3Client{
+		GetObjectFunc: func(key string, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			if key == "unreachable-key" {
+				return nil, errors.New("connection reset")
+			}
+			assert.Equal(t, "photo-key", key)
+			return io.NopCloser(bytes.NewReader(original.Bytes())), nil
+		},
+		UploadObjectFunc: func(key string, body io.Reader, opts s3client.PutObjectOptions) error {
+			data, _ := io.ReadAll(body)
+			uploaded[key] = data
+			return nil
+		},
+	}
+	archivedUUID := uuid.MustParse("660e8400-e29b-41d4-a716-446655440000")
+	unreachableUUID := uuid.MustParse("770e8400-e29b-41d4-a716-446655440000")
+	var created []database.CreateRenditionParams
+	statuses := map[uuid.UUID]string{}
+	var attempted []uuid.UUID
+	mockDB := &MockDB{
+		ListPendingRenditionsFunc: func(ctx context.Context, arg database.ListPendingRenditionsParams) ([]database.UploadedFile, error) {
+			return []database.UploadedFile{{
+				TransactionUuid: transactionUUID,
+				Consumer:        "test-consumer",
+				ObjectKey:       "photo-key",
+				Status:          StatusFileUploaded,
+				RenditionStatus: sql.NullString{String: RenditionPending, Valid: true},
+			}, {
+				TransactionUuid: archivedUUID,
+				Consumer:        "test-consumer",
+				ObjectKey:       "archived-key",
+				Status:          StatusFileUploaded,
+				StorageClass:    "DEEP_ARCHIVE",
+				RenditionStatus: sql.NullString{String: RenditionPending, Valid: true},
+			}, {
+				TransactionUuid: unreachableUUID,
+				Consumer:        "test-consumer",
+				ObjectKey:       "unreachable-key",
+				Status:          StatusFileUploaded,
+				RenditionStatus: sql.NullString{String: RenditionPending, Valid: true},
+			}}, nil
+		},
+		RecordRenditionAttemptFunc: func(ctx context.Context, transactionUuid uuid.UUID) error {
+			attempted = append(attempted, transactionUuid)
+			return nil
+		},
+		CreateRenditionFunc: func(ctx context.Context, arg database.CreateRenditionParams) (database.Rendition, error) {
+			created = append(created, arg)
+			return database.Rendition{}, nil
+		},
+		SetUploadedFileRenditionStatusFunc: func(ctx context.Context, arg database.SetUploadedFileRenditionStatusParams) error {
+			statuses[arg.TransactionUuid] = arg.RenditionStatus.String
+			return nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client:       mockS3Client,
+		DB:             mockDB,
+		ThumbnailSizes: []thumbnail.Size{{Name: "small", Width: 200, Height: 200}},
+	}
+
+	n, err := RunRenditions(context.Background(), apiCfg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, RenditionDone, statuses[transactionUUID])
+	// Neither leaves the row at the head of the queue
+	assert.Equal(t, RenditionSkipped, statuses[archivedUUID])
+	assert.Equal(t, []uuid.UUID{unreachableUUID}, attempted)
+	key := "renditions/" + transactionUUID.String() + "/small.png"
+	assert.Contains(t, uploaded, key)
+	if assert.Len(t, created, 1) {
+		assert.Equal(t, key, created[0].ObjectKey)
+		assert.Equal(t, int32(200), created[0].Width)
+		assert.Equal(t, int32(100), created[0].Height)
+		assert.Equal(t, int32(len(uploaded[key])), created[0].FileSize)
+	}
+}
+
+func TestUploadedCompletedStripsImageMetadata(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	var encoded bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 16, 16)), nil))
+	// APP1 EXIF segment holding a GPS IFD pointer
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01\x88\x25\x00\x04\x00\x00\x00\x01\x00\x00\x00\x1a\x00\x00\x00\x00")
+	photo := append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	photo = append(photo, encoded.Bytes()[2:]...)
+
+	moved := map[string]string{}
+	var stored []byte
+	mockS3Client := &MockS3Client{
+		GetObjectRangeFunc: func(key string, offset int64, length int64, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(photo)), nil
+		},
+		GetObjectFunc: func(key string, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(photo)), nil
+		},
+		MoveObjectFunc: func(key string, destinationKey string, opts s3client.PutObjectOptions) error {
+			moved[key] = destinationKey
+			return nil
+		},
+		UploadObjectFunc: func(key string, body io.Reader, opts s3client.PutObjectOptions) error {
+			assert.Equal(t, "photo-key", key)
+			stored, _ = io.ReadAll(body)
+			return nil
+		},
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			return "http://mock-presigned-url", time.Hour, nil
+		},
+	}
+	var sanitized database.SetUploadedFileSanitizedParams
+	var recordedSize int32
+	mockDB := &MockDB{
+		GetConsumerUploadedFileFunc: func(ctx context.Context, arg database.GetConsumerUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid: fixedUUID,
+				Consumer:        arg.Consumer,
+				FileName:        "holiday.jpg",
+				ObjectKey:       "photo-key",
+				Status:          StatusWaitingFile,
+			}, nil
+		},
+		SetUploadedFileDetectedTypeFunc: func(ctx context.Context, arg database.SetUploadedFileDetectedTypeParams) error {
+			assert.Equal(t, "image/jpeg", arg.DetectedType.String)
+			return nil
+		},
+		SetUploadedFileSanitizedFunc: func(ctx context.Context, arg database.SetUploadedFileSanitizedParams) error {
+			sanitized = arg
+			return nil
+		},
+		UpdateUploadedFileFunc: func(ctx context.Context, arg database.UpdateUploadedFileParams) (database.UploadedFile, error) {
+			recordedSize = arg.FileSize.Int32
+			return database.UploadedFile{TransactionUuid: arg.TransactionUuid, Status: arg.Status}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		DB:       mockDB,
+		S3Client: mockS3Client,
+		MetadataStripping: imagemeta.Policies{
+			Consumers: map[string]imagemeta.Policy{"test-consumer": {Enabled: true, KeepOriginal: true}},
+		},
+	}
+	c, _ := gin.CreateTestContext(nil)
+	params := UploadCompletedParams{
+		TransactionUuid: &fixedUUID,
+		FileSize:        int64(len(photo)),
+		FileType:        "image/jpeg",
+	}
+
+	_, err := UploadedCompleted(c, params, "test-consumer", apiCfg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"photo-key": "originals/photo-key"}, moved)
+	assert.Equal(t, encoded.Bytes(), stored)
+	assert.Equal(t, []string{imagemeta.EXIF, imagemeta.GPS}, sanitized.StrippedMetadata)
+	assert.Equal(t, "originals/photo-key", sanitized.OriginalObjectKey.String)
+	assert.Equal(t, int32(len(stored)), recordedSize)
+}
+
+func TestStrippingReader(t *testing.T) {
+	var encoded bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 16, 16)), nil))
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00")
+	photo := append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	photo = append(photo, encoded.Bytes()[2:]...)
+
+	stripper := newStrippingReader(bytes.NewReader(photo), "image/jpeg")
+	stripped, err := io.ReadAll(stripper)
+	assert.NoError(t, err)
+	assert.Equal(t, encoded.Bytes(), stripped)
+	removed, err := stripper.result()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{imagemeta.EXIF}, removed)
+
+	// A stripping error is reported once it has interrupted the read
+	stripper = newStrippingReader(strings.NewReader("not a jpeg"), "image/jpeg")
+	_, err = io.ReadAll(stripper)
+	assert.ErrorIs(t, err, ErrImageNotSanitized)
+	assert.ErrorIs(t, stripper.failure(), ErrImageNotSanitized)
+}
+
+func TestUploadedCompletedLinksFileObjectLast(t *testing.T) {
+	fixedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	var encoded bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 16, 16)), nil))
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00")
+	photo := append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	photo = append(photo, encoded.Bytes()[2:]...)
+	checksum := sha256.Sum256(photo)
+
+	uploadErr := errors.New("connection reset")
+	var stored []byte
+	var deleted []string
+	mockS3Client := &MockS3Client{
+		GetObjectRangeFunc: func(key string, offset int64, length int64, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(photo)), nil
+		},
+		GetObjectFunc: func(key string, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(photo)), nil
+		},
+		GetObjectInfoFunc: func(key string, opts s3client.GetObjectOptions) (s3client.ObjectInfo, error) {
+			return s3client.ObjectInfo{ChecksumSHA256: base64.StdEncoding.EncodeToString(checksum[:])}, nil
+		},
+		UploadObjectFunc: func(key string, body io.Reader, opts s3client.PutObjectOptions) error {
+			stored, _ = io.ReadAll(body)
+			return uploadErr
+		},
+		DeleteObjectFunc: func(key string) error {
+			deleted = append(deleted, key)
+			return nil
+		},
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			return "http://mock-presigned-url", time.Hour, nil
+		},
+	}
+	var linked []database.CompleteDeduplicatedUploadParams
+	mockDB := &MockDB{
+		GetConsumerUploadedFileFunc: func(ctx context.Context, arg database.GetConsumerUploadedFileParams) (database.UploadedFile, error) {
+			return database.UploadedFile{
+				TransactionUuid: fixedUUID,
+				Consumer:        arg.Consumer,
+				FileName:        "holiday.jpg",
+				ObjectKey:       "photo-key",
+				Status:          StatusWaitingFile,
+				Sha256:          sql.NullString{String: hex.EncodeToString(checksum[:]), Valid: true},
+			}, nil
+		},
+		SetUploadedFileDetectedTypeFunc: func(ctx context.Context, arg database.SetUploadedFileDetectedTypeParams) error {
+			return nil
+		},
+		SetUploadedFileSanitizedFunc: func(ctx context.Context, arg database.SetUploadedFileSanitizedParams) error {
+			return nil
+		},
+		CompleteDeduplicatedUploadFunc: func(ctx context.Context, arg database.CompleteDeduplicatedUploadParams) (database.UploadedFile, error) {
+			linked = append(linked, arg)
+			// Identical content was stored by an earlier upload
+			return database.UploadedFile{TransactionUuid: arg.TransactionUuid, ObjectKey: "stored-key", Status: arg.CompletedStatus}, nil
+		},
+		UpdateUploadedFileFunc: func(ctx context.Context, arg database.UpdateUploadedFileParams) (database.UploadedFile, error) {
+			t.Fatal("deduplicated uploads are completed along with their file object reference")
+			return database.UploadedFile{}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		DB:       mockDB,
+		S3Client: mockS3Client,
+		MetadataStripping: imagemeta.Policies{
+			Consumers: map[string]imagemeta.Policy{"test-consumer": {Enabled: true}},
+		},
+	}
+	c, _ := gin.CreateTestContext(nil)
+	params := UploadCompletedParams{
+		TransactionUuid: &fixedUUID,
+		FileSize:        int64(len(photo)),
+		FileType:        "image/jpeg",
+	}
+
+	// Sanitizing fails, the file object isn't referenced
+	_, err := UploadedCompleted(c, params, "test-consumer", apiCfg)
+	assert.Error(t, err)
+	assert.Empty(t, linked)
+
+	// The client retries, the reference is taken once
+	uploadErr = nil
+	result, err := UploadedCompleted(c, params, "test-consumer", apiCfg)
+	assert.NoError(t, err)
+	assert.Len(t, linked, 1)
+	assert.Equal(t, StatusWaitingFile, linked[0].WaitingStatus)
+	// Registered under the stored content, the declared checksum still had the EXIF segment
+	sanitizedChecksum := sha256.Sum256(stored)
+	assert.Equal(t, hex.EncodeToString(sanitizedChecksum[:]), linked[0].Sha256)
+	assert.NotEqual(t, hex.EncodeToString(checksum[:]), linked[0].Sha256)
+	assert.Equal(t, "stored-key", result.ObjectKey)
+	assert.Equal(t, []string{"photo-key"}, deleted)
+}
+
+func TestRunExtractionsAndSearch(t *testing.T) {
+	transactionUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	mockS3Client := &MockS3Client{
+		GetObjectFunc: func(key string, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(`{"title": "Rapport annuel"}`)), nil
+		},
+	}
+	var indexed database.UpsertFileContentParams
+	statuses := map[uuid.UUID]string{}
+	mockDB := &MockDB{
+		ListPendingExtractionsFunc: func(ctx context.Context, arg database.ListPendingExtractionsParams) ([]database.UploadedFile, error) {
+			return []database.UploadedFile{{
+				TransactionUuid:  transactionUUID,
+				Consumer:         "test-consumer",
+				ObjectKey:        "report-key",
+				Status:           StatusFileUploaded,
+				DetectedType:     sql.NullString{String: "application/json", Valid: true},
+				ExtractionStatus: sql.NullString{String: ExtractionPending, Valid: true},
+			}}, nil
+		},
+		UpsertFileContentFunc: func(ctx context.Context, arg database.UpsertFileContentParams) error {
+			indexed = arg
+			return nil
+		},
+		SetUploadedFileExtractionStatusFunc: func(ctx context.Context, arg database.SetUploadedFileExtractionStatusParams) error {
+			statuses[arg.TransactionUuid] = arg.ExtractionStatus.String
+			return nil
+		},
+		SearchUploadedFilesFunc: func(ctx context.Context, arg database.SearchUploadedFilesParams) ([]database.SearchUploadedFilesRow, error) {
+			assert.Equal(t, "french", arg.Language)
+			assert.Equal(t, "test-consumer", arg.Consumer)
+			assert.Equal(t, "test-user", arg.UserName.String)
+			assert.Equal(t, int32(maxListResults), arg.MaxResults)
+			return []database.SearchUploadedFilesRow{{
+				UploadedFile: database.UploadedFile{TransactionUuid: transactionUUID},
+				Rank:         0.5,
+				Snippet:      "<mark>Rapport</mark> annuel",
+			}}, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client:        mockS3Client,
+		DB:              mockDB,
+		SearchLanguages: textextract.Languages{Consumers: map[string]string{"test-consumer": "french"}},
+	}
+
+	n, err := RunExtractions(context.Background(), apiCfg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, ExtractionDone, statuses[transactionUUID])
+	assert.Equal(t, "french", indexed.Language)
+	assert.Equal(t, "title\nRapport annuel\n", indexed.Content)
+
+	c, _ := gin.CreateTestContext(nil)
+	results, err := SearchFiles(c, "test-consumer", SearchFilesParams{UserName: "test-user", Query: "rapport"}, apiCfg)
+
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, transactionUUID, results[0].TransactionUuid)
+		assert.Equal(t, "<mark>Rapport</mark> annuel", results[0].Snippet)
+	}
+}
+
+func TestRunExtractionsMovesStuckDocumentsOn(t *testing.T) {
+	archivedUUID := uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	retriedUUID := uuid.MustParse("660e8400-e29b-41d4-a716-446655440000")
+	exhaustedUUID := uuid.MustParse("770e8400-e29b-41d4-a716-446655440000")
+	mockS3Client := &MockS3Client{
+		GetObjectFunc: func(key string, opts s3client.GetObjectOptions) (io.ReadCloser, error) {
+			return nil, errors.New("connection reset")
+		},
+	}
+	statuses := map[uuid.UUID]string{}
+	var attempted []uuid.UUID
+	mockDB := &MockDB{
+		ListPendingExtractionsFunc: func(ctx context.Context, arg database.ListPendingExtractionsParams) ([]database.UploadedFile, error) {
+			pending := sql.NullString{String: ExtractionPending, Valid: true}
+			return []database.UploadedFile{
+				{TransactionUuid: archivedUUID, ObjectKey: "archived-key", Status: StatusFileUploaded, StorageClass: "GLACIER", ExtractionStatus: pending},
+				{TransactionUuid: retriedUUID, ObjectKey: "retried-key", Status: StatusFileUploaded, ExtractionStatus: pending},
+				{TransactionUuid: exhaustedUUID, ObjectKey: "exhausted-key", Status: StatusFileUploaded, ExtractionStatus: pending, ExtractionAttempts: maxExtractionAttempts - 1},
+			}, nil
+		},
+		RecordExtractionAttemptFunc: func(ctx context.Context, transactionUuid uuid.UUID) error {
+			attempted = append(attempted, transactionUuid)
+			return nil
+		},
+		SetUploadedFileExtractionStatusFunc: func(ctx context.Context, arg database.SetUploadedFileExtractionStatusParams) error {
+			statuses[arg.TransactionUuid] = arg.ExtractionStatus.String
+			return nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+	}
+
+	n, err := RunExtractions(context.Background(), apiCfg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, map[uuid.UUID]string{archivedUUID: ExtractionSkipped, exhaustedUUID: ExtractionFailed}, statuses)
+	assert.Equal(t, []uuid.UUID{retriedUUID}, attempted)
+}
+
+func TestShareLinkLifecycle(t *testing.T) {
+	transactionUuid := uuid.MustParse("3f0c6f8e-2222-4b6f-9c3e-2a1b3c4d5e6f")
+	uploadedFile := database.UploadedFile{
+		TransactionUuid: transactionUuid,
+		Consumer:        "test-consumer",
+		UserName:        "test-user",
+		ObjectKey:       "shared-key",
+		Status:          StatusFileUploaded,
+		StorageClass:    "STANDARD",
+	}
+	var stored database.ShareLink
+	var audited []database.CreateShareLinkDownloadParams
+	mockDB := &MockDB{
+		GetUploadedFileFunc: func(ctx context.Context, arg database.GetUploadedFileParams) (database.UploadedFile, error) {
+			return uploadedFile, nil
+		},
+		CreateShareLinkFunc: func(ctx context.Context, arg database.CreateShareLinkParams) (database.ShareLink, error) {
+			stored = database.ShareLink{
+				ID:              arg.ID,
+				TokenHash:       arg.TokenHash,
+				TransactionUuid: arg.TransactionUuid,
+				CreatedBy:       arg.CreatedBy,
+				PasswordHash:    arg.PasswordHash,
+				ExpiresAt:       arg.ExpiresAt,
+				MaxDownloads:    arg.MaxDownloads,
+				AllowedIpRanges: arg.AllowedIpRanges,
+				CreatedAt:       time.Now(),
+			}
+			return stored, nil
+		},
+		GetShareLinkByTokenHashFunc: func(ctx context.Context, tokenHash string) (database.GetShareLinkByTokenHashRow, error) {
+			if tokenHash != stored.TokenHash {
+				return database.GetShareLinkByTokenHashRow{}, sql.ErrNoRows
+			}
+			return database.GetShareLinkByTokenHashRow{ShareLink: stored, UploadedFile: uploadedFile}, nil
+		},
+		ClaimShareLinkDownloadFunc: func(ctx context.Context, id uuid.UUID) (database.ShareLink, error) {
+			stored.DownloadCount++
+			return stored, nil
+		},
+		CreateShareLinkDownloadFunc: func(ctx context.Context, arg database.CreateShareLinkDownloadParams) error {
+			audited = append(audited, arg)
+			return nil
+		},
+		RecordUploadedFileDownloadFunc: func(ctx context.Context, transactionUuid uuid.UUID) error {
+			return nil
+		},
+	}
+	mockS3Client := &MockS3Client{
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			assert.Equal(t, "shared-key", key)
+			assert.Equal(t, redirectURLExpiration, *expirationTime)
+			return "http://short-lived-url", time.Minute, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+	}
+	c, _ := gin.CreateTestContext(nil)
+
+	_, err := CreateShareLink(c, transactionUuid, "test-consumer", CreateShareLinkParams{
+		UserName:        "test-user",
+		AllowedIpRanges: []string{"not-an-ip"},
+	}, apiCfg)
+	assert.ErrorIs(t, err, ErrInvalidShareIPRange)
+
+	shareLink, err := CreateShareLink(c, transactionUuid, "test-consumer", CreateShareLinkParams{
+		UserName:        "test-user",
+		Password:        "correct horse",
+		ExpiresIn:       3600,
+		MaxDownloads:    1,
+		AllowedIpRanges: []string{"203.0.113.0/24", "198.51.100.7"},
+	}, apiCfg)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, shareLink.Token)
+	assert.True(t, shareLink.PasswordProtected)
+	assert.Equal(t, []string{"203.0.113.0/24", "198.51.100.7/32"}, shareLink.AllowedIpRanges)
+	assert.NotEqual(t, shareLink.Token, stored.TokenHash)
+
+	_, err = RedeemShareLink(c, "unknown-token", "correct horse", "203.0.113.9", "test-agent", apiCfg)
+	assert.ErrorIs(t, err, ErrShareLinkNotFound)
+	_, err = RedeemShareLink(c, shareLink.Token, "correct horse", "192.0.2.1", "test-agent", apiCfg)
+	assert.ErrorIs(t, err, ErrShareLinkForbidden)
+	_, err = RedeemShareLink(c, shareLink.Token, "wrong password", "203.0.113.9", "test-agent", apiCfg)
+	assert.ErrorIs(t, err, ErrInvalidSharePassword)
+	assert.Empty(t, audited)
+
+	download, err := RedeemShareLink(c, shareLink.Token, "correct horse", "203.0.113.9", "test-agent", apiCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://short-lived-url", download.RedirectUrl)
+	assert.Equal(t, int32(1), stored.DownloadCount)
+	assert.Equal(t, []database.CreateShareLinkDownloadParams{{ShareLinkID: stored.ID, ClientIp: "203.0.113.9", UserAgent: "test-agent"}}, audited)
+
+	_, err = RedeemShareLink(c, shareLink.Token, "correct horse", "198.51.100.7", "test-agent", apiCfg)
+	assert.ErrorIs(t, err, ErrShareLinkExhausted)
+
+	stored.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	_, err = RedeemShareLink(c, shareLink.Token, "correct horse", "203.0.113.9", "test-agent", apiCfg)
+	assert.ErrorIs(t, err, ErrShareLinkRevoked)
+}
+
+func TestRedeemShareLinkIgnoresUntrustedForwardedFor(t *testing.T) {
+	transactionUuid := uuid.MustParse("5b2c3d4e-2222-4b6f-9c3e-2a1b3c4d5e6f")
+	uploadedFile := database.UploadedFile{
+		TransactionUuid: transactionUuid,
+		Consumer:        "test-consumer",
+		UserName:        "test-user",
+		ObjectKey:       "shared-key",
+		Status:          StatusFileUploaded,
+		StorageClass:    "STANDARD",
+	}
+	var stored database.ShareLink
+	mockDB := &MockDB{
+		GetUploadedFileFunc: func(ctx context.Context, arg database.GetUploadedFileParams) (database.UploadedFile, error) {
+			return uploadedFile, nil
+		},
+		CreateShareLinkFunc: func(ctx context.Context, arg database.CreateShareLinkParams) (database.ShareLink, error) {
+			stored = database.ShareLink{
+				ID:              arg.ID,
+				TokenHash:       arg.TokenHash,
+				TransactionUuid: arg.TransactionUuid,
+				ExpiresAt:       arg.ExpiresAt,
+				AllowedIpRanges: arg.AllowedIpRanges,
+			}
+			return stored, nil
+		},
+		GetShareLinkByTokenHashFunc: func(ctx context.Context, tokenHash string) (database.GetShareLinkByTokenHashRow, error) {
+			return database.GetShareLinkByTokenHashRow{ShareLink: stored, UploadedFile: uploadedFile}, nil
+		},
+		ClaimShareLinkDownloadFunc: func(ctx context.Context, id uuid.UUID) (database.ShareLink, error) {
+			return stored, nil
+		},
+		CreateShareLinkDownloadFunc: func(ctx context.Context, arg database.CreateShareLinkDownloadParams) error {
+			assert.Equal(t, "203.0.113.9", arg.ClientIp)
+			return nil
+		},
+		RecordUploadedFileDownloadFunc: func(ctx context.Context, transactionUuid uuid.UUID) error {
+			return nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: &MockS3Client{
+			GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+				return "http://short-lived-url", time.Minute, nil
+			},
+		},
+		DB: mockDB,
+	}
+	c, _ := gin.CreateTestContext(nil)
+	shareLink, err := CreateShareLink(c, transactionUuid, "test-consumer", CreateShareLinkParams{
+		UserName:        "test-user",
+		AllowedIpRanges: []string{"203.0.113.0/24"},
+	}, apiCfg)
+	assert.NoError(t, err)
+
+	redeem := func(trustedProxies []string) int {
+		router := gin.New()
+		assert.NoError(t, router.SetTrustedProxies(trustedProxies))
+		router.GET("/share/:token", apiCfg.HandlerRedeemShareLink)
+		req := httptest.NewRequest(http.MethodGet, "/share/"+shareLink.Token, nil)
+		req.RemoteAddr = "192.0.2.1:4711"
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	// The peer is outside the allowed range and claims an address inside it
+	assert.Equal(t, http.StatusForbidden, redeem(nil))
+	// Behind a trusted proxy the forwarded address is the client's
+	assert.Equal(t, http.StatusFound, redeem([]string{"192.0.2.1"}))
+}
+
+func TestDownloadTokenCutOffOnQuarantine(t *testing.T) {
+	transactionUuid := uuid.MustParse("7a1d2e3f-3333-4b6f-9c3e-2a1b3c4d5e6f")
+	uploadedFile := database.UploadedFile{
+		TransactionUuid: transactionUuid,
+		Consumer:        "test-consumer",
+		UserName:        "test-user",
+		ObjectKey:       "token-key",
+		Status:          StatusFileUploaded,
+		StorageClass:    "STANDARD",
+	}
+	var stored database.DownloadToken
+	used := 0
+	mockDB := &MockDB{
+		GetUploadedFileFunc: func(ctx context.Context, arg database.GetUploadedFileParams) (database.UploadedFile, error) {
+			return uploadedFile, nil
+		},
+		CreateDownloadTokenFunc: func(ctx context.Context, arg database.CreateDownloadTokenParams) (database.DownloadToken, error) {
+			stored = database.DownloadToken{
+				ID:              arg.ID,
+				TokenHash:       arg.TokenHash,
+				TransactionUuid: arg.TransactionUuid,
+				Consumer:        arg.Consumer,
+				UserName:        arg.UserName,
+				ExpiresAt:       arg.ExpiresAt,
+				CreatedAt:       time.Now(),
+			}
+			return stored, nil
+		},
+		GetDownloadTokenByTokenHashFunc: func(ctx context.Context, tokenHash string) (database.GetDownloadTokenByTokenHashRow, error) {
+			if tokenHash != stored.TokenHash {
+				return database.GetDownloadTokenByTokenHashRow{}, sql.ErrNoRows
+			}
+			return database.GetDownloadTokenByTokenHashRow{DownloadToken: stored, UploadedFile: uploadedFile}, nil
+		},
+		TouchDownloadTokenFunc: func(ctx context.Context, id uuid.UUID) error {
+			used++
+			return nil
+		},
+		RevokeFileDownloadTokensFunc: func(ctx context.Context, transactionUuid uuid.UUID) (int64, error) {
+			stored.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			return 1, nil
+		},
+		RecordUploadedFileDownloadFunc: func(ctx context.Context, transactionUuid uuid.UUID) error {
+			return nil
+		},
+	}
+	mockS3Client := &MockS3Client{
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			assert.Equal(t, redirectURLExpiration, *expirationTime)
+			return "http://minted-url", time.Minute, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		DB:       mockDB,
+	}
+	c, _ := gin.CreateTestContext(nil)
+
+	downloadToken, err := CreateDownloadToken(c, transactionUuid, "test-consumer", CreateDownloadTokenParams{
+		UserName:  "test-user",
+		ExpiresIn: 30 * 24 * 3600,
+	}, apiCfg)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, downloadToken.Token)
+	assert.WithinDuration(t, time.Now().Add(s3client.MaxPresignedURLExpiration), downloadToken.ExpiresAt, time.Minute)
+
+	download, err := RedeemDownloadToken(c, downloadToken.Token, apiCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://minted-url", download.RedirectUrl)
+	assert.Equal(t, 1, used)
+
+	uploadedFile.ScanStatus = sql.NullString{String: ScanInfected, Valid: true}
+	_, err = RedeemDownloadToken(c, downloadToken.Token, apiCfg)
+	assert.ErrorIs(t, err, ErrFileInfected)
+
+	revoked, err := RevokeFileDownloadTokens(c, transactionUuid, "test-consumer", "test-user", apiCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), revoked.Revoked)
+	_, err = RedeemDownloadToken(c, downloadToken.Token, apiCfg)
+	assert.ErrorIs(t, err, ErrDownloadTokenRevoked)
+	assert.Equal(t, 1, used)
+}
+
+func TestDownloadURLThroughCloudFront(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	presigned := 0
+	mockS3Client := &MockS3Client{
+		GeneratePresignedDownloadURLFunc: func(key string, expirationTime *int, opts s3client.GetObjectOptions) (string, time.Duration, error) {
+			presigned++
+			return "http://s3-presigned-url", time.Hour, nil
+		},
+	}
+	apiCfg := &ApiConfig{
+		S3Client: mockS3Client,
+		CloudFront: cloudfront.Distributions{
+			Consumers: map[string]cloudfront.Distribution{
+				"media": cloudfront.Distribution{Domain: "cdn.example.com", KeyPairID: "K2JCJMDEHXQW5F"}.WithKey(key),
+			},
+		},
+	}
+
+	signedURL, duration, err := apiCfg.downloadURL("media", mockS3Client, "media/photo.jpg", nil, s3client.GetObjectOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, s3client.DefaultPresignedURLExpiration, duration)
+	assert.True(t, strings.HasPrefix(signedURL, "https://cdn.example.com/media/photo.jpg?Expires="))
+	assert.Contains(t, signedURL, "Key-Pair-Id=K2JCJMDEHXQW5F")
+	assert.Equal(t, 0, presigned)
+
+	// CloudFront cannot pin versions, other consumers are not behind a distribution
+	url, _, err := apiCfg.downloadURL("media", mockS3Client, "media/photo.jpg", nil, s3client.GetObjectOptions{VersionID: "v1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://s3-presigned-url", url)
+	url, _, err = apiCfg.downloadURL("other", mockS3Client, "other/photo.jpg", nil, s3client.GetObjectOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://s3-presigned-url", url)
+	assert.Equal(t, 2, presigned)
+}
@@ -0,0 +1,343 @@
+package s3uploadfile
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Header carrying the password of protected share links, kept out of the URL
+	SharePasswordHeader = "X-Share-Password"
+
+	shareTokenBytes = 32
+	// Download URLs are minted for each request, they only need to be followed right away
+	redirectURLExpiration = 60
+)
+
+var (
+	ErrShareLinkNotFound    = errors.New("share link not found")
+	ErrShareLinkRevoked     = errors.New("share link has been revoked")
+	ErrShareLinkExpired     = errors.New("share link has expired")
+	ErrShareLinkExhausted   = errors.New("share link download limit reached")
+	ErrShareLinkForbidden   = errors.New("share link cannot be used from this address")
+	ErrInvalidSharePassword = errors.New("invalid share link password")
+	ErrSharePasswordTooLong = errors.New("share link password must be at most 72 bytes")
+	ErrInvalidShareIPRange  = errors.New("invalid allowed IP range")
+)
+
+type ShareLink struct {
+	Id              uuid.UUID
+	TransactionUuid uuid.UUID
+	CreatedBy       string
+	// Only returned when the link is created, the service keeps a hash
+	Token             string `json:",omitempty"`
+	PasswordProtected bool
+	ExpiresAt         time.Time
+	MaxDownloads      int32
+	DownloadCount     int32
+	AllowedIpRanges   []string
+	LastDownloadedAt  time.Time
+	RevokedAt         time.Time
+	CreatedAt         time.Time
+}
+
+func DatabaseShareLinkToShareLink(dbShareLink database.ShareLink) ShareLink {
+	return ShareLink{
+		Id:                dbShareLink.ID,
+		TransactionUuid:   dbShareLink.TransactionUuid,
+		CreatedBy:         dbShareLink.CreatedBy,
+		PasswordProtected: dbShareLink.PasswordHash.Valid,
+		ExpiresAt:         dbShareLink.ExpiresAt.Time,
+		MaxDownloads:      dbShareLink.MaxDownloads.Int32,
+		DownloadCount:     dbShareLink.DownloadCount,
+		AllowedIpRanges:   dbShareLink.AllowedIpRanges,
+		LastDownloadedAt:  dbShareLink.LastDownloadedAt.Time,
+		RevokedAt:         dbShareLink.RevokedAt.Time,
+		CreatedAt:         dbShareLink.CreatedAt,
+	}
+}
+
+// SharedDownload is what a redeemed share link serves, either a redirect or the file itself
+type SharedDownload struct {
+	UploadedFile UploadedFile
+	RedirectUrl  string
+	// Set instead of RedirectUrl for files the recipient cannot fetch from S3 directly,
+	// the caller must close it
+	Body io.ReadCloser
+}
+
+// hashToken is what the database stores for opaque tokens, a leaked table does not leak
+// usable links
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// normalizeIPRanges accepts CIDR ranges and single addresses, stored as /32 or /128 ranges
+func normalizeIPRanges(ranges []string) ([]string, error) {
+	normalized := make([]string, 0, len(ranges))
+	for _, ipRange := range ranges {
+		ipRange = strings.TrimSpace(ipRange)
+		if !strings.Contains(ipRange, "/") {
+			ip := net.ParseIP(ipRange)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidShareIPRange, ipRange)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			ipRange = fmt.Sprintf("%s/%d", ipRange, bits)
+		}
+		_, network, err := net.ParseCIDR(ipRange)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidShareIPRange, ipRange)
+		}
+		normalized = append(normalized, network.String())
+	}
+	return normalized, nil
+}
+
+func ipAllowed(ranges []string, clientIP string) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, ipRange := range ranges {
+		if _, network, err := net.ParseCIDR(ipRange); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// shareLinkBlocked explains why a link cannot be redeemed, nil when it can
+func shareLinkBlocked(shareLink database.ShareLink, clientIP string, now time.Time) error {
+	switch {
+	case shareLink.RevokedAt.Valid:
+		return ErrShareLinkRevoked
+	case shareLink.ExpiresAt.Valid && !now.Before(shareLink.ExpiresAt.Time):
+		return ErrShareLinkExpired
+	case shareLink.MaxDownloads.Valid && shareLink.DownloadCount >= shareLink.MaxDownloads.Int32:
+		return ErrShareLinkExhausted
+	case !ipAllowed(shareLink.AllowedIpRanges, clientIP):
+		return ErrShareLinkForbidden
+	}
+	return nil
+}
+
+// ownedFile loads a file of the calling user, share links are managed by the file's owner
+func ownedFile(ctx context.Context, transactionUuid uuid.UUID, consumer string, userName string, apiCfg *ApiConfig) (database.UploadedFile, error) {
+	uploadedFile, err := apiCfg.DB.GetUploadedFile(ctx, database.GetUploadedFileParams{
+		TransactionUuid: transactionUuid,
+		Consumer:        consumer,
+		UserName:        userName,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.UploadedFile{}, ErrFileNotFound
+		}
+		logging.FromContext(ctx).Error("error getting uploaded file", "error", err)
+		return database.UploadedFile{}, fmt.Errorf("error getting uploaded file")
+	}
+	return uploadedFile, nil
+}
+
+func CreateShareLink(c *gin.Context, transactionUuid uuid.UUID, consumer string, params CreateShareLinkParams, apiCfg *ApiConfig) (ShareLink, error) {
+	uploadedFile, err := ownedFile(c, transactionUuid, consumer, params.UserName, apiCfg)
+	if err != nil {
+		return ShareLink{}, err
+	}
+	if uploadedFile.Status == StatusWaitingFile {
+		return ShareLink{}, ErrFileNotUploaded
+	}
+	allowedIPRanges, err := normalizeIPRanges(params.AllowedIpRanges)
+	if err != nil {
+		return ShareLink{}, err
+	}
+	passwordHash := sql.NullString{}
+	if params.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(params.Password), bcrypt.DefaultCost)
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return ShareLink{}, ErrSharePasswordTooLong
+		}
+		if err != nil {
+			logging.FromContext(c).Error("error hashing share link password", "error", err)
+			return ShareLink{}, fmt.Errorf("error hashing share link password")
+		}
+		passwordHash = sql.NullString{String: string(hash), Valid: true}
+	}
+	expiresAt := sql.NullTime{}
+	if params.ExpiresIn > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().Add(time.Duration(params.ExpiresIn) * time.Second), Valid: true}
+	}
+	token, err := newToken(shareTokenBytes)
+	if err != nil {
+		logging.FromContext(c).Error("error generating share token", "error", err)
+		return ShareLink{}, fmt.Errorf("error generating share token")
+	}
+	dbShareLink, err := apiCfg.DB.CreateShareLink(c, database.CreateShareLinkParams{
+		ID:              uuid.New(),
+		TokenHash:       hashToken(token),
+		TransactionUuid: uploadedFile.TransactionUuid,
+		CreatedBy:       params.UserName,
+		PasswordHash:    passwordHash,
+		ExpiresAt:       expiresAt,
+		MaxDownloads:    sql.NullInt32{Int32: params.MaxDownloads, Valid: params.MaxDownloads > 0},
+		AllowedIpRanges: allowedIPRanges,
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error creating share link", "error", err)
+		return ShareLink{}, fmt.Errorf("error creating share link")
+	}
+	shareLink := DatabaseShareLinkToShareLink(dbShareLink)
+	shareLink.Token = token
+	return shareLink, nil
+}
+
+func ListShareLinks(c *gin.Context, transactionUuid uuid.UUID, consumer string, userName string, apiCfg *ApiConfig) ([]ShareLink, error) {
+	uploadedFile, err := ownedFile(c, transactionUuid, consumer, userName, apiCfg)
+	if err != nil {
+		return nil, err
+	}
+	dbShareLinks, err := apiCfg.DB.ListShareLinks(c, uploadedFile.TransactionUuid)
+	if err != nil {
+		logging.FromContext(c).Error("error listing share links", "error", err)
+		return nil, fmt.Errorf("error listing share links")
+	}
+	shareLinks := make([]ShareLink, 0, len(dbShareLinks))
+	for _, dbShareLink := range dbShareLinks {
+		shareLinks = append(shareLinks, DatabaseShareLinkToShareLink(dbShareLink))
+	}
+	return shareLinks, nil
+}
+
+func RevokeShareLink(c *gin.Context, transactionUuid uuid.UUID, shareLinkId uuid.UUID, consumer string, userName string, apiCfg *ApiConfig) (ShareLink, error) {
+	uploadedFile, err := ownedFile(c, transactionUuid, consumer, userName, apiCfg)
+	if err != nil {
+		return ShareLink{}, err
+	}
+	dbShareLink, err := apiCfg.DB.RevokeShareLink(c, database.RevokeShareLinkParams{
+		ID:              shareLinkId,
+		TransactionUuid: uploadedFile.TransactionUuid,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ShareLink{}, ErrShareLinkNotFound
+		}
+		logging.FromContext(c).Error("error revoking share link", "error", err)
+		return ShareLink{}, fmt.Errorf("error revoking share link")
+	}
+	return DatabaseShareLinkToShareLink(dbShareLink), nil
+}
+
+// RedeemShareLink validates a link presented by an anonymous recipient and counts the
+// download. The download is only counted once the file could be served.
+func RedeemShareLink(c *gin.Context, token string, password string, clientIP string, userAgent string, apiCfg *ApiConfig) (SharedDownload, error) {
+	row, err := apiCfg.DB.GetShareLinkByTokenHash(c, hashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return SharedDownload{}, ErrShareLinkNotFound
+		}
+		logging.FromContext(c).Error("error getting share link", "error", err)
+		return SharedDownload{}, fmt.Errorf("error getting share link")
+	}
+	shareLink, uploadedFile := row.ShareLink, row.UploadedFile
+	if err := shareLinkBlocked(shareLink, clientIP, time.Now()); err != nil {
+		return SharedDownload{}, err
+	}
+	if shareLink.PasswordHash.Valid {
+		if bcrypt.CompareHashAndPassword([]byte(shareLink.PasswordHash.String), []byte(password)) != nil {
+			return SharedDownload{}, ErrInvalidSharePassword
+		}
+	}
+	if uploadedFile.Status == StatusWaitingFile {
+		return SharedDownload{}, ErrFileNotUploaded
+	}
+	if err := downloadBlocked(uploadedFile, time.Now()); err != nil {
+		return SharedDownload{}, err
+	}
+	download, err := openSharedDownload(c, uploadedFile, apiCfg)
+	if err != nil {
+		return SharedDownload{}, err
+	}
+	if _, err := apiCfg.DB.ClaimShareLinkDownload(c, shareLink.ID); err != nil {
+		if download.Body != nil {
+			download.Body.Close()
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			// Revoked, expired or used up by a concurrent download
+			return SharedDownload{}, ErrShareLinkExhausted
+		}
+		logging.FromContext(c).Error("error counting share link download", "error", err)
+		return SharedDownload{}, fmt.Errorf("error counting share link download")
+	}
+	err = apiCfg.DB.CreateShareLinkDownload(c, database.CreateShareLinkDownloadParams{
+		ShareLinkID: shareLink.ID,
+		ClientIp:    clientIP,
+		UserAgent:   userAgent,
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error recording share link download", "error", err)
+	}
+	recordDownload(c, uploadedFile, apiCfg)
+	return download, nil
+}
+
+// openSharedDownload presigns a short-lived URL, or streams the file when S3 alone cannot
+// serve it: envelope encrypted files and SSE-C objects need keys the recipient lacks.
+func openSharedDownload(ctx context.Context, uploadedFile database.UploadedFile, apiCfg *ApiConfig) (SharedDownload, error) {
+	download := SharedDownload{UploadedFile: DatabaseUploadFileToUploadFile(uploadedFile)}
+	if uploadedFile.EnvelopeAlgorithm.Valid || uploadedFile.SseMode.String == s3client.EncryptionSSEC {
+		body, err := openObject(ctx, uploadedFile, apiCfg)
+		if err != nil {
+			return SharedDownload{}, err
+		}
+		download.Body = body
+		return download, nil
+	}
+	getOpts, err := getObjectOptions(uploadedFile.Consumer, uploadedFile.SseMode, uploadedFile.SseCustomerKeyMd5, apiCfg)
+	if err != nil {
+		return SharedDownload{}, err
+	}
+	s3Client, err := apiCfg.s3ClientAt(ctx, uploadedFile.Bucket, uploadedFile.Region)
+	if err != nil {
+		return SharedDownload{}, err
+	}
+	expiration := redirectURLExpiration
+	presignedURL, _, err := apiCfg.downloadURL(uploadedFile.Consumer, s3Client, uploadedFile.ObjectKey, &expiration, getOpts)
+	if err != nil {
+		logging.FromContext(ctx).Error("error generating presigned URL", "error", err)
+		return SharedDownload{}, fmt.Errorf("error generating presigned URL")
+	}
+	download.RedirectUrl = presignedURL
+	return download, nil
+}
@@ -0,0 +1,158 @@
+package s3uploadfile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const downloadTokenBytes = 16
+
+var (
+	ErrDownloadTokenNotFound = errors.New("download token not found")
+	ErrDownloadTokenRevoked  = errors.New("download token has been revoked")
+	ErrDownloadTokenExpired  = errors.New("download token has expired")
+)
+
+type DownloadToken struct {
+	Id              uuid.UUID
+	TransactionUuid uuid.UUID
+	UserName        string
+	// Only returned when the token is created, the service keeps a hash
+	Token      string `json:",omitempty"`
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+	CreatedAt  time.Time
+}
+
+func DatabaseDownloadTokenToDownloadToken(dbDownloadToken database.DownloadToken) DownloadToken {
+	return DownloadToken{
+		Id:              dbDownloadToken.ID,
+		TransactionUuid: dbDownloadToken.TransactionUuid,
+		UserName:        dbDownloadToken.UserName,
+		ExpiresAt:       dbDownloadToken.ExpiresAt,
+		LastUsedAt:      dbDownloadToken.LastUsedAt.Time,
+		RevokedAt:       dbDownloadToken.RevokedAt.Time,
+		CreatedAt:       dbDownloadToken.CreatedAt,
+	}
+}
+
+type RevokedDownloadTokens struct {
+	Revoked int64
+}
+
+func CreateDownloadToken(c *gin.Context, transactionUuid uuid.UUID, consumer string, params CreateDownloadTokenParams, apiCfg *ApiConfig) (DownloadToken, error) {
+	uploadedFile, err := ownedFile(c, transactionUuid, consumer, params.UserName, apiCfg)
+	if err != nil {
+		return DownloadToken{}, err
+	}
+	if uploadedFile.Status == StatusWaitingFile {
+		return DownloadToken{}, ErrFileNotUploaded
+	}
+	token, err := newToken(downloadTokenBytes)
+	if err != nil {
+		logging.FromContext(c).Error("error generating download token", "error", err)
+		return DownloadToken{}, fmt.Errorf("error generating download token")
+	}
+	dbDownloadToken, err := apiCfg.DB.CreateDownloadToken(c, database.CreateDownloadTokenParams{
+		ID:              uuid.New(),
+		TokenHash:       hashToken(token),
+		TransactionUuid: uploadedFile.TransactionUuid,
+		Consumer:        consumer,
+		UserName:        params.UserName,
+		// Tokens live as long as the presigned URLs they replace would have
+		ExpiresAt: time.Now().Add(s3client.PresignedURLDuration(&params.ExpiresIn)),
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error creating download token", "error", err)
+		return DownloadToken{}, fmt.Errorf("error creating download token")
+	}
+	downloadToken := DatabaseDownloadTokenToDownloadToken(dbDownloadToken)
+	downloadToken.Token = token
+	return downloadToken, nil
+}
+
+// RedeemDownloadToken mints a fresh short-lived presigned URL for every hit. The file is
+// checked each time, so a deleted or quarantined file stops being served at once.
+func RedeemDownloadToken(ctx context.Context, token string, apiCfg *ApiConfig) (SharedDownload, error) {
+	row, err := apiCfg.DB.GetDownloadTokenByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return SharedDownload{}, ErrDownloadTokenNotFound
+		}
+		logging.FromContext(ctx).Error("error getting download token", "error", err)
+		return SharedDownload{}, fmt.Errorf("error getting download token")
+	}
+	downloadToken, uploadedFile := row.DownloadToken, row.UploadedFile
+	if downloadToken.RevokedAt.Valid {
+		return SharedDownload{}, ErrDownloadTokenRevoked
+	}
+	if !time.Now().Before(downloadToken.ExpiresAt) {
+		return SharedDownload{}, ErrDownloadTokenExpired
+	}
+	if uploadedFile.Status == StatusWaitingFile {
+		return SharedDownload{}, ErrFileNotUploaded
+	}
+	if err := downloadBlocked(uploadedFile, time.Now()); err != nil {
+		return SharedDownload{}, err
+	}
+	download, err := openSharedDownload(ctx, uploadedFile, apiCfg)
+	if err != nil {
+		return SharedDownload{}, err
+	}
+	if err := apiCfg.DB.TouchDownloadToken(ctx, downloadToken.ID); err != nil {
+		logging.FromContext(ctx).Error("error recording download token use", "error", err)
+	}
+	recordDownload(ctx, uploadedFile, apiCfg)
+	return download, nil
+}
+
+func RevokeDownloadToken(c *gin.Context, downloadTokenId uuid.UUID, consumer string, userName string, apiCfg *ApiConfig) (RevokedDownloadTokens, error) {
+	_, err := apiCfg.DB.RevokeDownloadToken(c, database.RevokeDownloadTokenParams{
+		ID:       downloadTokenId,
+		Consumer: consumer,
+		UserName: userName,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return RevokedDownloadTokens{}, ErrDownloadTokenNotFound
+		}
+		logging.FromContext(c).Error("error revoking download token", "error", err)
+		return RevokedDownloadTokens{}, fmt.Errorf("error revoking download token")
+	}
+	return RevokedDownloadTokens{Revoked: 1}, nil
+}
+
+func RevokeFileDownloadTokens(c *gin.Context, transactionUuid uuid.UUID, consumer string, userName string, apiCfg *ApiConfig) (RevokedDownloadTokens, error) {
+	uploadedFile, err := ownedFile(c, transactionUuid, consumer, userName, apiCfg)
+	if err != nil {
+		return RevokedDownloadTokens{}, err
+	}
+	revoked, err := apiCfg.DB.RevokeFileDownloadTokens(c, uploadedFile.TransactionUuid)
+	if err != nil {
+		logging.FromContext(c).Error("error revoking download tokens", "error", err)
+		return RevokedDownloadTokens{}, fmt.Errorf("error revoking download tokens")
+	}
+	return RevokedDownloadTokens{Revoked: revoked}, nil
+}
+
+func RevokeUserDownloadTokens(c *gin.Context, consumer string, userName string, apiCfg *ApiConfig) (RevokedDownloadTokens, error) {
+	revoked, err := apiCfg.DB.RevokeUserDownloadTokens(c, database.RevokeUserDownloadTokensParams{
+		Consumer: consumer,
+		UserName: userName,
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error revoking download tokens", "error", err)
+		return RevokedDownloadTokens{}, fmt.Errorf("error revoking download tokens")
+	}
+	return RevokedDownloadTokens{Revoked: revoked}, nil
+}
@@ -0,0 +1,131 @@
+package s3uploadfile
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/metrics"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/google/uuid"
+)
+
+const transitionBatchSize = 100
+
+// recordDownload marks a file as accessed, failures only delay its next transition
+func recordDownload(ctx context.Context, uploadedFile database.UploadedFile, apiCfg *ApiConfig) {
+	if err := apiCfg.DB.RecordUploadedFileDownload(ctx, uploadedFile.TransactionUuid); err != nil {
+		logging.FromContext(ctx).Error("error recording download", "error", err)
+	}
+}
+
+// RunStorageTransitions moves objects not downloaded for longer than their consumer's
+// policy allows to a colder storage class and returns how many were moved. An object
+// shared by deduplicated transactions is only idle when none of them was downloaded.
+func RunStorageTransitions(ctx context.Context, apiCfg *ApiConfig, now time.Time) (int, error) {
+	minAge, ok := apiCfg.StorageClasses.MinTransitionAge()
+	if !ok {
+		return 0, nil
+	}
+	transitioned := 0
+	var after database.ListIdleObjectsRow
+	for {
+		objects, err := apiCfg.DB.ListIdleObjects(ctx, database.ListIdleObjectsParams{
+			WaitingStatus:  StatusWaitingFile,
+			AfterConsumer:  after.Consumer,
+			AfterBucket:    after.Bucket.String,
+			AfterObjectKey: after.ObjectKey,
+			IdleSince:      now.Add(-minAge),
+			MaxResults:     transitionBatchSize,
+		})
+		if err != nil {
+			logging.FromContext(ctx).Error("error listing idle objects", "error", err)
+			return transitioned, fmt.Errorf("error listing idle objects")
+		}
+		for _, object := range objects {
+			moved, err := transitionObject(ctx, object, now, apiCfg)
+			if err != nil {
+				logging.FromContext(ctx).Error("error transitioning", "object_key", object.ObjectKey, "error", err)
+			}
+			if moved {
+				transitioned++
+			}
+		}
+		if len(objects) < transitionBatchSize {
+			return transitioned, nil
+		}
+		after = objects[len(objects)-1]
+	}
+}
+
+func transitionObject(ctx context.Context, object database.ListIdleObjectsRow, now time.Time, apiCfg *ApiConfig) (bool, error) {
+	policy := apiCfg.StorageClasses.For(object.Consumer)
+	target, ok := policy.TransitionFor(object.StorageClass, now.Sub(object.LastAccessedAt))
+	if !ok {
+		return false, nil
+	}
+	getOpts, err := getObjectOptions(object.Consumer, object.SseMode, object.SseCustomerKeyMd5, apiCfg)
+	if err != nil {
+		return false, err
+	}
+	s3Client, err := apiCfg.s3ClientAt(ctx, object.Bucket, object.Region)
+	if err != nil {
+		return false, err
+	}
+	err = s3Client.ChangeStorageClass(object.ObjectKey, s3client.PutObjectOptions{
+		Encryption:   recordedEncryption(object.Consumer, object.SseMode, object.SseKmsKeyID, getOpts, apiCfg),
+		StorageClass: target,
+		ObjectLock:   objectLock(object.RetentionMode, object.RetainUntil),
+	})
+	if err != nil {
+		return false, err
+	}
+	err = apiCfg.DB.SetObjectStorageClass(ctx, database.SetObjectStorageClassParams{
+		Consumer:     object.Consumer,
+		Bucket:       object.Bucket,
+		ObjectKey:    object.ObjectKey,
+		StorageClass: target,
+	})
+	if err != nil {
+		return true, err
+	}
+	err = apiCfg.DB.SetFileObjectStorageClass(ctx, database.SetFileObjectStorageClassParams{
+		Consumer:     object.Consumer,
+		Bucket:       object.Bucket.String,
+		ObjectKey:    object.ObjectKey,
+		StorageClass: target,
+	})
+	if err != nil {
+		return true, err
+	}
+	_, err = apiCfg.DB.CreateStorageTransition(ctx, database.CreateStorageTransitionParams{
+		ID:               uuid.New(),
+		Consumer:         object.Consumer,
+		Bucket:           object.Bucket,
+		ObjectKey:        object.ObjectKey,
+		FromStorageClass: object.StorageClass,
+		ToStorageClass:   target,
+	})
+	return true, err
+}
+
+// StartStorageTransitionWorker runs RunStorageTransitions every interval until ctx is done
+func StartStorageTransitionWorker(ctx context.Context, apiCfg *ApiConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			start := time.Now()
+			n, err := RunStorageTransitions(ctx, apiCfg, now)
+			metrics.ObserveWorkerRun("storage_transition", start, n, err)
+			if err == nil && n > 0 {
+				logging.FromContext(ctx).Info("moved objects to colder storage classes", "objects", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package s3uploadfile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/OliPou/s3are/internal/database"
+	"github.com/OliPou/s3are/logging"
+	"github.com/OliPou/s3are/s3client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrLogicalFileNotFound = errors.New("logical file not found")
+	ErrVersionNotFound     = errors.New("version not found")
+)
+
+// fileVersion places a transaction in the version history of a logical file
+type fileVersion struct {
+	LogicalFileID uuid.UUID
+	Version       int32
+}
+
+// allocateVersion returns the next version of the targeted logical file, or starts a
+// new logical file, identified by the transaction UUID, when none is targeted
+func allocateVersion(c *gin.Context, transactionUUID uuid.UUID, consumer string, params UploadsFileParams, apiCfg *ApiConfig) (fileVersion, error) {
+	if params.LogicalFileId == nil {
+		logicalFile, err := apiCfg.DB.CreateLogicalFile(c, database.CreateLogicalFileParams{
+			ID:       transactionUUID,
+			Consumer: consumer,
+			UserName: params.UserName,
+		})
+		if err != nil {
+			logging.FromContext(c).Error("error creating logical file", "error", err)
+			return fileVersion{}, fmt.Errorf("error creating logical file")
+		}
+		return fileVersion{LogicalFileID: logicalFile.ID, Version: logicalFile.LatestVersion}, nil
+	}
+	logicalFile, err := apiCfg.DB.NextLogicalFileVersion(c, database.NextLogicalFileVersionParams{
+		ID:       *params.LogicalFileId,
+		Consumer: consumer,
+		UserName: params.UserName,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fileVersion{}, ErrLogicalFileNotFound
+		}
+		logging.FromContext(c).Error("error allocating version", "error", err)
+		return fileVersion{}, fmt.Errorf("error allocating version")
+	}
+	return fileVersion{LogicalFileID: logicalFile.ID, Version: logicalFile.LatestVersion}, nil
+}
+
+// recordS3Version stores the S3 version ID of a freshly uploaded object, so later
+// downloads of this version are not affected by overwrites of its key
+func recordS3Version(c *gin.Context, transactionUuid uuid.UUID, objectKey string, getOpts s3client.GetObjectOptions, s3Client S3ClientInterface, apiCfg *ApiConfig) {
+	if !apiCfg.BucketVersioning {
+		return
+	}
+	objectInfo, err := s3Client.GetObjectInfo(objectKey, getOpts)
+	if err != nil || objectInfo.VersionID == "" {
+		logging.FromContext(c).Error("error getting object version", "error", err)
+		return
+	}
+	err = apiCfg.DB.SetUploadedFileS3Version(c, database.SetUploadedFileS3VersionParams{
+		TransactionUuid: transactionUuid,
+		S3VersionID:     sql.NullString{String: objectInfo.VersionID, Valid: true},
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error recording object version", "error", err)
+	}
+}
+
+// ListFileVersions returns the version history of a logical file, latest first
+func ListFileVersions(c *gin.Context, logicalFileId uuid.UUID, consumer string, userName string, apiCfg *ApiConfig) ([]UploadedFile, error) {
+	versions, err := apiCfg.DB.ListFileVersions(c, database.ListFileVersionsParams{
+		LogicalFileID: logicalFileId,
+		Consumer:      consumer,
+		UserName:      userName,
+	})
+	if err != nil {
+		logging.FromContext(c).Error("error listing file versions", "error", err)
+		return nil, fmt.Errorf("error listing file versions")
+	}
+	if len(versions) == 0 {
+		return nil, ErrLogicalFileNotFound
+	}
+	files := make([]UploadedFile, len(versions))
+	for i, v := range versions {
+		files[i] = DatabaseUploadFileToUploadFile(v)
+	}
+	return files, nil
+}
+
+// GetFileVersion returns one version of a logical file with a fresh download URL
+func GetFileVersion(c *gin.Context, logicalFileId uuid.UUID, version int32, consumer string, userName string, apiCfg *ApiConfig) (UploadedFile, error) {
+	uploadedFile, err := apiCfg.DB.GetFileVersion(c, database.GetFileVersionParams{
+		LogicalFileID: logicalFileId,
+		Version:       version,
+		Consumer:      consumer,
+		UserName:      userName,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UploadedFile{}, ErrVersionNotFound
+		}
+		logging.FromContext(c).Error("error getting file version", "error", err)
+		return UploadedFile{}, fmt.Errorf("error getting file version")
+	}
+	result := withDownloadURL(c, DatabaseUploadFileToUploadFile(uploadedFile), uploadedFile, true, apiCfg)
+	if result.DownloadPresignedUrl != "" {
+		recordDownload(c, uploadedFile, apiCfg)
+	}
+	return result, nil
+}
+
+// withDownloadURL fills in a fresh download URL and its expiry. The file is returned
+// without one when it can't be signed, e.g. after an SSE-C key rotation.
+func withDownloadURL(ctx context.Context, result UploadedFile, uploadedFile database.UploadedFile, pinVersion bool, apiCfg *ApiConfig) UploadedFile {
+	downloadURL, expiresAt, err := freshDownloadURL(ctx, uploadedFile, pinVersion, apiCfg)
+	if err != nil {
+		logging.FromContext(ctx).Error("error generating presigned URL", "error", err)
+		return result
+	}
+	result.DownloadPresignedUrl = downloadURL
+	result.DownloadExpirationTime = expiresAt
+	return result
+}
+
+// freshDownloadURL presigns a short-lived download URL, empty while the file cannot be
+// downloaded straight from S3. pinVersion ties the URL to the file's S3 version, which
+// rules CloudFront out.
+func freshDownloadURL(ctx context.Context, uploadedFile database.UploadedFile, pinVersion bool, apiCfg *ApiConfig) (string, time.Time, error) {
+	// Envelope encrypted files are only served through the service
+	if uploadedFile.Status == StatusWaitingFile || uploadedFile.EnvelopeAlgorithm.Valid || !downloadAvailable(uploadedFile, time.Now()) {
+		return "", time.Time{}, nil
+	}
+	getOpts, err := getObjectOptions(uploadedFile.Consumer, uploadedFile.SseMode, uploadedFile.SseCustomerKeyMd5, apiCfg)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if pinVersion {
+		getOpts.VersionID = uploadedFile.S3VersionID.String
+	}
+	s3Client, err := apiCfg.s3ClientAt(ctx, uploadedFile.Bucket, uploadedFile.Region)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiration := redirectURLExpiration
+	presignedURL, duration, err := apiCfg.downloadURL(uploadedFile.Consumer, s3Client, uploadedFile.ObjectKey, &expiration, getOpts)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return presignedURL, time.Now().Add(duration), nil
+}
@@ -0,0 +1,183 @@
+package s3client
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	EncryptionNone   = ""
+	EncryptionSSES3  = "SSE-S3"
+	EncryptionSSEKMS = "SSE-KMS"
+	EncryptionSSEC   = "SSE-C"
+)
+
+// Encryption describes the server-side encryption required for a consumer's objects
+type Encryption struct {
+	Mode             string `json:"mode"`
+	KMSKeyID         string `json:"kmsKeyId,omitempty"`
+	BucketKeyEnabled bool   `json:"bucketKeyEnabled,omitempty"`
+	// Base64 encoded 256-bit key, only used with SSE-C
+	CustomerKey string `json:"customerKey,omitempty"`
+}
+
+func (e Encryption) Validate() error {
+	switch e.Mode {
+	case EncryptionNone, EncryptionSSES3:
+		return nil
+	case EncryptionSSEKMS:
+		if e.KMSKeyID == "" {
+			return fmt.Errorf("kmsKeyId is required for %s", EncryptionSSEKMS)
+		}
+		return nil
+	case EncryptionSSEC:
+		key, err := base64.StdEncoding.DecodeString(e.CustomerKey)
+		if err != nil {
+			return fmt.Errorf("customerKey must be base64 encoded: %w", err)
+		}
+		if len(key) != 32 {
+			return fmt.Errorf("customerKey must be 256 bits, got %d", len(key)*8)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown encryption mode %q", e.Mode)
+	}
+}
+
+// CustomerKeyMD5 returns the base64 encoded MD5 S3 uses to identify an SSE-C key
+func (e Encryption) CustomerKeyMD5() string {
+	if e.Mode != EncryptionSSEC {
+		return ""
+	}
+	key, _ := base64.StdEncoding.DecodeString(e.CustomerKey)
+	sum := md5.Sum(key)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (e Encryption) customerKey() *string {
+	key, _ := base64.StdEncoding.DecodeString(e.CustomerKey)
+	return aws.String(string(key))
+}
+
+func (e Encryption) applyToPut(input *s3.PutObjectInput) {
+	switch e.Mode {
+	case EncryptionSSES3:
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAes256)
+	case EncryptionSSEKMS:
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		input.SSEKMSKeyId = aws.String(e.KMSKeyID)
+		if e.BucketKeyEnabled {
+			input.BucketKeyEnabled = aws.Bool(true)
+		}
+	case EncryptionSSEC:
+		input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.SSECustomerKey = e.customerKey()
+	}
+}
+
+func (e Encryption) applyToUpload(input *s3manager.UploadInput) {
+	switch e.Mode {
+	case EncryptionSSES3:
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAes256)
+	case EncryptionSSEKMS:
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		input.SSEKMSKeyId = aws.String(e.KMSKeyID)
+		if e.BucketKeyEnabled {
+			input.BucketKeyEnabled = aws.Bool(true)
+		}
+	case EncryptionSSEC:
+		input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.SSECustomerKey = e.customerKey()
+	}
+}
+
+// The source and destination of a copy share the same encryption
+func (e Encryption) applyToCopy(input *s3.CopyObjectInput) {
+	switch e.Mode {
+	case EncryptionSSES3:
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAes256)
+	case EncryptionSSEKMS:
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		input.SSEKMSKeyId = aws.String(e.KMSKeyID)
+		if e.BucketKeyEnabled {
+			input.BucketKeyEnabled = aws.Bool(true)
+		}
+	case EncryptionSSEC:
+		input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.SSECustomerKey = e.customerKey()
+		input.CopySourceSSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.CopySourceSSECustomerKey = e.customerKey()
+	}
+}
+
+func (e Encryption) applyToGet(input *s3.GetObjectInput) {
+	if e.Mode == EncryptionSSEC {
+		input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.SSECustomerKey = e.customerKey()
+	}
+}
+
+func (e Encryption) applyToHead(input *s3.HeadObjectInput) {
+	if e.Mode == EncryptionSSEC {
+		input.SSECustomerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		input.SSECustomerKey = e.customerKey()
+	}
+}
+
+// Matches checks that the encryption S3 reports for an object is the required one
+func (e Encryption) Matches(info ObjectInfo) bool {
+	switch e.Mode {
+	case EncryptionSSES3:
+		return info.ServerSideEncryption == s3.ServerSideEncryptionAes256
+	case EncryptionSSEKMS:
+		// S3 reports the full key ARN, the configuration may only hold the key ID
+		return info.ServerSideEncryption == s3.ServerSideEncryptionAwsKms &&
+			(info.KMSKeyID == e.KMSKeyID || strings.HasSuffix(info.KMSKeyID, "key/"+e.KMSKeyID))
+	case EncryptionSSEC:
+		return info.SSECustomerKeyMD5 == e.CustomerKeyMD5()
+	default:
+		return true
+	}
+}
+
+// EncryptionPolicies maps consumers to the encryption their objects require
+type EncryptionPolicies struct {
+	Default   Encryption            `json:"default"`
+	Consumers map[string]Encryption `json:"consumers"`
+}
+
+func (p EncryptionPolicies) For(consumer string) Encryption {
+	if e, ok := p.Consumers[consumer]; ok {
+		return e
+	}
+	return p.Default
+}
+
+// LoadEncryptionPolicies reads per-consumer encryption policies from a JSON file
+func LoadEncryptionPolicies(path string) (EncryptionPolicies, error) {
+	var policies EncryptionPolicies
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policies, err
+	}
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return policies, fmt.Errorf("invalid encryption policies: %w", err)
+	}
+	if err := policies.Default.Validate(); err != nil {
+		return policies, fmt.Errorf("default encryption: %w", err)
+	}
+	for consumer, e := range policies.Consumers {
+		if err := e.Validate(); err != nil {
+			return policies, fmt.Errorf("encryption for consumer %s: %w", consumer, err)
+		}
+	}
+	return policies, nil
+}
@@ -0,0 +1,60 @@
+package s3client
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const errCodeRestoreAlreadyInProgress = "RestoreAlreadyInProgress"
+
+// ValidateRestoreTier checks the tier is available for objects of the storage class
+func ValidateRestoreTier(storageClass string, tier string) error {
+	switch tier {
+	case s3.TierBulk, s3.TierStandard:
+		return nil
+	case s3.TierExpedited:
+		if storageClass == s3.StorageClassDeepArchive {
+			return fmt.Errorf("tier %s is not available for %s objects", tier, storageClass)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown restore tier %q", tier)
+}
+
+// Function to restore a temporary copy of an archived object for the given number of days.
+// Requesting a restore that is already in progress is not an error.
+func (s *S3Client) RestoreObject(key string, tier string, days int) error {
+	_, err := s.Client.RestoreObjectWithContext(s.context(), &s3.RestoreObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+		RestoreRequest: &s3.RestoreRequest{
+			Days: aws.Int64(int64(days)),
+			GlacierJobParameters: &s3.GlacierJobParameters{
+				Tier: aws.String(tier),
+			},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == errCodeRestoreAlreadyInProgress {
+		return nil
+	}
+	return err
+}
+
+var restoreHeaderPattern = regexp.MustCompile(`ongoing-request="(true|false)"(?:,\s*expiry-date="([^"]+)")?`)
+
+// parseRestoreHeader reads the x-amz-restore header, absent until a restore was requested
+func parseRestoreHeader(header string) (inProgress bool, expiry time.Time) {
+	match := restoreHeaderPattern.FindStringSubmatch(header)
+	if match == nil {
+		return false, time.Time{}
+	}
+	if match[2] != "" {
+		expiry, _ = time.Parse(time.RFC1123, match[2])
+	}
+	return match[1] == "true", expiry
+}
@@ -0,0 +1,111 @@
+package s3client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Retention keeps new objects write-once for Days with Object Lock. GOVERNANCE can be
+// lifted by users with the s3:BypassGovernanceRetention permission, COMPLIANCE by no one.
+type Retention struct {
+	Mode string `json:"mode"`
+	Days int    `json:"days"`
+}
+
+func (r Retention) Enabled() bool {
+	return r.Mode != ""
+}
+
+func (r Retention) Validate() error {
+	switch r.Mode {
+	case "":
+		return nil
+	case s3.ObjectLockModeGovernance, s3.ObjectLockModeCompliance:
+		if r.Days <= 0 {
+			return fmt.Errorf("retention must last at least one day")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown object lock mode %q", r.Mode)
+}
+
+// RetainUntil is when an object stored at the given time leaves retention
+func (r Retention) RetainUntil(storedAt time.Time) time.Time {
+	return storedAt.AddDate(0, 0, r.Days).UTC().Truncate(time.Second)
+}
+
+// ObjectLock is the lock written with an object
+type ObjectLock struct {
+	Mode        string
+	RetainUntil time.Time
+}
+
+func (l ObjectLock) applyToPut(input *s3.PutObjectInput) {
+	if l.Mode == "" {
+		return
+	}
+	input.ObjectLockMode = aws.String(l.Mode)
+	input.ObjectLockRetainUntilDate = aws.Time(l.RetainUntil)
+}
+
+func (l ObjectLock) applyToCopy(input *s3.CopyObjectInput) {
+	if l.Mode == "" {
+		return
+	}
+	input.ObjectLockMode = aws.String(l.Mode)
+	input.ObjectLockRetainUntilDate = aws.Time(l.RetainUntil)
+}
+
+type RetentionPolicies struct {
+	Default   Retention            `json:"default"`
+	Consumers map[string]Retention `json:"consumers"`
+}
+
+func (p RetentionPolicies) For(consumer string) Retention {
+	if r, ok := p.Consumers[consumer]; ok {
+		return r
+	}
+	return p.Default
+}
+
+// LoadRetentionPolicies reads per-consumer retention policies from a JSON file
+func LoadRetentionPolicies(path string) (RetentionPolicies, error) {
+	var policies RetentionPolicies
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policies, err
+	}
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return policies, fmt.Errorf("invalid retention policies: %w", err)
+	}
+	if err := policies.Default.Validate(); err != nil {
+		return policies, fmt.Errorf("default retention: %w", err)
+	}
+	for consumer, r := range policies.Consumers {
+		if err := r.Validate(); err != nil {
+			return policies, fmt.Errorf("retention for consumer %s: %w", consumer, err)
+		}
+	}
+	return policies, nil
+}
+
+// Function to place or release a legal hold, which blocks deletion regardless of retention
+func (s *S3Client) SetLegalHold(key string, enabled bool) error {
+	status := s3.ObjectLockLegalHoldStatusOff
+	if enabled {
+		status = s3.ObjectLockLegalHoldStatusOn
+	}
+	_, err := s.Client.PutObjectLegalHoldWithContext(s.context(), &s3.PutObjectLegalHoldInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+		LegalHold: &s3.ObjectLockLegalHold{
+			Status: aws.String(status),
+		},
+	})
+	return err
+}
@@ -0,0 +1,212 @@
+package s3client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Location is where an object is stored
+type Location struct {
+	Bucket string `json:"bucket"`
+	Region string `json:"region"`
+	// Optional, for S3 compatible stores or VPC endpoints
+	Endpoint       string `json:"endpoint,omitempty"`
+	ForcePathStyle bool   `json:"forcePathStyle,omitempty"`
+}
+
+func (l Location) validate() error {
+	if l.Bucket == "" || l.Region == "" {
+		return fmt.Errorf("bucket and region are required")
+	}
+	return nil
+}
+
+// ConsumerRoute is where a consumer's objects go, optionally per data-residency tag
+type ConsumerRoute struct {
+	Location
+	Residency map[string]Location `json:"residency,omitempty"`
+}
+
+type RoutingConfig struct {
+	Default   ConsumerRoute            `json:"default"`
+	Consumers map[string]ConsumerRoute `json:"consumers"`
+}
+
+// LoadRoutingConfig reads the consumer to bucket routing from a JSON file
+func LoadRoutingConfig(path string) (RoutingConfig, error) {
+	var cfg RoutingConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid routing config: %w", err)
+	}
+	return cfg, cfg.Validate()
+}
+
+func (cfg RoutingConfig) Validate() error {
+	if err := cfg.Default.Location.validate(); err != nil {
+		return fmt.Errorf("default route: %w", err)
+	}
+	for tag, l := range cfg.Default.Residency {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("default route, residency %s: %w", tag, err)
+		}
+	}
+	for consumer, route := range cfg.Consumers {
+		if route.Bucket != "" || route.Region != "" {
+			if err := route.Location.validate(); err != nil {
+				return fmt.Errorf("route of consumer %s: %w", consumer, err)
+			}
+		}
+		for tag, l := range route.Residency {
+			if err := l.validate(); err != nil {
+				return fmt.Errorf("route of consumer %s, residency %s: %w", consumer, tag, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Router picks the bucket for each consumer and keeps one client per bucket
+type Router struct {
+	cfg     RoutingConfig
+	mu      sync.Mutex
+	clients map[string]*S3Client
+}
+
+func NewRouter(cfg RoutingConfig) (*Router, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Router{cfg: cfg, clients: map[string]*S3Client{}}, nil
+}
+
+// Resolve returns the location for a consumer's new object. An empty residency
+// selects the consumer's default location, an unknown one is an error.
+func (r *Router) Resolve(consumer string, residency string) (Location, error) {
+	route, ok := r.cfg.Consumers[consumer]
+	if residency != "" {
+		if ok {
+			if l, found := route.Residency[residency]; found {
+				return l, nil
+			}
+		}
+		if l, found := r.cfg.Default.Residency[residency]; found {
+			return l, nil
+		}
+		return Location{}, fmt.Errorf("no bucket configured for residency %q", residency)
+	}
+	if ok && route.Bucket != "" {
+		return route.Location, nil
+	}
+	return r.cfg.Default.Location, nil
+}
+
+// Client returns the pooled client for a location. Locations recorded on stored
+// objects only hold the bucket and region, the endpoint is taken from the routing
+// configuration.
+func (r *Router) Client(location Location) (S3ClientInterface, error) {
+	return r.client(location)
+}
+
+func (r *Router) client(location Location) (*S3Client, error) {
+	key := location.Region + "/" + location.Bucket
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if client, ok := r.clients[key]; ok {
+		return client, nil
+	}
+	if location.Endpoint == "" {
+		location = r.configured(location)
+	}
+	client, err := newLocationClient(location)
+	if err != nil {
+		return nil, err
+	}
+	r.clients[key] = client
+	return client, nil
+}
+
+// Clients returns the client of every bucket of the routing configuration
+func (r *Router) Clients() ([]*S3Client, error) {
+	routes := []ConsumerRoute{r.cfg.Default}
+	for _, route := range r.cfg.Consumers {
+		routes = append(routes, route)
+	}
+	var locations []Location
+	for _, route := range routes {
+		if route.Bucket != "" {
+			locations = append(locations, route.Location)
+		}
+		for _, l := range route.Residency {
+			locations = append(locations, l)
+		}
+	}
+	seen := map[string]bool{}
+	var clients []*S3Client
+	for _, location := range locations {
+		key := location.Region + "/" + location.Bucket
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		client, err := r.client(location)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+func (r *Router) configured(location Location) Location {
+	candidates := []ConsumerRoute{r.cfg.Default}
+	for _, route := range r.cfg.Consumers {
+		candidates = append(candidates, route)
+	}
+	for _, route := range candidates {
+		if route.Bucket == location.Bucket && route.Region == location.Region {
+			return route.Location
+		}
+		for _, l := range route.Residency {
+			if l.Bucket == location.Bucket && l.Region == location.Region {
+				return l
+			}
+		}
+	}
+	return location
+}
+
+func newLocationClient(location Location) (*S3Client, error) {
+	if err := location.validate(); err != nil {
+		return nil, err
+	}
+	config := &aws.Config{
+		Region: aws.String(location.Region),
+	}
+	if location.Endpoint != "" {
+		config.Endpoint = aws.String(location.Endpoint)
+	}
+	if location.ForcePathStyle {
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+	s3Client := s3.New(sess)
+	return &S3Client{
+		Client:   s3Client,
+		Uploader: s3manager.NewUploaderWithClient(s3Client),
+		Bucket:   location.Bucket,
+	}, nil
+}
@@ -3,57 +3,153 @@
 package s3client
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 type S3ClientInterface interface {
-	GeneratePresignedURL(key string, expirationTime *int) (string, time.Duration, error)
-	GeneratePresignedDownloadURL(key string, expirationTime *int) (string, time.Duration, error)
+	GeneratePresignedURL(key string, expirationTime *int, opts PutObjectOptions) (string, time.Duration, error)
+	GeneratePresignedDownloadURL(key string, expirationTime *int, opts GetObjectOptions) (string, time.Duration, error)
+	GetObjectInfo(key string, opts GetObjectOptions) (ObjectInfo, error)
+	DeleteObject(key string) error
+	UploadObject(key string, body io.Reader, opts PutObjectOptions) error
+	GetObject(key string, opts GetObjectOptions) (io.ReadCloser, error)
+	GetObjectRange(key string, offset int64, length int64, opts GetObjectOptions) (io.ReadCloser, error)
+	ReplaceObjectMetadata(key string, opts PutObjectOptions) (string, error)
+	ChangeStorageClass(key string, opts PutObjectOptions) error
+	RestoreObject(key string, tier string, days int) error
+	SetLegalHold(key string, enabled bool) error
+	MoveObject(key string, destinationKey string, opts PutObjectOptions) error
+}
+
+// PutObjectOptions holds the optional parameters signed into an upload presigned URL
+type PutObjectOptions struct {
+	// Base64 encoded SHA-256 of the object. When set, S3 rejects any body that does not match.
+	ChecksumSHA256 string
+	Encryption     Encryption
+	// Written as x-amz-meta-* headers
+	Metadata map[string]string
+	Tags     map[string]string
+	// STANDARD when empty
+	StorageClass string
+	// Requires a bucket with Object Lock enabled, and a checksum on presigned uploads
+	ObjectLock ObjectLock
+}
+
+// EncodeTags returns tags in the URL query form S3 expects in x-amz-tagging
+func EncodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
+// GetObjectOptions holds the optional parameters needed to read an object
+type GetObjectOptions struct {
+	Encryption Encryption
+	// Pins a version in a bucket with versioning enabled, the latest when empty
+	VersionID string
+}
+
+// ObjectInfo is what S3 reports about a stored object
+type ObjectInfo struct {
+	// Base64 encoded SHA-256, only set when the object was uploaded with a checksum
+	ChecksumSHA256       string
+	ServerSideEncryption string
+	KMSKeyID             string
+	BucketKeyEnabled     bool
+	SSECustomerKeyMD5    string
+	StorageClass         string
+	// Only meaningful for archived objects a restore was requested for
+	RestoreInProgress bool
+	RestoreExpiryDate time.Time
+	// Only set in buckets with versioning enabled
+	VersionID string
 }
 
 type S3Client struct {
-	Client *s3.S3
-	Bucket string
+	Client   *s3.S3
+	Uploader *s3manager.Uploader
+	Bucket   string
+	// Carried by every request, see WithContext
+	ctx context.Context
 }
 
-const DefaultPresignedURLExpiration = 24 * time.Hour
+// WithContext returns a copy of the client whose requests are cancelled with ctx and
+// carry its trace context
+func (s *S3Client) WithContext(ctx context.Context) *S3Client {
+	scoped := *s
+	scoped.ctx = ctx
+	return &scoped
+}
 
-func NewS3Client(region, bucket string) (*S3Client, error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(region),
-	})
-	if err != nil {
-		return nil, err
+func (s *S3Client) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
 	}
+	return s.ctx
+}
 
-	s3Client := s3.New(sess)
+const (
+	DefaultPresignedURLExpiration = 24 * time.Hour
+	// Longest validity S3 accepts for SigV4 presigned URLs
+	MaxPresignedURLExpiration = 7 * 24 * time.Hour
+)
 
-	return &S3Client{
-		Client: s3Client,
-		Bucket: bucket,
-	}, nil
+// PresignedURLDuration is how long a link requested for expirationTime seconds stays
+// valid, the default when no expiration time is provided
+func PresignedURLDuration(expirationTime *int) time.Duration {
+	duration := DefaultPresignedURLExpiration
+	if expirationTime != nil && *expirationTime > 0 {
+		duration = time.Duration(*expirationTime) * time.Second
+	}
+	if duration > MaxPresignedURLExpiration {
+		duration = MaxPresignedURLExpiration
+	}
+	return duration
+}
+
+func NewS3Client(region, bucket string) (*S3Client, error) {
+	return newLocationClient(Location{Bucket: bucket, Region: region})
+}
+
+// HeadBucket checks the bucket exists and the client's credentials can reach it
+func (s *S3Client) HeadBucket(ctx context.Context) error {
+	_, err := s.Client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.Bucket)})
+	return err
 }
 
 // Function to create Upload presigned Url on S3
-func (s *S3Client) GeneratePresignedURL(key string, expirationTime *int) (string, time.Duration, error) {
-	req, _ := s.Client.PutObjectRequest(&s3.PutObjectInput{
+func (s *S3Client) GeneratePresignedURL(key string, expirationTime *int, opts PutObjectOptions) (string, time.Duration, error) {
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(s.Bucket),
 		Key:    aws.String(key),
 		// ContentType: aws.String(contentType),
-	})
-	// Use default duration if no expiration time is provided
-	duration := DefaultPresignedURLExpiration
-	if expirationTime != nil && *expirationTime > 0 {
-		duration = time.Duration(*expirationTime) * time.Second
 	}
-	maxDuration := 7 * 24 * time.Hour
-	if duration > maxDuration {
-		duration = maxDuration
+	if opts.ChecksumSHA256 != "" {
+		input.ChecksumSHA256 = aws.String(opts.ChecksumSHA256)
+	}
+	opts.Encryption.applyToPut(input)
+	if len(opts.Metadata) > 0 {
+		input.Metadata = aws.StringMap(opts.Metadata)
 	}
+	if len(opts.Tags) > 0 {
+		input.Tagging = aws.String(EncodeTags(opts.Tags))
+	}
+	if opts.StorageClass != "" {
+		input.StorageClass = aws.String(opts.StorageClass)
+	}
+	opts.ObjectLock.applyToPut(input)
+	req, _ := s.Client.PutObjectRequest(input)
+	duration := PresignedURLDuration(expirationTime)
 
 	url, err := req.Presign(duration)
 	if err != nil {
@@ -64,20 +160,17 @@ func (s *S3Client) GeneratePresignedURL(key string, expirationTime *int) (string
 }
 
 // Function to create Download presigned Url on S3
-func (s *S3Client) GeneratePresignedDownloadURL(key string, expirationTime *int) (string, time.Duration, error) {
-	req, _ := s.Client.GetObjectRequest(&s3.GetObjectInput{
+func (s *S3Client) GeneratePresignedDownloadURL(key string, expirationTime *int, opts GetObjectOptions) (string, time.Duration, error) {
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(s.Bucket),
 		Key:    aws.String(key),
-	})
-	// Use default duration if no expiration time is provided
-	duration := DefaultPresignedURLExpiration
-	if expirationTime != nil && *expirationTime > 0 {
-		duration = time.Duration(*expirationTime) * time.Second
 	}
-	maxDuration := 7 * 24 * time.Hour
-	if duration > maxDuration {
-		duration = maxDuration
+	if opts.VersionID != "" {
+		input.VersionId = aws.String(opts.VersionID)
 	}
+	opts.Encryption.applyToGet(input)
+	req, _ := s.Client.GetObjectRequest(input)
+	duration := PresignedURLDuration(expirationTime)
 	url, err := req.Presign(duration)
 	if err != nil {
 		return "", time.Duration(0), err
@@ -86,4 +179,168 @@ func (s *S3Client) GeneratePresignedDownloadURL(key string, expirationTime *int)
 	return url, duration, nil
 }
 
+// Function to get the checksum and encryption S3 stored for an object
+func (s *S3Client) GetObjectInfo(key string, opts GetObjectOptions) (ObjectInfo, error) {
+	input := &s3.HeadObjectInput{
+		Bucket:       aws.String(s.Bucket),
+		Key:          aws.String(key),
+		ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+	}
+	if opts.VersionID != "" {
+		input.VersionId = aws.String(opts.VersionID)
+	}
+	opts.Encryption.applyToHead(input)
+	output, err := s.Client.HeadObjectWithContext(s.context(), input)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	restoreInProgress, restoreExpiryDate := parseRestoreHeader(aws.StringValue(output.Restore))
+	return ObjectInfo{
+		ChecksumSHA256:       aws.StringValue(output.ChecksumSHA256),
+		ServerSideEncryption: aws.StringValue(output.ServerSideEncryption),
+		KMSKeyID:             aws.StringValue(output.SSEKMSKeyId),
+		BucketKeyEnabled:     aws.BoolValue(output.BucketKeyEnabled),
+		SSECustomerKeyMD5:    aws.StringValue(output.SSECustomerKeyMD5),
+		// S3 omits the class of STANDARD objects
+		StorageClass:      aws.StringValue(output.StorageClass),
+		RestoreInProgress: restoreInProgress,
+		RestoreExpiryDate: restoreExpiryDate,
+		VersionID:         aws.StringValue(output.VersionId),
+	}, nil
+}
+
+// Function to delete an object from S3
+func (s *S3Client) DeleteObject(key string) error {
+	_, err := s.Client.DeleteObjectWithContext(s.context(), &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// Function to stream an object to S3, large bodies are sent as a multipart upload
+func (s *S3Client) UploadObject(key string, body io.Reader, opts PutObjectOptions) error {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	opts.Encryption.applyToUpload(input)
+	if len(opts.Metadata) > 0 {
+		input.Metadata = aws.StringMap(opts.Metadata)
+	}
+	if len(opts.Tags) > 0 {
+		input.Tagging = aws.String(EncodeTags(opts.Tags))
+	}
+	if opts.StorageClass != "" {
+		input.StorageClass = aws.String(opts.StorageClass)
+	}
+	if opts.ObjectLock.Mode != "" {
+		input.ObjectLockMode = aws.String(opts.ObjectLock.Mode)
+		input.ObjectLockRetainUntilDate = aws.Time(opts.ObjectLock.RetainUntil)
+	}
+	_, err := s.Uploader.UploadWithContext(s.context(), input)
+	return err
+}
+
+// Function to stream an object from S3, the caller must close the returned body
+func (s *S3Client) GetObject(key string, opts GetObjectOptions) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	}
+	if opts.VersionID != "" {
+		input.VersionId = aws.String(opts.VersionID)
+	}
+	opts.Encryption.applyToGet(input)
+	output, err := s.Client.GetObjectWithContext(s.context(), input)
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+// Function to read length bytes of an object starting at offset, fewer when the object is shorter
+func (s *S3Client) GetObjectRange(key string, offset int64, length int64, opts GetObjectOptions) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	}
+	if opts.VersionID != "" {
+		input.VersionId = aws.String(opts.VersionID)
+	}
+	opts.Encryption.applyToGet(input)
+	output, err := s.Client.GetObjectWithContext(s.context(), input)
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+// Function to replace the metadata and tags of an object. S3 metadata cannot be
+// edited in place so the object is copied onto itself, the version ID of the copy is
+// returned, empty when the bucket isn't versioned.
+func (s *S3Client) ReplaceObjectMetadata(key string, opts PutObjectOptions) (string, error) {
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(s.Bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(url.PathEscape(s.Bucket + "/" + key)),
+		MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+		TaggingDirective:  aws.String(s3.TaggingDirectiveReplace),
+		Metadata:          aws.StringMap(opts.Metadata),
+		Tagging:           aws.String(EncodeTags(opts.Tags)),
+	}
+	// A copy without a storage class would move the object back to STANDARD
+	if opts.StorageClass != "" {
+		input.StorageClass = aws.String(opts.StorageClass)
+	}
+	// The copy is a new version, which must stay locked like the one it replaces
+	opts.ObjectLock.applyToCopy(input)
+	opts.Encryption.applyToCopy(input)
+	output, err := s.Client.CopyObjectWithContext(s.context(), input)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.VersionId), nil
+}
+
+// Function to move an object to another storage class, keeping its metadata and tags.
+// The object is copied onto itself, which S3 only allows for objects up to 5GB.
+func (s *S3Client) ChangeStorageClass(key string, opts PutObjectOptions) error {
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(s.Bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(url.PathEscape(s.Bucket + "/" + key)),
+		MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
+		TaggingDirective:  aws.String(s3.TaggingDirectiveCopy),
+		StorageClass:      aws.String(opts.StorageClass),
+	}
+	opts.ObjectLock.applyToCopy(input)
+	opts.Encryption.applyToCopy(input)
+	_, err := s.Client.CopyObjectWithContext(s.context(), input)
+	return err
+}
+
+// Function to move an object to another key of the bucket, keeping its metadata, tags
+// and storage class. Like every copy it is limited to objects up to 5GB.
+func (s *S3Client) MoveObject(key string, destinationKey string, opts PutObjectOptions) error {
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(s.Bucket),
+		Key:               aws.String(destinationKey),
+		CopySource:        aws.String(url.PathEscape(s.Bucket + "/" + key)),
+		MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
+		TaggingDirective:  aws.String(s3.TaggingDirectiveCopy),
+	}
+	if opts.StorageClass != "" {
+		input.StorageClass = aws.String(opts.StorageClass)
+	}
+	opts.ObjectLock.applyToCopy(input)
+	opts.Encryption.applyToCopy(input)
+	if _, err := s.Client.CopyObjectWithContext(s.context(), input); err != nil {
+		return err
+	}
+	return s.DeleteObject(key)
+}
+
 var _ S3ClientInterface = (*S3Client)(nil) // Ensure S3Client implements S3ClientInterface
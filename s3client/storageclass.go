@@ -0,0 +1,153 @@
+package s3client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Storage classes ordered from the warmest to the coldest
+var storageClassRank = map[string]int{
+	s3.StorageClassStandard:           0,
+	s3.StorageClassIntelligentTiering: 1,
+	s3.StorageClassStandardIa:         2,
+	s3.StorageClassGlacierIr:          3,
+	s3.StorageClassGlacier:            4,
+	s3.StorageClassDeepArchive:        5,
+}
+
+// ArchiveStorageClasses are the classes whose objects must be restored before they can be read
+var ArchiveStorageClasses = []string{s3.StorageClassGlacier, s3.StorageClassDeepArchive}
+
+// IsArchiveStorageClass reports whether objects of the class must be restored before they can be read
+func IsArchiveStorageClass(storageClass string) bool {
+	return slices.Contains(ArchiveStorageClasses, storageClass)
+}
+
+// Transition moves objects not downloaded for AfterDays to a colder storage class
+type Transition struct {
+	AfterDays    int    `json:"afterDays"`
+	StorageClass string `json:"storageClass"`
+}
+
+type StorageClassPolicy struct {
+	// STANDARD when empty
+	Default string `json:"default,omitempty"`
+	// Classes consumers may request, only the default when empty
+	Allowed     []string     `json:"allowed,omitempty"`
+	Transitions []Transition `json:"transitions,omitempty"`
+}
+
+func (p StorageClassPolicy) Validate() error {
+	for _, class := range append([]string{p.defaultClass()}, p.Allowed...) {
+		if _, ok := storageClassRank[class]; !ok {
+			return fmt.Errorf("unknown storage class %q", class)
+		}
+	}
+	for _, t := range p.Transitions {
+		if _, ok := storageClassRank[t.StorageClass]; !ok {
+			return fmt.Errorf("unknown storage class %q", t.StorageClass)
+		}
+		if t.AfterDays <= 0 {
+			return fmt.Errorf("transition to %s must happen after at least one day", t.StorageClass)
+		}
+	}
+	return nil
+}
+
+func (p StorageClassPolicy) defaultClass() string {
+	if p.Default == "" {
+		return s3.StorageClassStandard
+	}
+	return p.Default
+}
+
+// Resolve returns the storage class of a new upload, the default when none was requested
+func (p StorageClassPolicy) Resolve(requested string) (string, error) {
+	if requested == "" || requested == p.defaultClass() {
+		return p.defaultClass(), nil
+	}
+	if !slices.Contains(p.Allowed, requested) {
+		return "", fmt.Errorf("storage class %q is not allowed", requested)
+	}
+	return requested, nil
+}
+
+// TransitionFor returns the coldest class an object of the given class, idle for the given
+// time, should move to. Objects are never moved to a warmer class nor out of an archive class.
+func (p StorageClassPolicy) TransitionFor(current string, idle time.Duration) (string, bool) {
+	if IsArchiveStorageClass(current) {
+		return "", false
+	}
+	target := ""
+	for _, t := range p.Transitions {
+		if idle < time.Duration(t.AfterDays)*24*time.Hour {
+			continue
+		}
+		if storageClassRank[t.StorageClass] <= storageClassRank[current] {
+			continue
+		}
+		if target == "" || storageClassRank[t.StorageClass] > storageClassRank[target] {
+			target = t.StorageClass
+		}
+	}
+	return target, target != ""
+}
+
+type StorageClassPolicies struct {
+	Default   StorageClassPolicy            `json:"default"`
+	Consumers map[string]StorageClassPolicy `json:"consumers"`
+}
+
+func (p StorageClassPolicies) For(consumer string) StorageClassPolicy {
+	if policy, ok := p.Consumers[consumer]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+// MinTransitionAge is the shortest idle time after which any policy moves an object
+func (p StorageClassPolicies) MinTransitionAge() (time.Duration, bool) {
+	var minDays int
+	for _, policy := range append([]StorageClassPolicy{p.Default}, mapValues(p.Consumers)...) {
+		for _, t := range policy.Transitions {
+			if minDays == 0 || t.AfterDays < minDays {
+				minDays = t.AfterDays
+			}
+		}
+	}
+	return time.Duration(minDays) * 24 * time.Hour, minDays > 0
+}
+
+func mapValues(m map[string]StorageClassPolicy) []StorageClassPolicy {
+	values := make([]StorageClassPolicy, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
+
+// LoadStorageClassPolicies reads per-consumer storage class policies from a JSON file
+func LoadStorageClassPolicies(path string) (StorageClassPolicies, error) {
+	var policies StorageClassPolicies
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policies, err
+	}
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return policies, fmt.Errorf("invalid storage class policies: %w", err)
+	}
+	if err := policies.Default.Validate(); err != nil {
+		return policies, fmt.Errorf("default storage class: %w", err)
+	}
+	for consumer, policy := range policies.Consumers {
+		if err := policy.Validate(); err != nil {
+			return policies, fmt.Errorf("storage class for consumer %s: %w", consumer, err)
+		}
+	}
+	return policies, nil
+}
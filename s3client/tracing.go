@@ -0,0 +1,132 @@
+package s3client
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/OliPou/s3are/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedClient spans every operation of a client as a child of the span in ctx
+type tracedClient struct {
+	ctx    context.Context
+	client S3ClientInterface
+}
+
+// WithTracing returns client with its operations traced under the span of ctx
+func WithTracing(ctx context.Context, client S3ClientInterface) S3ClientInterface {
+	if client == nil {
+		return nil
+	}
+	return tracedClient{ctx: ctx, client: client}
+}
+
+// start opens the span of an operation and returns the client to run it with, bound to
+// the span so the SDK request is cancelled with the caller and carries the trace
+func (t tracedClient) start(operation string, key string) (S3ClientInterface, trace.Span) {
+	attrs := []attribute.KeyValue{
+		semconv.RPCSystemKey.String("aws-api"),
+		semconv.RPCService("S3"),
+		semconv.RPCMethod(operation),
+		semconv.AWSS3Key(key),
+	}
+	if client, ok := t.client.(*S3Client); ok {
+		attrs = append(attrs, semconv.AWSS3Bucket(client.Bucket))
+	}
+	ctx, span := tracing.Tracer().Start(t.ctx, "S3."+operation,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	if client, ok := t.client.(*S3Client); ok {
+		return client.WithContext(ctx), span
+	}
+	return t.client, span
+}
+
+func (t tracedClient) GeneratePresignedURL(key string, expirationTime *int, opts PutObjectOptions) (string, time.Duration, error) {
+	client, span := t.start("PresignPutObject", key)
+	url, duration, err := client.GeneratePresignedURL(key, expirationTime, opts)
+	tracing.End(span, err)
+	return url, duration, err
+}
+
+func (t tracedClient) GeneratePresignedDownloadURL(key string, expirationTime *int, opts GetObjectOptions) (string, time.Duration, error) {
+	client, span := t.start("PresignGetObject", key)
+	url, duration, err := client.GeneratePresignedDownloadURL(key, expirationTime, opts)
+	tracing.End(span, err)
+	return url, duration, err
+}
+
+func (t tracedClient) GetObjectInfo(key string, opts GetObjectOptions) (ObjectInfo, error) {
+	client, span := t.start("HeadObject", key)
+	info, err := client.GetObjectInfo(key, opts)
+	tracing.End(span, err)
+	return info, err
+}
+
+func (t tracedClient) DeleteObject(key string) error {
+	client, span := t.start("DeleteObject", key)
+	err := client.DeleteObject(key)
+	tracing.End(span, err)
+	return err
+}
+
+func (t tracedClient) UploadObject(key string, body io.Reader, opts PutObjectOptions) error {
+	client, span := t.start("PutObject", key)
+	err := client.UploadObject(key, body, opts)
+	tracing.End(span, err)
+	return err
+}
+
+// GetObject spans the request up to the response headers, the body is streamed afterwards
+func (t tracedClient) GetObject(key string, opts GetObjectOptions) (io.ReadCloser, error) {
+	client, span := t.start("GetObject", key)
+	body, err := client.GetObject(key, opts)
+	tracing.End(span, err)
+	return body, err
+}
+
+func (t tracedClient) GetObjectRange(key string, offset int64, length int64, opts GetObjectOptions) (io.ReadCloser, error) {
+	client, span := t.start("GetObject", key)
+	span.SetAttributes(attribute.Int64("aws.s3.range.offset", offset), attribute.Int64("aws.s3.range.length", length))
+	body, err := client.GetObjectRange(key, offset, length, opts)
+	tracing.End(span, err)
+	return body, err
+}
+
+func (t tracedClient) ReplaceObjectMetadata(key string, opts PutObjectOptions) (string, error) {
+	client, span := t.start("CopyObject", key)
+	versionID, err := client.ReplaceObjectMetadata(key, opts)
+	tracing.End(span, err)
+	return versionID, err
+}
+
+func (t tracedClient) ChangeStorageClass(key string, opts PutObjectOptions) error {
+	client, span := t.start("CopyObject", key)
+	err := client.ChangeStorageClass(key, opts)
+	tracing.End(span, err)
+	return err
+}
+
+func (t tracedClient) RestoreObject(key string, tier string, days int) error {
+	client, span := t.start("RestoreObject", key)
+	err := client.RestoreObject(key, tier, days)
+	tracing.End(span, err)
+	return err
+}
+
+func (t tracedClient) SetLegalHold(key string, enabled bool) error {
+	client, span := t.start("PutObjectLegalHold", key)
+	err := client.SetLegalHold(key, enabled)
+	tracing.End(span, err)
+	return err
+}
+
+func (t tracedClient) MoveObject(key string, destinationKey string, opts PutObjectOptions) error {
+	client, span := t.start("MoveObject", key)
+	err := client.MoveObject(key, destinationKey, opts)
+	tracing.End(span, err)
+	return err
+}
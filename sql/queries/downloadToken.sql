@@ -0,0 +1,38 @@
+-- name: CreateDownloadToken :one
+INSERT INTO download_token (
+    id,
+    token_hash,
+    transaction_uuid,
+    consumer,
+    user_name,
+    expires_at,
+    created_at
+) VALUES ($1, $2, $3, $4, $5, $6, NOW())
+RETURNING *;
+
+-- name: GetDownloadTokenByTokenHash :one
+SELECT sqlc.embed(download_token), sqlc.embed(uploaded_file)
+FROM download_token
+JOIN uploaded_file ON uploaded_file.transaction_uuid = download_token.transaction_uuid
+WHERE download_token.token_hash = $1;
+
+-- name: TouchDownloadToken :exec
+UPDATE download_token
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: RevokeDownloadToken :one
+UPDATE download_token
+SET revoked_at = COALESCE(revoked_at, NOW())
+WHERE id = $1 AND consumer = $2 AND user_name = $3
+RETURNING *;
+
+-- name: RevokeFileDownloadTokens :execrows
+UPDATE download_token
+SET revoked_at = NOW()
+WHERE transaction_uuid = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserDownloadTokens :execrows
+UPDATE download_token
+SET revoked_at = NOW()
+WHERE consumer = $1 AND user_name = $2 AND revoked_at IS NULL;
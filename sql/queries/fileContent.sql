@@ -0,0 +1,30 @@
+-- name: UpsertFileContent :exec
+INSERT INTO file_content (
+    transaction_uuid,
+    language,
+    content,
+    content_tsv,
+    extracted_at
+) VALUES (
+    sqlc.arg(transaction_uuid), sqlc.arg(language), sqlc.arg(content),
+    to_tsvector(sqlc.arg(language)::regconfig, sqlc.arg(content)), NOW()
+)
+ON CONFLICT (transaction_uuid) DO UPDATE
+SET language = EXCLUDED.language,
+    content = EXCLUDED.content,
+    content_tsv = EXCLUDED.content_tsv,
+    extracted_at = EXCLUDED.extracted_at;
+
+-- name: SearchUploadedFiles :many
+SELECT sqlc.embed(uploaded_file),
+    ts_rank(file_content.content_tsv, query)::REAL AS rank,
+    ts_headline(file_content.language::regconfig, file_content.content, query,
+        'StartSel=<mark>, StopSel=</mark>, MaxFragments=3, MaxWords=20, MinWords=5')::TEXT AS snippet
+FROM uploaded_file
+JOIN file_content ON file_content.transaction_uuid = uploaded_file.transaction_uuid,
+    websearch_to_tsquery(sqlc.arg(language)::TEXT::regconfig, sqlc.arg(query)::TEXT) AS query
+WHERE uploaded_file.consumer = sqlc.arg(consumer)
+AND (sqlc.narg(user_name)::TEXT IS NULL OR uploaded_file.user_name = sqlc.narg(user_name))
+AND file_content.content_tsv @@ query
+ORDER BY rank DESC, uploaded_file.created_at DESC
+LIMIT sqlc.arg(max_results) OFFSET sqlc.arg(skip_results);
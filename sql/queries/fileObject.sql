@@ -0,0 +1,90 @@
+-- name: AcquireFileObject :one
+-- Objects whose last reference was released are about to be deleted and can't be acquired
+UPDATE file_object
+SET
+    ref_count = ref_count + 1,
+    updated_at = NOW()
+WHERE consumer = $1 and sha256 = $2 and bucket = $3 and ref_count > 0
+RETURNING *;
+
+-- name: ReleaseFileObject :one
+-- The row lock serializes concurrent releases, each sees the count it left
+UPDATE file_object
+SET
+    ref_count = ref_count - 1,
+    updated_at = NOW()
+WHERE consumer = $1 and sha256 = $2 and bucket = $3
+RETURNING *;
+
+-- name: DeleteReleasedFileObject :one
+-- Finds no row when an upload of the same content revived the object in the meantime
+DELETE FROM file_object
+WHERE consumer = $1 and sha256 = $2 and bucket = $3 and ref_count <= 0
+RETURNING *;
+
+-- name: SetFileObjectStorageClass :exec
+UPDATE file_object
+SET
+    storage_class = $4,
+    updated_at = NOW()
+WHERE consumer = $1 and bucket = $2 and object_key = $3;
+
+-- name: DeleteFileObjectByKey :exec
+DELETE FROM file_object
+WHERE consumer = $1 and bucket = $2 and object_key = $3;
+
+-- name: CompleteDeduplicatedUpload :one
+-- Records a waiting upload as completed and takes its reference on the file object in one
+-- statement, a failed or retried completion can't count twice. The object is created from
+-- the upload unless the content is already stored, the upload then points at that object.
+-- The row lock keeps concurrent completions of the same upload from both counting.
+WITH linked AS (
+    INSERT INTO file_object (
+        consumer,
+        sha256,
+        object_key,
+        file_size,
+        file_type,
+        sse_mode,
+        sse_kms_key_id,
+        sse_customer_key_md5,
+        bucket,
+        region,
+        storage_class,
+        ref_count,
+        created_at
+    )
+    SELECT
+        pending.consumer,
+        sqlc.arg(sha256)::text,
+        pending.object_key,
+        sqlc.narg(file_size)::int,
+        sqlc.narg(file_type)::text,
+        pending.sse_mode,
+        pending.sse_kms_key_id,
+        pending.sse_customer_key_md5,
+        COALESCE(pending.bucket, ''),
+        pending.region,
+        pending.storage_class,
+        1,
+        NOW()
+    FROM uploaded_file AS pending
+    WHERE pending.transaction_uuid = sqlc.arg(transaction_uuid) and pending.status = sqlc.arg(waiting_status)
+    FOR UPDATE
+    ON CONFLICT (consumer, bucket, sha256) DO UPDATE
+    SET
+        ref_count = file_object.ref_count + 1,
+        updated_at = NOW()
+    RETURNING *
+)
+UPDATE uploaded_file
+SET
+    object_key = linked.object_key,
+    sha256 = linked.sha256,
+    file_size = sqlc.narg(file_size)::int,
+    file_type = sqlc.narg(file_type)::text,
+    status = sqlc.arg(completed_status),
+    updated_at = NOW()
+FROM linked
+WHERE uploaded_file.transaction_uuid = sqlc.arg(transaction_uuid)
+RETURNING uploaded_file.*;
@@ -0,0 +1,19 @@
+-- name: CreateLogicalFile :one
+INSERT INTO logical_file (
+    id,
+    consumer,
+    user_name,
+    latest_version,
+    created_at
+) VALUES (
+    $1, $2, $3, 1, NOW()
+)
+RETURNING *;
+
+-- name: NextLogicalFileVersion :one
+UPDATE logical_file
+SET
+    latest_version = latest_version + 1,
+    updated_at = NOW()
+WHERE id = $1 and consumer = $2 and user_name = $3
+RETURNING *;
@@ -0,0 +1,23 @@
+-- name: TakeRateLimitToken :one
+-- Refills the bucket for the time elapsed since its last use, then takes a token if
+-- one is available. Runs as a single statement so concurrent replicas serialize on the row.
+INSERT INTO rate_limit_bucket (key, tokens, allowed, updated_at)
+VALUES (sqlc.arg(key), sqlc.arg(burst)::FLOAT8 - 1, TRUE, NOW())
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+        WHEN LEAST(sqlc.arg(burst)::FLOAT8, rate_limit_bucket.tokens
+            + EXTRACT(EPOCH FROM NOW() - rate_limit_bucket.updated_at)::FLOAT8 * sqlc.arg(rate)::FLOAT8) >= 1
+        THEN LEAST(sqlc.arg(burst)::FLOAT8, rate_limit_bucket.tokens
+            + EXTRACT(EPOCH FROM NOW() - rate_limit_bucket.updated_at)::FLOAT8 * sqlc.arg(rate)::FLOAT8) - 1
+        ELSE LEAST(sqlc.arg(burst)::FLOAT8, rate_limit_bucket.tokens
+            + EXTRACT(EPOCH FROM NOW() - rate_limit_bucket.updated_at)::FLOAT8 * sqlc.arg(rate)::FLOAT8)
+    END,
+    allowed = LEAST(sqlc.arg(burst)::FLOAT8, rate_limit_bucket.tokens
+        + EXTRACT(EPOCH FROM NOW() - rate_limit_bucket.updated_at)::FLOAT8 * sqlc.arg(rate)::FLOAT8) >= 1,
+    updated_at = NOW()
+RETURNING tokens, allowed;
+
+-- name: DeleteIdleRateLimitBuckets :execrows
+-- Buckets idle long enough to be full again behave exactly like missing ones
+DELETE FROM rate_limit_bucket
+WHERE updated_at < sqlc.arg(idle_since);
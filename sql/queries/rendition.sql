@@ -0,0 +1,26 @@
+-- name: CreateRendition :one
+INSERT INTO rendition (
+    transaction_uuid,
+    name,
+    object_key,
+    width,
+    height,
+    content_type,
+    file_size,
+    created_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, NOW()
+)
+ON CONFLICT (transaction_uuid, name) DO UPDATE
+SET object_key = EXCLUDED.object_key,
+    width = EXCLUDED.width,
+    height = EXCLUDED.height,
+    content_type = EXCLUDED.content_type,
+    file_size = EXCLUDED.file_size,
+    created_at = EXCLUDED.created_at
+RETURNING *;
+
+-- name: ListRenditions :many
+SELECT * FROM rendition
+WHERE transaction_uuid = $1
+ORDER BY width, name;
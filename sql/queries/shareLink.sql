@@ -0,0 +1,49 @@
+-- name: CreateShareLink :one
+INSERT INTO share_link (
+    id,
+    token_hash,
+    transaction_uuid,
+    created_by,
+    password_hash,
+    expires_at,
+    max_downloads,
+    allowed_ip_ranges,
+    created_at
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+RETURNING *;
+
+-- name: GetShareLinkByTokenHash :one
+SELECT sqlc.embed(share_link), sqlc.embed(uploaded_file)
+FROM share_link
+JOIN uploaded_file ON uploaded_file.transaction_uuid = share_link.transaction_uuid
+WHERE share_link.token_hash = $1;
+
+-- name: ListShareLinks :many
+SELECT * FROM share_link
+WHERE transaction_uuid = $1
+ORDER BY created_at DESC;
+
+-- name: RevokeShareLink :one
+UPDATE share_link
+SET revoked_at = COALESCE(revoked_at, NOW())
+WHERE id = $1 AND transaction_uuid = $2
+RETURNING *;
+
+-- name: ClaimShareLinkDownload :one
+-- Counts a download unless the link was revoked, expired or used up in the meantime
+UPDATE share_link
+SET download_count = download_count + 1,
+    last_downloaded_at = NOW()
+WHERE id = $1
+AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW())
+AND (max_downloads IS NULL OR download_count < max_downloads)
+RETURNING *;
+
+-- name: CreateShareLinkDownload :exec
+INSERT INTO share_link_download (
+    share_link_id,
+    client_ip,
+    user_agent,
+    downloaded_at
+) VALUES ($1, $2, $3, NOW());
@@ -0,0 +1,13 @@
+-- name: CreateStorageTransition :one
+INSERT INTO storage_transition (
+    id,
+    consumer,
+    bucket,
+    object_key,
+    from_storage_class,
+    to_storage_class,
+    transitioned_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, NOW()
+)
+RETURNING *;
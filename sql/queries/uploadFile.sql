@@ -7,9 +7,24 @@ INSERT INTO uploaded_file (
     upload_presigned_url,
     upload_expiration_time,
     status,
+    sha256,
+    sse_mode,
+    sse_kms_key_id,
+    sse_customer_key_md5,
+    metadata,
+    tags,
+    object_key,
+    bucket,
+    region,
+    storage_class,
+    retention_mode,
+    retain_until,
+    logical_file_id,
+    version,
+    scan_status,
     created_at
 ) VALUES (
-    $1, $2, $3, $4, $5, $6, $7, NOW()
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, NOW()
 )
 RETURNING *;
 
@@ -18,10 +33,9 @@ UPDATE uploaded_file
 SET
     file_size = $2,
     file_type = $3,
-    download_presigned_url = $4,
-    status = $5,
+    status = $4,
     updated_at = NOW(),
-    download_expiration_time = $6
+    object_key = $5
 WHERE transaction_uuid = $1
 RETURNING *;
 
@@ -29,3 +43,244 @@ RETURNING *;
 SELECT * FROM uploaded_file
 WHERE transaction_uuid = $1 and consumer = $2 and user_name = $3
 LIMIT 1;
+
+-- name: GetConsumerUploadedFile :one
+SELECT * FROM uploaded_file
+WHERE transaction_uuid = $1 and consumer = $2
+LIMIT 1;
+
+-- name: GetConsumerUploadedFileByKey :one
+SELECT * FROM uploaded_file
+WHERE object_key = $1 and consumer = $2
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: DeleteUploadedFile :one
+DELETE FROM uploaded_file
+WHERE transaction_uuid = $1 and consumer = $2 and user_name = $3
+    and NOT legal_hold
+    and (retain_until IS NULL or retain_until <= NOW())
+RETURNING *;
+
+-- name: SetUploadedFileEnvelope :one
+UPDATE uploaded_file
+SET
+    envelope_algorithm = $2,
+    envelope_key_id = $3,
+    envelope_wrapped_key = $4,
+    envelope_nonce = $5,
+    envelope_chunk_size = $6,
+    updated_at = NOW()
+WHERE transaction_uuid = $1
+RETURNING *;
+
+-- name: UpdateUploadedFileMetadata :one
+UPDATE uploaded_file
+SET
+    metadata = $2,
+    tags = $3,
+    updated_at = NOW()
+WHERE transaction_uuid = $1
+RETURNING *;
+
+-- name: ListUploadedFiles :many
+SELECT * FROM uploaded_file
+WHERE consumer = @consumer
+    and (sqlc.narg('user_name')::text IS NULL or user_name = sqlc.narg('user_name'))
+    and metadata @> @metadata_filter::jsonb
+    and metadata ?& @metadata_keys::text[]
+    and tags @> @tags_filter::jsonb
+ORDER BY created_at DESC
+LIMIT @max_results OFFSET @skip_results;
+
+-- name: RecordUploadedFileDownload :exec
+UPDATE uploaded_file
+SET last_downloaded_at = NOW()
+WHERE transaction_uuid = $1;
+
+-- name: ListIdleObjects :many
+-- Paged by key, moved objects keep matching and would shift an offset
+SELECT
+    consumer,
+    bucket,
+    region,
+    object_key,
+    storage_class,
+    sse_mode,
+    sse_kms_key_id,
+    sse_customer_key_md5,
+    retention_mode,
+    retain_until,
+    MAX(COALESCE(last_downloaded_at, updated_at, created_at))::timestamp AS last_accessed_at
+FROM uploaded_file
+WHERE status <> @waiting_status
+    and (consumer, COALESCE(bucket, ''), object_key) > (@after_consumer::text, @after_bucket::text, @after_object_key::text)
+GROUP BY consumer, bucket, region, object_key, storage_class, sse_mode, sse_kms_key_id, sse_customer_key_md5,
+    retention_mode, retain_until
+HAVING MAX(COALESCE(last_downloaded_at, updated_at, created_at)) < @idle_since::timestamp
+ORDER BY consumer, COALESCE(bucket, ''), object_key
+LIMIT @max_results;
+
+-- name: SetObjectStorageClass :exec
+UPDATE uploaded_file
+SET
+    storage_class = @storage_class,
+    storage_class_updated_at = NOW()
+WHERE consumer = @consumer
+    and bucket IS NOT DISTINCT FROM sqlc.narg('bucket')
+    and object_key = @object_key;
+
+-- name: SetUploadedFileRestore :one
+UPDATE uploaded_file
+SET
+    restore_status = $2,
+    restore_tier = $3,
+    restore_requested_at = NOW(),
+    updated_at = NOW()
+WHERE transaction_uuid = $1
+RETURNING *;
+
+-- name: ListPendingRestores :many
+SELECT * FROM uploaded_file
+WHERE restore_status = $1
+ORDER BY restore_requested_at
+LIMIT $2;
+
+-- name: CompleteUploadedFileRestore :one
+UPDATE uploaded_file
+SET
+    restore_status = $2,
+    restore_expires_at = $3,
+    updated_at = NOW()
+WHERE transaction_uuid = $1
+RETURNING *;
+
+-- name: ExpireUploadedFileRestores :exec
+UPDATE uploaded_file
+SET
+    restore_status = @expired_status
+WHERE restore_status = @completed_status and restore_expires_at < @now::timestamp;
+
+-- name: SetUploadedFileLegalHold :one
+UPDATE uploaded_file
+SET
+    legal_hold = $2,
+    updated_at = NOW()
+WHERE transaction_uuid = $1
+RETURNING *;
+
+-- name: ListFileVersions :many
+SELECT * FROM uploaded_file
+WHERE logical_file_id = $1 and consumer = $2 and user_name = $3
+ORDER BY version DESC;
+
+-- name: GetFileVersion :one
+SELECT * FROM uploaded_file
+WHERE logical_file_id = $1 and version = $2 and consumer = $3 and user_name = $4
+LIMIT 1;
+
+-- name: SetUploadedFileS3Version :exec
+UPDATE uploaded_file
+SET s3_version_id = $2
+WHERE transaction_uuid = $1;
+
+-- name: SetUploadedFileDetectedType :exec
+UPDATE uploaded_file
+SET detected_type = $2, type_mismatch = $3, rendition_status = $4, extraction_status = $5
+WHERE transaction_uuid = $1;
+
+-- name: SetUploadedFileSanitized :exec
+UPDATE uploaded_file
+SET stripped_metadata = $2, original_object_key = $3, sanitized_at = NOW()
+WHERE transaction_uuid = $1;
+
+-- name: ListPendingRenditions :many
+-- Files that failed to render back off for a minute doubled per attempt
+SELECT * FROM uploaded_file
+WHERE rendition_status = sqlc.arg(pending_status)
+AND status <> sqlc.arg(waiting_status)
+AND (scan_status IS NULL OR scan_status = sqlc.arg(clean_status))
+AND (rendition_attempted_at IS NULL
+    OR rendition_attempted_at < NOW() - power(2, rendition_attempts) * interval '1 minute')
+ORDER BY updated_at
+LIMIT sqlc.arg(max_results);
+
+-- name: ListPendingExtractions :many
+-- Documents whose text failed to extract back off for a minute doubled per attempt
+SELECT * FROM uploaded_file
+WHERE extraction_status = sqlc.arg(pending_status)
+AND status <> sqlc.arg(waiting_status)
+AND (scan_status IS NULL OR scan_status = sqlc.arg(clean_status))
+AND (extraction_attempted_at IS NULL
+    OR extraction_attempted_at < NOW() - power(2, extraction_attempts) * interval '1 minute')
+ORDER BY updated_at
+LIMIT sqlc.arg(max_results);
+
+-- name: SetUploadedFileExtractionStatus :exec
+UPDATE uploaded_file
+SET extraction_status = $2
+WHERE transaction_uuid = $1;
+
+-- name: RecordExtractionAttempt :exec
+UPDATE uploaded_file
+SET extraction_attempts = extraction_attempts + 1, extraction_attempted_at = NOW()
+WHERE transaction_uuid = $1;
+
+-- name: SetUploadedFileRenditionStatus :exec
+UPDATE uploaded_file
+SET rendition_status = $2
+WHERE transaction_uuid = $1;
+
+-- name: RecordRenditionAttempt :exec
+UPDATE uploaded_file
+SET rendition_attempts = rendition_attempts + 1, rendition_attempted_at = NOW()
+WHERE transaction_uuid = $1;
+
+-- name: ListPendingScans :many
+-- The oldest transaction of each object, oldest objects first. Archived objects wait for
+-- a restored copy, objects that failed to scan back off for a minute doubled per attempt.
+SELECT * FROM uploaded_file
+WHERE transaction_uuid IN (
+    SELECT DISTINCT ON (bucket, object_key) transaction_uuid FROM uploaded_file AS candidate
+    WHERE candidate.scan_status = @pending_status
+        and candidate.status <> @waiting_status
+        and (candidate.storage_class <> ALL(@archive_classes::text[])
+            or (candidate.restore_status = @restored_status and candidate.restore_expires_at > NOW()))
+        and (candidate.scan_attempted_at IS NULL
+            or candidate.scan_attempted_at < NOW() - power(2, candidate.scan_attempts) * interval '1 minute')
+    ORDER BY bucket, object_key, created_at
+)
+ORDER BY created_at
+LIMIT @max_results;
+
+-- name: RecordObjectScanAttempt :exec
+UPDATE uploaded_file
+SET
+    scan_attempts = scan_attempts + 1,
+    scan_attempted_at = NOW()
+WHERE consumer = @consumer
+    and bucket IS NOT DISTINCT FROM sqlc.narg('bucket')
+    and object_key = @object_key
+    and status <> @waiting_status;
+
+-- name: SetObjectScanResult :exec
+UPDATE uploaded_file
+SET
+    scan_status = @scan_status,
+    scan_signature = @scan_signature,
+    scanned_at = NOW()
+WHERE consumer = @consumer
+    and bucket IS NOT DISTINCT FROM sqlc.narg('bucket')
+    and object_key = @object_key
+    and status <> @waiting_status;
+
+-- name: QuarantineObject :exec
+UPDATE uploaded_file
+SET
+    object_key = @quarantine_key,
+    scan_status = @scan_status,
+    scan_signature = @scan_signature,
+    scanned_at = NOW()
+WHERE consumer = @consumer
+    and bucket IS NOT DISTINCT FROM sqlc.narg('bucket')
+    and object_key = @object_key;
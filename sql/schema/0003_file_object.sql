@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE file_object(
+    consumer TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    file_size INT,
+    file_type TEXT,
+    ref_count INT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP,
+    PRIMARY KEY (consumer, sha256)
+);
+ALTER TABLE uploaded_file
+ADD sha256 TEXT;
+
+-- +goose Down
+ALTER TABLE uploaded_file
+DROP COLUMN sha256;
+DROP TABLE file_object;
@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD sse_mode TEXT,
+ADD sse_kms_key_id TEXT,
+ADD sse_customer_key_md5 TEXT;
+ALTER TABLE file_object
+ADD sse_mode TEXT,
+ADD sse_kms_key_id TEXT,
+ADD sse_customer_key_md5 TEXT;
+
+-- +goose Down
+ALTER TABLE file_object
+DROP COLUMN sse_mode,
+DROP COLUMN sse_kms_key_id,
+DROP COLUMN sse_customer_key_md5;
+ALTER TABLE uploaded_file
+DROP COLUMN sse_mode,
+DROP COLUMN sse_kms_key_id,
+DROP COLUMN sse_customer_key_md5;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD envelope_algorithm TEXT,
+ADD envelope_key_id TEXT,
+ADD envelope_wrapped_key BYTEA,
+ADD envelope_nonce BYTEA,
+ADD envelope_chunk_size INT;
+
+-- +goose Down
+ALTER TABLE uploaded_file
+DROP COLUMN envelope_algorithm,
+DROP COLUMN envelope_key_id,
+DROP COLUMN envelope_wrapped_key,
+DROP COLUMN envelope_nonce,
+DROP COLUMN envelope_chunk_size;
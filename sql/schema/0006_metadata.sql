@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD metadata JSONB NOT NULL DEFAULT '{}',
+ADD tags JSONB NOT NULL DEFAULT '{}';
+CREATE INDEX uploaded_file_metadata_idx ON uploaded_file USING GIN (metadata);
+CREATE INDEX uploaded_file_tags_idx ON uploaded_file USING GIN (tags);
+
+-- +goose Down
+DROP INDEX uploaded_file_tags_idx;
+DROP INDEX uploaded_file_metadata_idx;
+ALTER TABLE uploaded_file
+DROP COLUMN metadata,
+DROP COLUMN tags;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD object_key TEXT;
+UPDATE uploaded_file SET object_key = file_name;
+ALTER TABLE uploaded_file
+ALTER COLUMN object_key SET NOT NULL;
+CREATE INDEX uploaded_file_object_key_idx ON uploaded_file (object_key);
+ALTER TABLE file_object
+RENAME COLUMN file_name TO object_key;
+
+-- +goose Down
+ALTER TABLE file_object
+RENAME COLUMN object_key TO file_name;
+DROP INDEX uploaded_file_object_key_idx;
+UPDATE uploaded_file SET file_name = object_key;
+ALTER TABLE uploaded_file
+DROP COLUMN object_key;
@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD bucket TEXT,
+ADD region TEXT;
+ALTER TABLE file_object
+ADD bucket TEXT NOT NULL DEFAULT '',
+ADD region TEXT;
+ALTER TABLE file_object
+DROP CONSTRAINT file_object_pkey,
+ADD PRIMARY KEY (consumer, bucket, sha256);
+
+-- +goose Down
+DELETE FROM file_object WHERE bucket <> '';
+ALTER TABLE file_object
+DROP CONSTRAINT file_object_pkey,
+ADD PRIMARY KEY (consumer, sha256);
+ALTER TABLE file_object
+DROP COLUMN region,
+DROP COLUMN bucket;
+ALTER TABLE uploaded_file
+DROP COLUMN region,
+DROP COLUMN bucket;
@@ -0,0 +1,26 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD storage_class TEXT NOT NULL DEFAULT 'STANDARD',
+ADD storage_class_updated_at TIMESTAMP,
+ADD last_downloaded_at TIMESTAMP;
+ALTER TABLE file_object
+ADD storage_class TEXT NOT NULL DEFAULT 'STANDARD';
+CREATE TABLE storage_transition(
+    id UUID PRIMARY KEY,
+    consumer TEXT NOT NULL,
+    bucket TEXT,
+    object_key TEXT NOT NULL,
+    from_storage_class TEXT NOT NULL,
+    to_storage_class TEXT NOT NULL,
+    transitioned_at TIMESTAMP NOT NULL
+);
+CREATE INDEX storage_transition_object_idx ON storage_transition (consumer, object_key);
+
+-- +goose Down
+DROP TABLE storage_transition;
+ALTER TABLE file_object
+DROP COLUMN storage_class;
+ALTER TABLE uploaded_file
+DROP COLUMN last_downloaded_at,
+DROP COLUMN storage_class_updated_at,
+DROP COLUMN storage_class;
@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD restore_status TEXT,
+ADD restore_tier TEXT,
+ADD restore_requested_at TIMESTAMP,
+ADD restore_expires_at TIMESTAMP;
+CREATE INDEX uploaded_file_restore_status_idx ON uploaded_file (restore_status)
+WHERE restore_status IS NOT NULL;
+
+-- +goose Down
+DROP INDEX uploaded_file_restore_status_idx;
+ALTER TABLE uploaded_file
+DROP COLUMN restore_expires_at,
+DROP COLUMN restore_requested_at,
+DROP COLUMN restore_tier,
+DROP COLUMN restore_status;
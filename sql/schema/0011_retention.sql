@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD retention_mode TEXT,
+ADD retain_until TIMESTAMP,
+ADD legal_hold BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE uploaded_file
+DROP COLUMN legal_hold,
+DROP COLUMN retain_until,
+DROP COLUMN retention_mode;
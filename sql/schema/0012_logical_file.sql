@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE logical_file(
+    id UUID PRIMARY KEY,
+    consumer TEXT NOT NULL,
+    user_name TEXT NOT NULL,
+    latest_version INT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP
+);
+ALTER TABLE uploaded_file
+ADD logical_file_id UUID REFERENCES logical_file(id),
+ADD version INT NOT NULL DEFAULT 1,
+ADD s3_version_id TEXT;
+-- Every existing transaction becomes the first version of its own logical file
+INSERT INTO logical_file (id, consumer, user_name, created_at)
+SELECT transaction_uuid, consumer, user_name, created_at FROM uploaded_file;
+UPDATE uploaded_file SET logical_file_id = transaction_uuid;
+ALTER TABLE uploaded_file
+ALTER COLUMN logical_file_id SET NOT NULL;
+CREATE UNIQUE INDEX uploaded_file_logical_file_version_idx ON uploaded_file (logical_file_id, version);
+
+-- +goose Down
+DROP INDEX uploaded_file_logical_file_version_idx;
+ALTER TABLE uploaded_file
+DROP COLUMN s3_version_id,
+DROP COLUMN version,
+DROP COLUMN logical_file_id;
+DROP TABLE logical_file;
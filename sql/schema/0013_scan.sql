@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD scan_status TEXT,
+ADD scan_signature TEXT,
+ADD scanned_at TIMESTAMP;
+CREATE INDEX uploaded_file_scan_status_idx ON uploaded_file (scan_status)
+WHERE scan_status IS NOT NULL;
+
+-- +goose Down
+DROP INDEX uploaded_file_scan_status_idx;
+ALTER TABLE uploaded_file
+DROP COLUMN scanned_at,
+DROP COLUMN scan_signature,
+DROP COLUMN scan_status;
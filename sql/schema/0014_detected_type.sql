@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD detected_type TEXT,
+ADD type_mismatch BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE uploaded_file
+DROP COLUMN type_mismatch,
+DROP COLUMN detected_type;
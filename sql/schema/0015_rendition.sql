@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD rendition_status TEXT;
+CREATE INDEX uploaded_file_rendition_status_idx ON uploaded_file (rendition_status)
+WHERE rendition_status IS NOT NULL;
+CREATE TABLE rendition(
+    transaction_uuid UUID NOT NULL REFERENCES uploaded_file(transaction_uuid) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    object_key TEXT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    content_type TEXT NOT NULL,
+    file_size INT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (transaction_uuid, name)
+);
+
+-- +goose Down
+DROP TABLE rendition;
+DROP INDEX uploaded_file_rendition_status_idx;
+ALTER TABLE uploaded_file
+DROP COLUMN rendition_status;
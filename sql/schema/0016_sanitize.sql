@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD stripped_metadata TEXT[],
+ADD sanitized_at TIMESTAMP,
+ADD original_object_key TEXT;
+
+-- +goose Down
+ALTER TABLE uploaded_file
+DROP COLUMN original_object_key,
+DROP COLUMN sanitized_at,
+DROP COLUMN stripped_metadata;
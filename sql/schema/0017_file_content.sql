@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD extraction_status TEXT;
+CREATE INDEX uploaded_file_extraction_status_idx ON uploaded_file (extraction_status)
+WHERE extraction_status IS NOT NULL;
+CREATE TABLE file_content(
+    transaction_uuid UUID PRIMARY KEY REFERENCES uploaded_file(transaction_uuid) ON DELETE CASCADE,
+    language TEXT NOT NULL,
+    content TEXT NOT NULL,
+    content_tsv TSVECTOR NOT NULL,
+    extracted_at TIMESTAMP NOT NULL
+);
+CREATE INDEX file_content_tsv_idx ON file_content USING GIN (content_tsv);
+
+-- +goose Down
+DROP TABLE file_content;
+DROP INDEX uploaded_file_extraction_status_idx;
+ALTER TABLE uploaded_file
+DROP COLUMN extraction_status;
@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE share_link(
+    id UUID PRIMARY KEY,
+    -- SHA-256 of the token, the token itself is only returned on creation
+    token_hash TEXT NOT NULL UNIQUE,
+    transaction_uuid UUID NOT NULL REFERENCES uploaded_file(transaction_uuid) ON DELETE CASCADE,
+    created_by TEXT NOT NULL,
+    password_hash TEXT,
+    expires_at TIMESTAMP,
+    max_downloads INT,
+    download_count INT NOT NULL DEFAULT 0,
+    allowed_ip_ranges TEXT[],
+    last_downloaded_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX share_link_transaction_uuid_idx ON share_link (transaction_uuid);
+CREATE TABLE share_link_download(
+    id BIGSERIAL PRIMARY KEY,
+    share_link_id UUID NOT NULL REFERENCES share_link(id) ON DELETE CASCADE,
+    client_ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    downloaded_at TIMESTAMP NOT NULL
+);
+CREATE INDEX share_link_download_share_link_id_idx ON share_link_download (share_link_id);
+
+-- +goose Down
+DROP TABLE share_link_download;
+DROP TABLE share_link;
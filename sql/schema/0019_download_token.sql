@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE download_token(
+    id UUID PRIMARY KEY,
+    -- SHA-256 of the token, the token itself is only returned on creation
+    token_hash TEXT NOT NULL UNIQUE,
+    transaction_uuid UUID NOT NULL REFERENCES uploaded_file(transaction_uuid) ON DELETE CASCADE,
+    consumer TEXT NOT NULL,
+    user_name TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX download_token_transaction_uuid_idx ON download_token (transaction_uuid);
+CREATE INDEX download_token_user_idx ON download_token (consumer, user_name);
+
+-- +goose Down
+DROP TABLE download_token;
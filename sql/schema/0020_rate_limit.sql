@@ -0,0 +1,12 @@
+-- +goose Up
+-- Token buckets shared by every replica, losing them on a crash only resets the limits
+CREATE UNLOGGED TABLE rate_limit_bucket(
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    allowed BOOLEAN NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+CREATE INDEX rate_limit_bucket_updated_at_idx ON rate_limit_bucket (updated_at);
+
+-- +goose Down
+DROP TABLE rate_limit_bucket;
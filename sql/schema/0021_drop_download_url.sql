@@ -0,0 +1,10 @@
+-- +goose Up
+-- Download URLs are minted for each request and never stored, a leaked one could not be revoked
+ALTER TABLE uploaded_file
+DROP COLUMN download_presigned_url,
+DROP COLUMN download_expiration_time;
+
+-- +goose Down
+ALTER TABLE uploaded_file
+ADD download_presigned_url TEXT,
+ADD download_expiration_time TIMESTAMP;
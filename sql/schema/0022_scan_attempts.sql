@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD scan_attempts INTEGER NOT NULL DEFAULT 0,
+ADD scan_attempted_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE uploaded_file
+DROP COLUMN scan_attempted_at,
+DROP COLUMN scan_attempts;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD rendition_attempts INTEGER NOT NULL DEFAULT 0,
+ADD rendition_attempted_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE uploaded_file
+DROP COLUMN rendition_attempted_at,
+DROP COLUMN rendition_attempts;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE uploaded_file
+ADD extraction_attempts INTEGER NOT NULL DEFAULT 0,
+ADD extraction_attempted_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE uploaded_file
+DROP COLUMN extraction_attempted_at,
+DROP COLUMN extraction_attempts;
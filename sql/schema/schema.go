@@ -0,0 +1,7 @@
+// Package schema embeds the goose migrations of the database schema, also read by sqlc
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,276 @@
+// Package textextract pulls the searchable text out of plain text, CSV, JSON, HTML and
+// PDF documents.
+package textextract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// MaxTextLength caps the stored text, Postgres refuses tsvectors over 1MB
+const MaxTextLength = 512 * 1024
+
+var ErrUnsupportedDocument = errors.New("unsupported document")
+
+func mediaType(mimeType string) string {
+	return strings.TrimSpace(strings.Split(mimeType, ";")[0])
+}
+
+// Supported reports whether text can be extracted from documents of this MIME type
+func Supported(mimeType string) bool {
+	switch mediaType(mimeType) {
+	case "text/plain", "text/csv", "application/json", "text/html", "application/pdf":
+		return true
+	}
+	return false
+}
+
+// Extract returns the text of a document, truncated to MaxTextLength
+func Extract(r io.Reader, mimeType string) (string, error) {
+	var text string
+	var err error
+	switch mediaType(mimeType) {
+	case "text/plain", "text/csv":
+		var data []byte
+		data, err = io.ReadAll(io.LimitReader(r, MaxTextLength))
+		text = string(data)
+	case "application/json":
+		text, err = extractJSON(r)
+	case "text/html":
+		text, err = extractHTML(r)
+	case "application/pdf":
+		text, err = extractPDF(r)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedDocument, mimeType)
+	}
+	if err != nil {
+		return "", err
+	}
+	return truncate(strings.ToValidUTF8(text, " "), MaxTextLength), nil
+}
+
+func truncate(text string, length int) string {
+	if len(text) <= length {
+		return text
+	}
+	text = text[:length]
+	for !utf8.ValidString(text) {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// extractJSON keeps the keys and string values of a JSON document
+func extractJSON(r io.Reader) (string, error) {
+	decoder := json.NewDecoder(r)
+	var text strings.Builder
+	for text.Len() < MaxTextLength {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrUnsupportedDocument, err)
+		}
+		if s, ok := token.(string); ok {
+			text.WriteString(s)
+			text.WriteByte('\n')
+		}
+	}
+	return text.String(), nil
+}
+
+// extractHTML keeps the text nodes of a page, minus scripts and styles
+func extractHTML(r io.Reader) (string, error) {
+	tokenizer := html.NewTokenizer(r)
+	var text strings.Builder
+	skip := 0
+	for text.Len() < MaxTextLength {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if tokenizer.Err() == io.EOF {
+				return text.String(), nil
+			}
+			return "", tokenizer.Err()
+		case html.StartTagToken:
+			if name, _ := tokenizer.TagName(); isHidden(name) {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); isHidden(name) && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				if s := strings.TrimSpace(string(tokenizer.Text())); s != "" {
+					text.WriteString(s)
+					text.WriteByte('\n')
+				}
+			}
+		}
+	}
+	return text.String(), nil
+}
+
+func isHidden(tagName []byte) bool {
+	switch string(tagName) {
+	case "script", "style", "noscript", "template":
+		return true
+	}
+	return false
+}
+
+// Larger PDFs are not read
+const maxPDFSize = 32 << 20
+
+var (
+	pdfStream = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+	// Text showing operators: (string) Tj, [(string) -250 (string)] TJ, (string) ' and "
+	pdfText    = regexp.MustCompile(`(?s)(\((?:\\.|[^\\)])*\)|\[(?:\\.|[^\]])*\])\s*(Tj|TJ|'|")|(T\*|\b(?:ET|Td|TD)\b)`)
+	pdfLiteral = regexp.MustCompile(`\((?:\\.|[^\\)])*\)`)
+)
+
+// extractPDF reads the text layer of a PDF: the strings shown by the text operators of
+// its content streams. Text drawn with CID fonts is encoded and not recovered.
+func extractPDF(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxPDFSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxPDFSize || !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "", fmt.Errorf("%w: not a readable PDF", ErrUnsupportedDocument)
+	}
+	var text strings.Builder
+	for _, loc := range pdfStream.FindAllSubmatchIndex(data, -1) {
+		dict := data[loc[2]:loc[3]]
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		content := data[start : start+end]
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			inflated, err := io.ReadAll(io.LimitReader(zlibReader(content), maxPDFSize))
+			if err != nil && len(inflated) == 0 {
+				continue
+			}
+			content = inflated
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			// Images and other encodings carry no text
+			continue
+		}
+		writePDFText(&text, content)
+		if text.Len() >= MaxTextLength {
+			break
+		}
+	}
+	return text.String(), nil
+}
+
+func zlibReader(data []byte) io.Reader {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return bytes.NewReader(nil)
+	}
+	return r
+}
+
+func writePDFText(text *strings.Builder, content []byte) {
+	for _, match := range pdfText.FindAllSubmatch(content, -1) {
+		if len(match[3]) > 0 {
+			// Line and block changes
+			text.WriteByte('\n')
+			continue
+		}
+		for _, literal := range pdfLiteral.FindAll(match[1], -1) {
+			text.WriteString(unescapePDF(literal[1 : len(literal)-1]))
+		}
+		if string(match[2]) != "Tj" && string(match[2]) != "TJ" {
+			text.WriteByte('\n')
+		}
+	}
+	text.WriteByte('\n')
+}
+
+// unescapePDF decodes the escapes of a PDF literal string, bytes are read as Latin-1
+// which PDFDocEncoding matches for text
+func unescapePDF(s []byte) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out.WriteRune(rune(s[i]))
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 't':
+			out.WriteByte('\t')
+		case 'b', 'f', '\n':
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			value := 0
+			for j := 0; j < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; j++ {
+				value = value*8 + int(s[i]-'0')
+				i++
+			}
+			i--
+			out.WriteRune(rune(value))
+		default:
+			out.WriteRune(rune(c))
+		}
+	}
+	return out.String()
+}
+
+var languageName = regexp.MustCompile(`^[a-z_]+$`)
+
+// Languages names the Postgres text search configuration, e.g. "english" or "french",
+// used to index and search each consumer's documents
+type Languages struct {
+	Default   string            `json:"default"`
+	Consumers map[string]string `json:"consumers"`
+}
+
+// For returns the consumer's configuration, "simple" when none is set
+func (l Languages) For(consumer string) string {
+	if language, ok := l.Consumers[consumer]; ok {
+		return language
+	}
+	if l.Default != "" {
+		return l.Default
+	}
+	return "simple"
+}
+
+func LoadLanguages(path string) (Languages, error) {
+	var languages Languages
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return languages, err
+	}
+	if err := json.Unmarshal(data, &languages); err != nil {
+		return languages, fmt.Errorf("invalid search languages: %w", err)
+	}
+	if languages.Default != "" && !languageName.MatchString(languages.Default) {
+		return languages, fmt.Errorf("invalid default search language %q", languages.Default)
+	}
+	for consumer, language := range languages.Consumers {
+		if !languageName.MatchString(language) {
+			return languages, fmt.Errorf("invalid search language %q for consumer %s", language, consumer)
+		}
+	}
+	return languages, nil
+}
@@ -0,0 +1,65 @@
+package textextract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func minimalPDF(t *testing.T, content string) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	_, err := w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", compressed.Len())
+	pdf.Write(compressed.Bytes())
+	pdf.WriteString("\nendstream\nendobj\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	text, err := Extract(strings.NewReader(`{"title": "Quarterly report", "pages": 3, "tags": ["finance"]}`), "application/json")
+	require.NoError(t, err)
+	assert.Equal(t, "title\nQuarterly report\npages\ntags\nfinance\n", text)
+
+	text, err = Extract(strings.NewReader(`<html><head><style>p {}</style><script>var x;</script></head><body><h1>Invoice</h1><p>Total &amp; taxes</p></body></html>`), "text/html; charset=utf-8")
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice\nTotal & taxes\n", text)
+
+	pdf := minimalPDF(t, "BT /F1 12 Tf 72 712 Td (Hello \\(PDF\\)) Tj T* [(Caf) -10 (\\351)] TJ ET")
+	text, err = Extract(bytes.NewReader(pdf), "application/pdf")
+	require.NoError(t, err)
+	assert.Contains(t, text, "Hello (PDF)")
+	assert.Contains(t, text, "Café")
+
+	// T* moves to the next line, words either side of it must not run together
+	pdf = minimalPDF(t, "BT (first) Tj T*\n(second) Tj T* (third) Tj ET")
+	text, err = Extract(bytes.NewReader(pdf), "application/pdf")
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\nthird\n\n", text)
+
+	_, err = Extract(strings.NewReader("GIF89a"), "image/gif")
+	assert.ErrorIs(t, err, ErrUnsupportedDocument)
+}
+
+func TestExtractTruncates(t *testing.T) {
+	text, err := Extract(strings.NewReader(strings.Repeat("é", MaxTextLength)), "text/plain")
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(text), MaxTextLength)
+	assert.True(t, strings.HasSuffix(text, "é"))
+}
+
+func TestLanguages(t *testing.T) {
+	languages := Languages{Consumers: map[string]string{"fr-consumer": "french"}}
+	assert.Equal(t, "french", languages.For("fr-consumer"))
+	assert.Equal(t, "simple", languages.For("other"))
+}
@@ -0,0 +1,169 @@
+// Package thumbnail renders downscaled previews of JPEG, PNG and GIF images.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Larger images are refused before being decoded
+	MaxPixels   = 50_000_000
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image")
+	ErrImageTooLarge    = errors.New("image too large")
+)
+
+var sizeName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Size is a named bounding box, renditions keep the aspect ratio of their source
+type Size struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// ParseSizes reads a list such as "small=160x160,large=1024x1024"
+func ParseSizes(spec string) ([]Size, error) {
+	var sizes []Size
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(spec, ",") {
+		name, box, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || !sizeName.MatchString(name) {
+			return nil, fmt.Errorf("invalid thumbnail size %q", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate thumbnail size %q", name)
+		}
+		w, h, ok := strings.Cut(box, "x")
+		width, errW := strconv.Atoi(w)
+		height, errH := strconv.Atoi(h)
+		if !ok || errW != nil || errH != nil || width <= 0 || height <= 0 {
+			return nil, fmt.Errorf("invalid thumbnail size %q", entry)
+		}
+		seen[name] = true
+		sizes = append(sizes, Size{Name: name, Width: width, Height: height})
+	}
+	return sizes, nil
+}
+
+// Supported reports whether images of this MIME type can be rendered
+func Supported(mimeType string) bool {
+	switch strings.TrimSpace(strings.Split(mimeType, ";")[0]) {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Rendition is an encoded thumbnail
+type Rendition struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Extension   string
+	Data        []byte
+}
+
+// Render decodes src and produces one rendition per size. JPEG sources give JPEG
+// renditions, PNG and GIF ones give PNG renditions to keep their transparency.
+// Images are never enlarged.
+func Render(src []byte, sizes []Size) ([]Rendition, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(src))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, config.Width, config.Height)
+	}
+	var img image.Image
+	switch format {
+	case "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(src))
+	case "png":
+		img, err = png.Decode(bytes.NewReader(src))
+	case "gif":
+		// The first frame of animations
+		img, err = gif.Decode(bytes.NewReader(src))
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedImage, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	source := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(source, source.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	renditions := make([]Rendition, 0, len(sizes))
+	for _, size := range sizes {
+		width, height := fit(source.Bounds().Dx(), source.Bounds().Dy(), size)
+		resized := resize(source, width, height)
+		var buf bytes.Buffer
+		rendition := Rendition{Name: size.Name, Width: width, Height: height}
+		if format == "jpeg" {
+			rendition.ContentType, rendition.Extension = "image/jpeg", ".jpg"
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: jpegQuality})
+		} else {
+			rendition.ContentType, rendition.Extension = "image/png", ".png"
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rendition.Data = buf.Bytes()
+		renditions = append(renditions, rendition)
+	}
+	return renditions, nil
+}
+
+// fit scales width x height down into the size's bounding box
+func fit(width, height int, size Size) (int, int) {
+	if width <= size.Width && height <= size.Height {
+		return width, height
+	}
+	if width*size.Height > height*size.Width {
+		return size.Width, max(1, height*size.Width/width)
+	}
+	return max(1, width*size.Height/height), size.Height
+}
+
+// resize averages the source pixels covered by each destination pixel
+func resize(src *image.RGBA, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcH/height, max((y+1)*srcH/height, y*srcH/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcW/width, max((x+1)*srcW/width, x*srcW/width+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for i := range sum {
+				dst.Pix[offset+i] = uint8(sum[i] / n)
+			}
+		}
+	}
+	return dst
+}
@@ -0,0 +1,62 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSizes(t *testing.T) {
+	sizes, err := ParseSizes("small=160x160, large=1024x768")
+	require.NoError(t, err)
+	assert.Equal(t, []Size{{"small", 160, 160}, {"large", 1024, 768}}, sizes)
+
+	for _, spec := range []string{"", "small", "small=160", "small=0x10", "Small=1x1", "a=1x1,a=2x2"} {
+		_, err := ParseSizes(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestRender(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			src.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, src))
+
+	renditions, err := Render(encoded.Bytes(), []Size{{"small", 100, 100}, {"huge", 1000, 1000}})
+	require.NoError(t, err)
+	require.Len(t, renditions, 2)
+
+	small := renditions[0]
+	assert.Equal(t, "image/png", small.ContentType)
+	assert.Equal(t, 100, small.Width)
+	assert.Equal(t, 50, small.Height)
+	decoded, err := png.Decode(bytes.NewReader(small.Data))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 100, 50), decoded.Bounds())
+	r, _, _, _ := decoded.At(50, 25).RGBA()
+	assert.Equal(t, uint32(200), r>>8)
+
+	// Never enlarged
+	assert.Equal(t, 400, renditions[1].Width)
+	assert.Equal(t, 200, renditions[1].Height)
+
+	encoded.Reset()
+	require.NoError(t, jpeg.Encode(&encoded, src, nil))
+	renditions, err = Render(encoded.Bytes(), []Size{{"small", 100, 100}})
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", renditions[0].ContentType)
+
+	_, err = Render([]byte("not an image"), []Size{{"small", 100, 100}})
+	assert.ErrorIs(t, err, ErrUnsupportedImage)
+}
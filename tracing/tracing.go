@@ -0,0 +1,120 @@
+// Package tracing sets up OpenTelemetry tracing and instruments the database with spans
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/OliPou/s3are/internal/database"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TracerName = "github.com/OliPou/s3are"
+	// Overridden by OTEL_SERVICE_NAME
+	DefaultServiceName = "s3are"
+)
+
+// Tracer starts the service's spans, from the provider installed by Setup
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// NewExporter builds the span exporter named exporter: otlp sends spans over HTTP to the
+// collector set by the standard OTEL_EXPORTER_OTLP_* variables, stdout (or console)
+// writes them as JSON to w. Tracing is off with none or an empty name.
+func NewExporter(ctx context.Context, exporter string, w io.Writer) (sdktrace.SpanExporter, error) {
+	switch exporter {
+	case "", "none":
+		return nil, nil
+	case "otlp":
+		return otlptracehttp.New(ctx)
+	case "stdout", "console":
+		return stdouttrace.New(stdouttrace.WithWriter(w))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+}
+
+// Setup installs a tracer provider exporting to exporter and W3C trace context
+// propagation. Spans are started but dropped when exporter is nil. The returned function
+// flushes pending spans.
+func Setup(ctx context.Context, exporter sdktrace.SpanExporter) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(DefaultServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// InMemory installs a tracer provider exporting synchronously to the returned exporter,
+// for tests to inspect the spans they produced
+func InMemory() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return exporter
+}
+
+// DB wraps the queries run through a sqlc DBTX in spans named after the query
+type DB struct {
+	database.DBTX
+}
+
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := database.QueryName(query)
+	return Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(name)))
+}
+
+// End ends span, marking it failed when err is set
+func End(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (db DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	result, err := db.DBTX.ExecContext(ctx, query, args...)
+	End(span, err)
+	return result, err
+}
+
+func (db DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	rows, err := db.DBTX.QueryContext(ctx, query, args...)
+	End(span, err)
+	return rows, err
+}
+
+// QueryRowContext spans the query up to its first row, sql.Row reports errors on Scan
+func (db DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	defer span.End()
+	return db.DBTX.QueryRowContext(ctx, query, args...)
+}
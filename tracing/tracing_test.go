@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type fakeDBTX struct {
+	err error
+}
+
+func (db fakeDBTX) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, db.err
+}
+
+func (db fakeDBTX) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, db.err
+}
+
+func (db fakeDBTX) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, db.err
+}
+
+func (db fakeDBTX) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestDBSpans(t *testing.T) {
+	exporter := InMemory()
+	ctx, parent := Tracer().Start(context.Background(), "POST /v1/upload-file-request")
+	_, _ = DB{DBTX: fakeDBTX{}}.ExecContext(ctx, "-- name: CreateUploadedFile :one\nINSERT INTO uploaded_file")
+	_, _ = DB{DBTX: fakeDBTX{err: errors.New("connection refused")}}.QueryContext(ctx, "-- name: ListFiles :many\nSELECT 1")
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "CreateUploadedFile", spans[0].Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	assert.Equal(t, "ListFiles", spans[1].Name)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+}
+
+func TestNewExporter(t *testing.T) {
+	exporter, err := NewExporter(context.Background(), "", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, exporter)
+
+	var buf bytes.Buffer
+	exporter, err = NewExporter(context.Background(), "stdout", &buf)
+	require.NoError(t, err)
+	shutdown, err := Setup(context.Background(), exporter)
+	require.NoError(t, err)
+	_, span := Tracer().Start(context.Background(), "GET /v1/files")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+	assert.Contains(t, buf.String(), `"Name":"GET /v1/files"`)
+
+	_, err = NewExporter(context.Background(), "zipkin", nil)
+	assert.Error(t, err)
+}